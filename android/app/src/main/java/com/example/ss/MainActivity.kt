@@ -1,8 +1,21 @@
 package com.example.ss
 
 import android.Manifest
+import android.content.Context
+import android.content.Intent
+import android.content.IntentFilter
 import android.content.pm.PackageManager
+import android.graphics.ImageFormat
+import android.hardware.camera2.CameraCharacteristics
+import android.hardware.camera2.CameraManager
+import android.net.ConnectivityManager
+import android.net.NetworkCapabilities
+import android.net.wifi.WifiManager
+import android.os.BatteryManager
+import android.os.Build
 import android.os.Bundle
+import android.os.StatFs
+import android.telephony.TelephonyManager
 //import android.util.Base64
 import android.util.Log
 import android.widget.Toast
@@ -27,8 +40,11 @@ import org.eclipse.paho.client.mqttv3.MqttClient
 import org.eclipse.paho.client.mqttv3.MqttConnectOptions
 import org.eclipse.paho.client.mqttv3.MqttException
 import org.eclipse.paho.client.mqttv3.MqttMessage
+import org.json.JSONArray
+import org.json.JSONObject
 import java.io.BufferedInputStream
 import java.io.ByteArrayOutputStream
+import java.io.File
 import java.io.InputStream
 import java.io.InputStreamReader
 import java.nio.charset.StandardCharsets
@@ -38,7 +54,10 @@ import java.security.Security
 import java.security.cert.X509Certificate
 import java.util.concurrent.Executors
 import kotlin.concurrent.fixedRateTimer
+import java.util.Timer
+import java.util.concurrent.atomic.AtomicInteger
 import java.security.cert.CertificateFactory
+import javax.security.auth.x500.X500Principal
 import javax.net.ssl.KeyManagerFactory
 import javax.net.ssl.SSLContext
 import javax.net.ssl.SSLSocketFactory
@@ -58,9 +77,19 @@ class MainActivity : AppCompatActivity() {
     private var stopTransmission = true
     private var manualMode = false
     private var sendManual = false
-    private var deviceID = (1..0xFFFF).random()
+    // Every install has its own client certificate, provisioned into the
+    // app's files directory; a certificate bundled with the app would give
+    // every install the same identity
+    private val clientCertFile by lazy { File(filesDir, CLIENT_CERT_FILE) }
+    private val clientKeyFile by lazy { File(filesDir, CLIENT_KEY_FILE) }
+    // The broker only lets a device use the topics of the common name in its
+    // client certificate, so the ID comes from there
+    private val deviceID by lazy { certificateCommonName(clientCertFile.inputStream()) }
 
     private lateinit var mqttClient: MqttClient
+    private var heartbeatTimer: Timer? = null
+    private var telemetryTimer: Timer? = null
+    private val captureErrors = AtomicInteger(0)
 
     override fun onCreate(savedInstanceState: Bundle?) {
         super.onCreate(savedInstanceState)
@@ -113,19 +142,36 @@ class MainActivity : AppCompatActivity() {
         }
     }
 
+    override fun onResume() {
+        super.onResume()
+        if (::mqttClient.isInitialized && mqttClient.isConnected) {
+            publishStatus(STATUS_ONLINE)
+            startHeartbeat()
+            startTelemetry()
+        }
+    }
+
     override fun onPause() {
         super.onPause()
-        publish("device/id/$deviceID", "Device Disconnected")
+        stopHeartbeat()
+        stopTelemetry()
+        publishStatus(STATUS_OFFLINE)
     }
 
     override fun onStop() {
         super.onStop()
-        publish("device/id/$deviceID", "Device Disconnected")
+        publishStatus(STATUS_OFFLINE)
     }
 
     private fun setupMQTT() {
+        if (!clientCertFile.exists() || !clientKeyFile.exists()) {
+            Log.e("SS", "No client certificate in ${filesDir.path}")
+            Toast.makeText(applicationContext, "Device certificate is not provisioned", Toast.LENGTH_LONG).show()
+            return
+        }
+
         val serverURI = "ssl://31.97.52.8:8883" // Or your broker
-        val clientId = MqttClient.generateClientId()
+        val clientId = deviceID
 
         mqttClient = MqttClient(serverURI, clientId, null)
 
@@ -155,8 +201,8 @@ class MainActivity : AppCompatActivity() {
         })
 
         val caCrtFile = resources.openRawResource(R.raw.ca)
-        val keyFile = resources.openRawResource(R.raw.clientkey)
-        val crtFile = resources.openRawResource(R.raw.clientcrt)
+        val keyFile = clientKeyFile.inputStream()
+        val crtFile = clientCertFile.inputStream()
 
         Log.d("SS", "Getting ssl socket")
         val sslSocketFactory = getSocketFactory(caCrtFile, crtFile, keyFile, "")
@@ -165,6 +211,10 @@ class MainActivity : AppCompatActivity() {
         val options = MqttConnectOptions()
         options.isCleanSession = false
         options.socketFactory = sslSocketFactory
+        // The broker publishes the will when the connection drops without a
+        // disconnect, e.g. when the app crashes or the network goes away
+        options.setWill("status/$deviceID", STATUS_LOST.toByteArray(), 1, true)
+        options.keepAliveInterval = KEEP_ALIVE_INTERVAL_S
         //options.isAutomaticReconnect = CONNECTION_RECONNECT
         //options.isCleanSession = CONNECTION_CLEAN_SESSION
         //options.userName = CLIENT_USER_NAME
@@ -192,13 +242,15 @@ class MainActivity : AppCompatActivity() {
             Toast.makeText(applicationContext, "MQTT Connection Failed", Toast.LENGTH_SHORT).show()
         }
 
-        val devname = android.os.Build.MANUFACTURER + " " + android.os.Build.MODEL
-        publish("register/$deviceID", devname)
+        publish("register/$deviceID", registrationPayload())
+        publishStatus(STATUS_ONLINE)
         Toast.makeText(applicationContext, "MQTT Connected", Toast.LENGTH_SHORT).show()
         Log.d("SS", "CONNECTED!!")
 
         mqttClient.subscribe("setup/$deviceID")
 
+        startHeartbeat()
+        startTelemetry()
         startImageCaptureLoop()
     }
 
@@ -230,6 +282,146 @@ class MainActivity : AppCompatActivity() {
         }
     }
 
+    // Registration schema version 1, see domain.DeviceRegistration on the server
+    private fun registrationPayload(): String {
+        val registration = JSONObject()
+            .put("version", 1)
+            .put("name", Build.MANUFACTURER + " " + Build.MODEL)
+            .put("manufacturer", Build.MANUFACTURER)
+            .put("model", Build.MODEL)
+            .put("os_version", Build.VERSION.RELEASE)
+            .put("app_version", packageManager.getPackageInfo(packageName, 0).versionName)
+            .put("network_type", networkType())
+
+        val batteryManager = getSystemService(Context.BATTERY_SERVICE) as BatteryManager
+        val level = batteryManager.getIntProperty(BatteryManager.BATTERY_PROPERTY_CAPACITY)
+        if (level in 0..100) {
+            registration.put("battery", JSONObject()
+                .put("level", level)
+                .put("charging", batteryManager.isCharging))
+        }
+
+        try {
+            registration.put("camera", cameraCapabilities())
+        } catch (e: Exception) {
+            Log.w("SS", "Failed to read camera capabilities", e)
+        }
+        return registration.toString()
+    }
+
+    private fun networkType(): String {
+        val connectivityManager = getSystemService(Context.CONNECTIVITY_SERVICE) as ConnectivityManager
+        val capabilities = connectivityManager.getNetworkCapabilities(connectivityManager.activeNetwork)
+            ?: return "none"
+        return when {
+            capabilities.hasTransport(NetworkCapabilities.TRANSPORT_WIFI) -> "wifi"
+            capabilities.hasTransport(NetworkCapabilities.TRANSPORT_CELLULAR) -> "cellular"
+            capabilities.hasTransport(NetworkCapabilities.TRANSPORT_ETHERNET) -> "ethernet"
+            else -> "other"
+        }
+    }
+
+    private fun cameraCapabilities(): JSONObject {
+        val cameraManager = getSystemService(Context.CAMERA_SERVICE) as CameraManager
+        val resolutions = mutableSetOf<android.util.Size>()
+        val lenses = JSONArray()
+        for (id in cameraManager.cameraIdList) {
+            val characteristics = cameraManager.getCameraCharacteristics(id)
+            val facing = when (characteristics.get(CameraCharacteristics.LENS_FACING)) {
+                CameraCharacteristics.LENS_FACING_FRONT -> "front"
+                CameraCharacteristics.LENS_FACING_BACK -> "back"
+                else -> "external"
+            }
+            val focalLengths = JSONArray()
+            characteristics.get(CameraCharacteristics.LENS_INFO_AVAILABLE_FOCAL_LENGTHS)
+                ?.forEach { focalLengths.put(it.toDouble()) }
+            if (lenses.length() < MAX_REPORTED_LENSES) {
+                lenses.put(JSONObject().put("facing", facing).put("focal_lengths", focalLengths))
+            }
+
+            characteristics.get(CameraCharacteristics.SCALER_STREAM_CONFIGURATION_MAP)
+                ?.getOutputSizes(ImageFormat.JPEG)
+                ?.let { resolutions.addAll(it) }
+        }
+        val sizes = JSONArray()
+        resolutions.sortedByDescending { it.width * it.height }
+            .take(MAX_REPORTED_RESOLUTIONS)
+            .forEach { sizes.put(JSONObject().put("width", it.width).put("height", it.height)) }
+        return JSONObject().put("resolutions", sizes).put("lenses", lenses)
+    }
+
+    // The server marks devices that stay silent for a few minutes as inactive,
+    // so keep checking in while the app is in the foreground
+    private fun startHeartbeat() {
+        if (heartbeatTimer != null) return
+        heartbeatTimer = fixedRateTimer("heartbeatTimer", true, 0L, HEARTBEAT_INTERVAL_MS) {
+            publish("heartbeat/$deviceID", "")
+        }
+    }
+
+    private fun stopHeartbeat() {
+        heartbeatTimer?.cancel()
+        heartbeatTimer = null
+    }
+
+    private fun startTelemetry() {
+        if (telemetryTimer != null) return
+        telemetryTimer = fixedRateTimer("telemetryTimer", true, 0L, TELEMETRY_INTERVAL_MS) {
+            try {
+                publish("telemetry/$deviceID", telemetryPayload())
+            } catch (e: Exception) {
+                Log.w("SS", "Failed to collect telemetry", e)
+            }
+        }
+    }
+
+    private fun stopTelemetry() {
+        telemetryTimer?.cancel()
+        telemetryTimer = null
+    }
+
+    // See domain.TelemetryReport on the server for the payload
+    private fun telemetryPayload(): String {
+        val telemetry = JSONObject()
+            .put("timestamp", java.time.Instant.now().toString())
+            .put("free_storage", StatFs(filesDir.path).availableBytes)
+            .put("capture_errors", captureErrors.getAndSet(0))
+
+        val battery = registerReceiver(null, IntentFilter(Intent.ACTION_BATTERY_CHANGED))
+        if (battery != null) {
+            val level = battery.getIntExtra(BatteryManager.EXTRA_LEVEL, -1)
+            val scale = battery.getIntExtra(BatteryManager.EXTRA_SCALE, -1)
+            if (level >= 0 && scale > 0) {
+                telemetry.put("battery_level", level * 100.0 / scale)
+            }
+            val temperature = battery.getIntExtra(BatteryManager.EXTRA_TEMPERATURE, Int.MIN_VALUE)
+            if (temperature != Int.MIN_VALUE) {
+                // Reported in tenths of a degree Celsius
+                telemetry.put("temperature", temperature / 10.0)
+            }
+        }
+
+        signalStrength()?.let { telemetry.put("signal_strength", it) }
+        return telemetry.toString()
+    }
+
+    // Signal strength of the active network in dBm, when it can be read
+    private fun signalStrength(): Int? {
+        return when (networkType()) {
+            "wifi" -> {
+                val wifiManager = applicationContext.getSystemService(Context.WIFI_SERVICE) as WifiManager
+                @Suppress("DEPRECATION")
+                wifiManager.connectionInfo.rssi.takeIf { it < 0 }
+            }
+            "cellular" -> if (Build.VERSION.SDK_INT >= Build.VERSION_CODES.Q) {
+                val telephonyManager = getSystemService(Context.TELEPHONY_SERVICE) as TelephonyManager
+                telephonyManager.signalStrength?.cellSignalStrengths?.firstOrNull()?.dbm
+                    ?.takeIf { it < 0 }
+            } else null
+            else -> null
+        }
+    }
+
     private fun captureImageAndSend() {
         val outputOptions = ImageCapture.OutputFileOptions.Builder(ByteArrayOutputStream()).build()
         if (::imageCapture.isInitialized && !stopTransmission && !manualMode) {
@@ -247,6 +439,7 @@ class MainActivity : AppCompatActivity() {
                 }
 
                 override fun onError(exception: ImageCaptureException) {
+                    captureErrors.incrementAndGet()
                     Log.e("CameraX", "Capture failed: ${exception.message}", exception)
                 }
             })
@@ -270,6 +463,7 @@ class MainActivity : AppCompatActivity() {
                 }
 
                 override fun onError(exception: ImageCaptureException) {
+                    captureErrors.incrementAndGet()
                     Log.e("CameraX", "Capture failed: ${exception.message}", exception)
                 }
             })
@@ -277,7 +471,7 @@ class MainActivity : AppCompatActivity() {
     }
 
     private fun sendToMQTT(data: ByteArray) {
-        if (mqttClient.isConnected) {
+        if (::mqttClient.isInitialized && mqttClient.isConnected) {
             Thread {
                 val message = MqttMessage(data)
                 message.qos = 0
@@ -307,15 +501,33 @@ class MainActivity : AppCompatActivity() {
 
     companion object {
         private const val REQUEST_CODE_PERMISSIONS = 10
+        private const val CLIENT_CERT_FILE = "client.crt"
+        private const val CLIENT_KEY_FILE = "client.key"
+        private const val HEARTBEAT_INTERVAL_MS = 30_000L
+        private const val TELEMETRY_INTERVAL_MS = 60_000L
+        private const val KEEP_ALIVE_INTERVAL_S = 30
+        // The server accepts up to 64 resolutions and 8 lenses
+        private const val MAX_REPORTED_RESOLUTIONS = 64
+        private const val MAX_REPORTED_LENSES = 8
+        private const val STATUS_ONLINE = """{"status":"online"}"""
+        private const val STATUS_OFFLINE = """{"status":"offline","reason":"disconnected"}"""
+        private const val STATUS_LOST = """{"status":"offline","reason":"connection_lost"}"""
         private val REQUIRED_PERMISSIONS =
             arrayOf(Manifest.permission.CAMERA, Manifest.permission.INTERNET)
     }
 
-    fun publish(topic: String, msg: String, qos: Int = 0) {
+    // Status messages are retained, so the topic always holds the latest state
+    private fun publishStatus(status: String) {
+        // Without a provisioned certificate there is no connection to report on
+        if (!::mqttClient.isInitialized) return
+        publish("status/$deviceID", status, 1, true)
+    }
+
+    fun publish(topic: String, msg: String, qos: Int = 0, retained: Boolean = false) {
         try {
             val mqttMessage = MqttMessage(msg.toByteArray())
             Thread {
-                mqttClient.publish(topic, mqttMessage.payload, qos, false)
+                mqttClient.publish(topic, mqttMessage.payload, qos, retained)
             }.start()
             Log.d("SS", "Message published to topic `$topic`: $msg")
         } catch (e: MqttException) {
@@ -325,6 +537,20 @@ class MainActivity : AppCompatActivity() {
     }
 
 
+    // Returns the common name of the certificate's subject, the device's identity
+    private fun certificateCommonName(certInput: InputStream): String {
+        val cert = certInput.use {
+            CertificateFactory.getInstance("X.509").generateCertificate(it) as X509Certificate
+        }
+        val subject = cert.subjectX500Principal.getName(X500Principal.RFC2253)
+        return subject.split(Regex("(?<!\\\\)[,+]"))
+            .map { it.trim() }
+            .firstOrNull { it.startsWith("CN=", ignoreCase = true) }
+            ?.substring(3)
+            ?.replace(Regex("\\\\(.)"), "$1")
+            ?: throw IllegalStateException("Client certificate has no common name")
+    }
+
     private fun getSocketFactory(
         caInput: InputStream,
         certInput: InputStream,
@@ -8,6 +8,18 @@ interface Device {
   device_id: string;
   device_name: string;
   device_status: string;
+  manufacturer?: string;
+  model?: string;
+  os_version?: string;
+  app_version?: string;
+  camera?: {
+    resolutions?: { width: number; height: number }[];
+    lenses?: { facing: string; focal_lengths?: number[] }[];
+  };
+  battery?: { level: number; charging: boolean };
+  network_type?: string;
+  last_seen?: string;
+  last_photo_at?: string;
 }
 
 // Interface for tracking device action states
@@ -63,6 +63,11 @@ const PhotosPage: React.FC = () => {
   const [photos, setPhotos] = useState<Photo[]>([]);
   const [photosLoading, setPhotosLoading] = useState<boolean>(false);
   const [photosError, setPhotosError] = useState<string | null>(null);
+  // Pagination state from the X-Next-Cursor / X-Total-Count response headers
+  const [nextCursor, setNextCursor] = useState<string | null>(null);
+  const [totalCount, setTotalCount] = useState<number>(0);
+  // Live mode prepends photos pushed by the /photos/stream Server-Sent Events endpoint
+  const [liveMode, setLiveMode] = useState<boolean>(false);
   
   const { token } = useAuth();
 
@@ -111,13 +116,36 @@ const PhotosPage: React.FC = () => {
     fetchDevices();
   }, [token]);
 
+  useEffect(() => {
+    if (!liveMode || !token) {
+      return;
+    }
+
+    // EventSource cannot send headers, so the token goes in the query string
+    const streamParams = new URLSearchParams({ access_token: token, size: 'preview' });
+    if (selectedDevice !== 'all') {
+      streamParams.append('device_id', selectedDevice);
+    }
+    const source = new EventSource(`https://api.ss.stefaniordache.com/photos/stream?${streamParams.toString()}`);
+    source.addEventListener('photo.committed', (event) => {
+      const { photo } = JSON.parse((event as MessageEvent).data) as { photo: Photo };
+      setPhotos(previous => [photo, ...previous.filter(p => p.id !== photo.id)]);
+      setTotalCount(previous => previous + 1);
+    });
+    source.onerror = () => {
+      console.error('Live photo stream interrupted, reconnecting...');
+    };
+
+    return () => source.close();
+  }, [liveMode, selectedDevice, token]);
+
   // Initial search on page load
   useEffect(() => {
     handleSearch();
     // eslint-disable-next-line react-hooks/exhaustive-deps
   }, []);
 
-  const handleSearch = async () => {
+  const handleSearch = async (cursor?: string) => {
     setPhotosLoading(true);
     setPhotosError(null);
     
@@ -130,6 +158,8 @@ const PhotosPage: React.FC = () => {
       const queryParams = new URLSearchParams();
       queryParams.append('start', startTimestamp.toString());
       queryParams.append('end', endTimestamp.toString());
+      // The grid shows 800px previews instead of full-resolution originals
+      queryParams.append('size', 'preview');
       
       if (searchText.trim()) {
         queryParams.append('text', searchText.trim());
@@ -139,6 +169,10 @@ const PhotosPage: React.FC = () => {
       if (selectedDevice !== 'all') {
         queryParams.append('device_id', selectedDevice);
       }
+
+      if (cursor) {
+        queryParams.append('cursor', cursor);
+      }
       
       // Make API request
       const response = await fetch(`https://api.ss.stefaniordache.com/photos?${queryParams.toString()}`, {
@@ -155,12 +189,16 @@ const PhotosPage: React.FC = () => {
       
       const data = await response.json();
       // Ensure data is an array, otherwise use empty array
-      setPhotos(Array.isArray(data) ? data : []);
+      const page: Photo[] = Array.isArray(data) ? data : [];
+      setPhotos(previous => (cursor ? [...previous, ...page] : page));
+      setNextCursor(response.headers.get('X-Next-Cursor'));
+      setTotalCount(Number(response.headers.get('X-Total-Count') ?? page.length));
       
     } catch (error) {
       console.error('Error fetching photos:', error);
       setPhotosError((error as Error).message || 'Failed to load photos');
       setPhotos([]);
+      setNextCursor(null);
     } finally {
       setPhotosLoading(false);
     }
@@ -248,10 +286,24 @@ const PhotosPage: React.FC = () => {
             </div>
           )}
           
+          {/* Live feed toggle */}
+          <div className="flex items-center h-10">
+            <label htmlFor="live-mode" className="flex items-center gap-2 text-sm font-medium text-gray-700">
+              <input
+                id="live-mode"
+                type="checkbox"
+                checked={liveMode}
+                onChange={(e) => setLiveMode(e.target.checked)}
+                className="h-4 w-4 text-sky-600 border-gray-300 rounded focus:ring-sky-500"
+              />
+              Live
+            </label>
+          </div>
+
           {/* Search button */}
           <div>
             <button
-              onClick={handleSearch}
+              onClick={() => handleSearch()}
               disabled={photosLoading}
               className="px-4 py-2 bg-sky-600 text-white rounded-md hover:bg-sky-700 focus:outline-none focus:ring-2 focus:ring-sky-500 focus:ring-offset-2 transition-colors disabled:opacity-50 disabled:cursor-not-allowed"
             >
@@ -264,7 +316,7 @@ const PhotosPage: React.FC = () => {
       {/* Photos section with fixed height and scroll */}
       <div className="bg-gray-50 p-4 rounded-lg shadow-sm overflow-y-auto max-h-[60vh]">
         {/* Loading state */}
-        {photosLoading && (
+        {photosLoading && photos.length === 0 && (
           <div className="flex justify-center items-center h-40">
             <div className="animate-spin rounded-full h-12 w-12 border-t-2 border-b-2 border-sky-500"></div>
           </div>
@@ -279,7 +331,7 @@ const PhotosPage: React.FC = () => {
         )}
         
         {/* Results grid */}
-        {!photosLoading && !photosError && (
+        {(!photosLoading || photos.length > 0) && !photosError && (
           <>
             {(photos || []).length === 0 ? (
               <div className="text-center text-gray-500 py-10">
@@ -297,6 +349,22 @@ const PhotosPage: React.FC = () => {
                 ))}
               </div>
             )}
+
+            {/* Pagination */}
+            {photos.length > 0 && (
+              <div className="flex justify-between items-center mt-4 text-sm text-gray-500">
+                <span>Showing {photos.length} of {totalCount} photos</span>
+                {nextCursor && (
+                  <button
+                    onClick={() => handleSearch(nextCursor)}
+                    disabled={photosLoading}
+                    className="px-4 py-2 bg-sky-600 text-white rounded-md hover:bg-sky-700 focus:outline-none focus:ring-2 focus:ring-sky-500 focus:ring-offset-2 transition-colors disabled:opacity-50 disabled:cursor-not-allowed"
+                  >
+                    {photosLoading ? 'Loading...' : 'Load more'}
+                  </button>
+                )}
+              </div>
+            )}
           </>
         )}
       </div>
@@ -0,0 +1,163 @@
+// Package alerts evaluates alert rules against ingested photos and sends the
+// resulting notifications through the configured sinks.
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"mqtt-streaming-server/domain"
+)
+
+type Config struct {
+	// QueueSize is how many photos may wait for evaluation; more are skipped.
+	QueueSize int
+	// SendTimeout bounds a single notification.
+	SendTimeout time.Duration
+}
+
+// Engine evaluates photos on its own goroutine so ingestion never waits on
+// Mongo lookups or slow notification sinks.
+type Engine struct {
+	rules   domain.AlertRuleRepository
+	history domain.AlertRepository
+	senders map[domain.SinkType]Sender
+	cfg     Config
+
+	queue chan *domain.Photo
+	done  chan struct{}
+	// queueMu guards closed; Evaluate holds it for reading so Close cannot close the queue under a sender.
+	queueMu sync.RWMutex
+	closed  bool
+
+	// lastFired is keyed by rule ID and device ID, for the rule cooldowns.
+	mu        sync.Mutex
+	lastFired map[string]time.Time
+}
+
+func NewEngine(rules domain.AlertRuleRepository, history domain.AlertRepository, senders map[domain.SinkType]Sender, cfg Config) *Engine {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 256
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = 10 * time.Second
+	}
+	return &Engine{
+		rules:     rules,
+		history:   history,
+		senders:   senders,
+		cfg:       cfg,
+		queue:     make(chan *domain.Photo, cfg.QueueSize),
+		done:      make(chan struct{}),
+		lastFired: make(map[string]time.Time),
+	}
+}
+
+// Start runs the evaluation loop until Close.
+func (e *Engine) Start() {
+	go func() {
+		defer close(e.done)
+		for photo := range e.queue {
+			e.EvaluateNow(context.Background(), photo)
+		}
+	}()
+}
+
+// Close stops accepting photos and waits for the queued ones to be evaluated.
+// It must only be called after Start.
+func (e *Engine) Close() {
+	e.queueMu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.queueMu.Unlock()
+	<-e.done
+}
+
+// Evaluate queues the photo for evaluation without blocking. Photos arriving
+// after Close are ignored.
+func (e *Engine) Evaluate(photo *domain.Photo) {
+	e.queueMu.RLock()
+	defer e.queueMu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- photo:
+	default:
+		fmt.Printf("Alert queue full, skipping rules for photo %s\n", photo.ID.Hex())
+	}
+}
+
+// EvaluateNow checks the photo against every enabled rule and dispatches the
+// rules that fire. It returns the alerts it recorded.
+func (e *Engine) EvaluateNow(ctx context.Context, photo *domain.Photo) []*domain.Alert {
+	rules, err := e.rules.GetEnabled(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load alert rules: %v\n", err)
+		return nil
+	}
+
+	var fired []*domain.Alert
+	for _, rule := range rules {
+		reason, ok := rule.Match(photo)
+		if !ok || !e.acquire(rule, photo.DeviceID, photo.Timestamp) {
+			continue
+		}
+		alert := &domain.Alert{
+			ID:       primitive.NewObjectID(),
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			DeviceID: photo.DeviceID,
+			PhotoID:  photo.ID,
+			Reason:   reason,
+			FiredAt:  time.Now().UTC(),
+		}
+		e.dispatch(ctx, rule, alert, photo)
+		if err := e.history.Save(ctx, alert); err != nil {
+			fmt.Printf("Failed to record alert for rule %s: %v\n", rule.Name, err)
+		}
+		fmt.Printf("Alert %q fired for device %s: %s\n", rule.Name, photo.DeviceID, reason)
+		fired = append(fired, alert)
+	}
+	return fired
+}
+
+// acquire reports whether the rule may fire for the device, and if so starts its cooldown.
+func (e *Engine) acquire(rule *domain.AlertRule, deviceID string, at time.Time) bool {
+	key := rule.ID.Hex() + "/" + deviceID
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if last, ok := e.lastFired[key]; ok && at.Sub(last) < time.Duration(rule.CooldownSeconds)*time.Second {
+		return false
+	}
+	e.lastFired[key] = at
+	return true
+}
+
+func (e *Engine) dispatch(ctx context.Context, rule *domain.AlertRule, alert *domain.Alert, photo *domain.Photo) {
+	for _, sink := range rule.Sinks {
+		delivery := domain.AlertDelivery{Sink: sink.Type}
+		sender, ok := e.senders[sink.Type]
+		if !ok {
+			delivery.Error = "sink type not available"
+			alert.Deliveries = append(alert.Deliveries, delivery)
+			continue
+		}
+		delivery.Target = sender.Target(sink, alert)
+
+		sendCtx, cancel := context.WithTimeout(ctx, e.cfg.SendTimeout)
+		err := sender.Send(sendCtx, sink, alert, photo)
+		cancel()
+		if err != nil {
+			fmt.Printf("Failed to send %s alert to %s: %v\n", sink.Type, delivery.Target, err)
+			delivery.Error = err.Error()
+		}
+		alert.Deliveries = append(alert.Deliveries, delivery)
+	}
+}
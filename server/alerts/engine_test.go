@@ -0,0 +1,112 @@
+package alerts_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/alerts"
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+)
+
+type fakeSender struct {
+	err  error
+	sent []*domain.Alert
+}
+
+func (s *fakeSender) Target(sink domain.AlertSink, _ *domain.Alert) string { return sink.URL }
+
+func (s *fakeSender) Send(_ context.Context, _ domain.AlertSink, alert *domain.Alert, _ *domain.Photo) error {
+	s.sent = append(s.sent, alert)
+	return s.err
+}
+
+func TestEngine_EvaluateNow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rule := &domain.AlertRule{
+		ID:              primitive.NewObjectID(),
+		Name:            "alarm",
+		Condition:       domain.RuleText,
+		Pattern:         "alarm",
+		CooldownSeconds: 60,
+		Sinks: []domain.AlertSink{
+			{Type: domain.SinkWebhook, URL: "https://example.com/ok"},
+			{Type: domain.SinkMQTT},
+			{Type: domain.SinkEmail, To: []string{"ops@example.com"}},
+		},
+		Enabled: true,
+	}
+	rules := mock_domain.NewMockAlertRuleRepository(ctrl)
+	rules.EXPECT().GetEnabled(gomock.Any()).Return([]*domain.AlertRule{rule}, nil).Times(3)
+	history := mock_domain.NewMockAlertRepository(ctrl)
+	history.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	webhook := &fakeSender{}
+	email := &fakeSender{err: errors.New("connection refused")}
+	engine := alerts.NewEngine(rules, history, map[domain.SinkType]alerts.Sender{
+		domain.SinkWebhook: webhook,
+		domain.SinkEmail:   email,
+	}, alerts.Config{})
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	photo := &domain.Photo{ID: primitive.NewObjectID(), DeviceID: "dev-1", Text: "ALARM", Timestamp: start}
+
+	fired := engine.EvaluateNow(context.Background(), photo)
+	if len(fired) != 1 {
+		t.Fatalf("expected one alert, got %d", len(fired))
+	}
+	alert := fired[0]
+	if alert.ID.IsZero() || alert.RuleID != rule.ID || alert.PhotoID != photo.ID {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	if len(webhook.sent) != 1 || len(email.sent) != 1 {
+		t.Errorf("expected one webhook and one email send, got %d and %d", len(webhook.sent), len(email.sent))
+	}
+	if len(alert.Deliveries) != 3 {
+		t.Fatalf("expected three deliveries, got %+v", alert.Deliveries)
+	}
+	if alert.Deliveries[0].Error != "" || alert.Deliveries[0].Target != "https://example.com/ok" {
+		t.Errorf("unexpected webhook delivery %+v", alert.Deliveries[0])
+	}
+	if alert.Deliveries[1].Error == "" {
+		t.Errorf("expected unavailable MQTT sink to be recorded as an error")
+	}
+	if alert.Deliveries[2].Error != "connection refused" {
+		t.Errorf("expected email failure to be recorded, got %+v", alert.Deliveries[2])
+	}
+
+	// Inside the cooldown the rule stays quiet for the same device
+	photo.Timestamp = start.Add(30 * time.Second)
+	if fired := engine.EvaluateNow(context.Background(), photo); len(fired) != 0 {
+		t.Errorf("expected cooldown to suppress the alert, got %d", len(fired))
+	}
+
+	photo.Timestamp = start.Add(2 * time.Minute)
+	if fired := engine.EvaluateNow(context.Background(), photo); len(fired) != 1 {
+		t.Errorf("expected the rule to fire again after the cooldown, got %d", len(fired))
+	}
+}
+
+func TestEngine_CloseDrainsQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rules := mock_domain.NewMockAlertRuleRepository(ctrl)
+	rules.EXPECT().GetEnabled(gomock.Any()).Return(nil, nil).Times(2)
+	engine := alerts.NewEngine(rules, mock_domain.NewMockAlertRepository(ctrl), nil, alerts.Config{QueueSize: 4})
+
+	engine.Start()
+	engine.Evaluate(&domain.Photo{DeviceID: "dev-1"})
+	engine.Evaluate(&domain.Photo{DeviceID: "dev-2"})
+	engine.Close()
+
+	// Photos after Close are ignored rather than panicking
+	engine.Evaluate(&domain.Photo{DeviceID: "dev-3"})
+}
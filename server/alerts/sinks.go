@@ -0,0 +1,185 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"mqtt-streaming-server/domain"
+)
+
+// Notification is the JSON document webhook and MQTT sinks receive.
+type Notification struct {
+	AlertID  string    `json:"alert_id"`
+	RuleID   string    `json:"rule_id"`
+	RuleName string    `json:"rule_name"`
+	DeviceID string    `json:"device_id"`
+	PhotoID  string    `json:"photo_id"`
+	Reason   string    `json:"reason"`
+	FiredAt  time.Time `json:"fired_at"`
+	// Text is the OCR text of the photo that fired the rule.
+	Text string `json:"text,omitempty"`
+}
+
+func newNotification(alert *domain.Alert, photo *domain.Photo) Notification {
+	return Notification{
+		AlertID:  alert.ID.Hex(),
+		RuleID:   alert.RuleID.Hex(),
+		RuleName: alert.RuleName,
+		DeviceID: alert.DeviceID,
+		PhotoID:  alert.PhotoID.Hex(),
+		Reason:   alert.Reason,
+		FiredAt:  alert.FiredAt,
+		Text:     photo.Text,
+	}
+}
+
+// Sender delivers notifications for one sink type.
+type Sender interface {
+	// Target describes where the sink delivers to, for the alert history.
+	Target(sink domain.AlertSink, alert *domain.Alert) string
+	Send(ctx context.Context, sink domain.AlertSink, alert *domain.Alert, photo *domain.Photo) error
+}
+
+// WebhookSender POSTs the notification as JSON to the sink URL.
+type WebhookSender struct {
+	Client *http.Client
+}
+
+func NewWebhookSender() *WebhookSender {
+	return &WebhookSender{Client: &http.Client{}}
+}
+
+func (s *WebhookSender) Target(sink domain.AlertSink, _ *domain.Alert) string {
+	return sink.URL
+}
+
+func (s *WebhookSender) Send(ctx context.Context, sink domain.AlertSink, alert *domain.Alert, photo *domain.Photo) error {
+	body, err := json.Marshal(newNotification(alert, photo))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// MQTTSender publishes the notification to alerts/<device>, or to the sink topic when set.
+type MQTTSender struct {
+	Client mqtt.Client
+}
+
+func NewMQTTSender(client mqtt.Client) *MQTTSender {
+	return &MQTTSender{Client: client}
+}
+
+func (s *MQTTSender) Target(sink domain.AlertSink, alert *domain.Alert) string {
+	if sink.Topic != "" {
+		return sink.Topic
+	}
+	return "alerts/" + alert.DeviceID
+}
+
+func (s *MQTTSender) Send(ctx context.Context, sink domain.AlertSink, alert *domain.Alert, photo *domain.Photo) error {
+	payload, err := json.Marshal(newNotification(alert, photo))
+	if err != nil {
+		return err
+	}
+	token := s.Client.Publish(s.Target(sink, alert), 1, false, payload)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// EmailSender mails a plain text notification through an SMTP relay.
+type EmailSender struct {
+	cfg SMTPConfig
+}
+
+func NewEmailSender(cfg SMTPConfig) *EmailSender {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &EmailSender{cfg: cfg}
+}
+
+func (s *EmailSender) Target(sink domain.AlertSink, _ *domain.Alert) string {
+	return strings.Join(sink.To, ", ")
+}
+
+func (s *EmailSender) Send(ctx context.Context, sink domain.AlertSink, alert *domain.Alert, photo *domain.Photo) error {
+	if s.cfg.Host == "" || s.cfg.From == "" {
+		return errors.New("SMTP is not configured")
+	}
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	msg := emailMessage(s.cfg.From, sink.To, alert, photo)
+
+	// net/smtp has no context support, so give up waiting on it instead
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(addr, auth, s.cfg.From, sink.To, msg) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func emailMessage(from string, to []string, alert *domain.Alert, photo *domain.Photo) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	// The rule name and the matched text are user data; encoding the subject
+	// keeps line breaks in them from starting new headers
+	subject := fmt.Sprintf("[%s] %s on %s", alert.RuleName, alert.Reason, alert.DeviceID)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", alert.FiredAt.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "Rule: %s\r\n", alert.RuleName)
+	fmt.Fprintf(&b, "Device: %s\r\n", alert.DeviceID)
+	fmt.Fprintf(&b, "Reason: %s\r\n", alert.Reason)
+	fmt.Fprintf(&b, "Photo: %s taken %s\r\n", alert.PhotoID.Hex(), photo.Timestamp.Format(time.RFC3339))
+	if photo.Text != "" {
+		fmt.Fprintf(&b, "\r\nText:\r\n%s\r\n", photo.Text)
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,149 @@
+package alerts_test
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"mqtt-streaming-server/alerts"
+	"mqtt-streaming-server/domain"
+)
+
+func TestWebhookSender_Send(t *testing.T) {
+	alert := &domain.Alert{
+		ID:       primitive.NewObjectID(),
+		RuleID:   primitive.NewObjectID(),
+		RuleName: "alarm",
+		DeviceID: "dev-1",
+		PhotoID:  primitive.NewObjectID(),
+		Reason:   `text matched "alarm"`,
+		FiredAt:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	photo := &domain.Photo{Text: "ALARM"}
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "accepted", status: http.StatusNoContent},
+		{name: "rejected", status: http.StatusBadGateway, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got alerts.Notification
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("expected JSON content type, got %q", r.Header.Get("Content-Type"))
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("invalid body: %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := alerts.NewWebhookSender().Send(context.Background(), domain.AlertSink{Type: domain.SinkWebhook, URL: server.URL}, alert, photo)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if got.AlertID != alert.ID.Hex() || got.DeviceID != "dev-1" || got.Text != "ALARM" {
+				t.Errorf("unexpected notification %+v", got)
+			}
+		})
+	}
+}
+
+// smtpServer accepts one message over plain SMTP and sends its data on
+// messages.
+func smtpServer(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ready")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+			case "EHLO", "HELO":
+				text.PrintfLine("250 localhost")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				messages <- string(data)
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber, messages
+}
+
+func TestEmailSender_SendEncodesSubject(t *testing.T) {
+	host, port, messages := smtpServer(t)
+	alert := &domain.Alert{
+		ID:       primitive.NewObjectID(),
+		RuleName: "alarm\r\nBcc: victim@example.com",
+		DeviceID: "dev-1",
+		PhotoID:  primitive.NewObjectID(),
+		Reason:   `text matched "alarm"`,
+		FiredAt:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	sender := alerts.NewEmailSender(alerts.SMTPConfig{Host: host, Port: port, From: "alerts@example.com"})
+	err := sender.Send(context.Background(), domain.AlertSink{Type: domain.SinkEmail, To: []string{"ops@example.com"}}, alert, &domain.Photo{})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-messages))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("expected no injected Bcc header, got %q", bcc)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("invalid subject: %v", err)
+	}
+	if want := "[" + alert.RuleName + `] text matched "alarm" on dev-1`; subject != want {
+		t.Errorf("expected subject %q, got %q", want, subject)
+	}
+}
@@ -0,0 +1,251 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Access is what a client asks to do with a topic, numbered as the broker's
+// auth plugin sends it.
+type Access int
+
+const (
+	AccessRead      Access = 1
+	AccessWrite     Access = 2
+	AccessReadWrite Access = 3
+	AccessSubscribe Access = 4
+)
+
+type ACLConfig struct {
+	// ServerIdentity is the common name of the server's own certificate,
+	// which may use every topic.
+	ServerIdentity string
+	// SharedReadTopics are topic filters every client may subscribe to, such
+	// as alerts/# for alert consumers.
+	SharedReadTopics []string
+	// PublishWindow is how long a publish the ACL allowed vouches for the
+	// messages the server then receives on that topic. Zero means 10 seconds.
+	// The check is a best-effort second line behind the broker's ACL: it ties
+	// a message to a recent allowed publish on the same topic, not to the
+	// certificate that sent it, so a shorter window leaves less room.
+	PublishWindow time.Duration
+}
+
+// devicePublishTopics are the topics a device publishes on, each followed by
+// its own ID.
+var devicePublishTopics = []string{"photos", "register", "status", "heartbeat", "telemetry", "device/id"}
+
+// deviceReadTopics are the topics a device listens on, each followed by its own ID.
+var deviceReadTopics = []string{"setup", "alerts"}
+
+// ACL decides what MQTT clients may do. Clients connect with a certificate
+// issued by the project CA and the broker passes its subject on as their
+// username. The certificate's common name is the ID of the device it was
+// issued to, so a device can only publish photos, registrations and status
+// on its own topics, whatever ID it claims.
+type ACL struct {
+	cfg ACLConfig
+
+	// published is when each device topic was last allowed to its device,
+	// swept of entries older than the publish window once per window.
+	mu        sync.Mutex
+	published map[string]time.Time
+	swept     time.Time
+}
+
+func NewACL(cfg ACLConfig) *ACL {
+	if cfg.PublishWindow <= 0 {
+		cfg.PublishWindow = 10 * time.Second
+	}
+	return &ACL{cfg: cfg, published: make(map[string]time.Time)}
+}
+
+// Authenticate reports whether the username names a client the ACL knows:
+// the server or a device.
+func (a *ACL) Authenticate(username string) bool {
+	_, err := DeviceIdentity(username)
+	return err == nil
+}
+
+func (a *ACL) Superuser(username string) bool {
+	identity, err := DeviceIdentity(username)
+	return err == nil && a.cfg.ServerIdentity != "" && identity == a.cfg.ServerIdentity
+}
+
+// Allowed reports whether the client may access the topic, a topic filter
+// when subscribing.
+func (a *ACL) Allowed(username, topic string, access Access) bool {
+	if a.Superuser(username) {
+		return true
+	}
+	deviceID, err := DeviceIdentity(username)
+	if err != nil {
+		return false
+	}
+
+	switch access {
+	case AccessWrite:
+		if !ownTopic(devicePublishTopics, deviceID, topic) {
+			return false
+		}
+		a.recordPublish(topic, time.Now())
+		return true
+	case AccessRead, AccessSubscribe:
+		if ownTopic(deviceReadTopics, deviceID, topic) {
+			return true
+		}
+		for _, filter := range a.cfg.SharedReadTopics {
+			if filterCovers(filter, topic) {
+				return true
+			}
+		}
+		return false
+	case AccessReadWrite:
+		return a.Allowed(username, topic, AccessRead) && a.Allowed(username, topic, AccessWrite)
+	default:
+		return false
+	}
+}
+
+func (a *ACL) recordPublish(topic string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.published[topic] = now
+	if now.Sub(a.swept) < a.cfg.PublishWindow {
+		return
+	}
+	for t, at := range a.published {
+		if now.Sub(at) > a.cfg.PublishWindow {
+			delete(a.published, t)
+		}
+	}
+	a.swept = now
+}
+
+// PublishedByOwner reports whether the device named by the topic was allowed
+// to publish on it within the publish window. Only the device a topic
+// belongs to is ever allowed to publish on it.
+func (a *ACL) PublishedByOwner(topic string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	at, ok := a.published[topic]
+	return ok && time.Since(at) <= a.cfg.PublishWindow
+}
+
+// Verified wraps a handler of device messages. MQTT does not tell the server
+// who published a message, so the handler only gets the messages on topics
+// whose own device the ACL allowed to publish there within the publish
+// window. This drops messages on topics no vetted device published to, such
+// as through a broker running without the auth plugin, but any message on the
+// topic passes inside the window; the broker's ACL is what keeps devices off
+// each other's topics. Retained messages and wills are not checked again when
+// they are delivered, so only live topics should be wrapped.
+func (a *ACL) Verified(handler mqtt.MessageHandler) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		if !a.PublishedByOwner(msg.Topic()) {
+			fmt.Printf("Dropping message on %s from a publisher the ACL did not allow\n", msg.Topic())
+			return
+		}
+		handler(client, msg)
+	}
+}
+
+func ownTopic(prefixes []string, deviceID, topic string) bool {
+	for _, prefix := range prefixes {
+		if topic == prefix+"/"+deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCovers reports whether every topic matching the requested filter
+// also matches the allowed one.
+func filterCovers(allowed, requested string) bool {
+	allowedLevels := strings.Split(allowed, "/")
+	requestedLevels := strings.Split(requested, "/")
+	for i, level := range allowedLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(requestedLevels) {
+			return false
+		}
+		switch requestedLevels[i] {
+		case "#":
+			return false
+		case "+":
+			if level != "+" {
+				return false
+			}
+		default:
+			if level != "+" && level != requestedLevels[i] {
+				return false
+			}
+		}
+	}
+	return len(allowedLevels) == len(requestedLevels)
+}
+
+// DeviceIdentity returns the common name of a certificate subject in the
+// RFC 2253 form the broker uses, such as "CN=dev-1,O=FirstForce". It must be
+// usable as a topic level.
+func DeviceIdentity(subject string) (string, error) {
+	for _, attribute := range splitRDNs(subject) {
+		name, value, ok := strings.Cut(attribute, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "CN") {
+			continue
+		}
+		identity := unescapeDN(strings.TrimSpace(value))
+		if identity == "" || strings.ContainsAny(identity, "/+#\x00") {
+			return "", fmt.Errorf("common name %q is not a valid device ID", identity)
+		}
+		return identity, nil
+	}
+	return "", errors.New("subject has no common name")
+}
+
+// splitRDNs splits a distinguished name into its attributes at the commas
+// and plus signs that are not escaped.
+func splitRDNs(dn string) []string {
+	var attributes []string
+	var current strings.Builder
+	escaped := false
+	for _, r := range dn {
+		switch {
+		case escaped:
+			current.WriteRune('\\')
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',' || r == '+':
+			attributes = append(attributes, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(attributes, current.String())
+}
+
+// unescapeDN removes the backslashes that escape special characters in an
+// attribute value.
+func unescapeDN(value string) string {
+	var unescaped strings.Builder
+	escaped := false
+	for _, r := range value {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		unescaped.WriteRune(r)
+		escaped = false
+	}
+	return unescaped.String()
+}
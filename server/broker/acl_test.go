@@ -0,0 +1,134 @@
+package broker_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"mqtt-streaming-server/broker"
+)
+
+func TestDeviceIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  string
+		expected string
+		wantErr  bool
+	}{
+		{name: "common name first", subject: "CN=dev-1,O=FirstForce,C=RO", expected: "dev-1"},
+		{name: "common name last", subject: "C=RO,O=FirstForce,CN=dev-2", expected: "dev-2"},
+		{name: "multi-valued RDN", subject: "O=FirstForce+CN=dev-3", expected: "dev-3"},
+		{name: "escaped comma", subject: `CN=lobby\, door,O=FirstForce`, expected: "lobby, door"},
+		{name: "escaped plus in another attribute", subject: `O=First\+Force,CN=dev-4`, expected: "dev-4"},
+		{name: "no common name", subject: "O=FirstForce,C=RO", wantErr: true},
+		{name: "empty common name", subject: "CN=,O=FirstForce", wantErr: true},
+		{name: "topic separator", subject: "CN=dev/1", wantErr: true},
+		{name: "wildcard", subject: "CN=#", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := broker.DeviceIdentity(tt.subject)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got identity %q", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if identity != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, identity)
+			}
+		})
+	}
+}
+
+func TestACL_Allowed(t *testing.T) {
+	acl := broker.NewACL(broker.ACLConfig{
+		ServerIdentity:   "web",
+		SharedReadTopics: []string{"alerts/#"},
+	})
+	const device = "CN=dev-1,O=FirstForce"
+
+	tests := []struct {
+		name     string
+		username string
+		topic    string
+		access   broker.Access
+		expected bool
+	}{
+		{name: "own photo topic", username: device, topic: "photos/dev-1", access: broker.AccessWrite, expected: true},
+		{name: "another device's photo topic", username: device, topic: "photos/dev-2", access: broker.AccessWrite},
+		{name: "own status topic", username: device, topic: "status/dev-1", access: broker.AccessWrite, expected: true},
+		{name: "legacy disconnect topic", username: device, topic: "device/id/dev-1", access: broker.AccessWrite, expected: true},
+		{name: "another device's registration", username: device, topic: "register/dev-2", access: broker.AccessWrite},
+		{name: "photo subtopic", username: device, topic: "photos/dev-1/extra", access: broker.AccessWrite},
+		{name: "publish on setup", username: device, topic: "setup/dev-1", access: broker.AccessWrite},
+		{name: "subscribe to own setup", username: device, topic: "setup/dev-1", access: broker.AccessSubscribe, expected: true},
+		{name: "read own setup", username: device, topic: "setup/dev-1", access: broker.AccessRead, expected: true},
+		{name: "subscribe to another device's setup", username: device, topic: "setup/dev-2", access: broker.AccessSubscribe},
+		{name: "subscribe to every setup", username: device, topic: "setup/#", access: broker.AccessSubscribe},
+		{name: "subscribe to every photo", username: device, topic: "photos/+", access: broker.AccessSubscribe},
+		{name: "subscribe to shared topic", username: device, topic: "alerts/#", access: broker.AccessSubscribe, expected: true},
+		{name: "subscribe within shared topic", username: device, topic: "alerts/+/critical", access: broker.AccessSubscribe, expected: true},
+		{name: "read shared topic", username: device, topic: "alerts/dev-2", access: broker.AccessRead, expected: true},
+		{name: "subscribe to everything", username: device, topic: "#", access: broker.AccessSubscribe},
+		{name: "read and write own photo topic", username: device, topic: "photos/dev-1", access: broker.AccessReadWrite},
+		{name: "server subscribes to every photo", username: "CN=web,O=FirstForce", topic: "photos/#", access: broker.AccessSubscribe, expected: true},
+		{name: "server publishes setup", username: "CN=web", topic: "setup/dev-1", access: broker.AccessWrite, expected: true},
+		{name: "subject without common name", username: "O=FirstForce", topic: "photos/dev-1", access: broker.AccessWrite},
+		{name: "unknown access", username: device, topic: "photos/dev-1", access: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if allowed := acl.Allowed(tt.username, tt.topic, tt.access); allowed != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestACL_Superuser(t *testing.T) {
+	acl := broker.NewACL(broker.ACLConfig{ServerIdentity: "web"})
+
+	if !acl.Superuser("CN=web,O=FirstForce") {
+		t.Error("expected the server to be a superuser")
+	}
+	if acl.Superuser("CN=dev-1,O=FirstForce") {
+		t.Error("expected a device not to be a superuser")
+	}
+	if broker.NewACL(broker.ACLConfig{}).Superuser("CN=") {
+		t.Error("expected no superuser without a server identity")
+	}
+}
+
+func TestACL_Verified(t *testing.T) {
+	acl := broker.NewACL(broker.ACLConfig{ServerIdentity: "web", PublishWindow: 50 * time.Millisecond})
+	var handled []string
+	handler := acl.Verified(func(_ mqtt.Client, msg mqtt.Message) {
+		handled = append(handled, msg.Topic())
+	})
+
+	// Nothing was allowed yet, as with a broker running without the auth plugin
+	handler(nil, message{topic: "photos/dev-1"})
+	// A device trying another device's topic does not vouch for it
+	acl.Allowed("CN=dev-1", "photos/dev-2", broker.AccessWrite)
+	handler(nil, message{topic: "photos/dev-2"})
+	// Neither does the server, which may use every topic
+	acl.Allowed("CN=web", "photos/dev-3", broker.AccessWrite)
+	handler(nil, message{topic: "photos/dev-3"})
+
+	acl.Allowed("CN=dev-1", "photos/dev-1", broker.AccessWrite)
+	handler(nil, message{topic: "photos/dev-1"})
+	time.Sleep(60 * time.Millisecond)
+	handler(nil, message{topic: "photos/dev-1"})
+
+	if !reflect.DeepEqual(handled, []string{"photos/dev-1"}) {
+		t.Errorf("expected only the allowed publish to be handled, got %v", handled)
+	}
+}
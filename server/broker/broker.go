@@ -7,39 +7,73 @@ import (
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
+	"strings"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"github.com/otiai10/gosseract/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"mqtt-streaming-server/domain"
-	"mqtt-streaming-server/repository"
-	"mqtt-streaming-server/utils"
+	"mqtt-streaming-server/events"
+	"mqtt-streaming-server/ocr"
 )
 
 type BrokerHandler struct {
 	photoRepository  domain.PhotoRepository
 	deviceRepository domain.DeviceRepository
-	ocrClient        *gosseract.Client
+	statusHistory    domain.DeviceStatusHistoryRepository
+	telemetry        domain.TelemetryRepository
+	blobStore        domain.BlobStore
+	frames           *events.FrameStore
+	changes          *changeDetector
+	committed        committedPhotos
+	webhooks         domain.WebhookPublisher
+	pipeline         *photoPipeline
 }
 
-func NewBrokerHandler(db *mongo.Database, ocrClient *gosseract.Client) BrokerHandler {
-	return BrokerHandler{
-		photoRepository:  repository.NewPhotoRepository(db),
-		deviceRepository: repository.NewDeviceRepository(db),
-		ocrClient:        ocrClient,
+func NewBrokerHandler(photoRepository domain.PhotoRepository, deviceRepository domain.DeviceRepository, statusHistory domain.DeviceStatusHistoryRepository, telemetry domain.TelemetryRepository, blobStore domain.BlobStore, photoEvents domain.PhotoPublisher, frames *events.FrameStore, alerts domain.AlertEvaluator, webhooks domain.WebhookPublisher, cfg PipelineConfig) BrokerHandler {
+	b := BrokerHandler{
+		photoRepository:  photoRepository,
+		deviceRepository: deviceRepository,
+		statusHistory:    statusHistory,
+		telemetry:        telemetry,
+		blobStore:        blobStore,
+		frames:           frames,
+		changes:          newChangeDetector(),
+		committed:        committedPhotos{photoEvents: photoEvents, alerts: alerts, webhooks: webhooks},
+		webhooks:         webhooks,
+		pipeline:         newPhotoPipeline(cfg),
 	}
+	b.pipeline.start(b.processPhoto)
+	return b
 }
 
+// Close stops accepting photos and waits for the queued ones to be processed.
+func (b BrokerHandler) Close() {
+	b.pipeline.close()
+}
+
+// HandlePhoto queues the photo for the ingestion workers so the MQTT callback
+// goroutine is never held up by OCR, MongoDB or blob storage.
 func (b BrokerHandler) HandlePhoto(_ mqtt.Client, msg mqtt.Message) {
 	topic := msg.Topic()
 	// topci is photos/device_id
 	deviceID := topic[len("photos/"):]
-	ctx := context.Background()
 	fmt.Println("Received message on topic:", msg.Topic())
-	// get registered device
-	device, err := b.deviceRepository.GetByID(ctx, deviceID)
+	b.pipeline.enqueue(photoJob{
+		deviceID:   deviceID,
+		body:       msg.Payload(),
+		receivedAt: time.Now().UTC(),
+	})
+}
+
+func (b BrokerHandler) processPhoto(w *photoWorker, job photoJob) {
+	cfg := b.pipeline.cfg
+	deviceID := job.deviceID
+	// get registered device, recording that it is alive
+	lookupCtx, cancel := context.WithTimeout(context.Background(), cfg.LookupTimeout)
+	device, err := b.markSeen(lookupCtx, deviceID, job.receivedAt, true, domain.DeviceStatusSeen)
+	cancel()
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			fmt.Printf("Device ID not found: %s\n", deviceID)
@@ -49,40 +83,164 @@ func (b BrokerHandler) HandlePhoto(_ mqtt.Client, msg mqtt.Message) {
 		return
 	}
 	fmt.Printf("Received photo from device: %s\n", device.DeviceName)
-	body := msg.Payload()
-	_, imageType, err := image.DecodeConfig(bytes.NewReader(body))
+	body := job.body
+	img, imageType, err := image.Decode(bytes.NewReader(body))
 	if err != nil {
 		fmt.Printf("Failed to decode image: %v\n", err)
 		return
 	}
 	fmt.Printf("Image type: %s\n", imageType)
+	// Live viewers get the frame straight away, before OCR and storage
+	if imageType == "jpeg" {
+		b.frames.Push(deviceID, body, "image/jpeg")
+	}
+
+	// Skip OCR and storage for frames that look like the previous one
+	settings := cfg.ChangeDetection
+	if device.ChangeDetection != nil {
+		settings = *device.ChangeDetection
+	}
+	signature, changeScore, changed := b.changes.check(deviceID, img, settings.Threshold)
+	if !changed && settings.Action == domain.ChangeActionDrop {
+		fmt.Printf("Dropped unchanged frame from device %s (change score %.4f)\n", deviceID, *changeScore)
+		return
+	}
+
+	// Prepare the image for OCR; a failure leaves OCR the original photo
+	preprocessing := cfg.Preprocessing
+	if device.Preprocessing != nil {
+		preprocessing = *device.Preprocessing
+	}
+	ocrSettings := cfg.OCR
+	if device.OCR != nil {
+		ocrSettings = *device.OCR
+	}
+	prepared, err := ocr.Prepare(body, img, preprocessing, ocrSettings.Regions)
+	if err != nil {
+		fmt.Printf("Failed to preprocess image: %v\n", err)
+		prepared, _ = ocr.Prepare(body, img, domain.Preprocessing{}, nil)
+	}
 
 	// Extract text from image
-	text, err := b.extractTextFromImage(body)
+	ocrCtx, cancel := context.WithTimeout(context.Background(), cfg.OCRTimeout)
+	result, err := prepared.Extract(ocrCtx, w.ocr, ocrSettings)
+	cancel()
+	text := ""
 	if err != nil {
 		fmt.Printf("Failed to extract text from image: %v\n", err)
-		text = "OCR failed"
+	} else {
+		text = result.Text
 	}
 	// UTC timestamp
-	timestamp := time.Now().UTC()
-	err = b.photoRepository.Save(ctx, &domain.Photo{
-		ImageType: imageType,
-		Timestamp: timestamp,
-		DeviceID:  deviceID,
-		Text:      text,
-	})
+	timestamp := job.receivedAt
+	keyName := domain.NewPhotoStorageKey(deviceID, timestamp, body, imageType)
+	photo := &domain.Photo{
+		ImageType:   imageType,
+		Timestamp:   timestamp,
+		DeviceID:    deviceID,
+		Text:        text,
+		OCR:         domain.NewPhotoOCR(result, err),
+		Width:       prepared.Width,
+		Height:      prepared.Height,
+		StorageKey:  keyName,
+		ChangeScore: changeScore,
+		Unchanged:   !changed,
+		Status:      domain.PhotoStatusPending,
+	}
+	// A photo without derivatives is still stored; clients fall back to the original
+	derivatives, err := makeDerivatives(cfg, keyName, img)
+	if err != nil {
+		fmt.Printf("Failed to generate derivatives: %v\n", err)
+	}
+	for _, d := range derivatives {
+		switch d.size {
+		case domain.PhotoSizeThumb:
+			photo.ThumbnailKey = d.key
+		case domain.PhotoSizePreview:
+			photo.PreviewKey = d.key
+		}
+	}
+	// The record is saved as pending first so a failed upload never leaves a
+	// blob without a record; the reconciler cleans up what stays pending
+	saveCtx, cancel := context.WithTimeout(context.Background(), cfg.SaveTimeout)
+	err = b.photoRepository.Save(saveCtx, photo)
+	cancel()
 	if err != nil {
 		fmt.Printf("Failed to insert photo into MongoDB: %v\n", err)
 		return
 	}
-	// upload to S3
-	keyName := fmt.Sprintf("photos/%d.%s", timestamp.Unix(), imageType)
-	err = utils.UploadToS3(ctx, body, imageType, keyName)
-	if err != nil {
-		fmt.Printf("Failed to upload photo to S3: %v\n", err)
+	// Derivatives go up before the original, so the reconciler never commits
+	// a photo whose derivatives are missing
+	for _, d := range derivatives {
+		if err := b.uploadPhoto(d.key, d.data, "image/jpeg"); err != nil {
+			fmt.Printf("Failed to upload %s derivative: %v\n", d.size, err)
+			b.setPhotoStatus(photo, domain.PhotoStatusFailed)
+			return
+		}
+	}
+	// upload to blob storage
+	if err := b.uploadPhoto(keyName, body, "image/"+imageType); err != nil {
+		fmt.Printf("Failed to upload photo: %v\n", err)
+		b.setPhotoStatus(photo, domain.PhotoStatusFailed)
 		return
 	}
-	fmt.Printf("Photo uploaded to S3 with key: %s\n", keyName)
+	fmt.Printf("Photo uploaded with key: %s\n", keyName)
+	if !b.setPhotoStatus(photo, domain.PhotoStatusCommitted) {
+		return
+	}
+	// A frame that never made it to storage must not become the reference
+	if changed {
+		b.changes.accept(deviceID, signature)
+	}
+	b.committed.publish(photo)
+}
+
+// committedPhotos tells the live photo stream, the alert rules and the
+// webhook subscribers about a photo once it is stored and committed, by the
+// ingestion workers or by the reconciler.
+type committedPhotos struct {
+	photoEvents domain.PhotoPublisher
+	alerts      domain.AlertEvaluator
+	webhooks    domain.WebhookPublisher
+}
+
+func (c committedPhotos) publish(photo *domain.Photo) {
+	c.photoEvents.Publish(domain.PhotoEvent{Type: domain.PhotoCommitted, Photo: photo})
+	c.alerts.Evaluate(photo)
+	c.webhooks.Publish(domain.NewPhotoIngestedEvent(photo))
+}
+
+// uploadPhoto puts the image in blob storage, retrying with exponential backoff.
+func (b BrokerHandler) uploadPhoto(key string, body []byte, contentType string) error {
+	cfg := b.pipeline.cfg
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 0; attempt <= cfg.UploadRetries; attempt++ {
+		if attempt > 0 {
+			fmt.Printf("Retrying upload of %s in %s (attempt %d)\n", key, backoff, attempt+1)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		uploadCtx, cancel := context.WithTimeout(context.Background(), cfg.UploadTimeout)
+		err = b.blobStore.Put(uploadCtx, key, body, contentType)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// setPhotoStatus persists the new status and reports whether it succeeded.
+func (b BrokerHandler) setPhotoStatus(photo *domain.Photo, status string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), b.pipeline.cfg.SaveTimeout)
+	defer cancel()
+	if err := b.photoRepository.UpdateStatus(ctx, photo.ID, status); err != nil {
+		fmt.Printf("Failed to mark photo %s as %s: %v\n", photo.ID.Hex(), status, err)
+		return false
+	}
+	photo.Status = status
+	return true
 }
 
 func (b BrokerHandler) RegisterDevice(_ mqtt.Client, msg mqtt.Message) {
@@ -93,54 +251,93 @@ func (b BrokerHandler) RegisterDevice(_ mqtt.Client, msg mqtt.Message) {
 	fmt.Println("Received message on topic:", msg.Topic())
 	body := msg.Payload()
 	fmt.Printf("Received device registration: %s\n", body)
+	registration, err := domain.ParseDeviceRegistration(body)
+	if err != nil {
+		fmt.Printf("Invalid device registration from %s: %v\n", deviceID, err)
+		return
+	}
 	// Check if device ID already exists
-	_, err := b.deviceRepository.GetByID(ctx, deviceID)
+	existing, err := b.deviceRepository.GetByID(ctx, deviceID)
 	if err != nil && err != mongo.ErrNoDocuments {
 		fmt.Printf("Failed to check device ID: %v\n", err)
 		return
 	}
+	now := time.Now().UTC()
+	device := &domain.Device{
+		DeviceID:     deviceID,
+		DeviceName:   registration.Name,
+		DeviceStatus: domain.DeviceStatusActive,
+		DeviceInfo:   registration.DeviceInfo,
+		LastSeen:     &now,
+	}
 	if err == mongo.ErrNoDocuments {
 		// Device ID does not exist, insert it
-		err = b.deviceRepository.Save(ctx, &domain.Device{
-			DeviceID:     deviceID,
-			DeviceName:   string(body),
-			DeviceStatus: "active",
-		})
+		err = b.deviceRepository.Save(ctx, device)
 		if err != nil {
 			fmt.Printf("Failed to insert device ID: %v\n", err)
 			return
 		}
 		fmt.Printf("Device registered: %s\n", deviceID)
+		recordStatus(ctx, b.statusHistory, deviceID, "", domain.DeviceStatusActive, domain.DeviceStatusRegistered, now)
+		b.webhooks.Publish(domain.NewDeviceEvent(domain.WebhookDeviceRegistered, device))
 		return
 	}
-	// Device ID already exists, update it
-	err = b.deviceRepository.Update(ctx, deviceID, &domain.Device{
-		DeviceID:     deviceID,
-		DeviceName:   string(body),
-		DeviceStatus: "active",
-	})
+	// Device ID already exists, update it; details a plain registration
+	// leaves out keep their stored values
+	err = b.deviceRepository.Update(ctx, deviceID, device)
 	if err != nil {
 		fmt.Printf("Failed to update device ID: %v\n", err)
 		return
 	}
 	fmt.Printf("Device updated: %s\n", deviceID)
+	if existing.DeviceStatus != domain.DeviceStatusActive {
+		recordStatus(ctx, b.statusHistory, deviceID, existing.DeviceStatus, domain.DeviceStatusActive, domain.DeviceStatusRegistered, now)
+	}
+	b.webhooks.Publish(domain.NewDeviceEvent(domain.WebhookDeviceRegistered, device))
 }
 
+// DisconnectDevice applies a status message from status/<id>, where devices
+// publish their online state and leave an offline will (see
+// domain.DeviceStatusMessage), or from device/id/<id>, where older app
+// versions announce their disconnection.
 func (b BrokerHandler) DisconnectDevice(_ mqtt.Client, msg mqtt.Message) {
 	topic := msg.Topic()
-	// topic is disconnect/device_id
-	deviceID := topic[len("device/id/"):]
+	// topic is status/device_id or device/id/device_id
+	deviceID, ok := strings.CutPrefix(topic, "status/")
+	if !ok {
+		deviceID = topic[len("device/id/"):]
+	}
 	ctx := context.Background()
 	fmt.Println("Received message on topic:", msg.Topic())
-	message := string(msg.Payload())
-	fmt.Printf("Received device disconnection: %s\n", message)
-	// Check if message is a disconnect request
-	if message != "Device Disconnected" {
-		fmt.Printf("Invalid disconnection message: %s\n", message)
+	status, err := domain.ParseDeviceStatusMessage(msg.Payload())
+	if err != nil {
+		fmt.Printf("Invalid device status from %s: %v\n", deviceID, err)
+		return
+	}
+	fmt.Printf("Received device status: %s (%s)\n", status.Status, status.Reason)
+	now := time.Now().UTC()
+
+	if status.Status == domain.DeviceOnline {
+		// A retained online status is current too: the broker replaces it
+		// with the will as soon as the connection drops
+		if _, err := b.markSeen(ctx, deviceID, now, false, domain.DeviceStatusConnected); err != nil {
+			if err == mongo.ErrNoDocuments {
+				fmt.Printf("Device ID not found: %s\n", deviceID)
+			} else {
+				fmt.Printf("Failed to update device ID: %v\n", err)
+			}
+		}
 		return
 	}
-	// Check if device ID exists
-	device, err := b.deviceRepository.GetByID(ctx, deviceID)
+
+	// Check if device ID exists. Only a device publishing live proves it was
+	// just seen; a will or a retained status may be long out of date.
+	var device *domain.Device
+	if status.Reason == domain.DeviceStatusDisconnected && !msg.Retained() {
+		device, err = b.deviceRepository.Touch(ctx, deviceID, now, false)
+	} else {
+		device, err = b.deviceRepository.GetByID(ctx, deviceID)
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			fmt.Printf("Device ID not found: %s\n", deviceID)
@@ -149,29 +346,90 @@ func (b BrokerHandler) DisconnectDevice(_ mqtt.Client, msg mqtt.Message) {
 		}
 		return
 	}
-	if device.DeviceStatus != "active" {
+	if device.DeviceStatus != domain.DeviceStatusActive {
 		fmt.Printf("Device ID is not active: %s\n", deviceID)
 		return
 	}
-	// Update device status to inactive
-	err = b.deviceRepository.Update(ctx, deviceID, &domain.Device{
-		DeviceID:     deviceID,
-		DeviceStatus: "inactive",
-		DeviceName:   device.DeviceName,
-	})
+	// Update device status to inactive, unless the presence sweeper just did
+	changed, err := b.deviceRepository.SetStatus(ctx, deviceID, domain.DeviceStatusActive, domain.DeviceStatusInactive)
 	if err != nil {
 		fmt.Printf("Failed to update device ID: %v\n", err)
 		return
 	}
+	if !changed {
+		fmt.Printf("Device ID is not active: %s\n", deviceID)
+		return
+	}
+	device.DeviceStatus = domain.DeviceStatusInactive
 	fmt.Printf("Device disconnected: %s\n", deviceID)
+	recordStatus(ctx, b.statusHistory, deviceID, domain.DeviceStatusActive, domain.DeviceStatusInactive, status.Reason, now)
+	b.webhooks.Publish(domain.NewDeviceEvent(domain.WebhookDeviceDisconnected, device))
 }
 
-func (b BrokerHandler) extractTextFromImage(imageData []byte) (string, error) {
-	// Use the OCR client to extract text from the image
-	b.ocrClient.SetImageFromBytes(imageData)
-	text, err := b.ocrClient.Text()
+// HandleHeartbeat records that a device is alive. Devices publish on
+// heartbeat/<id> between photos, so the presence sweeper can tell a device
+// that crashed or lost its network from one that is just idle.
+func (b BrokerHandler) HandleHeartbeat(_ mqtt.Client, msg mqtt.Message) {
+	// topic is heartbeat/device_id
+	deviceID := msg.Topic()[len("heartbeat/"):]
+	ctx, cancel := context.WithTimeout(context.Background(), b.pipeline.cfg.LookupTimeout)
+	defer cancel()
+	if _, err := b.markSeen(ctx, deviceID, time.Now().UTC(), false, domain.DeviceStatusSeen); err != nil {
+		if err == mongo.ErrNoDocuments {
+			fmt.Printf("Heartbeat from unknown device: %s\n", deviceID)
+		} else {
+			fmt.Printf("Failed to record heartbeat: %v\n", err)
+		}
+	}
+}
+
+// HandleTelemetry stores the readings a device reports on telemetry/<id>.
+// See domain.TelemetryReport for the payload.
+func (b BrokerHandler) HandleTelemetry(_ mqtt.Client, msg mqtt.Message) {
+	// topic is telemetry/device_id
+	deviceID := msg.Topic()[len("telemetry/"):]
+	receivedAt := time.Now().UTC()
+	sample, err := domain.ParseTelemetryReport(deviceID, msg.Payload(), receivedAt)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract text from image: %v", err)
+		fmt.Printf("Invalid telemetry from %s: %v\n", deviceID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.pipeline.cfg.SaveTimeout)
+	defer cancel()
+	// Only registered devices report telemetry
+	if _, err := b.markSeen(ctx, deviceID, receivedAt, false, domain.DeviceStatusSeen); err != nil {
+		if err == mongo.ErrNoDocuments {
+			fmt.Printf("Telemetry from unknown device: %s\n", deviceID)
+		} else {
+			fmt.Printf("Failed to check device ID: %v\n", err)
+		}
+		return
+	}
+	if err := b.telemetry.Save(ctx, sample); err != nil {
+		fmt.Printf("Failed to save telemetry from %s: %v\n", deviceID, err)
+	}
+}
+
+// markSeen updates when the device was last seen, and last sent a photo when
+// photo is set, bringing a device marked inactive back online for reason.
+func (b BrokerHandler) markSeen(ctx context.Context, deviceID string, at time.Time, photo bool, reason domain.DeviceStatusReason) (*domain.Device, error) {
+	device, err := b.deviceRepository.Touch(ctx, deviceID, at, photo)
+	if err != nil {
+		return nil, err
+	}
+	if device.DeviceStatus != domain.DeviceStatusInactive {
+		return device, nil
+	}
+	changed, err := b.deviceRepository.SetStatus(ctx, deviceID, domain.DeviceStatusInactive, domain.DeviceStatusActive)
+	if err != nil {
+		fmt.Printf("Failed to reactivate device %s: %v\n", deviceID, err)
+		return device, nil
+	}
+	if changed {
+		device.DeviceStatus = domain.DeviceStatusActive
+		fmt.Printf("Device back online: %s\n", deviceID)
+		recordStatus(ctx, b.statusHistory, deviceID, domain.DeviceStatusInactive, domain.DeviceStatusActive, reason, at)
 	}
-	return text, nil
+	return device, nil
 }
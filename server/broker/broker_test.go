@@ -1,30 +1,614 @@
 package broker_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"reflect"
+	"sync"
 	"testing"
 
-	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"github.com/otiai10/gosseract/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/mock/gomock"
 
 	"mqtt-streaming-server/broker"
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/events"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/ocr"
+	"mqtt-streaming-server/storage"
 )
 
+// message is an mqtt.Message carrying a topic and payload.
+type message struct {
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+func (m message) Duplicate() bool   { return false }
+func (m message) Qos() byte         { return 0 }
+func (m message) Retained() bool    { return m.retained }
+func (m message) Topic() string     { return m.topic }
+func (m message) MessageID() uint16 { return 0 }
+func (m message) Payload() []byte   { return m.payload }
+func (m message) Ack()              {}
+
+// recorder collects what the broker publishes.
+type recorder struct {
+	mu       sync.Mutex
+	photos   []domain.PhotoEvent
+	alerts   []*domain.Photo
+	webhooks []domain.WebhookEvent
+}
+
+func (r *recorder) photoEvents() domain.PhotoPublisher { return photoRecorder{r} }
+
+type photoRecorder struct{ r *recorder }
+
+func (p photoRecorder) Publish(event domain.PhotoEvent) {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	p.r.photos = append(p.r.photos, event)
+}
+
+func (r *recorder) Evaluate(photo *domain.Photo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, photo)
+}
+
+func (r *recorder) Publish(event domain.WebhookEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.webhooks = append(r.webhooks, event)
+}
+
+func jpegImage(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	img.SetGray(0, 0, color.Gray{Y: 255})
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// failingStore fails the first failures puts.
+type failingStore struct {
+	domain.BlobStore
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *failingStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	s.mu.Lock()
+	fail := s.failures > 0
+	s.failures--
+	s.mu.Unlock()
+	if fail {
+		return errors.New("storage unavailable")
+	}
+	return s.BlobStore.Put(ctx, key, data, contentType)
+}
+
+func invertedJPEGImage(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for i := range img.Pix {
+		img.Pix[i] = 255 - uint8(i)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBrokerHandler_ChangeDetection(t *testing.T) {
+	type stored struct {
+		status    string
+		score     *float64
+		unchanged bool
+	}
+	tests := []struct {
+		name          string
+		action        domain.ChangeAction
+		payloads      []func(*testing.T) []byte
+		failedUploads int
+		want          []stored
+	}{
+		{
+			name:     "drop discards unchanged frames",
+			action:   domain.ChangeActionDrop,
+			payloads: []func(*testing.T) []byte{jpegImage, jpegImage},
+			want:     []stored{{status: domain.PhotoStatusCommitted}},
+		},
+		{
+			name:     "flag stores unchanged frames marked",
+			action:   domain.ChangeActionFlag,
+			payloads: []func(*testing.T) []byte{jpegImage, jpegImage},
+			want:     []stored{{status: domain.PhotoStatusCommitted}, {status: domain.PhotoStatusCommitted, score: new(float64), unchanged: true}},
+		},
+		{
+			name:     "changed frames are kept",
+			action:   domain.ChangeActionDrop,
+			payloads: []func(*testing.T) []byte{jpegImage, invertedJPEGImage},
+			want:     []stored{{status: domain.PhotoStatusCommitted}, {status: domain.PhotoStatusCommitted, score: new(float64)}},
+		},
+		{
+			name:          "failed upload does not become the reference",
+			action:        domain.ChangeActionDrop,
+			payloads:      []func(*testing.T) []byte{jpegImage, jpegImage},
+			failedUploads: 1,
+			want:          []stored{{status: domain.PhotoStatusFailed}, {status: domain.PhotoStatusCommitted}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockPhotos := mock_domain.NewMockPhotoRepository(ctrl)
+			mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+			mockDevices.EXPECT().Touch(gomock.Any(), "dev-1", gomock.Any(), true).Return(&domain.Device{
+				DeviceID:        "dev-1",
+				DeviceStatus:    domain.DeviceStatusActive,
+				ChangeDetection: &domain.ChangeDetection{Threshold: 0.1, Action: tt.action},
+			}, nil).AnyTimes()
+			var saved []*domain.Photo
+			mockPhotos.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, photo *domain.Photo) error {
+				photo.ID = primitive.NewObjectID()
+				saved = append(saved, photo)
+				return nil
+			}).AnyTimes()
+			mockPhotos.EXPECT().UpdateStatus(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+			rec := &recorder{}
+			store := &failingStore{BlobStore: storage.NewMemoryStore(nil), failures: tt.failedUploads}
+			b := broker.NewBrokerHandler(mockPhotos, mockDevices, mock_domain.NewMockDeviceStatusHistoryRepository(ctrl), mock_domain.NewMockTelemetryRepository(ctrl), store, rec.photoEvents(), events.NewFrameStore(4, 1), rec, rec, broker.PipelineConfig{Workers: 1})
+			for _, payload := range tt.payloads {
+				b.HandlePhoto(nil, message{topic: "photos/dev-1", payload: payload(t)})
+			}
+			b.Close()
+
+			if len(saved) != len(tt.want) {
+				t.Fatalf("expected %d photos stored, got %d", len(tt.want), len(saved))
+			}
+			for i, want := range tt.want {
+				got := saved[i]
+				if got.Status != want.status || got.Unchanged != want.unchanged || (got.ChangeScore == nil) != (want.score == nil) {
+					t.Errorf("photo %d: expected %+v, got status %s, score %v, unchanged %v", i, want, got.Status, got.ChangeScore, got.Unchanged)
+				}
+			}
+		})
+	}
+}
+
+func TestBrokerHandler_HandlePhoto(t *testing.T) {
+	tests := []struct {
+		name          string
+		extractor     *ocr.Fake
+		payload       func(t *testing.T) []byte
+		preprocessing *domain.Preprocessing
+		ocrSettings   *domain.OCRSettings
+		lookupErr     error
+		wantText      string
+		wantOCR       domain.PhotoOCR
+		wantStored    bool
+	}{
+		{
+			name:       "stores photo with extracted text",
+			extractor:  &ocr.Fake{Result: domain.OCRResult{Text: "GATE 4", Confidence: 0.9, Language: "eng"}},
+			payload:    jpegImage,
+			wantText:   "GATE 4",
+			wantOCR:    domain.PhotoOCR{Status: domain.OCRStatusDone, Confidence: 0.9, Language: "eng"},
+			wantStored: true,
+		},
+		{
+			name:       "OCR failure still stores photo",
+			extractor:  &ocr.Fake{Err: errors.New("engine crashed")},
+			payload:    jpegImage,
+			wantOCR:    domain.PhotoOCR{Status: domain.OCRStatusFailed, Error: "engine crashed"},
+			wantStored: true,
+		},
+		{
+			name: "word boxes map back from the cropped image",
+			extractor: &ocr.Fake{Result: domain.OCRResult{Text: "4", Confidence: 0.8, Words: []domain.WordBox{
+				{Text: "4", Confidence: 0.8, X: 2, Y: 3, Width: 5, Height: 6},
+			}}},
+			payload: jpegImage,
+			preprocessing: &domain.Preprocessing{
+				Steps: []domain.PreprocessStep{domain.PreprocessCrop, domain.PreprocessGrayscale, domain.PreprocessThreshold},
+				Crop:  &domain.Region{X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5},
+			},
+			wantText: "4",
+			wantOCR: domain.PhotoOCR{Status: domain.OCRStatusDone, Confidence: 0.8, Words: []domain.WordBox{
+				{Text: "4", Confidence: 0.8, X: 34, Y: 27, Width: 5, Height: 6},
+			}},
+			wantStored: true,
+		},
+		{
+			name: "regions of interest are read separately",
+			extractor: &ocr.Fake{Result: domain.OCRResult{Text: "42\n", Confidence: 0.6, Language: "ron", Words: []domain.WordBox{
+				{Text: "42", Confidence: 0.6, X: 1, Y: 1, Width: 4, Height: 4},
+			}}},
+			payload: jpegImage,
+			ocrSettings: &domain.OCRSettings{
+				Languages:   []string{"ron"},
+				PageSegMode: 7,
+				Whitelist:   "0123456789",
+				Regions:     []domain.Region{{X: 0, Y: 0, Width: 0.5, Height: 0.5}, {X: 0.5, Y: 0.5, Width: 0.25, Height: 0.25}},
+			},
+			wantText: "42\n42",
+			wantOCR: domain.PhotoOCR{Status: domain.OCRStatusDone, Confidence: 0.6, Language: "ron", Words: []domain.WordBox{
+				{Text: "42", Confidence: 0.6, X: 1, Y: 1, Width: 4, Height: 4},
+				{Text: "42", Confidence: 0.6, X: 33, Y: 25, Width: 4, Height: 4},
+			}},
+			wantStored: true,
+		},
+		{
+			name:      "unknown device",
+			extractor: &ocr.Fake{},
+			payload:   jpegImage,
+			lookupErr: mongo.ErrNoDocuments,
+		},
+		{
+			name:      "payload is not an image",
+			extractor: &ocr.Fake{},
+			payload:   func(*testing.T) []byte { return []byte("not an image") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockPhotos := mock_domain.NewMockPhotoRepository(ctrl)
+			mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+			store := storage.NewMemoryStore(nil)
+			rec := &recorder{}
+
+			if tt.lookupErr != nil {
+				mockDevices.EXPECT().Touch(gomock.Any(), "dev-1", gomock.Any(), true).Return(nil, tt.lookupErr)
+			} else {
+				mockDevices.EXPECT().Touch(gomock.Any(), "dev-1", gomock.Any(), true).Return(&domain.Device{DeviceID: "dev-1", DeviceName: "Pixel", DeviceStatus: domain.DeviceStatusActive, Preprocessing: tt.preprocessing, OCR: tt.ocrSettings}, nil)
+			}
+			var saved *domain.Photo
+			if tt.wantStored {
+				mockPhotos.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, photo *domain.Photo) error {
+					photo.ID = primitive.NewObjectID()
+					saved = photo
+					return nil
+				})
+				mockPhotos.EXPECT().UpdateStatus(gomock.Any(), gomock.Any(), domain.PhotoStatusCommitted).Return(nil)
+			}
+
+			b := broker.NewBrokerHandler(mockPhotos, mockDevices, mock_domain.NewMockDeviceStatusHistoryRepository(ctrl), mock_domain.NewMockTelemetryRepository(ctrl), store, rec.photoEvents(), events.NewFrameStore(4, 1), rec, rec, broker.PipelineConfig{
+				Workers:          1,
+				NewTextExtractor: func() domain.TextExtractor { return tt.extractor },
+			})
+			b.HandlePhoto(nil, message{topic: "photos/dev-1", payload: tt.payload(t)})
+			b.Close()
+
+			if !tt.wantStored {
+				if len(rec.photos) != 0 || len(rec.webhooks) != 0 {
+					t.Errorf("expected nothing published, got %d photo and %d webhook events", len(rec.photos), len(rec.webhooks))
+				}
+				return
+			}
+			if saved.Text != tt.wantText || saved.Status != domain.PhotoStatusCommitted || saved.Width != 64 || saved.Height != 48 {
+				t.Errorf("unexpected photo %+v", saved)
+			}
+			if saved.OCR == nil || !reflect.DeepEqual(*saved.OCR, tt.wantOCR) {
+				t.Errorf("expected OCR %+v, got %+v", tt.wantOCR, saved.OCR)
+			}
+			for _, key := range saved.BlobKeys() {
+				if _, err := store.Stat(context.Background(), key); err != nil {
+					t.Errorf("expected blob %s to be stored: %v", key, err)
+				}
+			}
+			if len(rec.photos) != 1 || len(rec.alerts) != 1 || len(rec.webhooks) != 1 || rec.webhooks[0].Type != domain.WebhookPhotoIngested {
+				t.Errorf("expected one photo event, alert evaluation and webhook, got %d, %d and %v", len(rec.photos), len(rec.alerts), rec.webhooks)
+			}
+			wantCalls, wantSettings := 1, domain.OCRSettings{}
+			if tt.ocrSettings != nil {
+				wantCalls, wantSettings = len(tt.ocrSettings.Regions), *tt.ocrSettings
+			}
+			if tt.extractor.Calls() != wantCalls {
+				t.Errorf("expected %d OCR calls, got %d", wantCalls, tt.extractor.Calls())
+			}
+			if got := tt.extractor.LastSettings(); !reflect.DeepEqual(got, wantSettings) {
+				t.Errorf("expected OCR settings %+v, got %+v", wantSettings, got)
+			}
+		})
+	}
+}
+
 func TestBrokerHandler_RegisterDevice(t *testing.T) {
 	tests := []struct {
-		name string // description of this test case
-		// Named input parameters for receiver constructor.
-		db        *mongo.Database
-		ocrClient *gosseract.Client
-		// Named input parameters for target function.
-		msg mqtt.Message
+		name        string
+		payload     string
+		existing    *domain.Device
+		lookupErr   error
+		wantSave    bool
+		wantUpdate  bool
+		wantHistory bool
+		wantFrom    string
+		wantInfo    domain.DeviceInfo
+	}{
+		{name: "new device", lookupErr: mongo.ErrNoDocuments, wantSave: true, wantHistory: true},
+		{
+			name:        "structured registration",
+			payload:     `{"version":1,"name":"Pixel 7","manufacturer":"Google","model":"Pixel 7","os_version":"14","battery":{"level":55}}`,
+			lookupErr:   mongo.ErrNoDocuments,
+			wantSave:    true,
+			wantHistory: true,
+			wantInfo:    domain.DeviceInfo{Manufacturer: "Google", Model: "Pixel 7", OSVersion: "14", Battery: &domain.BatteryStatus{Level: 55}},
+		},
+		{name: "invalid registration", payload: `{"version":1,"battery":{"level":-1}}`},
+		{name: "known device", existing: &domain.Device{DeviceID: "dev-1", DeviceStatus: domain.DeviceStatusInactive}, wantUpdate: true, wantHistory: true, wantFrom: domain.DeviceStatusInactive},
+		{name: "known active device", existing: &domain.Device{DeviceID: "dev-1", DeviceStatus: domain.DeviceStatusActive}, wantUpdate: true},
+		{name: "lookup fails", lookupErr: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+			mockHistory := mock_domain.NewMockDeviceStatusHistoryRepository(ctrl)
+			if tt.existing != nil || tt.lookupErr != nil {
+				mockDevices.EXPECT().GetByID(gomock.Any(), "dev-1").Return(tt.existing, tt.lookupErr)
+			}
+			check := func(device *domain.Device) {
+				if device.DeviceID != "dev-1" || device.DeviceName != "Pixel 7" || device.DeviceStatus != domain.DeviceStatusActive || device.LastSeen == nil {
+					t.Errorf("unexpected device %+v", device)
+				}
+				if !reflect.DeepEqual(device.DeviceInfo, tt.wantInfo) {
+					t.Errorf("expected device info %+v, got %+v", tt.wantInfo, device.DeviceInfo)
+				}
+			}
+			payload := tt.payload
+			if payload == "" {
+				payload = "Pixel 7"
+			}
+			if tt.wantSave {
+				mockDevices.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, device *domain.Device) error {
+					check(device)
+					return nil
+				})
+			}
+			if tt.wantUpdate {
+				mockDevices.EXPECT().Update(gomock.Any(), "dev-1", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, device *domain.Device) error {
+					check(device)
+					return nil
+				})
+			}
+			if tt.wantHistory {
+				mockHistory.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, change *domain.DeviceStatusChange) error {
+					if change.From != tt.wantFrom || change.To != domain.DeviceStatusActive || change.Reason != domain.DeviceStatusRegistered {
+						t.Errorf("unexpected status change %+v", change)
+					}
+					return nil
+				})
+			}
+			rec := &recorder{}
+
+			b := broker.NewBrokerHandler(mock_domain.NewMockPhotoRepository(ctrl), mockDevices, mockHistory, mock_domain.NewMockTelemetryRepository(ctrl), nil, rec.photoEvents(), nil, rec, rec, broker.PipelineConfig{Workers: 1})
+			defer b.Close()
+			b.RegisterDevice(nil, message{topic: "register/dev-1", payload: []byte(payload)})
+
+			registered := tt.wantSave || tt.wantUpdate
+			if registered != (len(rec.webhooks) == 1) {
+				t.Fatalf("expected registered=%v, got webhooks %v", registered, rec.webhooks)
+			}
+			if registered {
+				data := rec.webhooks[0].Data.(domain.DeviceEventData)
+				if rec.webhooks[0].Type != domain.WebhookDeviceRegistered || data.DeviceName != "Pixel 7" {
+					t.Errorf("unexpected webhook event %+v", rec.webhooks[0])
+				}
+			}
+		})
+	}
+}
+
+func TestBrokerHandler_DisconnectDevice(t *testing.T) {
+	active := &domain.Device{DeviceID: "dev-1", DeviceName: "Pixel", DeviceStatus: domain.DeviceStatusActive}
+	inactive := &domain.Device{DeviceID: "dev-1", DeviceName: "Pixel", DeviceStatus: domain.DeviceStatusInactive}
+	tests := []struct {
+		name       string
+		msg        message
+		touch      bool // a live message from the device updates last seen
+		device     *domain.Device
+		setStatus  []string
+		changed    bool
+		wantReason domain.DeviceStatusReason
+		wantEvent  bool
 	}{
-		// TODO: Add test cases.
+		{
+			name:       "graceful offline",
+			msg:        message{topic: "status/dev-1", payload: []byte(`{"status":"offline","reason":"disconnected"}`), retained: true},
+			device:     active,
+			setStatus:  []string{domain.DeviceStatusActive, domain.DeviceStatusInactive},
+			changed:    true,
+			wantReason: domain.DeviceStatusDisconnected,
+			wantEvent:  true,
+		},
+		{
+			name:       "will after lost connection",
+			msg:        message{topic: "status/dev-1", payload: []byte(`{"status":"offline","reason":"connection_lost"}`)},
+			device:     active,
+			setStatus:  []string{domain.DeviceStatusActive, domain.DeviceStatusInactive},
+			changed:    true,
+			wantReason: domain.DeviceStatusConnectionLost,
+			wantEvent:  true,
+		},
+		{
+			name:       "legacy disconnect",
+			msg:        message{topic: "device/id/dev-1", payload: []byte("Device Disconnected")},
+			touch:      true,
+			device:     active,
+			setStatus:  []string{domain.DeviceStatusActive, domain.DeviceStatusInactive},
+			changed:    true,
+			wantReason: domain.DeviceStatusDisconnected,
+			wantEvent:  true,
+		},
+		{
+			name:      "timed out meanwhile",
+			msg:       message{topic: "status/dev-1", payload: []byte(`{"status":"offline"}`)},
+			touch:     true,
+			device:    active,
+			setStatus: []string{domain.DeviceStatusActive, domain.DeviceStatusInactive},
+		},
+		{
+			name:   "already inactive",
+			msg:    message{topic: "status/dev-1", payload: []byte(`{"status":"offline"}`)},
+			touch:  true,
+			device: inactive,
+		},
+		{
+			name:       "online again",
+			msg:        message{topic: "status/dev-1", payload: []byte(`{"status":"online"}`), retained: true},
+			touch:      true,
+			device:     inactive,
+			setStatus:  []string{domain.DeviceStatusInactive, domain.DeviceStatusActive},
+			changed:    true,
+			wantReason: domain.DeviceStatusConnected,
+		},
+		{name: "unexpected payload", msg: message{topic: "status/dev-1", payload: []byte("bye")}},
 	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			b := broker.NewBrokerHandler(tt.db, tt.ocrClient)
-			b.RegisterDevice(nil, tt.msg)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+			mockHistory := mock_domain.NewMockDeviceStatusHistoryRepository(ctrl)
+			if tt.device != nil {
+				device := *tt.device
+				if tt.touch {
+					mockDevices.EXPECT().Touch(gomock.Any(), "dev-1", gomock.Any(), false).Return(&device, nil)
+				} else {
+					mockDevices.EXPECT().GetByID(gomock.Any(), "dev-1").Return(&device, nil)
+				}
+			}
+			if tt.setStatus != nil {
+				mockDevices.EXPECT().SetStatus(gomock.Any(), "dev-1", tt.setStatus[0], tt.setStatus[1]).Return(tt.changed, nil)
+			}
+			if tt.wantReason != "" {
+				mockHistory.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, change *domain.DeviceStatusChange) error {
+					if change.Reason != tt.wantReason || change.To != tt.setStatus[1] {
+						t.Errorf("unexpected status change %+v", change)
+					}
+					return nil
+				})
+			}
+			rec := &recorder{}
+
+			b := broker.NewBrokerHandler(mock_domain.NewMockPhotoRepository(ctrl), mockDevices, mockHistory, mock_domain.NewMockTelemetryRepository(ctrl), nil, rec.photoEvents(), nil, rec, rec, broker.PipelineConfig{Workers: 1})
+			defer b.Close()
+			b.DisconnectDevice(nil, tt.msg)
+
+			if tt.wantEvent != (len(rec.webhooks) == 1) {
+				t.Fatalf("expected disconnect webhook=%v, got %v", tt.wantEvent, rec.webhooks)
+			}
+			if tt.wantEvent && rec.webhooks[0].Data.(domain.DeviceEventData).DeviceStatus != domain.DeviceStatusInactive {
+				t.Errorf("unexpected webhook event %+v", rec.webhooks[0])
+			}
+		})
+	}
+}
+
+func TestBrokerHandler_HandleHeartbeat(t *testing.T) {
+	tests := []struct {
+		name        string
+		device      *domain.Device
+		touchErr    error
+		wantRevived bool
+	}{
+		{name: "active device", device: &domain.Device{DeviceID: "dev-1", DeviceStatus: domain.DeviceStatusActive}},
+		{name: "inactive device comes back", device: &domain.Device{DeviceID: "dev-1", DeviceStatus: domain.DeviceStatusInactive}, wantRevived: true},
+		{name: "unknown device", touchErr: mongo.ErrNoDocuments},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+			mockHistory := mock_domain.NewMockDeviceStatusHistoryRepository(ctrl)
+			mockDevices.EXPECT().Touch(gomock.Any(), "dev-1", gomock.Any(), false).Return(tt.device, tt.touchErr)
+			if tt.wantRevived {
+				mockDevices.EXPECT().SetStatus(gomock.Any(), "dev-1", domain.DeviceStatusInactive, domain.DeviceStatusActive).Return(true, nil)
+				mockHistory.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, change *domain.DeviceStatusChange) error {
+					if change.From != domain.DeviceStatusInactive || change.To != domain.DeviceStatusActive || change.Reason != domain.DeviceStatusSeen {
+						t.Errorf("unexpected status change %+v", change)
+					}
+					return nil
+				})
+			}
+			rec := &recorder{}
+
+			b := broker.NewBrokerHandler(mock_domain.NewMockPhotoRepository(ctrl), mockDevices, mockHistory, mock_domain.NewMockTelemetryRepository(ctrl), nil, rec.photoEvents(), nil, rec, rec, broker.PipelineConfig{Workers: 1})
+			defer b.Close()
+			b.HandleHeartbeat(nil, message{topic: "heartbeat/dev-1"})
+		})
+	}
+}
+
+func TestBrokerHandler_HandleTelemetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		touchErr error
+		wantSave map[domain.TelemetryMetric]float64
+	}{
+		{
+			name:     "readings are stored",
+			payload:  `{"timestamp":"2024-05-01T12:00:00Z","battery_level":80,"signal_strength":-67}`,
+			wantSave: map[domain.TelemetryMetric]float64{domain.MetricBatteryLevel: 80, domain.MetricSignalStrength: -67},
+		},
+		{name: "unknown device", payload: `{"battery_level":80}`, touchErr: mongo.ErrNoDocuments},
+		{name: "invalid report", payload: `{"battery_level":180}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+			mockTelemetry := mock_domain.NewMockTelemetryRepository(ctrl)
+			if tt.wantSave != nil || tt.touchErr != nil {
+				mockDevices.EXPECT().Touch(gomock.Any(), "dev-1", gomock.Any(), false).Return(&domain.Device{DeviceID: "dev-1", DeviceStatus: domain.DeviceStatusActive}, tt.touchErr)
+			}
+			if tt.wantSave != nil {
+				mockTelemetry.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sample *domain.TelemetrySample) error {
+					if sample.DeviceID != "dev-1" || !reflect.DeepEqual(sample.Values, tt.wantSave) || sample.Timestamp.Year() != 2024 {
+						t.Errorf("unexpected sample %+v", sample)
+					}
+					return nil
+				})
+			}
+			rec := &recorder{}
+
+			b := broker.NewBrokerHandler(mock_domain.NewMockPhotoRepository(ctrl), mockDevices, mock_domain.NewMockDeviceStatusHistoryRepository(ctrl), mockTelemetry, nil, rec.photoEvents(), nil, rec, rec, broker.PipelineConfig{Workers: 1})
+			defer b.Close()
+			b.HandleTelemetry(nil, message{topic: "telemetry/dev-1", payload: []byte(tt.payload)})
 		})
 	}
 }
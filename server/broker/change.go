@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"image"
+	"sync"
+
+	"mqtt-streaming-server/imaging"
+)
+
+// changeDetector remembers the signature of the last committed changed frame
+// of every device. Frames are compared with that one rather than with the
+// frame right before them, so slow changes add up until they cross the
+// threshold. The pipeline hands all frames of a device to the same worker, so
+// they are checked in the order they arrived.
+type changeDetector struct {
+	mu       sync.Mutex
+	previous map[string]imaging.Signature
+}
+
+func newChangeDetector() *changeDetector {
+	return &changeDetector{previous: make(map[string]imaging.Signature)}
+}
+
+// check scores img against the device's reference frame and reports whether it
+// reaches the threshold, with the frame's signature. The score is nil while the
+// device has no reference frame. The reference only moves on accept.
+func (d *changeDetector) check(deviceID string, img image.Image, threshold float64) (imaging.Signature, *float64, bool) {
+	sig := imaging.NewSignature(img)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	previous, ok := d.previous[deviceID]
+	if !ok {
+		return sig, nil, true
+	}
+	score := imaging.ChangeScore(previous, sig)
+	return sig, &score, score >= threshold
+}
+
+// accept makes the signature the device's reference frame, once the changed
+// frame it belongs to is committed.
+func (d *changeDetector) accept(deviceID string, sig imaging.Signature) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.previous[deviceID] = sig
+}
@@ -0,0 +1,42 @@
+package broker
+
+import (
+	"fmt"
+	"image"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/imaging"
+)
+
+// derivative is a downscaled JPEG copy of a photo.
+type derivative struct {
+	size domain.PhotoSize
+	key  string
+	data []byte
+}
+
+// makeDerivatives scales the decoded photo down to the preview and then the
+// thumbnail size, each step starting from the previous result.
+func makeDerivatives(cfg PipelineConfig, originalKey string, img image.Image) ([]derivative, error) {
+	steps := []struct {
+		size    domain.PhotoSize
+		maxEdge int
+	}{
+		{domain.PhotoSizePreview, cfg.PreviewSize},
+		{domain.PhotoSizeThumb, cfg.ThumbnailSize},
+	}
+	derivatives := make([]derivative, 0, len(steps))
+	for _, step := range steps {
+		img = imaging.Fit(img, step.maxEdge)
+		data, err := imaging.EncodeJPEG(img, cfg.DerivativeQuality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", step.size, err)
+		}
+		derivatives = append(derivatives, derivative{
+			size: step.size,
+			key:  domain.DerivativeStorageKey(originalKey, step.size),
+			data: data,
+		})
+	}
+	return derivatives, nil
+}
@@ -0,0 +1,251 @@
+package broker
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/imaging"
+	"mqtt-streaming-server/ocr"
+)
+
+// QueuePolicy decides what happens to an incoming photo when the ingestion queue is full.
+type QueuePolicy string
+
+const (
+	// DropOldest evicts the photo that has waited the longest to make room for the new one.
+	DropOldest QueuePolicy = "drop-oldest"
+	// DropNewest discards the incoming photo.
+	DropNewest QueuePolicy = "drop-newest"
+	// Block makes the MQTT callback wait until a worker frees a slot.
+	Block QueuePolicy = "block"
+)
+
+// PipelineConfig configures the photo ingestion pipeline.
+type PipelineConfig struct {
+	// Workers process photos in parallel, each the photos of its own share
+	// of the devices, so the photos of a device are processed in order.
+	Workers int
+	// QueueSize is how many photos may wait, split evenly across the workers.
+	QueueSize int
+	Policy    QueuePolicy
+
+	// Per-stage timeouts.
+	LookupTimeout time.Duration
+	OCRTimeout    time.Duration
+	SaveTimeout   time.Duration
+	UploadTimeout time.Duration
+
+	// UploadRetries is how many more times a failed upload is attempted, with exponential backoff.
+	UploadRetries int
+
+	// ThumbnailSize and PreviewSize are the longest edge, in pixels, of the
+	// JPEG derivatives generated for every photo.
+	ThumbnailSize int
+	PreviewSize   int
+	// DerivativeQuality is the JPEG quality of the derivatives.
+	DerivativeQuality int
+
+	// ChangeDetection applies to devices without their own settings.
+	ChangeDetection domain.ChangeDetection
+
+	// Preprocessing applies to devices without their own settings.
+	Preprocessing domain.Preprocessing
+
+	// OCR applies to devices without their own OCR settings.
+	OCR domain.OCRSettings
+
+	// NewTextExtractor builds the OCR engine owned by a single worker.
+	NewTextExtractor func() domain.TextExtractor
+}
+
+func DefaultPipelineConfig() PipelineConfig {
+	return PipelineConfig{
+		Workers:       4,
+		QueueSize:     64,
+		Policy:        DropOldest,
+		LookupTimeout: 5 * time.Second,
+		OCRTimeout:    30 * time.Second,
+		SaveTimeout:   10 * time.Second,
+		UploadTimeout: 30 * time.Second,
+		UploadRetries: 3,
+
+		ThumbnailSize:     160,
+		PreviewSize:       800,
+		DerivativeQuality: imaging.DefaultJPEGQuality,
+
+		ChangeDetection: domain.ChangeDetection{Threshold: 0, Action: domain.ChangeActionFlag},
+
+		// Without an engine configured photos are stored without text
+		NewTextExtractor: func() domain.TextExtractor { return &ocr.Fake{} },
+	}
+}
+
+func (cfg PipelineConfig) withDefaults() PipelineConfig {
+	def := DefaultPipelineConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+	switch cfg.Policy {
+	case DropOldest, DropNewest, Block:
+	default:
+		cfg.Policy = def.Policy
+	}
+	if cfg.LookupTimeout <= 0 {
+		cfg.LookupTimeout = def.LookupTimeout
+	}
+	if cfg.OCRTimeout <= 0 {
+		cfg.OCRTimeout = def.OCRTimeout
+	}
+	if cfg.SaveTimeout <= 0 {
+		cfg.SaveTimeout = def.SaveTimeout
+	}
+	if cfg.UploadTimeout <= 0 {
+		cfg.UploadTimeout = def.UploadTimeout
+	}
+	if cfg.UploadRetries < 0 {
+		cfg.UploadRetries = 0
+	}
+	if cfg.ThumbnailSize <= 0 {
+		cfg.ThumbnailSize = def.ThumbnailSize
+	}
+	if cfg.PreviewSize <= 0 {
+		cfg.PreviewSize = def.PreviewSize
+	}
+	if cfg.DerivativeQuality <= 0 || cfg.DerivativeQuality > 100 {
+		cfg.DerivativeQuality = def.DerivativeQuality
+	}
+	if cfg.ChangeDetection.Validate() != nil {
+		cfg.ChangeDetection = def.ChangeDetection
+	}
+	if cfg.Preprocessing.Validate() != nil {
+		cfg.Preprocessing = def.Preprocessing
+	}
+	if cfg.OCR.Validate() != nil {
+		cfg.OCR = def.OCR
+	}
+	if cfg.NewTextExtractor == nil {
+		cfg.NewTextExtractor = def.NewTextExtractor
+	}
+	return cfg
+}
+
+// photoJob is a photo received over MQTT waiting to be processed.
+type photoJob struct {
+	deviceID   string
+	body       []byte
+	receivedAt time.Time
+}
+
+// photoWorker owns the resources that cannot be shared between goroutines.
+type photoWorker struct {
+	id  int
+	ocr domain.TextExtractor
+}
+
+type photoPipeline struct {
+	cfg PipelineConfig
+	// queues holds one queue per worker; a device's photos always go to the same one.
+	queues []chan photoJob
+
+	// mu guards closed; enqueue holds it for reading so close cannot close a queue under a sender.
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newPhotoPipeline(cfg PipelineConfig) *photoPipeline {
+	cfg = cfg.withDefaults()
+	queueSize := max(1, (cfg.QueueSize+cfg.Workers-1)/cfg.Workers)
+	queues := make([]chan photoJob, cfg.Workers)
+	for i := range queues {
+		queues[i] = make(chan photoJob, queueSize)
+	}
+	return &photoPipeline{
+		cfg:    cfg,
+		queues: queues,
+	}
+}
+
+// start launches the workers; process is called once per dequeued job.
+func (p *photoPipeline) start(process func(w *photoWorker, job photoJob)) {
+	for i, queue := range p.queues {
+		w := &photoWorker{
+			id:  i,
+			ocr: p.cfg.NewTextExtractor(),
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer w.ocr.Close()
+			for job := range queue {
+				process(w, job)
+			}
+		}()
+	}
+}
+
+// queue returns the queue of the worker the device's photos go to.
+func (p *photoPipeline) queue(deviceID string) chan photoJob {
+	hash := fnv.New32a()
+	hash.Write([]byte(deviceID))
+	return p.queues[hash.Sum32()%uint32(len(p.queues))]
+}
+
+// enqueue hands a job to its worker according to the configured QueuePolicy.
+// It reports whether the job was accepted.
+func (p *photoPipeline) enqueue(job photoJob) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	queue := p.queue(job.deviceID)
+	switch p.cfg.Policy {
+	case Block:
+		queue <- job
+		return true
+	case DropNewest:
+		select {
+		case queue <- job:
+			return true
+		default:
+			fmt.Printf("Ingestion queue full, dropping photo from device %s\n", job.deviceID)
+			return false
+		}
+	default: // DropOldest
+		for {
+			select {
+			case queue <- job:
+				return true
+			default:
+			}
+			select {
+			case old := <-queue:
+				fmt.Printf("Ingestion queue full, dropping oldest photo from device %s\n", old.deviceID)
+			default:
+			}
+		}
+	}
+}
+
+// close stops accepting jobs and waits for the workers to drain the queues.
+func (p *photoPipeline) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
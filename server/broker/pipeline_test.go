@@ -0,0 +1,155 @@
+package broker_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/broker"
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/events"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/storage"
+)
+
+func TestBrokerHandler_QueuePolicies(t *testing.T) {
+	tests := []struct {
+		policy        broker.QueuePolicy
+		wantProcessed []string
+	}{
+		{policy: broker.DropOldest, wantProcessed: []string{"dev-1", "dev-3"}},
+		{policy: broker.DropNewest, wantProcessed: []string{"dev-1", "dev-2"}},
+		{policy: broker.Block, wantProcessed: []string{"dev-1", "dev-2", "dev-3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+			started := make(chan struct{})
+			release := make(chan struct{})
+			var mu sync.Mutex
+			var processed []string
+			// The first photo holds the only worker until released; the
+			// lookups fail so processing stops there
+			mockDevices.EXPECT().Touch(gomock.Any(), gomock.Any(), gomock.Any(), true).DoAndReturn(func(_ context.Context, id string, _ time.Time, _ bool) (*domain.Device, error) {
+				mu.Lock()
+				processed = append(processed, id)
+				first := len(processed) == 1
+				mu.Unlock()
+				if first {
+					close(started)
+					<-release
+				}
+				return nil, mongo.ErrNoDocuments
+			}).AnyTimes()
+
+			rec := &recorder{}
+			b := broker.NewBrokerHandler(mock_domain.NewMockPhotoRepository(ctrl), mockDevices, mock_domain.NewMockDeviceStatusHistoryRepository(ctrl), mock_domain.NewMockTelemetryRepository(ctrl), storage.NewMemoryStore(nil), rec.photoEvents(), events.NewFrameStore(4, 1), rec, rec, broker.PipelineConfig{
+				Workers:   1,
+				QueueSize: 1,
+				Policy:    tt.policy,
+			})
+			b.HandlePhoto(nil, message{topic: "photos/dev-1", payload: jpegImage(t)})
+			<-started
+			b.HandlePhoto(nil, message{topic: "photos/dev-2", payload: jpegImage(t)})
+
+			// The queue is full now
+			payload := jpegImage(t)
+			done := make(chan struct{})
+			go func() {
+				b.HandlePhoto(nil, message{topic: "photos/dev-3", payload: payload})
+				close(done)
+			}()
+			if tt.policy == broker.Block {
+				select {
+				case <-done:
+					t.Error("expected the photo to wait for a free slot")
+				case <-time.After(50 * time.Millisecond):
+				}
+			} else {
+				<-done
+			}
+			close(release)
+			<-done
+			b.Close()
+
+			if !reflect.DeepEqual(processed, tt.wantProcessed) {
+				t.Errorf("expected %v processed, got %v", tt.wantProcessed, processed)
+			}
+		})
+	}
+}
+
+func TestBrokerHandler_StageTimeouts(t *testing.T) {
+	waitForDeadline := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	device := &domain.Device{DeviceID: "dev-1", DeviceName: "Pixel", DeviceStatus: domain.DeviceStatusActive}
+
+	tests := []struct {
+		name  string
+		cfg   broker.PipelineConfig
+		setup func(*mock_domain.MockPhotoRepository, *mock_domain.MockDeviceRepository)
+	}{
+		{
+			name: "lookup",
+			cfg:  broker.PipelineConfig{Workers: 1, LookupTimeout: 10 * time.Millisecond},
+			setup: func(_ *mock_domain.MockPhotoRepository, devices *mock_domain.MockDeviceRepository) {
+				devices.EXPECT().Touch(gomock.Any(), "dev-1", gomock.Any(), true).DoAndReturn(func(ctx context.Context, _ string, _ time.Time, _ bool) (*domain.Device, error) {
+					return nil, waitForDeadline(ctx)
+				})
+			},
+		},
+		{
+			name: "save",
+			cfg:  broker.PipelineConfig{Workers: 1, SaveTimeout: 10 * time.Millisecond},
+			setup: func(photos *mock_domain.MockPhotoRepository, devices *mock_domain.MockDeviceRepository) {
+				devices.EXPECT().Touch(gomock.Any(), "dev-1", gomock.Any(), true).Return(device, nil)
+				photos.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ *domain.Photo) error {
+					return waitForDeadline(ctx)
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockPhotos := mock_domain.NewMockPhotoRepository(ctrl)
+			mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+			tt.setup(mockPhotos, mockDevices)
+
+			rec := &recorder{}
+			b := broker.NewBrokerHandler(mockPhotos, mockDevices, mock_domain.NewMockDeviceStatusHistoryRepository(ctrl), mock_domain.NewMockTelemetryRepository(ctrl), storage.NewMemoryStore(nil), rec.photoEvents(), events.NewFrameStore(4, 1), rec, rec, tt.cfg)
+
+			payload := jpegImage(t)
+			finished := make(chan struct{})
+			go func() {
+				b.HandlePhoto(nil, message{topic: "photos/dev-1", payload: payload})
+				b.Close()
+				close(finished)
+			}()
+			select {
+			case <-finished:
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the stage to time out")
+			}
+
+			// A timed out stage fails the job before the photo is committed
+			if len(rec.photos) != 0 || len(rec.alerts) != 0 || len(rec.webhooks) != 0 {
+				t.Errorf("expected nothing published, got %d photo events, %d alert evaluations and %d webhooks", len(rec.photos), len(rec.alerts), len(rec.webhooks))
+			}
+		})
+	}
+}
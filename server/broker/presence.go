@@ -0,0 +1,93 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mqtt-streaming-server/domain"
+)
+
+type PresenceConfig struct {
+	// Interval between two sweeps.
+	Interval time.Duration
+	// Timeout is how long an active device may stay silent before it is
+	// marked inactive. It should span a few heartbeats, so a single lost
+	// message does not take a device offline.
+	Timeout time.Duration
+}
+
+// PresenceSweeper marks devices inactive once they stop publishing, which is
+// how devices that crash or lose their network go offline: they never get to
+// announce their disconnection.
+type PresenceSweeper struct {
+	deviceRepository domain.DeviceRepository
+	statusHistory    domain.DeviceStatusHistoryRepository
+	webhooks         domain.WebhookPublisher
+	cfg              PresenceConfig
+}
+
+func NewPresenceSweeper(deviceRepository domain.DeviceRepository, statusHistory domain.DeviceStatusHistoryRepository, webhooks domain.WebhookPublisher, cfg PresenceConfig) *PresenceSweeper {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 3 * time.Minute
+	}
+	return &PresenceSweeper{
+		deviceRepository: deviceRepository,
+		statusHistory:    statusHistory,
+		webhooks:         webhooks,
+		cfg:              cfg,
+	}
+}
+
+// Run sweeps every Interval until ctx is cancelled.
+func (s *PresenceSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.SweepOnce(ctx); err != nil {
+			fmt.Printf("Device presence sweep failed: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *PresenceSweeper) SweepOnce(ctx context.Context) error {
+	now := time.Now().UTC()
+	before := now.Add(-s.cfg.Timeout)
+	silent, err := s.deviceRepository.GetSilent(ctx, before)
+	if err != nil {
+		return fmt.Errorf("failed to fetch silent devices: %w", err)
+	}
+	for _, device := range silent {
+		// The device may have disconnected or checked in since the query
+		changed, err := s.deviceRepository.MarkSilentInactive(ctx, device.DeviceID, before)
+		if err != nil {
+			fmt.Printf("Failed to mark device %s inactive: %v\n", device.DeviceID, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		device.DeviceStatus = domain.DeviceStatusInactive
+		fmt.Printf("Device timed out: %s\n", device.DeviceID)
+		recordStatus(ctx, s.statusHistory, device.DeviceID, domain.DeviceStatusActive, domain.DeviceStatusInactive, domain.DeviceStatusTimeout, now)
+		s.webhooks.Publish(domain.NewDeviceEvent(domain.WebhookDeviceDisconnected, device))
+	}
+	return nil
+}
+
+// recordStatus appends a transition to the device's status history. The
+// status itself is already changed, so a failure is only logged.
+func recordStatus(ctx context.Context, history domain.DeviceStatusHistoryRepository, deviceID, from, to string, reason domain.DeviceStatusReason, at time.Time) {
+	change := &domain.DeviceStatusChange{DeviceID: deviceID, From: from, To: to, Reason: reason, At: at}
+	if err := history.Save(ctx, change); err != nil {
+		fmt.Printf("Failed to record status change of device %s: %v\n", deviceID, err)
+	}
+}
@@ -0,0 +1,76 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/broker"
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+)
+
+func TestPresenceSweeper_SweepOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+	mockHistory := mock_domain.NewMockDeviceStatusHistoryRepository(ctrl)
+	start := time.Now().UTC()
+
+	silent := []*domain.Device{
+		{DeviceID: "dev-1", DeviceName: "Pixel", DeviceStatus: domain.DeviceStatusActive},
+		{DeviceID: "dev-2", DeviceName: "Galaxy", DeviceStatus: domain.DeviceStatusActive},
+	}
+	mockDevices.EXPECT().GetSilent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, before time.Time) ([]*domain.Device, error) {
+		if cutoff := start.Add(-2 * time.Minute); before.Before(cutoff) || before.After(cutoff.Add(time.Second)) {
+			t.Errorf("expected devices silent since %s, got %s", cutoff, before)
+		}
+		return silent, nil
+	})
+	var cutoff time.Time
+	mockDevices.EXPECT().MarkSilentInactive(gomock.Any(), "dev-1", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, before time.Time) (bool, error) {
+		cutoff = before
+		return true, nil
+	})
+	// dev-2 checked in or disconnected after the query
+	mockDevices.EXPECT().MarkSilentInactive(gomock.Any(), "dev-2", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, before time.Time) (bool, error) {
+		if !before.Equal(cutoff) {
+			t.Errorf("expected the query cutoff %s, got %s", cutoff, before)
+		}
+		return false, nil
+	})
+	mockHistory.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, change *domain.DeviceStatusChange) error {
+		want := domain.DeviceStatusChange{DeviceID: "dev-1", From: domain.DeviceStatusActive, To: domain.DeviceStatusInactive, Reason: domain.DeviceStatusTimeout, At: change.At}
+		if *change != want {
+			t.Errorf("expected status change %+v, got %+v", want, *change)
+		}
+		return nil
+	})
+	rec := &recorder{}
+
+	s := broker.NewPresenceSweeper(mockDevices, mockHistory, rec, broker.PresenceConfig{Timeout: 2 * time.Minute})
+	if err := s.SweepOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.webhooks) != 1 || rec.webhooks[0].Type != domain.WebhookDeviceDisconnected || rec.webhooks[0].DeviceID != "dev-1" {
+		t.Errorf("expected one device.disconnected webhook for dev-1, got %v", rec.webhooks)
+	}
+}
+
+func TestPresenceSweeper_SweepOnceRepositoryError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDevices := mock_domain.NewMockDeviceRepository(ctrl)
+	mockDevices.EXPECT().GetSilent(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection reset"))
+
+	s := broker.NewPresenceSweeper(mockDevices, mock_domain.NewMockDeviceStatusHistoryRepository(ctrl), &recorder{}, broker.PresenceConfig{})
+	if err := s.SweepOnce(context.Background()); err == nil {
+		t.Error("expected an error when the repository fails")
+	}
+}
@@ -0,0 +1,118 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mqtt-streaming-server/domain"
+)
+
+type ReconcilerConfig struct {
+	// Interval between two reconciliation passes.
+	Interval time.Duration
+	// PendingGracePeriod is how long a photo may stay pending before it is checked,
+	// so photos still being processed by a worker are left alone.
+	PendingGracePeriod time.Duration
+	// MaxPendingAge is how long a pending photo without a blob is kept before it is removed.
+	MaxPendingAge time.Duration
+}
+
+// Reconciler repairs photos left behind by interrupted ingestion: pending photos
+// whose upload did go through are committed and announced like any ingested
+// photo, and pending or failed photos that never got their blob are removed
+// together with any partial object.
+type Reconciler struct {
+	photoRepository domain.PhotoRepository
+	blobStore       domain.BlobStore
+	committed       committedPhotos
+	cfg             ReconcilerConfig
+}
+
+func NewReconciler(photoRepository domain.PhotoRepository, blobStore domain.BlobStore, photoEvents domain.PhotoPublisher, alerts domain.AlertEvaluator, webhooks domain.WebhookPublisher, cfg ReconcilerConfig) *Reconciler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.PendingGracePeriod <= 0 {
+		cfg.PendingGracePeriod = 5 * time.Minute
+	}
+	if cfg.MaxPendingAge < cfg.PendingGracePeriod {
+		cfg.MaxPendingAge = time.Hour
+	}
+	return &Reconciler{
+		photoRepository: photoRepository,
+		blobStore:       blobStore,
+		committed:       committedPhotos{photoEvents: photoEvents, alerts: alerts, webhooks: webhooks},
+		cfg:             cfg,
+	}
+}
+
+// Run reconciles every Interval until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := r.ReconcileOnce(ctx); err != nil {
+			fmt.Printf("Photo reconciliation failed: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reconciler) ReconcileOnce(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	pending, err := r.photoRepository.GetByStatus(ctx, domain.PhotoStatusPending, now.Add(-r.cfg.PendingGracePeriod))
+	if err != nil {
+		return fmt.Errorf("failed to fetch pending photos: %w", err)
+	}
+	for _, photo := range pending {
+		_, err := r.blobStore.Stat(ctx, photo.ObjectKey())
+		switch {
+		case err == nil:
+			// Uploaded, but the worker could not mark it committed
+			if err := r.photoRepository.UpdateStatus(ctx, photo.ID, domain.PhotoStatusCommitted); err != nil {
+				fmt.Printf("Failed to commit photo %s: %v\n", photo.ID.Hex(), err)
+				continue
+			}
+			fmt.Printf("Committed photo %s found in blob storage\n", photo.ID.Hex())
+			photo.Status = domain.PhotoStatusCommitted
+			r.committed.publish(photo)
+		case errors.Is(err, domain.ErrBlobNotFound):
+			if photo.Timestamp.Before(now.Add(-r.cfg.MaxPendingAge)) {
+				r.remove(ctx, photo)
+			}
+		default:
+			fmt.Printf("Failed to check blob for photo %s: %v\n", photo.ID.Hex(), err)
+		}
+	}
+
+	failed, err := r.photoRepository.GetByStatus(ctx, domain.PhotoStatusFailed, now)
+	if err != nil {
+		return fmt.Errorf("failed to fetch failed photos: %w", err)
+	}
+	for _, photo := range failed {
+		r.remove(ctx, photo)
+	}
+	return nil
+}
+
+// remove deletes the blob before the record, so a failed blob delete is retried on the next pass.
+func (r *Reconciler) remove(ctx context.Context, photo *domain.Photo) {
+	for _, key := range photo.BlobKeys() {
+		if err := r.blobStore.Delete(ctx, key); err != nil && !errors.Is(err, domain.ErrBlobNotFound) {
+			fmt.Printf("Failed to delete blob of photo %s: %v\n", photo.ID.Hex(), err)
+			return
+		}
+	}
+	if err := r.photoRepository.Delete(ctx, photo.ID); err != nil {
+		fmt.Printf("Failed to delete photo %s: %v\n", photo.ID.Hex(), err)
+		return
+	}
+	fmt.Printf("Removed orphaned photo %s\n", photo.ID.Hex())
+}
@@ -0,0 +1,124 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/broker"
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/storage"
+)
+
+func TestReconciler_ReconcileOnce(t *testing.T) {
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	recent := time.Now().UTC().Add(-10 * time.Minute)
+
+	tests := []struct {
+		name          string
+		pending       []*domain.Photo
+		failed        []*domain.Photo
+		storedKeys    []string
+		wantCommitted int
+		wantDeleted   int
+		wantBlobsLeft int
+	}{
+		{
+			name:          "uploaded pending photo is committed",
+			pending:       []*domain.Photo{{ID: primitive.NewObjectID(), Timestamp: recent, StorageKey: "photos/a.jpeg"}},
+			storedKeys:    []string{"photos/a.jpeg"},
+			wantCommitted: 1,
+			wantBlobsLeft: 1,
+		},
+		{
+			name:    "recent pending photo without blob is kept",
+			pending: []*domain.Photo{{ID: primitive.NewObjectID(), Timestamp: recent, StorageKey: "photos/b.jpeg"}},
+		},
+		{
+			name:        "stale pending photo without blob is removed",
+			pending:     []*domain.Photo{{ID: primitive.NewObjectID(), Timestamp: old, StorageKey: "photos/c.jpeg"}},
+			wantDeleted: 1,
+		},
+		{
+			name: "failed photo is removed with its derivatives",
+			failed: []*domain.Photo{{
+				ID: primitive.NewObjectID(), Timestamp: recent, StorageKey: "photos/e.jpeg",
+				ThumbnailKey: "photos/e_thumb.jpeg", PreviewKey: "photos/e_preview.jpeg",
+			}},
+			storedKeys:  []string{"photos/e_thumb.jpeg", "photos/e_preview.jpeg"},
+			wantDeleted: 1,
+		},
+		{
+			name:        "failed photo is removed with its partial blob",
+			failed:      []*domain.Photo{{ID: primitive.NewObjectID(), Timestamp: recent, StorageKey: "photos/d.jpeg"}},
+			storedKeys:  []string{"photos/d.jpeg"},
+			wantDeleted: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			store := storage.NewMemoryStore(nil)
+			for _, key := range tt.storedKeys {
+				store.Put(ctx, key, []byte("jpeg"), "image/jpeg")
+			}
+
+			mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+			mockRepo.EXPECT().GetByStatus(gomock.Any(), domain.PhotoStatusPending, gomock.Any()).Return(tt.pending, nil)
+			mockRepo.EXPECT().GetByStatus(gomock.Any(), domain.PhotoStatusFailed, gomock.Any()).Return(tt.failed, nil)
+			mockRepo.EXPECT().UpdateStatus(gomock.Any(), gomock.Any(), domain.PhotoStatusCommitted).Return(nil).Times(tt.wantCommitted)
+			mockRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil).Times(tt.wantDeleted)
+
+			rec := &recorder{}
+			r := broker.NewReconciler(mockRepo, store, rec.photoEvents(), rec, rec, broker.ReconcilerConfig{
+				PendingGracePeriod: 5 * time.Minute,
+				MaxPendingAge:      time.Hour,
+			})
+			if err := r.ReconcileOnce(ctx); err != nil {
+				t.Fatalf("ReconcileOnce failed: %v", err)
+			}
+
+			left := 0
+			for _, key := range tt.storedKeys {
+				if _, err := store.Stat(ctx, key); err == nil {
+					left++
+				}
+			}
+			if left != tt.wantBlobsLeft {
+				t.Errorf("expected %d blobs left, got %d", tt.wantBlobsLeft, left)
+			}
+			// Committed photos are announced like the ones the workers commit
+			if len(rec.photos) != tt.wantCommitted || len(rec.alerts) != tt.wantCommitted || len(rec.webhooks) != tt.wantCommitted {
+				t.Errorf("expected %d announced photos, got %d events, %d alert checks and %d webhooks", tt.wantCommitted, len(rec.photos), len(rec.alerts), len(rec.webhooks))
+			}
+			for _, event := range rec.webhooks {
+				if event.Type != domain.WebhookPhotoIngested {
+					t.Errorf("expected a photo.ingested webhook, got %s", event.Type)
+				}
+			}
+		})
+	}
+}
+
+func TestReconciler_ReconcileOnce_RepositoryError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+	mockRepo.EXPECT().GetByStatus(gomock.Any(), domain.PhotoStatusPending, gomock.Any()).Return(nil, errors.New("db error"))
+
+	rec := &recorder{}
+	r := broker.NewReconciler(mockRepo, storage.NewMemoryStore(nil), rec.photoEvents(), rec, rec, broker.ReconcilerConfig{})
+	if err := r.ReconcileOnce(context.Background()); err == nil {
+		t.Error("expected an error when the repository fails")
+	}
+}
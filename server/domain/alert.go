@@ -0,0 +1,271 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RuleCondition is what an alert rule watches for.
+type RuleCondition string
+
+const (
+	// RuleMotion fires on photos whose change score reaches the rule's minimum.
+	RuleMotion RuleCondition = "motion"
+	// RuleText fires on photos whose OCR text matches the rule's pattern.
+	RuleText RuleCondition = "text"
+)
+
+// SinkType names a notification channel.
+type SinkType string
+
+const (
+	SinkWebhook SinkType = "webhook"
+	SinkEmail   SinkType = "email"
+	SinkMQTT    SinkType = "mqtt"
+)
+
+type AlertRule struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name string             `json:"name" bson:"name"`
+	// DeviceIDs limits the rule to these devices; empty matches every device.
+	DeviceIDs []string      `json:"device_ids,omitempty" bson:"device_ids,omitempty"`
+	Condition RuleCondition `json:"condition" bson:"condition"`
+	// MinChangeScore is the change score a motion rule needs, from 0 to 1.
+	MinChangeScore float64 `json:"min_change_score,omitempty" bson:"min_change_score,omitempty"`
+	// Pattern is the regular expression a text rule matches, case-insensitively.
+	Pattern string `json:"pattern,omitempty" bson:"pattern,omitempty"`
+	// pattern is Pattern compiled by Compile.
+	pattern *regexp.Regexp
+	// Window restricts the rule to a time of day; nil means all day.
+	Window *TimeWindow `json:"window,omitempty" bson:"window,omitempty"`
+	// CooldownSeconds suppresses repeated firings for the same device.
+	CooldownSeconds int         `json:"cooldown_seconds" bson:"cooldown_seconds"`
+	Sinks           []AlertSink `json:"sinks" bson:"sinks"`
+	Enabled         bool        `json:"enabled" bson:"enabled"`
+	CreatedBy       string      `json:"created_by" bson:"created_by"`
+	CreatedAt       time.Time   `json:"created_at" bson:"created_at"`
+}
+
+// TimeWindow is a daily window such as 22:00 to 06:00. A window whose end is
+// before its start runs past midnight.
+type TimeWindow struct {
+	Start string `json:"start" bson:"start"`
+	End   string `json:"end" bson:"end"`
+	// Timezone is an IANA name like Europe/Bucharest; empty means UTC.
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+}
+
+// AlertSink is where a firing is sent. Only the fields of its type are used.
+type AlertSink struct {
+	Type SinkType `json:"type" bson:"type"`
+	// URL receives a JSON POST for webhook sinks.
+	URL string `json:"url,omitempty" bson:"url,omitempty"`
+	// To lists the recipients of email sinks.
+	To []string `json:"to,omitempty" bson:"to,omitempty"`
+	// Topic overrides alerts/<device> for MQTT sinks.
+	Topic string `json:"topic,omitempty" bson:"topic,omitempty"`
+}
+
+// Alert is one firing of a rule, kept as alert history.
+type Alert struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	RuleID     primitive.ObjectID `json:"rule_id" bson:"rule_id"`
+	RuleName   string             `json:"rule_name" bson:"rule_name"`
+	DeviceID   string             `json:"device_id" bson:"device_id"`
+	PhotoID    primitive.ObjectID `json:"photo_id" bson:"photo_id"`
+	Reason     string             `json:"reason" bson:"reason"`
+	FiredAt    time.Time          `json:"fired_at" bson:"fired_at"`
+	Deliveries []AlertDelivery    `json:"deliveries" bson:"deliveries"`
+}
+
+type AlertDelivery struct {
+	Sink   SinkType `json:"sink" bson:"sink"`
+	Target string   `json:"target" bson:"target"`
+	// Error is empty when the notification was delivered.
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// AlertQuery filters the alert history; zero values match everything.
+type AlertQuery struct {
+	RuleID   primitive.ObjectID
+	DeviceID string
+	Limit    int
+}
+
+// Validate rejects rules that could never fire or cannot be evaluated.
+func (r *AlertRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	switch r.Condition {
+	case RuleMotion:
+		if r.MinChangeScore < 0 || r.MinChangeScore > 1 {
+			return errors.New("min_change_score must be between 0 and 1")
+		}
+	case RuleText:
+		if r.Pattern == "" {
+			return errors.New("text rules need a pattern")
+		}
+		if err := r.Compile(); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	default:
+		return fmt.Errorf("invalid condition %q, expected motion or text", r.Condition)
+	}
+	if r.Window != nil {
+		if _, _, _, err := r.Window.parse(); err != nil {
+			return err
+		}
+	}
+	if r.CooldownSeconds < 0 {
+		return errors.New("cooldown_seconds must not be negative")
+	}
+	if len(r.Sinks) == 0 {
+		return errors.New("at least one sink is required")
+	}
+	for _, sink := range r.Sinks {
+		switch sink.Type {
+		case SinkWebhook:
+			if sink.URL == "" {
+				return errors.New("webhook sinks need a url")
+			}
+		case SinkEmail:
+			if len(sink.To) == 0 {
+				return errors.New("email sinks need at least one recipient")
+			}
+		case SinkMQTT:
+		default:
+			return fmt.Errorf("invalid sink type %q, expected webhook, email or mqtt", sink.Type)
+		}
+	}
+	return nil
+}
+
+// textPatterns caches compiled text rule patterns by their source. The
+// enabled rules are loaded again for every photo, so this keeps Match from
+// compiling the same pattern over and over.
+var textPatterns = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: make(map[string]*regexp.Regexp)}
+
+// maxTextPatterns bounds the cache; edited rules leave old patterns behind.
+const maxTextPatterns = 256
+
+// Compile prepares the pattern of a text rule for Match. The repository calls
+// it when rules are loaded and Validate when they are saved.
+func (r *AlertRule) Compile() error {
+	if r.Condition != RuleText {
+		return nil
+	}
+	textPatterns.Lock()
+	defer textPatterns.Unlock()
+	if pattern, ok := textPatterns.compiled[r.Pattern]; ok {
+		r.pattern = pattern
+		return nil
+	}
+	pattern, err := regexp.Compile("(?i)" + r.Pattern)
+	if err != nil {
+		return err
+	}
+	if len(textPatterns.compiled) >= maxTextPatterns {
+		clear(textPatterns.compiled)
+	}
+	textPatterns.compiled[r.Pattern] = pattern
+	r.pattern = pattern
+	return nil
+}
+
+// Match reports whether the photo triggers the rule, and why. Rules are
+// evaluated against the capture time of the photo, not the current time.
+func (r *AlertRule) Match(photo *Photo) (string, bool) {
+	if !r.Enabled {
+		return "", false
+	}
+	if len(r.DeviceIDs) > 0 && !slices.Contains(r.DeviceIDs, photo.DeviceID) {
+		return "", false
+	}
+	if r.Window != nil && !r.Window.Contains(photo.Timestamp) {
+		return "", false
+	}
+
+	switch r.Condition {
+	case RuleMotion:
+		if photo.ChangeScore == nil || photo.Unchanged || *photo.ChangeScore < r.MinChangeScore {
+			return "", false
+		}
+		return fmt.Sprintf("motion detected (change score %.3f)", *photo.ChangeScore), true
+	case RuleText:
+		if r.pattern == nil && r.Compile() != nil {
+			return "", false
+		}
+		match := r.pattern.FindString(photo.Text)
+		if match == "" {
+			return "", false
+		}
+		return fmt.Sprintf("text matched %q", match), true
+	}
+	return "", false
+}
+
+// Contains reports whether t falls inside the window.
+func (w TimeWindow) Contains(t time.Time) bool {
+	start, end, loc, err := w.parse()
+	if err != nil {
+		return false
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// parse returns the start and end as minutes after midnight and the location.
+func (w TimeWindow) parse() (int, int, *time.Location, error) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid window start %q, expected HH:MM", w.Start)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid window end %q, expected HH:MM", w.End)
+	}
+	loc := time.UTC
+	if w.Timezone != "" {
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid window timezone %q", w.Timezone)
+		}
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), loc, nil
+}
+
+// AlertEvaluator checks newly stored photos against the alert rules.
+type AlertEvaluator interface {
+	Evaluate(photo *Photo)
+}
+
+type AlertRuleRepository interface {
+	// Save inserts the rule and sets its ID.
+	Save(ctx context.Context, rule *AlertRule) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*AlertRule, error)
+	List(ctx context.Context) ([]*AlertRule, error)
+	GetEnabled(ctx context.Context) ([]*AlertRule, error)
+	Update(ctx context.Context, rule *AlertRule) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type AlertRepository interface {
+	// Save inserts the alert and sets its ID.
+	Save(ctx context.Context, alert *Alert) error
+	// List returns the alerts matching the query, most recent first.
+	List(ctx context.Context, query AlertQuery) ([]*Alert, error)
+}
@@ -0,0 +1,94 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"mqtt-streaming-server/domain"
+)
+
+func score(v float64) *float64 { return &v }
+
+func TestAlertRule_Match(t *testing.T) {
+	night := time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC)
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	motionAtNight := domain.AlertRule{
+		Condition:      domain.RuleMotion,
+		MinChangeScore: 0.05,
+		Window:         &domain.TimeWindow{Start: "22:00", End: "06:00"},
+		Enabled:        true,
+	}
+
+	tests := []struct {
+		name  string
+		rule  domain.AlertRule
+		photo domain.Photo
+		want  bool
+	}{
+		{name: "motion inside window", rule: motionAtNight, photo: domain.Photo{Timestamp: night, ChangeScore: score(0.2)}, want: true},
+		{name: "motion after midnight", rule: motionAtNight, photo: domain.Photo{Timestamp: night.Add(3 * time.Hour), ChangeScore: score(0.2)}, want: true},
+		{name: "motion outside window", rule: motionAtNight, photo: domain.Photo{Timestamp: day, ChangeScore: score(0.2)}},
+		{name: "change below minimum", rule: motionAtNight, photo: domain.Photo{Timestamp: night, ChangeScore: score(0.01)}},
+		{name: "first frame has no score", rule: motionAtNight, photo: domain.Photo{Timestamp: night}},
+		{
+			name:  "window in device time zone",
+			rule:  domain.AlertRule{Condition: domain.RuleMotion, Enabled: true, Window: &domain.TimeWindow{Start: "22:00", End: "23:00", Timezone: "Europe/Bucharest"}},
+			photo: domain.Photo{Timestamp: time.Date(2024, 5, 1, 19, 30, 0, 0, time.UTC), ChangeScore: score(1)},
+			want:  true,
+		},
+		{
+			name:  "text pattern ignores case",
+			rule:  domain.AlertRule{Condition: domain.RuleText, Pattern: "ALARM", Enabled: true},
+			photo: domain.Photo{Text: "fire alarm active"},
+			want:  true,
+		},
+		{
+			name:  "invalid pattern never matches",
+			rule:  domain.AlertRule{Condition: domain.RuleText, Pattern: "ALARM(", Enabled: true},
+			photo: domain.Photo{Text: "ALARM("},
+		},
+		{
+			name:  "other device",
+			rule:  domain.AlertRule{Condition: domain.RuleText, Pattern: "ALARM", DeviceIDs: []string{"dev-1"}, Enabled: true},
+			photo: domain.Photo{DeviceID: "dev-2", Text: "ALARM"},
+		},
+		{
+			name:  "disabled rule",
+			rule:  domain.AlertRule{Condition: domain.RuleText, Pattern: "ALARM"},
+			photo: domain.Photo{Text: "ALARM"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := tt.rule.Match(&tt.photo); got != tt.want {
+				t.Errorf("expected match=%v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAlertRule_Validate(t *testing.T) {
+	webhook := []domain.AlertSink{{Type: domain.SinkWebhook, URL: "https://example.com/hook"}}
+
+	tests := []struct {
+		name    string
+		rule    domain.AlertRule
+		wantErr bool
+	}{
+		{name: "valid text rule", rule: domain.AlertRule{Name: "alarm", Condition: domain.RuleText, Pattern: "ALARM", Sinks: webhook}},
+		{name: "bad pattern", rule: domain.AlertRule{Name: "alarm", Condition: domain.RuleText, Pattern: "(", Sinks: webhook}, wantErr: true},
+		{name: "bad window", rule: domain.AlertRule{Name: "night", Condition: domain.RuleMotion, Window: &domain.TimeWindow{Start: "10pm", End: "06:00"}, Sinks: webhook}, wantErr: true},
+		{name: "unknown time zone", rule: domain.AlertRule{Name: "night", Condition: domain.RuleMotion, Window: &domain.TimeWindow{Start: "22:00", End: "06:00", Timezone: "Mars/Olympus"}, Sinks: webhook}, wantErr: true},
+		{name: "no sinks", rule: domain.AlertRule{Name: "night", Condition: domain.RuleMotion}, wantErr: true},
+		{name: "email without recipients", rule: domain.AlertRule{Name: "night", Condition: domain.RuleMotion, Sinks: []domain.AlertSink{{Type: domain.SinkEmail}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
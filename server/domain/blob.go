@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrBlobNotFound is returned by a BlobStore when the requested key does not exist.
+var ErrBlobNotFound = errors.New("blob not found")
+
+type BlobInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the blob contents; the caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that grants temporary read access to the blob.
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+}
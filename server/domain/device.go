@@ -1,12 +1,151 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
 
 type Device struct {
 	ID           string `json:"id" bson:"_id,omitempty"`
 	DeviceID     string `json:"device_id" bson:"device_id"`
 	DeviceName   string `json:"device_name" bson:"device_name"`
 	DeviceStatus string `json:"device_status" bson:"device_status"`
+	// DeviceInfo is what the device reported about itself when it registered.
+	DeviceInfo `bson:",inline"`
+	// LastSeen is when the device last published any message.
+	LastSeen *time.Time `json:"last_seen,omitempty" bson:"last_seen,omitempty"`
+	// LastPhotoAt is when the device last published a photo.
+	LastPhotoAt *time.Time `json:"last_photo_at,omitempty" bson:"last_photo_at,omitempty"`
+	// ChangeDetection overrides the server defaults for this device when set.
+	ChangeDetection *ChangeDetection `json:"change_detection,omitempty" bson:"change_detection,omitempty"`
+	// Preprocessing overrides the server's preprocessing steps for this device when set.
+	Preprocessing *Preprocessing `json:"preprocessing,omitempty" bson:"preprocessing,omitempty"`
+	// OCR overrides the server's OCR settings for this device when set.
+	OCR *OCRSettings `json:"ocr,omitempty" bson:"ocr,omitempty"`
+}
+
+// ChangeAction decides what happens to a frame that barely differs from the
+// device's previous one.
+type ChangeAction string
+
+const (
+	// ChangeActionDrop discards the frame before OCR and storage.
+	ChangeActionDrop ChangeAction = "drop"
+	// ChangeActionFlag stores the frame marked as unchanged.
+	ChangeActionFlag ChangeAction = "flag"
+)
+
+type ChangeDetection struct {
+	// Threshold is the change score, from 0 to 1, a frame must reach to count
+	// as changed. Zero keeps every frame.
+	Threshold float64      `json:"threshold" bson:"threshold"`
+	Action    ChangeAction `json:"action" bson:"action"`
+}
+
+func (c ChangeDetection) Validate() error {
+	if c.Threshold < 0 || c.Threshold > 1 {
+		return errors.New("threshold must be between 0 and 1")
+	}
+	switch c.Action {
+	case ChangeActionDrop, ChangeActionFlag:
+	default:
+		return fmt.Errorf("invalid action %q, expected drop or flag", c.Action)
+	}
+	return nil
+}
+
+// PreprocessStep is an image transformation applied before OCR.
+type PreprocessStep string
+
+const (
+	// PreprocessAutoRotate turns the image upright according to its EXIF orientation.
+	PreprocessAutoRotate PreprocessStep = "auto_rotate"
+	// PreprocessCrop keeps only the configured crop region.
+	PreprocessCrop PreprocessStep = "crop"
+	// PreprocessGrayscale drops the colour information.
+	PreprocessGrayscale PreprocessStep = "grayscale"
+	// PreprocessNormalize stretches the contrast to the full brightness range.
+	PreprocessNormalize PreprocessStep = "normalize"
+	// PreprocessDeskew straightens text lines photographed at an angle.
+	PreprocessDeskew PreprocessStep = "deskew"
+	// PreprocessThreshold binarizes the image against the local mean brightness.
+	PreprocessThreshold PreprocessStep = "threshold"
+)
+
+// PreprocessSteps lists every step in the order the pipeline applies them,
+// whatever order a configuration names them in.
+var PreprocessSteps = []PreprocessStep{
+	PreprocessAutoRotate,
+	PreprocessCrop,
+	PreprocessGrayscale,
+	PreprocessNormalize,
+	PreprocessDeskew,
+	PreprocessThreshold,
+}
+
+// Region is a rectangle given as fractions, from 0 to 1, of the image width
+// and height, so it holds across capture resolutions.
+type Region struct {
+	X      float64 `json:"x" bson:"x"`
+	Y      float64 `json:"y" bson:"y"`
+	Width  float64 `json:"width" bson:"width"`
+	Height float64 `json:"height" bson:"height"`
+}
+
+func (r Region) Validate() error {
+	if r.X < 0 || r.Y < 0 || r.Width <= 0 || r.Height <= 0 || r.X+r.Width > 1 || r.Y+r.Height > 1 {
+		return errors.New("must lie within the image, as fractions from 0 to 1")
+	}
+	return nil
+}
+
+type Preprocessing struct {
+	Steps []PreprocessStep `json:"steps" bson:"steps"`
+	// Crop is required by the crop step.
+	Crop *Region `json:"crop,omitempty" bson:"crop,omitempty"`
+}
+
+func (p Preprocessing) Validate() error {
+	for _, step := range p.Steps {
+		if !slices.Contains(PreprocessSteps, step) {
+			return fmt.Errorf("invalid step %q", step)
+		}
+	}
+	if p.Has(PreprocessCrop) {
+		if p.Crop == nil {
+			return errors.New("the crop step needs a crop region")
+		}
+		if err := p.Crop.Validate(); err != nil {
+			return fmt.Errorf("crop region %v", err)
+		}
+	}
+	return nil
+}
+
+// Has reports whether the step is enabled.
+func (p Preprocessing) Has(step PreprocessStep) bool {
+	return slices.Contains(p.Steps, step)
+}
+
+// ParsePreprocessSteps parses a comma-separated list of steps, such as
+// "auto_rotate,grayscale,deskew".
+func ParsePreprocessSteps(value string) ([]PreprocessStep, error) {
+	var steps []PreprocessStep
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		step := PreprocessStep(name)
+		if !slices.Contains(PreprocessSteps, step) {
+			return nil, fmt.Errorf("invalid preprocessing step %q", name)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
 }
 
 type DeviceRepository interface {
@@ -14,4 +153,26 @@ type DeviceRepository interface {
 	GetByID(ctx context.Context, id string) (*Device, error)
 	Update(ctx context.Context, id string, device *Device) error
 	Save(ctx context.Context, device *Device) error
+	// UpdateChangeDetection sets the device's change detection settings, or
+	// removes them when settings is nil.
+	UpdateChangeDetection(ctx context.Context, id string, settings *ChangeDetection) error
+	// UpdatePreprocessing sets the device's preprocessing steps, or removes
+	// them when settings is nil.
+	UpdatePreprocessing(ctx context.Context, id string, settings *Preprocessing) error
+	// UpdateOCRSettings sets the device's OCR settings, or removes them when
+	// settings is nil.
+	UpdateOCRSettings(ctx context.Context, id string, settings *OCRSettings) error
+	// Touch records that the device published a message at seenAt, and a
+	// photo when photo is set, and returns the updated device. Timestamps
+	// never move backwards.
+	Touch(ctx context.Context, id string, seenAt time.Time, photo bool) (*Device, error)
+	// SetStatus changes the device's status from one value to another and
+	// reports whether it did, so concurrent transitions are recorded once.
+	SetStatus(ctx context.Context, id, from, to string) (bool, error)
+	// GetSilent returns the active devices last seen before the given time.
+	GetSilent(ctx context.Context, before time.Time) ([]*Device, error)
+	// MarkSilentInactive marks the device inactive if it is still active and
+	// was last seen before the given time, and reports whether it did, so a
+	// device checking in meanwhile stays active.
+	MarkSilentInactive(ctx context.Context, id string, before time.Time) (bool, error)
 }
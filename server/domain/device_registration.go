@@ -0,0 +1,174 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// DeviceRegistrationVersion is the version of the JSON registration schema.
+// Like the webhook schemas, it only changes when a field is removed or
+// changes meaning. Newer versions are read for the fields they share with
+// this one, so devices may update before the server does.
+const DeviceRegistrationVersion = 1
+
+const (
+	MaxCameraResolutions = 64
+	MaxCameraLenses      = 8
+	// MaxDeviceInfoLength caps each free-text field of DeviceInfo and the
+	// registered device name, in characters.
+	MaxDeviceInfoLength = 128
+)
+
+// LensFacing is the direction a camera lens points in.
+type LensFacing string
+
+const (
+	LensBack     LensFacing = "back"
+	LensFront    LensFacing = "front"
+	LensExternal LensFacing = "external"
+)
+
+// DeviceInfo describes the hardware and software of a device, as reported
+// when it registers. Devices registering with a plain name leave it empty.
+type DeviceInfo struct {
+	Manufacturer string              `json:"manufacturer,omitempty" bson:"manufacturer,omitempty"`
+	Model        string              `json:"model,omitempty" bson:"model,omitempty"`
+	OSVersion    string              `json:"os_version,omitempty" bson:"os_version,omitempty"`
+	AppVersion   string              `json:"app_version,omitempty" bson:"app_version,omitempty"`
+	Camera       *CameraCapabilities `json:"camera,omitempty" bson:"camera,omitempty"`
+	Battery      *BatteryStatus      `json:"battery,omitempty" bson:"battery,omitempty"`
+	// NetworkType is how the device is connected, such as wifi or cellular.
+	NetworkType string `json:"network_type,omitempty" bson:"network_type,omitempty"`
+}
+
+type CameraCapabilities struct {
+	// Resolutions the device can capture photos at.
+	Resolutions []Resolution `json:"resolutions,omitempty" bson:"resolutions,omitempty"`
+	Lenses      []Lens       `json:"lenses,omitempty" bson:"lenses,omitempty"`
+}
+
+type Resolution struct {
+	Width  int `json:"width" bson:"width"`
+	Height int `json:"height" bson:"height"`
+}
+
+type Lens struct {
+	Facing LensFacing `json:"facing" bson:"facing"`
+	// FocalLengths are in millimetres; zoom lenses report several.
+	FocalLengths []float64 `json:"focal_lengths,omitempty" bson:"focal_lengths,omitempty"`
+}
+
+type BatteryStatus struct {
+	// Level is the charge left, in percent.
+	Level    int  `json:"level" bson:"level"`
+	Charging bool `json:"charging" bson:"charging"`
+}
+
+func (c CameraCapabilities) Validate() error {
+	if len(c.Resolutions) > MaxCameraResolutions {
+		return fmt.Errorf("at most %d resolutions are allowed", MaxCameraResolutions)
+	}
+	for _, resolution := range c.Resolutions {
+		if resolution.Width <= 0 || resolution.Height <= 0 {
+			return fmt.Errorf("invalid resolution %dx%d", resolution.Width, resolution.Height)
+		}
+	}
+	if len(c.Lenses) > MaxCameraLenses {
+		return fmt.Errorf("at most %d lenses are allowed", MaxCameraLenses)
+	}
+	for _, lens := range c.Lenses {
+		switch lens.Facing {
+		case LensBack, LensFront, LensExternal:
+		default:
+			return fmt.Errorf("invalid lens facing %q, expected back, front or external", lens.Facing)
+		}
+		for _, focalLength := range lens.FocalLengths {
+			if focalLength <= 0 {
+				return errors.New("focal lengths must be positive")
+			}
+		}
+	}
+	return nil
+}
+
+func (i DeviceInfo) Validate() error {
+	for _, field := range []struct{ name, value string }{
+		{"manufacturer", i.Manufacturer},
+		{"model", i.Model},
+		{"os_version", i.OSVersion},
+		{"app_version", i.AppVersion},
+		{"network_type", i.NetworkType},
+	} {
+		if utf8.RuneCountInString(field.value) > MaxDeviceInfoLength {
+			return fmt.Errorf("%s must be at most %d characters", field.name, MaxDeviceInfoLength)
+		}
+	}
+	if i.Camera != nil {
+		if err := i.Camera.Validate(); err != nil {
+			return fmt.Errorf("camera: %v", err)
+		}
+	}
+	if i.Battery != nil && (i.Battery.Level < 0 || i.Battery.Level > 100) {
+		return errors.New("battery level must be between 0 and 100")
+	}
+	return nil
+}
+
+// DeviceRegistration is the payload devices publish on register/<id>. The
+// JSON form is
+//
+//	{"version":1,"name":"Pixel 7","manufacturer":"Google","model":"Pixel 7",
+//	 "os_version":"14","app_version":"1.2.0","network_type":"wifi",
+//	 "battery":{"level":80,"charging":false},
+//	 "camera":{"resolutions":[{"width":4032,"height":3024}],
+//	           "lenses":[{"facing":"back","focal_lengths":[6.81]}]}}
+//
+// where every field but version is optional. Older app versions publish the
+// device name as plain text instead.
+type DeviceRegistration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	DeviceInfo
+}
+
+// ParseDeviceRegistration decodes and validates a registration payload. A
+// JSON registration without a name is named after its manufacturer and model.
+// Plain-text names from older apps are cut to MaxDeviceInfoLength characters
+// rather than rejected, as those apps cannot report the error.
+func ParseDeviceRegistration(payload []byte) (DeviceRegistration, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		return DeviceRegistration{Name: truncateRunes(string(payload), MaxDeviceInfoLength)}, nil
+	}
+
+	var registration DeviceRegistration
+	if err := json.Unmarshal(trimmed, &registration); err != nil {
+		return registration, fmt.Errorf("invalid registration: %v", err)
+	}
+	if registration.Version < DeviceRegistrationVersion {
+		return registration, fmt.Errorf("unsupported registration version %d, expected %d or later", registration.Version, DeviceRegistrationVersion)
+	}
+	if utf8.RuneCountInString(registration.Name) > MaxDeviceInfoLength {
+		return registration, fmt.Errorf("name must be at most %d characters", MaxDeviceInfoLength)
+	}
+	if err := registration.Validate(); err != nil {
+		return registration, err
+	}
+	if registration.Name == "" {
+		name := strings.TrimSpace(registration.Manufacturer + " " + registration.Model)
+		registration.Name = truncateRunes(name, MaxDeviceInfoLength)
+	}
+	return registration, nil
+}
+
+// truncateRunes cuts s to at most n characters.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,78 @@
+package domain_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"mqtt-streaming-server/domain"
+)
+
+func TestParseDeviceRegistration(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    domain.DeviceRegistration
+		wantErr string
+	}{
+		{name: "plain name", payload: "Samsung SM-G991B", want: domain.DeviceRegistration{Name: "Samsung SM-G991B"}},
+		{
+			name:    "plain name too long is cut",
+			payload: strings.Repeat("é", domain.MaxDeviceInfoLength+10),
+			want:    domain.DeviceRegistration{Name: strings.Repeat("é", domain.MaxDeviceInfoLength)},
+		},
+		{
+			name: "full registration",
+			payload: `{"version":1,"name":"Door","manufacturer":"Google","model":"Pixel 7","os_version":"14","app_version":"1.2.0","network_type":"wifi",
+				"battery":{"level":80,"charging":true},
+				"camera":{"resolutions":[{"width":4032,"height":3024}],"lenses":[{"facing":"back","focal_lengths":[6.81]}]}}`,
+			want: domain.DeviceRegistration{Version: 1, Name: "Door", DeviceInfo: domain.DeviceInfo{
+				Manufacturer: "Google",
+				Model:        "Pixel 7",
+				OSVersion:    "14",
+				AppVersion:   "1.2.0",
+				NetworkType:  "wifi",
+				Battery:      &domain.BatteryStatus{Level: 80, Charging: true},
+				Camera: &domain.CameraCapabilities{
+					Resolutions: []domain.Resolution{{Width: 4032, Height: 3024}},
+					Lenses:      []domain.Lens{{Facing: domain.LensBack, FocalLengths: []float64{6.81}}},
+				},
+			}},
+		},
+		{
+			name:    "named after the model",
+			payload: `{"version":1,"manufacturer":"Google","model":"Pixel 7"}`,
+			want:    domain.DeviceRegistration{Version: 1, Name: "Google Pixel 7", DeviceInfo: domain.DeviceInfo{Manufacturer: "Google", Model: "Pixel 7"}},
+		},
+		{name: "missing version", payload: `{"name":"Door"}`, wantErr: "unsupported registration version 0"},
+		{
+			name:    "newer version keeps the known fields",
+			payload: `{"version":2,"name":"Door","model":"Pixel 9","thermal_state":"nominal"}`,
+			want:    domain.DeviceRegistration{Version: 2, Name: "Door", DeviceInfo: domain.DeviceInfo{Model: "Pixel 9"}},
+		},
+		{name: "name too long", payload: `{"version":1,"name":"` + strings.Repeat("x", domain.MaxDeviceInfoLength+1) + `"}`, wantErr: "name must be at most 128 characters"},
+		{name: "model too long", payload: `{"version":1,"model":"` + strings.Repeat("x", domain.MaxDeviceInfoLength+1) + `"}`, wantErr: "model must be at most 128 characters"},
+		{name: "malformed JSON", payload: `{"version":1,`, wantErr: "invalid registration"},
+		{name: "battery out of range", payload: `{"version":1,"battery":{"level":120}}`, wantErr: "battery level must be between 0 and 100"},
+		{name: "invalid resolution", payload: `{"version":1,"camera":{"resolutions":[{"width":0,"height":480}]}}`, wantErr: "camera: invalid resolution 0x480"},
+		{name: "invalid lens", payload: `{"version":1,"camera":{"lenses":[{"facing":"up"}]}}`, wantErr: `camera: invalid lens facing "up"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := domain.ParseDeviceRegistration([]byte(tt.payload))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DeviceStatusActive   = "active"
+	DeviceStatusInactive = "inactive"
+)
+
+// DeviceStatusReason explains why a device changed status.
+type DeviceStatusReason string
+
+const (
+	// DeviceStatusRegistered is a device publishing on register/<id>.
+	DeviceStatusRegistered DeviceStatusReason = "registered"
+	// DeviceStatusConnected is a device announcing it is online.
+	DeviceStatusConnected DeviceStatusReason = "connected"
+	// DeviceStatusDisconnected is a device announcing it goes away.
+	DeviceStatusDisconnected DeviceStatusReason = "disconnected"
+	// DeviceStatusConnectionLost is the will the broker publishes for a device
+	// whose connection dropped without it disconnecting.
+	DeviceStatusConnectionLost DeviceStatusReason = "connection_lost"
+	// DeviceStatusTimeout is a device that stayed silent for too long.
+	DeviceStatusTimeout DeviceStatusReason = "timeout"
+	// DeviceStatusSeen is an inactive device publishing a heartbeat or photo.
+	DeviceStatusSeen DeviceStatusReason = "seen"
+)
+
+// DeviceStatusChange is one entry of a device's status history.
+type DeviceStatusChange struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	DeviceID string             `json:"device_id" bson:"device_id"`
+	// From is empty for a device's first registration.
+	From   string             `json:"from" bson:"from"`
+	To     string             `json:"to" bson:"to"`
+	Reason DeviceStatusReason `json:"reason" bson:"reason"`
+	At     time.Time          `json:"at" bson:"at"`
+}
+
+type DeviceStatusHistoryRepository interface {
+	Save(ctx context.Context, change *DeviceStatusChange) error
+	// List returns the device's latest status changes, newest first.
+	List(ctx context.Context, deviceID string, limit int) ([]*DeviceStatusChange, error)
+}
+
+// Devices report their connection state on status/<id> with a JSON
+// DeviceStatusMessage, published retained with QoS 1:
+//
+//   - when connecting, they set {"status":"offline","reason":"connection_lost"}
+//     as their MQTT will, which the broker publishes if the connection drops
+//     without a DISCONNECT (a crash, a lost network or a missed keep-alive);
+//   - once connected, they publish {"status":"online"};
+//   - before disconnecting on purpose, they publish
+//     {"status":"offline","reason":"disconnected"}.
+//
+// Being retained, the topic always holds the device's latest state, and a
+// server that subscribes gets it straight away.
+const (
+	DeviceOnline  = "online"
+	DeviceOffline = "offline"
+)
+
+// legacyDisconnectMessage is what app versions before the status topic
+// publish on device/id/<id> when they go away.
+const legacyDisconnectMessage = "Device Disconnected"
+
+type DeviceStatusMessage struct {
+	Status string `json:"status"`
+	// Reason is why an offline device went away, disconnected when empty.
+	Reason DeviceStatusReason `json:"reason,omitempty"`
+}
+
+// ParseDeviceStatusMessage decodes and validates a status payload, filling
+// in the reason when the device left it out.
+func ParseDeviceStatusMessage(payload []byte) (DeviceStatusMessage, error) {
+	payload = bytes.TrimSpace(payload)
+	if string(payload) == legacyDisconnectMessage {
+		return DeviceStatusMessage{Status: DeviceOffline, Reason: DeviceStatusDisconnected}, nil
+	}
+
+	var message DeviceStatusMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return message, fmt.Errorf("invalid status message: %v", err)
+	}
+	switch message.Status {
+	case DeviceOnline:
+		message.Reason = DeviceStatusConnected
+	case DeviceOffline:
+		switch message.Reason {
+		case "":
+			message.Reason = DeviceStatusDisconnected
+		case DeviceStatusDisconnected, DeviceStatusConnectionLost:
+		default:
+			return message, fmt.Errorf("invalid offline reason %q, expected disconnected or connection_lost", message.Reason)
+		}
+	default:
+		return message, fmt.Errorf("invalid status %q, expected online or offline", message.Status)
+	}
+	return message, nil
+}
@@ -0,0 +1,37 @@
+package domain_test
+
+import (
+	"testing"
+
+	"mqtt-streaming-server/domain"
+)
+
+func TestParseDeviceStatusMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    domain.DeviceStatusMessage
+		wantErr bool
+	}{
+		{name: "online", payload: `{"status":"online"}`, want: domain.DeviceStatusMessage{Status: domain.DeviceOnline, Reason: domain.DeviceStatusConnected}},
+		{name: "graceful offline", payload: `{"status":"offline","reason":"disconnected"}`, want: domain.DeviceStatusMessage{Status: domain.DeviceOffline, Reason: domain.DeviceStatusDisconnected}},
+		{name: "offline without reason", payload: `{"status":"offline"}`, want: domain.DeviceStatusMessage{Status: domain.DeviceOffline, Reason: domain.DeviceStatusDisconnected}},
+		{name: "will", payload: `{"status":"offline","reason":"connection_lost"}`, want: domain.DeviceStatusMessage{Status: domain.DeviceOffline, Reason: domain.DeviceStatusConnectionLost}},
+		{name: "legacy disconnect", payload: "Device Disconnected\n", want: domain.DeviceStatusMessage{Status: domain.DeviceOffline, Reason: domain.DeviceStatusDisconnected}},
+		{name: "unknown status", payload: `{"status":"sleeping"}`, wantErr: true},
+		{name: "unknown reason", payload: `{"status":"offline","reason":"timeout"}`, wantErr: true},
+		{name: "plain text", payload: "bye", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := domain.ParseDeviceStatusMessage([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package domain
+
+const (
+	// PhotoCommitted is published once a photo is stored and visible to readers.
+	PhotoCommitted = "photo.committed"
+)
+
+type PhotoEvent struct {
+	Type  string `json:"type"`
+	Photo *Photo `json:"photo"`
+}
+
+// PhotoPublisher receives photo events from the ingestion path.
+type PhotoPublisher interface {
+	Publish(event PhotoEvent)
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// WordBox is a recognized word and where it was found in the image, in pixels
+// from the top-left corner.
+type WordBox struct {
+	Text string `json:"text" bson:"text"`
+	// Confidence is the engine's confidence in the word, from 0 to 1.
+	Confidence float64 `json:"confidence" bson:"confidence"`
+	X          int     `json:"x" bson:"x"`
+	Y          int     `json:"y" bson:"y"`
+	Width      int     `json:"width" bson:"width"`
+	Height     int     `json:"height" bson:"height"`
+}
+
+// OCRResult is the output of a TextExtractor.
+type OCRResult struct {
+	Text string `json:"text"`
+	// Confidence is the overall confidence, from 0 to 1; zero when the engine does not report one.
+	Confidence float64 `json:"confidence"`
+	// Language is the language setting the engine ran with, if it reports one.
+	Language string    `json:"language,omitempty"`
+	Words    []WordBox `json:"words,omitempty"`
+}
+
+// Limits on OCR settings, which keep a single photo's OCR time bounded.
+const (
+	MaxOCRLanguages = 8
+	MaxOCRRegions   = 16
+	MaxOCRWhitelist = 256
+	// MaxPageSegMode is Tesseract's highest page segmentation mode, raw line.
+	MaxPageSegMode = 13
+)
+
+// languagePattern matches Tesseract language names such as "eng" or "chi_sim".
+var languagePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// OCRSettings tune the text extraction of a device's photos.
+type OCRSettings struct {
+	// Languages are Tesseract language names, e.g. "eng" and "ron"; empty
+	// uses the engine's default.
+	Languages []string `json:"languages,omitempty" bson:"languages,omitempty"`
+	// PageSegMode is the Tesseract page segmentation mode, from 1 to 13;
+	// 0 uses the engine's default, fully automatic segmentation.
+	PageSegMode int `json:"page_seg_mode,omitempty" bson:"page_seg_mode,omitempty"`
+	// Whitelist restricts recognition to these characters when set.
+	Whitelist string `json:"whitelist,omitempty" bson:"whitelist,omitempty"`
+	// Regions restrict OCR to these parts of the photo. Each is read
+	// separately and the texts joined one per line.
+	Regions []Region `json:"regions,omitempty" bson:"regions,omitempty"`
+}
+
+func (s OCRSettings) Validate() error {
+	if len(s.Languages) > MaxOCRLanguages {
+		return fmt.Errorf("at most %d languages are allowed", MaxOCRLanguages)
+	}
+	for _, language := range s.Languages {
+		if !languagePattern.MatchString(language) {
+			return fmt.Errorf("invalid language %q", language)
+		}
+	}
+	if s.PageSegMode < 0 || s.PageSegMode > MaxPageSegMode {
+		return fmt.Errorf("page segmentation mode must be between 0 and %d", MaxPageSegMode)
+	}
+	if len(s.Whitelist) > MaxOCRWhitelist {
+		return errors.New("whitelist is too long")
+	}
+	if len(s.Regions) > MaxOCRRegions {
+		return fmt.Errorf("at most %d regions are allowed", MaxOCRRegions)
+	}
+	for i, region := range s.Regions {
+		if err := region.Validate(); err != nil {
+			return fmt.Errorf("region %d %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// TextExtractor runs OCR on an encoded image. Implementations need not be
+// safe for concurrent use; each ingestion worker owns its own.
+type TextExtractor interface {
+	// Extract applies the languages, page segmentation mode and whitelist of
+	// settings; regions are cropped by the caller.
+	Extract(ctx context.Context, image []byte, settings OCRSettings) (*OCRResult, error)
+	Close() error
+}
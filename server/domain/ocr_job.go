@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Re-OCR job states. Like time-lapses, jobs are queued, picked up by a worker
+// and end in one of the three final states.
+const (
+	OCRJobStatusQueued    = "queued"
+	OCRJobStatusRunning   = "running"
+	OCRJobStatusCompleted = "completed"
+	OCRJobStatusFailed    = "failed"
+	OCRJobStatusCanceled  = "canceled"
+)
+
+// OCRJob reruns text extraction over a device's photos in a time range, with
+// the device's current preprocessing and OCR settings.
+type OCRJob struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	DeviceID string             `json:"device_id" bson:"device_id"`
+	Start    time.Time          `json:"start" bson:"start"`
+	End      time.Time          `json:"end" bson:"end"`
+	Status   string             `json:"status" bson:"status"`
+	// Progress goes from 0 to 100 while the job is running.
+	Progress int `json:"progress" bson:"progress"`
+	// Total is the number of photos in the range, Processed how many of them
+	// were read again, and Failed how many of those kept their old text
+	// because the image was missing or extraction failed.
+	Total       int64      `json:"total" bson:"total"`
+	Processed   int64      `json:"processed" bson:"processed"`
+	Failed      int64      `json:"failed" bson:"failed"`
+	Error       string     `json:"error,omitempty" bson:"error,omitempty"`
+	RequestedBy string     `json:"requested_by" bson:"requested_by"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+// Validate rejects jobs without a device or a valid range.
+func (j *OCRJob) Validate() error {
+	if j.DeviceID == "" {
+		return errors.New("device ID must not be empty")
+	}
+	if j.Start.IsZero() || j.End.IsZero() || !j.End.After(j.Start) {
+		return errors.New("end must be after start")
+	}
+	return nil
+}
+
+// Finished reports whether the job reached a final state.
+func (j *OCRJob) Finished() bool {
+	switch j.Status {
+	case OCRJobStatusCompleted, OCRJobStatusFailed, OCRJobStatusCanceled:
+		return true
+	}
+	return false
+}
+
+type OCRJobRepository interface {
+	// Save inserts the job and sets its ID.
+	Save(ctx context.Context, job *OCRJob) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*OCRJob, error)
+	// List returns the jobs of the device, or of all devices when deviceID is empty, newest first.
+	List(ctx context.Context, deviceID string) ([]*OCRJob, error)
+	GetByStatus(ctx context.Context, status string) ([]*OCRJob, error)
+	Update(ctx context.Context, job *OCRJob) error
+	// SetStatus moves the job from one status to another, and reports false
+	// when it was not in the from status. Moving to a final status sets FinishedAt.
+	SetStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// PhotoTextVersion is a text a photo held before a re-OCR job replaced it.
+type PhotoTextVersion struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PhotoID primitive.ObjectID `json:"photo_id" bson:"photo_id"`
+	// Version is the photo's TextVersion while it held this text.
+	Version int       `json:"version" bson:"version"`
+	Text    string    `json:"text" bson:"text"`
+	OCR     *PhotoOCR `json:"ocr,omitempty" bson:"ocr,omitempty"`
+	// ReplacedBy is the job that replaced the text.
+	ReplacedBy primitive.ObjectID `json:"replaced_by" bson:"replaced_by"`
+	ReplacedAt time.Time          `json:"replaced_at" bson:"replaced_at"`
+}
+
+type PhotoTextVersionRepository interface {
+	// Save stores an earlier text of a photo. Saving a version the photo
+	// already has stored is a no-op.
+	Save(ctx context.Context, version *PhotoTextVersion) error
+	// ListByPhoto returns the earlier texts of the photo, newest first.
+	ListByPhoto(ctx context.Context, photoID primitive.ObjectID) ([]*PhotoTextVersion, error)
+	// DeleteByPhoto removes the earlier texts of the photo.
+	DeleteByPhoto(ctx context.Context, photoID primitive.ObjectID) error
+}
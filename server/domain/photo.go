@@ -2,11 +2,26 @@ package domain
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Photo ingestion states. A photo is saved as pending, its image uploaded, and
+// only then marked committed; failed photos are removed by the reconciler.
+const (
+	PhotoStatusPending   = "pending"
+	PhotoStatusCommitted = "committed"
+	PhotoStatusFailed    = "failed"
+)
+
 type Photo struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Timestamp    time.Time          `json:"timestamp" bson:"timestamp"`
@@ -14,9 +29,148 @@ type Photo struct {
 	PresignedURL string             `json:"presigned_url" bson:",omitempty"`
 	DeviceID     string             `json:"device_id" bson:"device_id"`
 	Text         string             `json:"text" bson:"text"`
+	// OCR is the structured recognition output; nil on photos stored before it was recorded.
+	OCR *PhotoOCR `json:"ocr,omitempty" bson:"ocr,omitempty"`
+	// TextVersion counts the re-OCR jobs that replaced the text; the texts it
+	// replaced are kept as PhotoTextVersions.
+	TextVersion int `json:"text_version,omitempty" bson:"text_version,omitempty"`
+	// Width and Height are the image dimensions in pixels, the coordinate space of the OCR word boxes.
+	Width  int `json:"width,omitempty" bson:"width,omitempty"`
+	Height int `json:"height,omitempty" bson:"height,omitempty"`
+	// Highlights are the OCR words matching a search term, returned when one is given.
+	Highlights []WordBox `json:"highlights,omitempty" bson:"-"`
+	Tags       []string  `json:"tags,omitempty" bson:"tags,omitempty"`
+	// ChangeScore is how much of the frame differs from the device's previous
+	// frame, from 0 to 1; nil when there was nothing to compare with.
+	ChangeScore *float64 `json:"change_score,omitempty" bson:"change_score,omitempty"`
+	// Unchanged flags frames kept although their score was below the device threshold.
+	Unchanged bool `json:"unchanged,omitempty" bson:"unchanged,omitempty"`
+	// StorageKey is the blob key of the image; empty on records stored before it was persisted.
+	StorageKey string `json:"-" bson:"storage_key,omitempty"`
+	// ThumbnailKey and PreviewKey are the blob keys of the downscaled JPEG
+	// copies; empty when none were generated.
+	ThumbnailKey string `json:"-" bson:"thumbnail_key,omitempty"`
+	PreviewKey   string `json:"-" bson:"preview_key,omitempty"`
+	Status       string `json:"-" bson:"status"`
+}
+
+// OCR states of a photo.
+const (
+	OCRStatusDone   = "done"
+	OCRStatusFailed = "failed"
+)
+
+type PhotoOCR struct {
+	Status string `json:"status" bson:"status"`
+	// Error is why recognition failed; empty unless Status is failed.
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// Confidence is the overall confidence, from 0 to 1.
+	Confidence float64 `json:"confidence" bson:"confidence"`
+	// Language is the engine's language setting, e.g. "eng" or "eng+deu".
+	Language string    `json:"language,omitempty" bson:"language,omitempty"`
+	Words    []WordBox `json:"words,omitempty" bson:"words,omitempty"`
+}
+
+// NewPhotoOCR records the outcome of running a TextExtractor.
+func NewPhotoOCR(result *OCRResult, err error) *PhotoOCR {
+	if err != nil {
+		return &PhotoOCR{Status: OCRStatusFailed, Error: err.Error()}
+	}
+	return &PhotoOCR{
+		Status:     OCRStatusDone,
+		Confidence: result.Confidence,
+		Language:   result.Language,
+		Words:      result.Words,
+	}
+}
+
+// PhotoSize selects the original image or one of its derivatives.
+type PhotoSize string
+
+const (
+	PhotoSizeThumb    PhotoSize = "thumb"
+	PhotoSizePreview  PhotoSize = "preview"
+	PhotoSizeOriginal PhotoSize = "original"
+)
+
+// ParsePhotoSize validates a size parameter; an empty value means the original.
+func ParsePhotoSize(value string) (PhotoSize, error) {
+	switch size := PhotoSize(value); size {
+	case "":
+		return PhotoSizeOriginal, nil
+	case PhotoSizeThumb, PhotoSizePreview, PhotoSizeOriginal:
+		return size, nil
+	default:
+		return "", fmt.Errorf("invalid size %q, expected thumb, preview or original", value)
+	}
 }
 
+// DerivativeStorageKey is the key a derivative is stored under, next to the original.
+func DerivativeStorageKey(originalKey string, size PhotoSize) string {
+	return strings.TrimSuffix(originalKey, path.Ext(originalKey)) + "_" + string(size) + ".jpeg"
+}
+
+// NewPhotoStorageKey builds a unique blob key from the device ID, the capture time
+// and a hash of the image, so two devices sending in the same second never collide.
+func NewPhotoStorageKey(deviceID string, timestamp time.Time, data []byte, imageType string) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("photos/%s/%d-%s.%s", url.PathEscape(deviceID), timestamp.UnixMilli(), hex.EncodeToString(sum[:8]), imageType)
+}
+
+// LegacyStorageKey is the timestamp-derived key photos were uploaded under before StorageKey existed.
+func (p *Photo) LegacyStorageKey() string {
+	return fmt.Sprintf("photos/%d.%s", p.Timestamp.Unix(), p.ImageType)
+}
+
+// ObjectKey returns the blob key of the image, falling back to the legacy key for old records.
+func (p *Photo) ObjectKey() string {
+	if p.StorageKey != "" {
+		return p.StorageKey
+	}
+	return p.LegacyStorageKey()
+}
+
+// SizeKey returns the blob key and content type of the requested size. Photos
+// without that derivative fall back to the original.
+func (p *Photo) SizeKey(size PhotoSize) (string, string) {
+	switch {
+	case size == PhotoSizeThumb && p.ThumbnailKey != "":
+		return p.ThumbnailKey, "image/jpeg"
+	case size == PhotoSizePreview && p.PreviewKey != "":
+		return p.PreviewKey, "image/jpeg"
+	}
+	return p.ObjectKey(), "image/" + p.ImageType
+}
+
+// BlobKeys returns the keys of every blob stored for the photo, derivatives first.
+func (p *Photo) BlobKeys() []string {
+	var keys []string
+	for _, key := range []string{p.ThumbnailKey, p.PreviewKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return append(keys, p.ObjectKey())
+}
+
+// ErrTextVersionConflict is returned by UpdateText when the photo's text was
+// replaced since it was read.
+var ErrTextVersionConflict = errors.New("photo text was replaced since it was read")
+
 type PhotoRepository interface {
-	GetPhotos(ctx context.Context, filters map[string]any) ([]*Photo, error)
+	// GetPhotos returns one page of committed photos matching the query.
+	GetPhotos(ctx context.Context, query PhotoQuery) (*PhotoPage, error)
+	// SearchPhotos runs query.Text as a full-text search and ranks committed photos by relevance.
+	SearchPhotos(ctx context.Context, query PhotoQuery) ([]*PhotoSearchResult, error)
+	GetByID(ctx context.Context, id primitive.ObjectID) (*Photo, error)
+	// Save inserts the photo and sets its ID.
 	Save(ctx context.Context, photo *Photo) error
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, status string) error
+	// UpdateText stores the photo's text, OCR output, dimensions and text
+	// version, if the stored text version is still the one before photo's.
+	// It returns ErrTextVersionConflict otherwise, or if the photo is gone.
+	UpdateText(ctx context.Context, photo *Photo) error
+	// GetByStatus returns photos in the given status received before the given time.
+	GetByStatus(ctx context.Context, status string, before time.Time) ([]*Photo, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
 }
@@ -0,0 +1,260 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrQueryTimeout means a photo query ran out of its time budget.
+	ErrQueryTimeout = errors.New("query took too long")
+	// ErrTextIndexMissing means full-text search ran before the text index was built.
+	ErrTextIndexMissing = errors.New("text index is missing")
+)
+
+// MaxPhotoQueryLimit caps the page size of a PhotoQuery.
+const MaxPhotoQueryLimit = 500
+
+// maxSearchTextLength keeps user supplied patterns small enough to evaluate cheaply.
+const maxSearchTextLength = 256
+
+// maxRegexRepeat caps the counted repetitions, such as a{100}, of a regex pattern.
+const maxRegexRepeat = 100
+
+// TextMode selects how PhotoQuery.Text is matched against the OCR text.
+type TextMode string
+
+const (
+	// TextSubstring matches the term literally, ignoring case.
+	TextSubstring TextMode = "substring"
+	// TextExact matches photos whose whole text is the term, case-sensitive.
+	TextExact TextMode = "exact"
+	// TextRegex matches the term as a case-insensitive regular expression,
+	// without quantified groups that themselves contain a quantifier or an
+	// alternation.
+	TextRegex TextMode = "regex"
+	// TextFullText uses the text index, with stemming and stop words.
+	TextFullText TextMode = "fulltext"
+)
+
+type SortOrder string
+
+const (
+	SortNewestFirst SortOrder = "desc"
+	SortOldestFirst SortOrder = "asc"
+)
+
+// PhotoCursor marks the last photo of a page. Photos are ordered by timestamp
+// and then by ID, so the pair is unique even when timestamps collide.
+type PhotoCursor struct {
+	Timestamp time.Time
+	ID        primitive.ObjectID
+}
+
+// Encode returns the opaque string handed to clients.
+func (c PhotoCursor) Encode() string {
+	raw := strconv.FormatInt(c.Timestamp.UnixNano(), 10) + ":" + c.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodePhotoCursor(s string) (*PhotoCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, hexID, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	ts, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(hexID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &PhotoCursor{Timestamp: time.Unix(0, ts).UTC(), ID: id}, nil
+}
+
+type PhotoQuery struct {
+	Start     time.Time
+	End       time.Time
+	DeviceIDs []string
+	Text      string
+	TextMode  TextMode
+	// Tags only matches photos carrying all of them.
+	Tags []string
+	// ChangedOnly leaves out frames flagged as unchanged.
+	ChangedOnly bool
+	// Limit is the page size; zero means no limit.
+	Limit int
+	// After resumes the listing after the given photo.
+	After *PhotoCursor
+	Sort  SortOrder
+}
+
+type PhotoPage struct {
+	Photos []*Photo
+	// Total counts every photo matching the query, across all pages.
+	Total int64
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// Validate rejects queries the repository cannot evaluate safely.
+func (q PhotoQuery) Validate() error {
+	if !q.Start.IsZero() && !q.End.IsZero() && q.End.Before(q.Start) {
+		return errors.New("end must not be before start")
+	}
+	// Zero means no limit, which internal callers rely on
+	if q.Limit < 0 {
+		return errors.New("limit must not be negative")
+	}
+	if q.Limit > MaxPhotoQueryLimit {
+		return fmt.Errorf("limit must be at most %d", MaxPhotoQueryLimit)
+	}
+	for _, id := range q.DeviceIDs {
+		if id == "" {
+			return errors.New("device ID must not be empty")
+		}
+	}
+	for _, tag := range q.Tags {
+		if tag == "" {
+			return errors.New("tag must not be empty")
+		}
+	}
+	if len(q.Text) > maxSearchTextLength {
+		return fmt.Errorf("text must be at most %d characters", maxSearchTextLength)
+	}
+	switch q.TextMode {
+	case "", TextSubstring, TextExact, TextFullText:
+	case TextRegex:
+		if _, err := regexp.Compile(q.Text); err != nil {
+			return fmt.Errorf("invalid regular expression: %v", err)
+		}
+		if err := checkRegexBacktracking(q.Text); err != nil {
+			return fmt.Errorf("invalid regular expression: %v", err)
+		}
+	default:
+		return fmt.Errorf("invalid text mode %q, expected substring, exact, regex or fulltext", q.TextMode)
+	}
+	switch q.Sort {
+	case "", SortNewestFirst, SortOldestFirst:
+	default:
+		return fmt.Errorf("invalid sort order %q, expected asc or desc", q.Sort)
+	}
+	return nil
+}
+
+// checkRegexBacktracking rejects patterns a backtracking engine, such as the
+// one MongoDB runs regexes on, can take exponential time to fail on: groups
+// holding a quantifier or an alternation that are quantified themselves,
+// like (a+)+ or (a|ab)*. The pattern must already compile.
+func checkRegexBacktracking(pattern string) error {
+	// groups tracks, for each open group, whether it holds a quantifier or
+	// an alternation; the first entry is the whole pattern
+	groups := []bool{false}
+	afterRiskyGroup := false
+	for i := 0; i < len(pattern); i++ {
+		closedRiskyGroup := false
+		switch c := pattern[i]; c {
+		case '\\':
+			i++
+		case '[':
+			i = classEnd(pattern, i)
+		case '(':
+			groups = append(groups, false)
+			// Skip the ? of (?:, (?i) and (?P<name>, which is no quantifier
+			if i+1 < len(pattern) && pattern[i+1] == '?' {
+				i++
+			}
+		case ')':
+			risky := groups[len(groups)-1]
+			groups = groups[:len(groups)-1]
+			groups[len(groups)-1] = groups[len(groups)-1] || risky
+			closedRiskyGroup = risky
+		case '|':
+			groups[len(groups)-1] = true
+		case '*', '+', '?', '{':
+			if c == '{' {
+				end, count, ok := countedRepeat(pattern, i)
+				if !ok {
+					break
+				}
+				if count > maxRegexRepeat {
+					return fmt.Errorf("repetition count must be at most %d", maxRegexRepeat)
+				}
+				i = end
+			}
+			if afterRiskyGroup {
+				return errors.New("quantified groups must not contain quantifiers or alternations")
+			}
+			groups[len(groups)-1] = true
+			// Lazy and possessive quantifiers
+			if i+1 < len(pattern) && (pattern[i+1] == '?' || pattern[i+1] == '+') {
+				i++
+			}
+		}
+		afterRiskyGroup = closedRiskyGroup
+	}
+	return nil
+}
+
+// classEnd returns the index of the ] closing the character class opening at start.
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && pattern[i] == '^' {
+		i++
+	}
+	// A ] right after the opening bracket is a literal
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			// Named classes such as [:alpha:]
+			if end := strings.Index(pattern[i:], ":]"); i+1 < len(pattern) && pattern[i+1] == ':' && end > 0 {
+				i += end + 1
+			}
+		case ']':
+			return i
+		}
+	}
+	return len(pattern)
+}
+
+// countedRepeat parses a {n}, {n,} or {n,m} quantifier opening at start,
+// returning the index of its closing brace and its largest count. Braces of
+// any other form are literals.
+func countedRepeat(pattern string, start int) (int, int, bool) {
+	end := strings.IndexByte(pattern[start:], '}')
+	if end < 0 {
+		return 0, 0, false
+	}
+	lowText, highText, hasHigh := strings.Cut(pattern[start+1:start+end], ",")
+	low, err := strconv.Atoi(lowText)
+	if err != nil {
+		return 0, 0, false
+	}
+	count := low
+	if hasHigh && highText != "" {
+		high, err := strconv.Atoi(highText)
+		if err != nil {
+			return 0, 0, false
+		}
+		count = high
+	}
+	return start + end, count, true
+}
@@ -0,0 +1,45 @@
+package domain_test
+
+import (
+	"strings"
+	"testing"
+
+	"mqtt-streaming-server/domain"
+)
+
+func TestPhotoQuery_ValidateRegex(t *testing.T) {
+	tests := []struct {
+		pattern         string
+		wantErrContains string
+	}{
+		{pattern: `gate \d+`},
+		{pattern: `^(gate|door) [0-9]{1,3}$`},
+		{pattern: `(?i)(ab)+c`},
+		{pattern: `[(+*)]+`},
+		{pattern: `a\(b+\)+`},
+		{pattern: `x{2}`},
+		{pattern: `(a+)+$`, wantErrContains: "quantified groups"},
+		{pattern: `(?:a+)+`, wantErrContains: "quantified groups"},
+		{pattern: `(a|ab)*c`, wantErrContains: "quantified groups"},
+		{pattern: `((a)*b)+`, wantErrContains: "quantified groups"},
+		{pattern: `(\d+x){2,5}`, wantErrContains: "quantified groups"},
+		{pattern: `(a*)+?`, wantErrContains: "quantified groups"},
+		{pattern: `a{1000}`, wantErrContains: "repetition count"},
+		{pattern: `(unclosed`, wantErrContains: "invalid regular expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			err := domain.PhotoQuery{Text: tt.pattern, TextMode: domain.TextRegex}.Validate()
+			if tt.wantErrContains == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrContains) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErrContains, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// snippetContext is how many characters of OCR text are kept around a match.
+const snippetContext = 40
+
+type PhotoSearchResult struct {
+	*Photo
+	// Score is the text search relevance, higher is better.
+	Score    float64   `json:"score"`
+	Snippets []Snippet `json:"snippets"`
+}
+
+// Snippet is an excerpt of the OCR text split into fragments, so clients can
+// render the matching ones highlighted without parsing markup.
+type Snippet struct {
+	Fragments []SnippetFragment `json:"fragments"`
+}
+
+type SnippetFragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// SearchTerms splits a full-text query the way Mongo does: quoted phrases are
+// kept together and negated terms ("-word") are dropped.
+func SearchTerms(search string) []string {
+	var terms []string
+	for i, part := range strings.Split(search, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.TrimSpace(part); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if !strings.HasPrefix(word, "-") {
+				terms = append(terms, word)
+			}
+		}
+	}
+	return terms
+}
+
+// BuildSnippets returns up to maxSnippets excerpts of text around the words
+// matching the search terms. A match starts at a word boundary and runs to the
+// end of the word, so stemmed hits like "doors" for "door" are highlighted whole.
+func BuildSnippets(text, search string, maxSnippets int) []Snippet {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	type span struct{ start, end int }
+	var matches []span
+	for _, term := range SearchTerms(search) {
+		needle := []rune(strings.ToLower(term))
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if i > 0 && isWordRune(lower[i-1]) {
+				continue
+			}
+			if string(lower[i:i+len(needle)]) != string(needle) {
+				continue
+			}
+			end := i + len(needle)
+			for end < len(lower) && isWordRune(lower[end]) {
+				end++
+			}
+			matches = append(matches, span{i, end})
+		}
+	}
+	if len(matches) == 0 {
+		return []Snippet{}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	// Merge overlapping matches, then group them into windows of context
+	merged := []span{matches[0]}
+	for _, m := range matches[1:] {
+		last := &merged[len(merged)-1]
+		if m.start <= last.end {
+			last.end = max(last.end, m.end)
+			continue
+		}
+		merged = append(merged, m)
+	}
+
+	var snippets []Snippet
+	for i := 0; i < len(merged) && len(snippets) < maxSnippets; {
+		windowStart := max(0, merged[i].start-snippetContext)
+		windowEnd := min(len(runes), merged[i].end+snippetContext)
+		j := i + 1
+		for j < len(merged) && merged[j].start-snippetContext <= windowEnd {
+			windowEnd = min(len(runes), merged[j].end+snippetContext)
+			j++
+		}
+
+		var snippet Snippet
+		cursor := windowStart
+		if windowStart > 0 {
+			snippet.Fragments = append(snippet.Fragments, SnippetFragment{Text: "…"})
+		}
+		for _, m := range merged[i:j] {
+			if m.start > cursor {
+				snippet.Fragments = append(snippet.Fragments, SnippetFragment{Text: string(runes[cursor:m.start])})
+			}
+			snippet.Fragments = append(snippet.Fragments, SnippetFragment{Text: string(runes[m.start:m.end]), Match: true})
+			cursor = m.end
+		}
+		if windowEnd > cursor {
+			snippet.Fragments = append(snippet.Fragments, SnippetFragment{Text: string(runes[cursor:windowEnd])})
+		}
+		if windowEnd < len(runes) {
+			snippet.Fragments = append(snippet.Fragments, SnippetFragment{Text: "…"})
+		}
+		snippets = append(snippets, snippet)
+		i = j
+	}
+	return snippets
+}
+
+// BuildHighlights returns the OCR words matching the search terms, for clients
+// to draw as boxes over the image. Words match like snippets do: a word matches
+// a term it starts with, ignoring case and surrounding punctuation, and a
+// quoted phrase matches a run of consecutive words.
+func BuildHighlights(words []WordBox, search string) []WordBox {
+	normalized := make([]string, len(words))
+	for i, word := range words {
+		normalized[i] = strings.ToLower(strings.TrimFunc(word.Text, func(r rune) bool { return !isWordRune(r) }))
+	}
+
+	matched := make([]bool, len(words))
+	for _, term := range SearchTerms(search) {
+		parts := strings.Fields(strings.ToLower(term))
+		if len(parts) == 0 {
+			continue
+		}
+	next:
+		for i := 0; i+len(parts) <= len(words); i++ {
+			for j, part := range parts {
+				part = strings.TrimFunc(part, func(r rune) bool { return !isWordRune(r) })
+				if part == "" || !strings.HasPrefix(normalized[i+j], part) {
+					continue next
+				}
+			}
+			for j := range parts {
+				matched[i+j] = true
+			}
+		}
+	}
+
+	highlights := []WordBox{}
+	for i, word := range words {
+		if matched[i] {
+			highlights = append(highlights, word)
+		}
+	}
+	return highlights
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
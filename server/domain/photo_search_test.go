@@ -0,0 +1,134 @@
+package domain_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mqtt-streaming-server/domain"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		want   []string
+	}{
+		{name: "words", search: "gate  alarm", want: []string{"gate", "alarm"}},
+		{name: "phrase", search: `"north gate" alarm`, want: []string{"north gate", "alarm"}},
+		{name: "negation dropped", search: "gate -test", want: []string{"gate"}},
+		{name: "empty", search: "   ", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := domain.SearchTerms(tt.search); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildSnippets(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		search      string
+		maxSnippets int
+		want        []string
+	}{
+		{
+			name:        "highlights whole word for stemmed match",
+			text:        "Emergency Doors must stay closed",
+			search:      "door",
+			maxSnippets: 3,
+			want:        []string{"Emergency [Doors] must stay closed"},
+		},
+		{
+			name:        "ignores matches inside words",
+			text:        "outdoor door",
+			search:      "door",
+			maxSnippets: 3,
+			want:        []string{"outdoor [door]"},
+		},
+		{
+			name:        "distant matches become separate snippets",
+			text:        "ALARM " + strings.Repeat("x ", 60) + "alarm",
+			search:      "alarm",
+			maxSnippets: 3,
+			want: []string{
+				"[ALARM]" + strings.Repeat(" x", 20) + "…",
+				"…" + strings.Repeat("x ", 20) + "[alarm]",
+			},
+		},
+		{
+			name:        "respects max snippets",
+			text:        "ALARM " + strings.Repeat("x ", 60) + "alarm",
+			search:      "alarm",
+			maxSnippets: 1,
+			want:        []string{"[ALARM]" + strings.Repeat(" x", 20) + "…"},
+		},
+		{
+			name:        "no match",
+			text:        "nothing here",
+			search:      "alarm",
+			maxSnippets: 3,
+			want:        []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, snippet := range domain.BuildSnippets(tt.text, tt.search, tt.maxSnippets) {
+				var b strings.Builder
+				for _, fragment := range snippet.Fragments {
+					if fragment.Match {
+						b.WriteString("[" + fragment.Text + "]")
+					} else {
+						b.WriteString(fragment.Text)
+					}
+				}
+				got = append(got, b.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildHighlights(t *testing.T) {
+	words := []domain.WordBox{
+		{Text: "Loading", X: 0},
+		{Text: "Dock", X: 10},
+		{Text: "DOORS:", X: 20},
+		{Text: "closed", X: 30},
+		{Text: "dock", X: 40},
+	}
+
+	tests := []struct {
+		name   string
+		search string
+		want   []int
+	}{
+		{name: "single term matches every occurrence", search: "dock", want: []int{10, 40}},
+		{name: "stemmed prefix and punctuation", search: "door", want: []int{20}},
+		{name: "phrase matches consecutive words", search: `"loading dock"`, want: []int{0, 10}},
+		{name: "negated term ignored", search: "closed -dock", want: []int{30}},
+		{name: "no match", search: "gate", want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int{}
+			for _, box := range domain.BuildHighlights(words, tt.search) {
+				got = append(got, box.X)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected boxes at %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
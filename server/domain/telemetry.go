@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// TelemetryMetric names a reading devices report on telemetry/<id>.
+type TelemetryMetric string
+
+const (
+	// MetricBatteryLevel is the charge left, in percent.
+	MetricBatteryLevel TelemetryMetric = "battery_level"
+	// MetricTemperature is the battery temperature, in degrees Celsius.
+	MetricTemperature TelemetryMetric = "temperature"
+	// MetricSignalStrength is the strength of the active network, in dBm.
+	MetricSignalStrength TelemetryMetric = "signal_strength"
+	// MetricFreeStorage is the storage left on the device, in bytes.
+	MetricFreeStorage TelemetryMetric = "free_storage"
+	// MetricCaptureErrors counts the photos the device failed to take since
+	// its previous report.
+	MetricCaptureErrors TelemetryMetric = "capture_errors"
+)
+
+// TelemetryMetrics lists every metric, in the order they are documented.
+var TelemetryMetrics = []TelemetryMetric{MetricBatteryLevel, MetricTemperature, MetricSignalStrength, MetricFreeStorage, MetricCaptureErrors}
+
+// ErrTooManyTelemetryPoints is returned for raw queries whose range holds more
+// than MaxTelemetryPoints readings, rather than silently cutting them off.
+var ErrTooManyTelemetryPoints = errors.New("too many telemetry points")
+
+const (
+	// MaxTelemetryPoints caps the points a TelemetryQuery returns, raw or downsampled.
+	MaxTelemetryPoints = 10000
+	// MinTelemetryInterval is the smallest downsampling interval.
+	MinTelemetryInterval = time.Second
+)
+
+// TelemetryReport is the JSON payload devices publish on telemetry/<id>, such as
+//
+//	{"timestamp":"2024-05-01T12:00:00Z","battery_level":80,"temperature":31.5,
+//	 "signal_strength":-67,"free_storage":5368709120,"capture_errors":0}
+//
+// Every reading is optional, but a report needs at least one.
+type TelemetryReport struct {
+	// Timestamp is when the readings were taken, the time the server
+	// received them when unset.
+	Timestamp      *time.Time `json:"timestamp,omitempty"`
+	BatteryLevel   *float64   `json:"battery_level,omitempty"`
+	Temperature    *float64   `json:"temperature,omitempty"`
+	SignalStrength *float64   `json:"signal_strength,omitempty"`
+	FreeStorage    *float64   `json:"free_storage,omitempty"`
+	CaptureErrors  *float64   `json:"capture_errors,omitempty"`
+}
+
+// TelemetrySample is one stored report.
+type TelemetrySample struct {
+	DeviceID  string                      `json:"device_id" bson:"device_id"`
+	Timestamp time.Time                   `json:"timestamp" bson:"timestamp"`
+	Values    map[TelemetryMetric]float64 `json:"values" bson:"values"`
+}
+
+// ParseTelemetryReport decodes and validates a telemetry payload into a
+// sample. Reports timestamped in the future, from a device with a wrong
+// clock, are stored at receivedAt instead.
+func ParseTelemetryReport(deviceID string, payload []byte, receivedAt time.Time) (*TelemetrySample, error) {
+	var report TelemetryReport
+	if err := json.Unmarshal(payload, &report); err != nil {
+		return nil, fmt.Errorf("invalid telemetry report: %v", err)
+	}
+
+	sample := &TelemetrySample{DeviceID: deviceID, Timestamp: receivedAt, Values: map[TelemetryMetric]float64{}}
+	if report.Timestamp != nil && !report.Timestamp.After(receivedAt) {
+		sample.Timestamp = report.Timestamp.UTC()
+	}
+	readings := []struct {
+		metric   TelemetryMetric
+		value    *float64
+		min, max float64
+	}{
+		{MetricBatteryLevel, report.BatteryLevel, 0, 100},
+		{MetricTemperature, report.Temperature, -50, 150},
+		{MetricSignalStrength, report.SignalStrength, -200, 0},
+		{MetricFreeStorage, report.FreeStorage, 0, math.MaxFloat64},
+		{MetricCaptureErrors, report.CaptureErrors, 0, math.MaxFloat64},
+	}
+	for _, reading := range readings {
+		if reading.value == nil {
+			continue
+		}
+		if *reading.value < reading.min || *reading.value > reading.max {
+			return nil, fmt.Errorf("%s %v is out of range", reading.metric, *reading.value)
+		}
+		sample.Values[reading.metric] = *reading.value
+	}
+	if len(sample.Values) == 0 {
+		return nil, errors.New("telemetry report has no readings")
+	}
+	return sample, nil
+}
+
+// TelemetryQuery selects one metric of a device over a time range. With an
+// Interval the readings are downsampled into buckets of that length,
+// aligned to the Unix epoch.
+type TelemetryQuery struct {
+	DeviceID string
+	Metric   TelemetryMetric
+	From     time.Time
+	To       time.Time
+	Interval time.Duration
+}
+
+func (q TelemetryQuery) Validate() error {
+	if !slices.Contains(TelemetryMetrics, q.Metric) {
+		return fmt.Errorf("invalid metric %q", q.Metric)
+	}
+	if !q.From.Before(q.To) {
+		return errors.New("from must be before to")
+	}
+	if q.Interval != 0 {
+		if q.Interval < MinTelemetryInterval {
+			return fmt.Errorf("interval must be at least %s", MinTelemetryInterval)
+		}
+		if q.To.Sub(q.From)/q.Interval >= MaxTelemetryPoints {
+			return fmt.Errorf("interval is too short for the range, at most %d points are returned", MaxTelemetryPoints)
+		}
+	}
+	return nil
+}
+
+// TelemetryPoint is one reading, or the summary of a downsampled bucket
+// starting at Timestamp. Value is the average of the bucket.
+type TelemetryPoint struct {
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+	Value     float64   `json:"value" bson:"value"`
+	Min       float64   `json:"min" bson:"min"`
+	Max       float64   `json:"max" bson:"max"`
+	Count     int       `json:"count" bson:"count"`
+}
+
+type TelemetryRepository interface {
+	Save(ctx context.Context, sample *TelemetrySample) error
+	// Query returns the points of the query oldest first, or
+	// ErrTooManyTelemetryPoints when there are more than MaxTelemetryPoints.
+	Query(ctx context.Context, query TelemetryQuery) ([]TelemetryPoint, error)
+}
@@ -0,0 +1,84 @@
+package domain_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mqtt-streaming-server/domain"
+)
+
+func TestParseTelemetryReport(t *testing.T) {
+	receivedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		payload       string
+		wantValues    map[domain.TelemetryMetric]float64
+		wantTimestamp time.Time
+		wantErr       string
+	}{
+		{
+			name:          "every reading",
+			payload:       `{"timestamp":"2024-05-01T11:59:00Z","battery_level":80,"temperature":31.5,"signal_strength":-67,"free_storage":5368709120,"capture_errors":2}`,
+			wantValues:    map[domain.TelemetryMetric]float64{"battery_level": 80, "temperature": 31.5, "signal_strength": -67, "free_storage": 5368709120, "capture_errors": 2},
+			wantTimestamp: receivedAt.Add(-time.Minute),
+		},
+		{name: "no timestamp", payload: `{"battery_level":50}`, wantValues: map[domain.TelemetryMetric]float64{"battery_level": 50}, wantTimestamp: receivedAt},
+		{name: "timestamp in the future", payload: `{"timestamp":"2030-01-01T00:00:00Z","battery_level":50}`, wantValues: map[domain.TelemetryMetric]float64{"battery_level": 50}, wantTimestamp: receivedAt},
+		{name: "no readings", payload: `{"timestamp":"2024-05-01T11:59:00Z"}`, wantErr: "no readings"},
+		{name: "battery out of range", payload: `{"battery_level":101}`, wantErr: "battery_level 101 is out of range"},
+		{name: "positive signal", payload: `{"signal_strength":3}`, wantErr: "signal_strength 3 is out of range"},
+		{name: "malformed", payload: `battery=80`, wantErr: "invalid telemetry report"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sample, err := domain.ParseTelemetryReport("dev-1", []byte(tt.payload), receivedAt)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sample.DeviceID != "dev-1" || !sample.Timestamp.Equal(tt.wantTimestamp) || !reflect.DeepEqual(sample.Values, tt.wantValues) {
+				t.Errorf("unexpected sample %+v", sample)
+			}
+		})
+	}
+}
+
+func TestTelemetryQuery_Validate(t *testing.T) {
+	to := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	day := domain.TelemetryQuery{Metric: domain.MetricBatteryLevel, From: to.Add(-24 * time.Hour), To: to}
+
+	withInterval := func(interval time.Duration) domain.TelemetryQuery {
+		q := day
+		q.Interval = interval
+		return q
+	}
+	tests := []struct {
+		name    string
+		query   domain.TelemetryQuery
+		wantErr bool
+	}{
+		{name: "raw", query: day},
+		{name: "hourly", query: withInterval(time.Hour)},
+		{name: "unknown metric", query: domain.TelemetryQuery{Metric: "humidity", From: day.From, To: to}, wantErr: true},
+		{name: "empty range", query: domain.TelemetryQuery{Metric: domain.MetricBatteryLevel, From: to, To: to}, wantErr: true},
+		{name: "interval below a second", query: withInterval(time.Millisecond), wantErr: true},
+		{name: "too many buckets", query: withInterval(5 * time.Second), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.query.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
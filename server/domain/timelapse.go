@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Time-lapse job states. Jobs are queued, picked up by a worker and end in one
+// of the three final states.
+const (
+	TimelapseStatusQueued    = "queued"
+	TimelapseStatusRunning   = "running"
+	TimelapseStatusCompleted = "completed"
+	TimelapseStatusFailed    = "failed"
+	TimelapseStatusCanceled  = "canceled"
+)
+
+const MaxTimelapseFPS = 60
+
+type VideoFormat string
+
+const (
+	VideoMP4  VideoFormat = "mp4"
+	VideoWebM VideoFormat = "webm"
+)
+
+func (f VideoFormat) ContentType() string {
+	return "video/" + string(f)
+}
+
+type Timelapse struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	DeviceID string             `json:"device_id" bson:"device_id"`
+	Start    time.Time          `json:"start" bson:"start"`
+	End      time.Time          `json:"end" bson:"end"`
+	FPS      int                `json:"fps" bson:"fps"`
+	Format   VideoFormat        `json:"format" bson:"format"`
+	// Overlay burns the capture time of every photo into its frame.
+	Overlay bool   `json:"overlay" bson:"overlay"`
+	Status  string `json:"status" bson:"status"`
+	// Progress goes from 0 to 100 while the job is running.
+	Progress   int    `json:"progress" bson:"progress"`
+	FrameCount int    `json:"frame_count" bson:"frame_count"`
+	Size       int64  `json:"size,omitempty" bson:"size,omitempty"`
+	Error      string `json:"error,omitempty" bson:"error,omitempty"`
+	// StorageKey is the blob key of the finished video.
+	StorageKey  string     `json:"-" bson:"storage_key,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty" bson:"-"`
+	RequestedBy string     `json:"requested_by" bson:"requested_by"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+// Validate rejects jobs that cannot be rendered.
+func (t *Timelapse) Validate() error {
+	if t.DeviceID == "" {
+		return errors.New("device ID must not be empty")
+	}
+	if t.Start.IsZero() || t.End.IsZero() || !t.End.After(t.Start) {
+		return errors.New("end must be after start")
+	}
+	if t.FPS < 1 || t.FPS > MaxTimelapseFPS {
+		return fmt.Errorf("fps must be between 1 and %d", MaxTimelapseFPS)
+	}
+	switch t.Format {
+	case VideoMP4, VideoWebM:
+	default:
+		return fmt.Errorf("invalid format %q, expected mp4 or webm", t.Format)
+	}
+	return nil
+}
+
+// Finished reports whether the job reached a final state.
+func (t *Timelapse) Finished() bool {
+	switch t.Status {
+	case TimelapseStatusCompleted, TimelapseStatusFailed, TimelapseStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// TimelapseStorageKey is the blob key the video of the job is stored under.
+func TimelapseStorageKey(id primitive.ObjectID, format VideoFormat) string {
+	return fmt.Sprintf("timelapses/%s.%s", id.Hex(), format)
+}
+
+type TimelapseRepository interface {
+	// Save inserts the job and sets its ID.
+	Save(ctx context.Context, timelapse *Timelapse) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*Timelapse, error)
+	// List returns the jobs of the device, or of all devices when deviceID is empty, newest first.
+	List(ctx context.Context, deviceID string) ([]*Timelapse, error)
+	GetByStatus(ctx context.Context, status string) ([]*Timelapse, error)
+	Update(ctx context.Context, timelapse *Timelapse) error
+	// SetStatus moves the job from status from to status to, and reports
+	// whether it still had status from. Moving to a final status sets FinishedAt.
+	SetStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookEventType names a lifecycle event that webhook subscriptions receive.
+type WebhookEventType string
+
+const (
+	WebhookPhotoIngested      WebhookEventType = "photo.ingested"
+	WebhookDeviceRegistered   WebhookEventType = "device.registered"
+	WebhookDeviceDisconnected WebhookEventType = "device.disconnected"
+)
+
+// WebhookEventTypes lists every event type, in the order they are documented.
+var WebhookEventTypes = []WebhookEventType{WebhookPhotoIngested, WebhookDeviceRegistered, WebhookDeviceDisconnected}
+
+// WebhookSchemaVersion is the version of the event payload schemas. It only
+// changes when a field is removed or changes meaning; new fields may be added
+// within a version.
+const WebhookSchemaVersion = 1
+
+// WebhookEvent is the envelope POSTed to subscribers. Data holds one of the
+// event-specific payloads below.
+type WebhookEvent struct {
+	// ID is shared by every delivery and replay of the event, so receivers can deduplicate.
+	ID         string           `json:"id"`
+	Type       WebhookEventType `json:"type"`
+	Version    int              `json:"version"`
+	OccurredAt time.Time        `json:"occurred_at"`
+	DeviceID   string           `json:"device_id"`
+	Data       any              `json:"data"`
+}
+
+// PhotoIngestedData is the payload of photo.ingested, sent once the photo is
+// stored and committed.
+type PhotoIngestedData struct {
+	PhotoID   string    `json:"photo_id"`
+	DeviceID  string    `json:"device_id"`
+	Timestamp time.Time `json:"timestamp"`
+	ImageType string    `json:"image_type"`
+	Text      string    `json:"text"`
+	Unchanged bool      `json:"unchanged"`
+}
+
+// DeviceEventData is the payload of device.registered and device.disconnected.
+type DeviceEventData struct {
+	DeviceID     string `json:"device_id"`
+	DeviceName   string `json:"device_name"`
+	DeviceStatus string `json:"device_status"`
+	// LastSeen is when the device last published a message, if known.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+func NewPhotoIngestedEvent(photo *Photo) WebhookEvent {
+	return newWebhookEvent(WebhookPhotoIngested, photo.DeviceID, PhotoIngestedData{
+		PhotoID:   photo.ID.Hex(),
+		DeviceID:  photo.DeviceID,
+		Timestamp: photo.Timestamp,
+		ImageType: photo.ImageType,
+		Text:      photo.Text,
+		Unchanged: photo.Unchanged,
+	})
+}
+
+func NewDeviceEvent(eventType WebhookEventType, device *Device) WebhookEvent {
+	return newWebhookEvent(eventType, device.DeviceID, DeviceEventData{
+		DeviceID:     device.DeviceID,
+		DeviceName:   device.DeviceName,
+		DeviceStatus: device.DeviceStatus,
+		LastSeen:     device.LastSeen,
+	})
+}
+
+func newWebhookEvent(eventType WebhookEventType, deviceID string, data any) WebhookEvent {
+	return WebhookEvent{
+		ID:         primitive.NewObjectID().Hex(),
+		Type:       eventType,
+		Version:    WebhookSchemaVersion,
+		OccurredAt: time.Now().UTC(),
+		DeviceID:   deviceID,
+		Data:       data,
+	}
+}
+
+// WebhookPublisher hands lifecycle events to the webhook dispatcher without blocking.
+type WebhookPublisher interface {
+	Publish(event WebhookEvent)
+}
+
+type WebhookSubscription struct {
+	ID  primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	URL string             `json:"url" bson:"url"`
+	// Events are the event types the subscription receives.
+	Events []WebhookEventType `json:"events" bson:"events"`
+	// DeviceIDs limits the subscription to these devices; empty matches every device.
+	DeviceIDs []string `json:"device_ids,omitempty" bson:"device_ids,omitempty"`
+	// Secret is the HMAC key deliveries are signed with. The API only returns
+	// it when the subscription is created or the secret is changed.
+	Secret    string    `json:"secret,omitempty" bson:"secret"`
+	Enabled   bool      `json:"enabled" bson:"enabled"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Validate rejects subscriptions that could never be delivered.
+func (s *WebhookSubscription) Validate() error {
+	target, err := url.Parse(s.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if len(s.Events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	for _, event := range s.Events {
+		if !slices.Contains(WebhookEventTypes, event) {
+			return fmt.Errorf("invalid event %q", event)
+		}
+	}
+	if s.Secret == "" {
+		return errors.New("secret must not be empty")
+	}
+	return nil
+}
+
+// Matches reports whether the subscription wants the event.
+func (s *WebhookSubscription) Matches(event WebhookEvent) bool {
+	if !s.Enabled || !slices.Contains(s.Events, event.Type) {
+		return false
+	}
+	return len(s.DeviceIDs) == 0 || slices.Contains(s.DeviceIDs, event.DeviceID)
+}
+
+const (
+	// WebhookDeliveryPending deliveries are waiting for their next attempt.
+	WebhookDeliveryPending = "pending"
+	// WebhookDeliverySucceeded deliveries got a 2xx response.
+	WebhookDeliverySucceeded = "succeeded"
+	// WebhookDeliveryFailed deliveries ran out of attempts.
+	WebhookDeliveryFailed = "failed"
+)
+
+// WebhookDelivery is one event sent to one subscription, with the outcome of
+// its attempts. The payload is kept so the delivery can be replayed verbatim.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SubscriptionID primitive.ObjectID `json:"subscription_id" bson:"subscription_id"`
+	EventID        string             `json:"event_id" bson:"event_id"`
+	EventType      WebhookEventType   `json:"event_type" bson:"event_type"`
+	Payload        string             `json:"payload" bson:"payload"`
+	Status         string             `json:"status" bson:"status"`
+	Attempts       int                `json:"attempts" bson:"attempts"`
+	// ResponseStatus is the HTTP status of the last attempt, zero if no response arrived.
+	ResponseStatus int        `json:"response_status,omitempty" bson:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	// ReplayOf is the delivery this one replays, if any.
+	ReplayOf  *primitive.ObjectID `json:"replay_of,omitempty" bson:"replay_of,omitempty"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// WebhookDeliveryQuery filters the delivery log; zero values match everything.
+type WebhookDeliveryQuery struct {
+	SubscriptionID primitive.ObjectID
+	Status         string
+	Limit          int
+}
+
+type WebhookSubscriptionRepository interface {
+	Save(ctx context.Context, subscription *WebhookSubscription) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*WebhookSubscription, error)
+	List(ctx context.Context) ([]*WebhookSubscription, error)
+	// GetByEvent returns the enabled subscriptions to the event type.
+	GetByEvent(ctx context.Context, eventType WebhookEventType) ([]*WebhookSubscription, error)
+	Update(ctx context.Context, subscription *WebhookSubscription) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type WebhookDeliveryRepository interface {
+	Save(ctx context.Context, delivery *WebhookDelivery) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*WebhookDelivery, error)
+	List(ctx context.Context, query WebhookDeliveryQuery) ([]*WebhookDelivery, error)
+	// GetDue returns up to limit pending deliveries whose next attempt is at or before now.
+	GetDue(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error)
+	Update(ctx context.Context, delivery *WebhookDelivery) error
+}
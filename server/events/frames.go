@@ -0,0 +1,191 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTooManyViewers = errors.New("too many viewers for this device")
+
+type Frame struct {
+	DeviceID    string
+	Data        []byte
+	ContentType string
+	Timestamp   time.Time
+	// Seq increases by one for every frame pushed for the device.
+	Seq uint64
+}
+
+// FrameStore keeps the most recent frames of every device in a ring buffer,
+// so live viewers are served from memory instead of blob storage. The
+// buffers of devices that go idle without viewers are dropped by EvictIdle.
+type FrameStore struct {
+	mu         sync.Mutex
+	capacity   int
+	maxViewers int
+	devices    map[string]*deviceFrames
+}
+
+type deviceFrames struct {
+	ring    []Frame
+	next    int
+	seq     uint64
+	viewers int
+	// active is when a frame was last pushed or a viewer last left.
+	active time.Time
+	// notify is closed and replaced whenever a frame is pushed.
+	notify chan struct{}
+}
+
+// NewFrameStore keeps capacity frames per device and allows up to maxViewers concurrent viewers per device.
+func NewFrameStore(capacity, maxViewers int) *FrameStore {
+	if capacity <= 0 {
+		capacity = 8
+	}
+	if maxViewers <= 0 {
+		maxViewers = 4
+	}
+	return &FrameStore{
+		capacity:   capacity,
+		maxViewers: maxViewers,
+		devices:    make(map[string]*deviceFrames),
+	}
+}
+
+func (s *FrameStore) device(deviceID string) *deviceFrames {
+	d, ok := s.devices[deviceID]
+	if !ok {
+		d = &deviceFrames{
+			ring:   make([]Frame, s.capacity),
+			notify: make(chan struct{}),
+		}
+		s.devices[deviceID] = d
+	}
+	return d
+}
+
+func (s *FrameStore) Push(deviceID string, data []byte, contentType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.device(deviceID)
+	d.seq++
+	d.ring[d.next] = Frame{
+		DeviceID:    deviceID,
+		Data:        data,
+		ContentType: contentType,
+		Timestamp:   time.Now().UTC(),
+		Seq:         d.seq,
+	}
+	d.next = (d.next + 1) % len(d.ring)
+	d.active = d.ring[(d.next+len(d.ring)-1)%len(d.ring)].Timestamp
+	close(d.notify)
+	d.notify = make(chan struct{})
+}
+
+// EvictIdle drops the frames of the devices without viewers that have been
+// idle since before the given time, and returns how many it dropped.
+func (s *FrameStore) EvictIdle(before time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	evicted := 0
+	for deviceID, d := range s.devices {
+		if d.viewers == 0 && d.active.Before(before) {
+			delete(s.devices, deviceID)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Run evicts the devices idle for longer than ttl until ctx is cancelled.
+func (s *FrameStore) Run(ctx context.Context, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	ticker := time.NewTicker(ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.EvictIdle(time.Now().UTC().Add(-ttl))
+	}
+}
+
+// Latest returns the most recent frame of the device, if any.
+func (s *FrameStore) Latest(deviceID string) (Frame, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[deviceID]
+	if !ok || d.seq == 0 {
+		return Frame{}, false
+	}
+	return d.ring[(d.next+len(d.ring)-1)%len(d.ring)], true
+}
+
+// Watch registers a viewer of the device. The first frame it receives is the latest one.
+func (s *FrameStore) Watch(deviceID string) (*FrameViewer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.device(deviceID)
+	if d.viewers >= s.maxViewers {
+		return nil, ErrTooManyViewers
+	}
+	d.viewers++
+	lastSeq := d.seq
+	if lastSeq > 0 {
+		lastSeq--
+	}
+	return &FrameViewer{store: s, deviceID: deviceID, lastSeq: lastSeq}, nil
+}
+
+type FrameViewer struct {
+	store    *FrameStore
+	deviceID string
+	lastSeq  uint64
+	once     sync.Once
+}
+
+// Next blocks until there is a frame the viewer has not seen yet. A viewer that
+// falls more than the ring capacity behind skips to the oldest buffered frame.
+func (v *FrameViewer) Next(ctx context.Context) (Frame, error) {
+	for {
+		v.store.mu.Lock()
+		d := v.store.devices[v.deviceID]
+		if d.seq > v.lastSeq {
+			oldest := uint64(1)
+			if d.seq > uint64(len(d.ring)) {
+				oldest = d.seq - uint64(len(d.ring)) + 1
+			}
+			want := max(v.lastSeq+1, oldest)
+			// The frame with sequence n sits (seq-n) slots before the write position
+			frame := d.ring[(d.next+len(d.ring)-1-int(d.seq-want))%len(d.ring)]
+			v.store.mu.Unlock()
+			v.lastSeq = frame.Seq
+			return frame, nil
+		}
+		notify := d.notify
+		v.store.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Frame{}, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// Close releases the viewer slot. It is safe to call more than once.
+func (v *FrameViewer) Close() {
+	v.once.Do(func() {
+		v.store.mu.Lock()
+		d := v.store.devices[v.deviceID]
+		d.viewers--
+		d.active = time.Now().UTC()
+		v.store.mu.Unlock()
+	})
+}
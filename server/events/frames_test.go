@@ -0,0 +1,128 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mqtt-streaming-server/events"
+)
+
+func TestFrameStore_ViewerStartsAtLatestFrame(t *testing.T) {
+	store := events.NewFrameStore(4, 2)
+	store.Push("dev-1", []byte("1"), "image/jpeg")
+	store.Push("dev-1", []byte("2"), "image/jpeg")
+
+	viewer, err := store.Watch("dev-1")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	defer viewer.Close()
+
+	frame, err := viewer.Next(context.Background())
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if string(frame.Data) != "2" {
+		t.Errorf("expected latest frame %q, got %q", "2", frame.Data)
+	}
+}
+
+func TestFrameStore_SlowViewerSkipsOverwrittenFrames(t *testing.T) {
+	store := events.NewFrameStore(2, 1)
+	viewer, err := store.Watch("dev-1")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	defer viewer.Close()
+
+	for _, data := range []string{"1", "2", "3", "4"} {
+		store.Push("dev-1", []byte(data), "image/jpeg")
+	}
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		frame, err := viewer.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		got = append(got, string(frame.Data))
+	}
+	if got[0] != "3" || got[1] != "4" {
+		t.Errorf("expected the two buffered frames [3 4], got %v", got)
+	}
+}
+
+func TestFrameStore_NextWaitsForNewFrame(t *testing.T) {
+	store := events.NewFrameStore(4, 1)
+	viewer, _ := store.Watch("dev-1")
+	defer viewer.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		store.Push("dev-1", []byte("live"), "image/jpeg")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	frame, err := viewer.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if string(frame.Data) != "live" {
+		t.Errorf("expected %q, got %q", "live", frame.Data)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := viewer.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded without new frames, got %v", err)
+	}
+}
+
+func TestFrameStore_ViewerCap(t *testing.T) {
+	store := events.NewFrameStore(4, 1)
+	first, err := store.Watch("dev-1")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if _, err := store.Watch("dev-1"); !errors.Is(err, events.ErrTooManyViewers) {
+		t.Errorf("expected ErrTooManyViewers, got %v", err)
+	}
+	first.Close()
+	first.Close()
+	second, err := store.Watch("dev-1")
+	if err != nil {
+		t.Fatalf("expected a free slot after Close, got %v", err)
+	}
+	second.Close()
+}
+
+func TestFrameStore_EvictIdle(t *testing.T) {
+	store := events.NewFrameStore(4, 2)
+	store.Push("idle", []byte("1"), "image/jpeg")
+	store.Push("watched", []byte("1"), "image/jpeg")
+	viewer, err := store.Watch("watched")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	if evicted := store.EvictIdle(time.Now().Add(-time.Minute)); evicted != 0 {
+		t.Errorf("expected recently active devices to stay, %d evicted", evicted)
+	}
+	if evicted := store.EvictIdle(time.Now().Add(time.Minute)); evicted != 1 {
+		t.Errorf("expected only the device without viewers evicted, %d evicted", evicted)
+	}
+	if _, ok := store.Latest("idle"); ok {
+		t.Error("expected the frames of the idle device to be dropped")
+	}
+	if _, ok := store.Latest("watched"); !ok {
+		t.Error("expected the frames of the watched device to be kept")
+	}
+
+	viewer.Close()
+	if evicted := store.EvictIdle(time.Now().Add(time.Minute)); evicted != 1 {
+		t.Errorf("expected the device to be evicted once its viewer left, %d evicted", evicted)
+	}
+}
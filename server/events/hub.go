@@ -0,0 +1,105 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// SlowConsumerPolicy decides what happens when a subscriber's buffer is full.
+type SlowConsumerPolicy string
+
+const (
+	// DropEvents skips the event for that subscriber and counts it as dropped.
+	DropEvents SlowConsumerPolicy = "drop"
+	// Disconnect closes the subscription so the consumer can reconnect and resync.
+	Disconnect SlowConsumerPolicy = "disconnect"
+)
+
+// Hub fans out published events to any number of subscribers. Publish never
+// blocks: a subscriber that cannot keep up is handled by the hub's policy.
+type Hub[T any] struct {
+	mu         sync.RWMutex
+	subs       map[*Subscription[T]]struct{}
+	bufferSize int
+	policy     SlowConsumerPolicy
+}
+
+type Subscription[T any] struct {
+	// C receives the events; it is closed when the subscription ends.
+	C <-chan T
+
+	ch      chan T
+	filter  func(T) bool
+	hub     *Hub[T]
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+func NewHub[T any](bufferSize int, policy SlowConsumerPolicy) *Hub[T] {
+	if bufferSize <= 0 {
+		bufferSize = 16
+	}
+	if policy != Disconnect {
+		policy = DropEvents
+	}
+	return &Hub[T]{
+		subs:       make(map[*Subscription[T]]struct{}),
+		bufferSize: bufferSize,
+		policy:     policy,
+	}
+}
+
+// Subscribe registers a subscriber receiving the events accepted by filter, or all events when filter is nil.
+func (h *Hub[T]) Subscribe(filter func(T) bool) *Subscription[T] {
+	ch := make(chan T, h.bufferSize)
+	sub := &Subscription[T]{C: ch, ch: ch, filter: filter, hub: h}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *Hub[T]) Publish(event T) {
+	h.mu.RLock()
+	var slow []*Subscription[T]
+	for sub := range h.subs {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+			if h.policy == Disconnect {
+				slow = append(slow, sub)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range slow {
+		sub.Close()
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (h *Hub[T]) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Close unsubscribes and closes C. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		s.hub.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Dropped returns how many events this subscriber missed because its buffer was full.
+func (s *Subscription[T]) Dropped() int64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,83 @@
+package events_test
+
+import (
+	"testing"
+
+	"mqtt-streaming-server/events"
+)
+
+func TestHub_PublishFiltersEvents(t *testing.T) {
+	hub := events.NewHub[string](4, events.DropEvents)
+	all := hub.Subscribe(nil)
+	defer all.Close()
+	onlyA := hub.Subscribe(func(event string) bool { return event == "a" })
+	defer onlyA.Close()
+
+	hub.Publish("a")
+	hub.Publish("b")
+
+	if got := len(all.C); got != 2 {
+		t.Errorf("expected 2 events for unfiltered subscriber, got %d", got)
+	}
+	if got := len(onlyA.C); got != 1 {
+		t.Errorf("expected 1 event for filtered subscriber, got %d", got)
+	}
+}
+
+func TestHub_SlowConsumerPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      events.SlowConsumerPolicy
+		wantClosed  bool
+		wantDropped int64
+	}{
+		{name: "drop keeps the subscriber", policy: events.DropEvents, wantDropped: 2},
+		{name: "disconnect closes the subscriber", policy: events.Disconnect, wantClosed: true, wantDropped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := events.NewHub[int](1, tt.policy)
+			sub := hub.Subscribe(nil)
+			defer sub.Close()
+
+			hub.Publish(1)
+			hub.Publish(2)
+			hub.Publish(3)
+
+			if sub.Dropped() != tt.wantDropped {
+				t.Errorf("expected %d dropped events, got %d", tt.wantDropped, sub.Dropped())
+			}
+
+			// Drain what was buffered and check whether the channel was closed
+			closed := false
+			for i := 0; i < 2; i++ {
+				if _, ok := <-sub.C; !ok {
+					closed = true
+					break
+				}
+				if !tt.wantClosed {
+					break
+				}
+			}
+			if closed != tt.wantClosed {
+				t.Errorf("expected closed=%v, got %v", tt.wantClosed, closed)
+			}
+			if tt.wantClosed && hub.Subscribers() != 0 {
+				t.Errorf("expected slow subscriber to be removed, %d left", hub.Subscribers())
+			}
+		})
+	}
+}
+
+func TestSubscription_CloseIsIdempotent(t *testing.T) {
+	hub := events.NewHub[int](1, events.DropEvents)
+	sub := hub.Subscribe(nil)
+	sub.Close()
+	sub.Close()
+	if hub.Subscribers() != 0 {
+		t.Errorf("expected no subscribers, got %d", hub.Subscribers())
+	}
+	// Publishing after close must not panic
+	hub.Publish(1)
+}
@@ -0,0 +1,61 @@
+package imaging
+
+import "image"
+
+// SignatureSize is the edge of the grid images are reduced to for comparison.
+const SignatureSize = 32
+
+// changeTolerance is how far, on a 0-255 scale, a cell's brightness may move
+// before it counts as changed. It absorbs sensor noise and JPEG artifacts.
+const changeTolerance = 16
+
+// Signature is an image reduced to a SignatureSize x SignatureSize grid of
+// average brightness values; it is cheap to keep per device and to compare.
+type Signature [SignatureSize * SignatureSize]uint8
+
+func NewSignature(img image.Image) Signature {
+	src := ToRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	var sig Signature
+	for cy := 0; cy < SignatureSize; cy++ {
+		y0, y1 := cy*h/SignatureSize, max((cy+1)*h/SignatureSize, cy*h/SignatureSize+1)
+		for cx := 0; cx < SignatureSize; cx++ {
+			x0, x1 := cx*w/SignatureSize, max((cx+1)*w/SignatureSize, cx*w/SignatureSize+1)
+			var sum, n int
+			for y := y0; y < min(y1, h); y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < min(x1, w); x++ {
+					p := row[x*4 : x*4+3]
+					sum += (299*int(p[0]) + 587*int(p[1]) + 114*int(p[2])) / 1000
+					n++
+				}
+			}
+			if n > 0 {
+				sig[cy*SignatureSize+cx] = uint8(sum / n)
+			}
+		}
+	}
+	return sig
+}
+
+// ChangeScore returns the share of the frame, from 0 to 1, that differs
+// between the two signatures. The average brightness of each frame is
+// subtracted first, so exposure adjustments alone do not count as change.
+func ChangeScore(a, b Signature) float64 {
+	var sumA, sumB int
+	for i := range a {
+		sumA += int(a[i])
+		sumB += int(b[i])
+	}
+	shift := (sumB - sumA) / len(a)
+
+	changed := 0
+	for i := range a {
+		diff := int(b[i]) - int(a[i]) - shift
+		if diff > changeTolerance || diff < -changeTolerance {
+			changed++
+		}
+	}
+	return float64(changed) / float64(len(a))
+}
@@ -0,0 +1,43 @@
+package imaging_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"mqtt-streaming-server/imaging"
+)
+
+func scene(brightness uint8, block image.Rectangle) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray{Y: brightness}}, image.Point{}, draw.Src)
+	draw.Draw(img, block, &image.Uniform{color.Black}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestChangeScore(t *testing.T) {
+	block := image.Rect(100, 100, 200, 200)
+	reference := imaging.NewSignature(scene(200, block))
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		wantMin float64
+		wantMax float64
+	}{
+		{name: "identical frame", img: scene(200, block), wantMin: 0, wantMax: 0},
+		{name: "exposure change only", img: scene(180, block), wantMin: 0, wantMax: 0.05},
+		{name: "object moved", img: scene(200, block.Add(image.Pt(300, 200))), wantMin: 0.05, wantMax: 0.2},
+		{name: "object gone", img: scene(200, image.Rectangle{}), wantMin: 0.02, wantMax: 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := imaging.ChangeScore(reference, imaging.NewSignature(tt.img))
+			if score < tt.wantMin || score > tt.wantMax {
+				t.Errorf("expected score between %.3f and %.3f, got %.3f", tt.wantMin, tt.wantMax, score)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package imaging_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"mqtt-streaming-server/imaging"
+)
+
+// withOrientation inserts an APP1 Exif segment holding the orientation after
+// the JPEG's start-of-image marker.
+func withOrientation(t *testing.T, orientation uint16, order binary.ByteOrder) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	if got := imaging.ExifOrientation(withOrientation(t, 6, binary.BigEndian)); got != 6 {
+		t.Errorf("expected orientation 6 from big-endian Exif, got %d", got)
+	}
+	if got := imaging.ExifOrientation(withOrientation(t, 3, binary.LittleEndian)); got != 3 {
+		t.Errorf("expected orientation 3 from little-endian Exif, got %d", got)
+	}
+	if got := imaging.ExifOrientation(withOrientation(t, 42, binary.BigEndian)); got != 1 {
+		t.Errorf("expected an invalid orientation to read as 1, got %d", got)
+	}
+	if got := imaging.ExifOrientation([]byte("not a jpeg")); got != 1 {
+		t.Errorf("expected 1 without Exif data, got %d", got)
+	}
+
+	// The segment survives decoding, so the photo itself stays valid
+	if _, err := jpeg.Decode(bytes.NewReader(withOrientation(t, 6, binary.BigEndian))); err != nil {
+		t.Errorf("expected the JPEG to decode, got %v", err)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image with a marked top-left pixel
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	img.SetGray(0, 0, color.Gray{Y: 255})
+
+	tests := []struct {
+		orientation  int
+		wantW, wantH int
+		wantMarked   image.Point
+	}{
+		{orientation: 1, wantW: 3, wantH: 2, wantMarked: image.Pt(0, 0)},
+		{orientation: 2, wantW: 3, wantH: 2, wantMarked: image.Pt(2, 0)},
+		{orientation: 3, wantW: 3, wantH: 2, wantMarked: image.Pt(2, 1)},
+		{orientation: 4, wantW: 3, wantH: 2, wantMarked: image.Pt(0, 1)},
+		{orientation: 5, wantW: 2, wantH: 3, wantMarked: image.Pt(0, 0)},
+		{orientation: 6, wantW: 2, wantH: 3, wantMarked: image.Pt(1, 0)},
+		{orientation: 7, wantW: 2, wantH: 3, wantMarked: image.Pt(1, 2)},
+		{orientation: 8, wantW: 2, wantH: 3, wantMarked: image.Pt(0, 2)},
+	}
+	for _, tt := range tests {
+		got := imaging.Orient(img, tt.orientation)
+		if got.Bounds().Dx() != tt.wantW || got.Bounds().Dy() != tt.wantH {
+			t.Errorf("orientation %d: expected %dx%d, got %v", tt.orientation, tt.wantW, tt.wantH, got.Bounds())
+			continue
+		}
+		if r, _, _, _ := got.At(tt.wantMarked.X, tt.wantMarked.Y).RGBA(); r == 0 {
+			t.Errorf("orientation %d: expected the marked pixel at %v", tt.orientation, tt.wantMarked)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// contrastClip is the share of the darkest and of the brightest pixels that
+// NormalizeContrast saturates, so a few specular highlights or dead pixels do
+// not decide the stretch.
+const contrastClip = 0.01
+
+// Grayscale converts img to 8-bit luma.
+func Grayscale(img image.Image) *image.Gray {
+	if gray, ok := img.(*image.Gray); ok && gray.Rect.Min == (image.Point{}) {
+		return gray
+	}
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+	return gray
+}
+
+// Crop returns the part of img inside rect, clamped to the image.
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	bounds := img.Bounds()
+	rect = rect.Add(bounds.Min).Intersect(bounds)
+	if rect.Empty() {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// NormalizeContrast stretches the brightness range of img to the full 0-255
+// scale, which lifts dim text off a dark or washed-out background.
+func NormalizeContrast(img *image.Gray) *image.Gray {
+	var histogram [256]int
+	for _, v := range img.Pix {
+		histogram[v]++
+	}
+	clip := int(float64(len(img.Pix)) * contrastClip)
+	lo, hi := 0, 255
+	for n := 0; lo < 255 && n+histogram[lo] <= clip; lo++ {
+		n += histogram[lo]
+	}
+	for n := 0; hi > 0 && n+histogram[hi] <= clip; hi-- {
+		n += histogram[hi]
+	}
+	if hi <= lo {
+		return img
+	}
+
+	var lut [256]uint8
+	for v := range lut {
+		scaled := (v - lo) * 255 / (hi - lo)
+		lut[v] = uint8(min(max(scaled, 0), 255))
+	}
+	dst := image.NewGray(img.Rect)
+	for i, v := range img.Pix {
+		dst.Pix[i] = lut[v]
+	}
+	return dst
+}
+
+// AdaptiveThreshold binarizes img against the mean brightness of each pixel's
+// neighbourhood, so text stays readable under uneven lighting where a single
+// global threshold would black out the shadows. Pixels darker than the local
+// mean by more than offset become black, the rest white.
+func AdaptiveThreshold(img *image.Gray, radius, offset int) *image.Gray {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if radius <= 0 {
+		// A window a few text lines tall suits typical phone photos
+		radius = max(7, min(w, h)/32)
+	}
+
+	// integral[y][x] is the sum of the pixels above and left of (x, y)
+	stride := w + 1
+	integral := make([]int64, stride*(h+1))
+	for y := 0; y < h; y++ {
+		var row int64
+		for x := 0; x < w; x++ {
+			row += int64(img.Pix[y*img.Stride+x])
+			integral[(y+1)*stride+x+1] = integral[y*stride+x+1] + row
+		}
+	}
+
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := max(0, y-radius), min(h, y+radius+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(0, x-radius), min(w, x+radius+1)
+			sum := integral[y1*stride+x1] - integral[y0*stride+x1] - integral[y1*stride+x0] + integral[y0*stride+x0]
+			mean := int(sum / int64((x1-x0)*(y1-y0)))
+			if int(img.Pix[y*img.Stride+x]) < mean-offset {
+				dst.Pix[y*dst.Stride+x] = 0
+			} else {
+				dst.Pix[y*dst.Stride+x] = 255
+			}
+		}
+	}
+	return dst
+}
+
+// Skew search range and resolution, in degrees.
+const (
+	maxSkew       = 15.0
+	skewStep      = 0.5
+	skewSampleMax = 800
+)
+
+// MinSkew is the smallest angle, in degrees, worth straightening; rotating
+// for less blurs the text more than it helps.
+const MinSkew = 0.25
+
+// EstimateSkew returns the angle, in degrees, by which the text lines in img
+// are rotated clockwise from horizontal. It projects the dark pixels onto rows
+// at every candidate angle and keeps the angle whose projection is sharpest,
+// which is where whole text lines fall into the same rows.
+func EstimateSkew(img *image.Gray) float64 {
+	sample := Grayscale(Fit(img, skewSampleMax))
+	w, h := sample.Rect.Dx(), sample.Rect.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	var sum int
+	for _, v := range sample.Pix {
+		sum += int(v)
+	}
+	threshold := sum / len(sample.Pix) * 3 / 4
+	var xs, ys []float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if int(sample.Pix[y*sample.Stride+x]) < threshold {
+				xs = append(xs, float64(x))
+				ys = append(ys, float64(y))
+			}
+		}
+	}
+	if len(xs) == 0 {
+		return 0
+	}
+
+	diagonal := int(math.Hypot(float64(w), float64(h))) + 1
+	bins := make([]float64, 2*diagonal)
+	best, bestScore := 0.0, -1.0
+	for angle := -maxSkew; angle <= maxSkew; angle += skewStep {
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		clear(bins)
+		for i := range xs {
+			row := int(ys[i]*cos-xs[i]*sin) + diagonal
+			bins[row]++
+		}
+		var score float64
+		for _, n := range bins {
+			score += n * n
+		}
+		if score > bestScore {
+			best, bestScore = angle, score
+		}
+	}
+	return best
+}
+
+// Rotate turns img by angle degrees counter-clockwise around its centre,
+// keeping its size and filling the uncovered corners with white.
+func Rotate(img *image.Gray, angle float64) *image.Gray {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	cx, cy := float64(w-1)/2, float64(h-1)/2
+
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Sample the source point that lands on (x, y)
+			dx, dy := float64(x)-cx, float64(y)-cy
+			sx := dx*cos - dy*sin + cx
+			sy := dx*sin + dy*cos + cy
+			dst.Pix[y*dst.Stride+x] = bilinear(img, sx, sy)
+		}
+	}
+	return dst
+}
+
+// RotatePoint maps a point of an image rotated by Rotate back to the source image.
+func RotatePoint(x, y float64, w, h int, angle float64) (float64, float64) {
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	cx, cy := float64(w-1)/2, float64(h-1)/2
+	dx, dy := x-cx, y-cy
+	return dx*cos - dy*sin + cx, dx*sin + dy*cos + cy
+}
+
+func bilinear(img *image.Gray, x, y float64) uint8 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if x < 0 || y < 0 || x > float64(w-1) || y > float64(h-1) {
+		return 255
+	}
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, w-1), min(y0+1, h-1)
+	fx, fy := x-float64(x0), y-float64(y0)
+	p := func(px, py int) float64 { return float64(img.Pix[py*img.Stride+px]) }
+	top := p(x0, y0)*(1-fx) + p(x1, y0)*fx
+	bottom := p(x0, y1)*(1-fx) + p(x1, y1)*fx
+	return uint8(top*(1-fy) + bottom*fy + 0.5)
+}
@@ -0,0 +1,101 @@
+package imaging_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"mqtt-streaming-server/imaging"
+)
+
+// page draws dark text-like lines on white paper.
+func page() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 400, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for y := 40; y < 260; y += 30 {
+		for row := y; row < y+6; row++ {
+			for x := 40; x < 360; x++ {
+				// Gaps between words
+				if x%50 < 40 {
+					img.SetGray(x, row, color.Gray{Y: 20})
+				}
+			}
+		}
+	}
+	return img
+}
+
+func TestEstimateSkew(t *testing.T) {
+	for _, angle := range []float64{-6, 0, 4} {
+		// Rotating counter-clockwise by -angle tilts the lines clockwise by angle
+		skewed := imaging.Rotate(page(), -angle)
+		got := imaging.EstimateSkew(skewed)
+		if math.Abs(got-angle) > 0.5 {
+			t.Errorf("expected skew %.1f, got %.1f", angle, got)
+		}
+		if math.Abs(imaging.EstimateSkew(imaging.Rotate(skewed, got))) >= 1 {
+			t.Errorf("expected rotating by %.1f to straighten the lines", got)
+		}
+	}
+}
+
+func TestRotatePoint(t *testing.T) {
+	// A point maps back to where it came from in the source
+	src := page()
+	rotated := imaging.Rotate(src, 10)
+	x, y := imaging.RotatePoint(200, 150, 400, 300, 10)
+	if math.Abs(x-199.5) > 1 || math.Abs(y-149.5) > 1 {
+		t.Errorf("expected the centre to stay in place, got (%.1f, %.1f)", x, y)
+	}
+	sx, sy := imaging.RotatePoint(100, 60, 400, 300, 10)
+	if got, want := rotated.GrayAt(100, 60).Y, src.GrayAt(int(math.Round(sx)), int(math.Round(sy))).Y; absDiff(got, want) > 128 {
+		t.Errorf("expected rotated pixel %d to match source pixel %d", got, want)
+	}
+}
+
+func TestNormalizeContrast(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 10, 10))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(100 + i%2*50)
+	}
+	got := imaging.NormalizeContrast(img)
+	if got.Pix[0] != 0 || got.Pix[1] != 255 {
+		t.Errorf("expected the range to stretch to 0-255, got %d-%d", got.Pix[0], got.Pix[1])
+	}
+}
+
+func TestAdaptiveThreshold(t *testing.T) {
+	// Text on a gradient from dark to light paper: every letter stays black
+	// and all of the paper turns white
+	img := image.NewGray(image.Rect(0, 0, 200, 50))
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 200; x++ {
+			paper := uint8(60 + x)
+			if x%20 < 4 && y > 20 && y < 30 {
+				paper -= 50
+			}
+			img.SetGray(x, y, color.Gray{Y: paper})
+		}
+	}
+	got := imaging.AdaptiveThreshold(img, 8, 10)
+	for _, p := range []image.Point{{1, 25}, {181, 25}} {
+		if got.GrayAt(p.X, p.Y).Y != 0 {
+			t.Errorf("expected text at %v to be black", p)
+		}
+	}
+	for _, p := range []image.Point{{10, 5}, {190, 45}} {
+		if got.GrayAt(p.X, p.Y).Y != 255 {
+			t.Errorf("expected paper at %v to be white", p)
+		}
+	}
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,79 @@
+// Package imaging holds the image processing the ingest pipeline runs on
+// photos, implemented on the standard library only.
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+)
+
+// DefaultJPEGQuality is used for derivatives when no quality is configured.
+const DefaultJPEGQuality = 80
+
+// ToRGBA returns img as an *image.RGBA, copying it when it is another type.
+func ToRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// Fit scales img down so its longest edge is at most maxEdge pixels, keeping
+// the aspect ratio. Images that already fit are returned unchanged. Every
+// destination pixel is the average of the source pixels it covers, which keeps
+// text and fine detail readable at thumbnail sizes.
+func Fit(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if maxEdge <= 0 || (w <= maxEdge && h <= maxEdge) {
+		return img
+	}
+
+	dw, dh := maxEdge, maxEdge
+	if w >= h {
+		dh = max(1, h*maxEdge/w)
+	} else {
+		dw = max(1, w*maxEdge/h)
+	}
+
+	src := ToRGBA(img)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG encodes img as a JPEG of the given quality.
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	if quality <= 0 || quality > 100 {
+		quality = DefaultJPEGQuality
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
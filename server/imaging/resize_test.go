@@ -0,0 +1,61 @@
+package imaging_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"mqtt-streaming-server/imaging"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		maxEdge       int
+		wantW, wantH  int
+	}{
+		{name: "landscape", width: 4000, height: 3000, maxEdge: 160, wantW: 160, wantH: 120},
+		{name: "portrait", width: 1080, height: 1920, maxEdge: 800, wantW: 450, wantH: 800},
+		{name: "already small", width: 100, height: 50, maxEdge: 160, wantW: 100, wantH: 50},
+		{name: "very wide keeps one row", width: 2000, height: 2, maxEdge: 160, wantW: 160, wantH: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewGray(image.Rect(0, 0, tt.width, tt.height))
+			bounds := imaging.Fit(img, tt.maxEdge).Bounds()
+			if bounds.Dx() != tt.wantW || bounds.Dy() != tt.wantH {
+				t.Errorf("expected %dx%d, got %dx%d", tt.wantW, tt.wantH, bounds.Dx(), bounds.Dy())
+			}
+		})
+	}
+}
+
+func TestFit_AveragesPixels(t *testing.T) {
+	// Alternating black and white columns average to mid grey
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x += 2 {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	got := imaging.Fit(img, 4).At(1, 1).(color.RGBA)
+	if got.R != 127 || got.G != 127 || got.B != 127 {
+		t.Errorf("expected mid grey, got %v", got)
+	}
+}
+
+func TestEncodeJPEG(t *testing.T) {
+	data, err := imaging.EncodeJPEG(image.NewRGBA(image.Rect(0, 0, 16, 9)), 0)
+	if err != nil {
+		t.Fatalf("EncodeJPEG failed: %v", err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != 16 || cfg.Height != 9 {
+		t.Errorf("expected a 16x9 JPEG, got %+v (%v)", cfg, err)
+	}
+}
@@ -0,0 +1,257 @@
+// Package jobs runs long jobs whose state is kept in a repository, such as
+// time-lapse renders and re-OCR runs, on a pool of background workers.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job states. Jobs are queued, claimed by a worker and end in one of the
+// three final states; the domain job types use the same values.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Repository moves a job between states. SetStatus only changes a job still
+// in the from state and reports whether it did, so a worker claiming a job
+// and a request canceling it cannot both win.
+type Repository interface {
+	SetStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error)
+}
+
+// Handler does the work of one kind of job.
+type Handler[J any] interface {
+	// Load returns a job a worker has claimed.
+	Load(ctx context.Context, id primitive.ObjectID) (J, error)
+	// Run processes the job on the given worker, numbered from 0. Its
+	// context is done when the job is canceled, times out or the queue is
+	// closed.
+	Run(ctx context.Context, worker int, job J) error
+	// Finish records the final state of the job, with the error message of a
+	// failed job. Its context is not the job's, which is already done for
+	// canceled and timed out jobs.
+	Finish(ctx context.Context, job J, status, message string)
+}
+
+type Config struct {
+	// Name is how log lines call a job, such as "time-lapse".
+	Name string
+	// Workers is the number of jobs run at the same time.
+	Workers int
+	// QueueSize is how many jobs may wait for a worker.
+	QueueSize int
+	// Timeout bounds a single job; zero means no limit.
+	Timeout time.Duration
+}
+
+// Queue hands queued jobs to its workers. A job is claimed by moving it from
+// queued to running, so a job canceled while it waited is skipped.
+type Queue[J any] struct {
+	repository Repository
+	handler    Handler[J]
+	cfg        Config
+
+	queue chan primitive.ObjectID
+	wg    sync.WaitGroup
+	ctx   context.Context
+	stop  context.CancelFunc
+
+	mu      sync.Mutex
+	running map[primitive.ObjectID]*runningJob
+}
+
+// runningJob is a job a worker holds; done is closed once the worker lets go of it.
+type runningJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewQueue[J any](repository Repository, handler Handler[J], cfg Config) *Queue[J] {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 16
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &Queue[J]{
+		repository: repository,
+		handler:    handler,
+		cfg:        cfg,
+		queue:      make(chan primitive.ObjectID, cfg.QueueSize),
+		ctx:        ctx,
+		stop:       stop,
+		running:    make(map[primitive.ObjectID]*runningJob),
+	}
+}
+
+// Start launches the workers and queues the given jobs, left queued by a
+// previous run, in order and without blocking on a full queue.
+func (q *Queue[J]) Start(queued []primitive.ObjectID) {
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.work(i)
+	}
+	if len(queued) == 0 {
+		return
+	}
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for _, id := range queued {
+			select {
+			case q.queue <- id:
+			case <-q.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the workers. Jobs still running are left in the running state
+// for the next run to requeue.
+func (q *Queue[J]) Close() {
+	q.stop()
+	q.wg.Wait()
+}
+
+// Enqueue queues a stored job unless the queue is full.
+func (q *Queue[J]) Enqueue(id primitive.ObjectID) bool {
+	select {
+	case q.queue <- id:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cancel marks a queued job as canceled, or stops a running job and waits for
+// its worker to record the final state. A finished job is left as it is.
+func (q *Queue[J]) Cancel(ctx context.Context, id primitive.ObjectID) error {
+	for {
+		if job, ok := q.worker(id); ok {
+			job.cancel()
+			select {
+			case <-job.done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		canceled, err := q.repository.SetStatus(ctx, id, StatusQueued, StatusCanceled)
+		if err != nil || canceled {
+			return err
+		}
+		// No longer queued: a worker claimed it in the meantime, or it finished
+		if _, ok := q.worker(id); !ok {
+			return nil
+		}
+	}
+}
+
+func (q *Queue[J]) worker(id primitive.ObjectID) (*runningJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.running[id]
+	return job, ok
+}
+
+func (q *Queue[J]) work(worker int) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case id := <-q.queue:
+			q.process(worker, id)
+		}
+	}
+}
+
+func (q *Queue[J]) process(worker int, id primitive.ObjectID) {
+	// Register before claiming, so a Cancel that finds the job still queued
+	// has marked it canceled before the claim, and one that does not finds
+	// it here
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if q.cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(q.ctx, q.cfg.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(q.ctx)
+	}
+	defer cancel()
+	running := &runningJob{cancel: cancel, done: make(chan struct{})}
+	q.mu.Lock()
+	q.running[id] = running
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, id)
+		q.mu.Unlock()
+		close(running.done)
+	}()
+
+	if q.ctx.Err() != nil {
+		return
+	}
+	to := StatusRunning
+	if ctx.Err() != nil {
+		to = StatusCanceled
+	}
+	claimed, err := q.repository.SetStatus(q.ctx, id, StatusQueued, to)
+	if err != nil {
+		fmt.Printf("Failed to start %s %s: %v\n", q.cfg.Name, id.Hex(), err)
+		return
+	}
+	if !claimed || to == StatusCanceled {
+		// Canceled or deleted while waiting
+		return
+	}
+
+	job, err := q.handler.Load(q.ctx, id)
+	if err != nil {
+		if q.ctx.Err() != nil {
+			// Shutting down; the job is requeued on the next start
+			return
+		}
+		fmt.Printf("Failed to load %s %s: %v\n", q.cfg.Name, id.Hex(), err)
+		// Nothing to hand to Finish, so fail the claimed job directly rather
+		// than leave it running with no worker
+		failCtx, failCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer failCancel()
+		if _, err := q.repository.SetStatus(failCtx, id, StatusRunning, StatusFailed); err != nil {
+			fmt.Printf("Failed to mark %s %s as failed: %v\n", q.cfg.Name, id.Hex(), err)
+		}
+		return
+	}
+
+	err = q.handler.Run(ctx, worker, job)
+	switch {
+	case err == nil:
+		q.finish(job, StatusCompleted, "")
+	case q.ctx.Err() != nil:
+		// Shutting down; the job stays running and is requeued on the next start
+	case errors.Is(ctx.Err(), context.Canceled):
+		q.finish(job, StatusCanceled, "")
+	default:
+		fmt.Printf("Failed to run %s %s: %v\n", q.cfg.Name, id.Hex(), err)
+		q.finish(job, StatusFailed, err.Error())
+	}
+}
+
+func (q *Queue[J]) finish(job J, status, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	q.handler.Finish(ctx, job, status, message)
+}
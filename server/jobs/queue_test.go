@@ -0,0 +1,173 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"mqtt-streaming-server/jobs"
+)
+
+// fakeJobs keeps the status of every job and runs them with run, reporting
+// the jobs that reach a final state on finished.
+type fakeJobs struct {
+	mu       sync.Mutex
+	statuses map[primitive.ObjectID]string
+	run      func(ctx context.Context) error
+	loadErr  error
+	started  chan primitive.ObjectID
+	finished chan string
+}
+
+func newFakeJobs(run func(ctx context.Context) error) *fakeJobs {
+	return &fakeJobs{
+		statuses: make(map[primitive.ObjectID]string),
+		run:      run,
+		started:  make(chan primitive.ObjectID, 8),
+		finished: make(chan string, 8),
+	}
+}
+
+func (f *fakeJobs) add() primitive.ObjectID {
+	id := primitive.NewObjectID()
+	f.mu.Lock()
+	f.statuses[id] = jobs.StatusQueued
+	f.mu.Unlock()
+	return id
+}
+
+func (f *fakeJobs) status(id primitive.ObjectID) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.statuses[id]
+}
+
+func (f *fakeJobs) SetStatus(_ context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.statuses[id] != from {
+		return false, nil
+	}
+	f.statuses[id] = to
+	return true, nil
+}
+
+func (f *fakeJobs) Load(_ context.Context, id primitive.ObjectID) (primitive.ObjectID, error) {
+	return id, f.loadErr
+}
+
+func (f *fakeJobs) Run(ctx context.Context, _ int, id primitive.ObjectID) error {
+	f.started <- id
+	return f.run(ctx)
+}
+
+func (f *fakeJobs) Finish(_ context.Context, id primitive.ObjectID, status, message string) {
+	f.mu.Lock()
+	f.statuses[id] = status
+	f.mu.Unlock()
+	f.finished <- status + ":" + message
+}
+
+func waitForContext(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestQueue_FinalStates(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(ctx context.Context) error
+		want string
+	}{
+		{name: "completed", run: func(context.Context) error { return nil }, want: "completed:"},
+		{name: "failed", run: func(context.Context) error { return errors.New("no photos") }, want: "failed:no photos"},
+		{name: "timed out", run: waitForContext, want: "failed:context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeJobs(tt.run)
+			queue := jobs.NewQueue[primitive.ObjectID](fake, fake, jobs.Config{Name: "test job", Timeout: 50 * time.Millisecond})
+			queue.Start(nil)
+			defer queue.Close()
+
+			if !queue.Enqueue(fake.add()) {
+				t.Fatal("expected the job to be queued")
+			}
+			select {
+			case got := <-fake.finished:
+				if got != tt.want {
+					t.Errorf("expected %q, got %q", tt.want, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("job did not finish")
+			}
+		})
+	}
+}
+
+func TestQueue_Cancel(t *testing.T) {
+	fake := newFakeJobs(waitForContext)
+	queue := jobs.NewQueue[primitive.ObjectID](fake, fake, jobs.Config{Name: "test job"})
+	ctx := context.Background()
+
+	// Not started, so the job stays queued and is skipped once canceled
+	queued := fake.add()
+	queue.Enqueue(queued)
+	if err := queue.Cancel(ctx, queued); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if got := fake.status(queued); got != jobs.StatusCanceled {
+		t.Fatalf("expected queued job to be canceled, got %s", got)
+	}
+
+	running := fake.add()
+	queue.Enqueue(running)
+	queue.Start(nil)
+	defer queue.Close()
+	if id := <-fake.started; id != running {
+		t.Fatalf("expected only the running job to start, got %s", id.Hex())
+	}
+
+	// Cancel returns once the worker recorded the final state
+	if err := queue.Cancel(ctx, running); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if got := fake.status(running); got != jobs.StatusCanceled {
+		t.Errorf("expected running job to be canceled, got %s", got)
+	}
+}
+
+func TestQueue_CloseLeavesRunningJob(t *testing.T) {
+	fake := newFakeJobs(waitForContext)
+	queue := jobs.NewQueue[primitive.ObjectID](fake, fake, jobs.Config{Name: "test job"})
+	id := fake.add()
+	queue.Start([]primitive.ObjectID{id})
+	<-fake.started
+
+	queue.Close()
+	if got := fake.status(id); got != jobs.StatusRunning {
+		t.Errorf("expected the job to stay running for the next start, got %s", got)
+	}
+}
+
+func TestQueue_LoadFailureFailsJob(t *testing.T) {
+	fake := newFakeJobs(waitForContext)
+	fake.loadErr = errors.New("job not found")
+	queue := jobs.NewQueue[primitive.ObjectID](fake, fake, jobs.Config{Name: "test job"})
+	id := fake.add()
+	queue.Start([]primitive.ObjectID{id})
+	defer queue.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fake.status(id) != jobs.StatusFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the job to fail, got %s", fake.status(id))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
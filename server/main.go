@@ -4,20 +4,35 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	// Alert rule windows name IANA time zones, which the runtime image does not ship
+	_ "time/tzdata"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"github.com/otiai10/gosseract/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"mqtt-streaming-server/alerts"
 	"mqtt-streaming-server/broker"
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/events"
+	"mqtt-streaming-server/ocr"
+	"mqtt-streaming-server/ocr/tesseract"
+	"mqtt-streaming-server/reocr"
+	"mqtt-streaming-server/repository"
 	"mqtt-streaming-server/routes"
+	"mqtt-streaming-server/storage"
+	"mqtt-streaming-server/timelapse"
+	"mqtt-streaming-server/utils"
+	"mqtt-streaming-server/webhooks"
 )
 
 func NewTLSConfig() *tls.Config {
@@ -55,6 +70,81 @@ func NewTLSConfig() *tls.Config {
 	}
 }
 
+// certificateCommonName returns the common name of the first certificate in
+// the PEM file, the identity the broker sees for the client using it.
+func certificateCommonName(path string) (string, error) {
+	pemCert, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(pemCert)
+	if block == nil {
+		return "", fmt.Errorf("no certificate in %s", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// NewBlobStore picks the photo storage backend from BLOB_STORE (s3, fs or memory).
+func NewBlobStore(ctx context.Context) (domain.BlobStore, *storage.URLSigner, error) {
+	backend := utils.GetEnv("BLOB_STORE", "s3")
+	switch backend {
+	case "s3", "fs", "memory":
+	default:
+		return nil, nil, fmt.Errorf("unknown BLOB_STORE %q", backend)
+	}
+	if backend == "s3" {
+		store, err := storage.NewS3Store(ctx, storage.S3Config{
+			Bucket:    os.Getenv("S3_BUCKET_NAME"),
+			Region:    os.Getenv("AWS_REGION"),
+			AccessKey: os.Getenv("AWS_ACCESS_KEY"),
+			SecretKey: os.Getenv("AWS_SECRET_KEY"),
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+		})
+		return store, nil, err
+	}
+
+	// Stores without native presigning hand out links to the API's /blobs/
+	// route, signed with a key of their own: with an empty or shared key
+	// anyone holding it could forge a link to any photo
+	secret := os.Getenv("BLOB_URL_SECRET")
+	if secret == "" {
+		return nil, nil, fmt.Errorf("BLOB_STORE=%s needs BLOB_URL_SECRET", backend)
+	}
+	if secret == os.Getenv("JWT_SECRET") {
+		return nil, nil, errors.New("BLOB_URL_SECRET must differ from JWT_SECRET")
+	}
+	signer := storage.NewURLSigner(utils.GetEnv("BLOB_URL_BASE", "http://localhost:8080/blobs"), secret)
+
+	if backend == "memory" {
+		return storage.NewMemoryStore(signer), signer, nil
+	}
+	store, err := storage.NewFilesystemStore(utils.GetEnv("BLOB_DIR", "./data/blobs"), signer)
+	return store, signer, err
+}
+
+// NewTextExtractorFactory picks the OCR engine from OCR_ENGINE (tesseract,
+// command or none). The factory is called once per ingestion worker.
+func NewTextExtractorFactory() (func() domain.TextExtractor, error) {
+	switch engine := utils.GetEnv("OCR_ENGINE", "tesseract"); engine {
+	case "tesseract":
+		return func() domain.TextExtractor { return tesseract.New() }, nil
+	case "command":
+		args := strings.Fields(os.Getenv("OCR_COMMAND"))
+		if len(args) == 0 {
+			return nil, fmt.Errorf("OCR_ENGINE=command needs OCR_COMMAND")
+		}
+		return func() domain.TextExtractor { return ocr.NewCommand(args[0], args[1:]...) }, nil
+	case "none":
+		return func() domain.TextExtractor { return &ocr.Fake{} }, nil
+	default:
+		return nil, fmt.Errorf("unknown OCR_ENGINE %q", engine)
+	}
+}
+
 func main() {
 	// Connect to MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -75,13 +165,85 @@ func main() {
 
 	fmt.Println("Connected to MongoDB!")
 
+	// Older photos only have the timestamp-derived blob key; persist it on them
+	migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), 5*time.Minute)
+	photoRepository := repository.NewPhotoRepository(db)
+	if err := photoRepository.EnsureIndexes(migrateCtx); err != nil {
+		fmt.Println("Failed to create photo indexes:", err)
+		panic(err)
+	}
+	textVersionRepository := repository.NewPhotoTextVersionRepository(db)
+	if err := textVersionRepository.EnsureIndexes(migrateCtx); err != nil {
+		fmt.Println("Failed to create text version indexes:", err)
+		panic(err)
+	}
+	deviceRepository := repository.NewDeviceRepository(db)
+	statusHistoryRepository := repository.NewDeviceStatusHistoryRepository(db)
+	if err := statusHistoryRepository.EnsureIndexes(migrateCtx); err != nil {
+		fmt.Println("Failed to create device status history indexes:", err)
+		panic(err)
+	}
+	telemetryRepository := repository.NewTelemetryRepository(db)
+	if err := telemetryRepository.EnsureCollection(migrateCtx, utils.GetEnvDuration("TELEMETRY_RETENTION", 30*24*time.Hour)); err != nil {
+		fmt.Println("Failed to create telemetry collection:", err)
+		panic(err)
+	}
+	// Devices registered before presence tracking get a full timeout to check in
+	migrated, err := deviceRepository.BackfillLastSeen(migrateCtx, time.Now().UTC())
+	if err != nil {
+		fmt.Println("Failed to backfill device last seen:", err)
+		panic(err)
+	}
+	if migrated > 0 {
+		fmt.Printf("Backfilled last seen on %d devices\n", migrated)
+	}
+	migrated, err = photoRepository.BackfillStorageKeys(migrateCtx)
+	if err != nil {
+		fmt.Println("Failed to backfill photo storage keys:", err)
+		panic(err)
+	}
+	if migrated > 0 {
+		fmt.Printf("Backfilled storage keys on %d photos\n", migrated)
+	}
+	// Photos stored before ingestion states existed were uploaded already
+	migrated, err = photoRepository.BackfillStatus(migrateCtx)
+	if err != nil {
+		fmt.Println("Failed to backfill photo status:", err)
+		panic(err)
+	}
+	if migrated > 0 {
+		fmt.Printf("Marked %d existing photos as committed\n", migrated)
+	}
+	// OCR failures used to be stored as the text "OCR failed"
+	migrated, err = photoRepository.BackfillOCRFailures(migrateCtx)
+	cancelMigrate()
+	if err != nil {
+		fmt.Println("Failed to backfill OCR status:", err)
+		panic(err)
+	}
+	if migrated > 0 {
+		fmt.Printf("Marked OCR as failed on %d existing photos\n", migrated)
+	}
+
 	c := make(chan os.Signal, 1)
 
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	ocrClient := gosseract.NewClient()
-	defer ocrClient.Close()
-	brokerHandler := broker.NewBrokerHandler(db, ocrClient)
+	blobStore, signer, err := NewBlobStore(ctx)
+	if err != nil {
+		fmt.Println("Failed to set up blob storage:", err)
+		panic(err)
+	}
+
+	photoEvents := events.NewHub[domain.PhotoEvent](
+		utils.GetEnvInt("STREAM_BUFFER_SIZE", 32),
+		events.SlowConsumerPolicy(utils.GetEnv("STREAM_SLOW_CONSUMER_POLICY", string(events.DropEvents))),
+	)
+
+	frames := events.NewFrameStore(
+		utils.GetEnvInt("MJPEG_BUFFER_FRAMES", 8),
+		utils.GetEnvInt("MJPEG_MAX_VIEWERS", 4),
+	)
 
 	tlsconfig := NewTLSConfig()
 
@@ -89,30 +251,217 @@ func main() {
 	opts.AddBroker("ssl://broker:8883")
 	opts.SetClientID("web").SetTLSConfig(tlsconfig)
 
-	// Start the connection
 	client := mqtt.NewClient(opts)
+
+	alertSenders := map[domain.SinkType]alerts.Sender{
+		domain.SinkMQTT:    alerts.NewMQTTSender(client),
+		domain.SinkWebhook: alerts.NewWebhookSender(),
+		domain.SinkEmail: alerts.NewEmailSender(alerts.SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     utils.GetEnvInt("SMTP_PORT", 587),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}),
+	}
+	alertEngine := alerts.NewEngine(repository.NewAlertRuleRepository(db), repository.NewAlertRepository(db), alertSenders, alerts.Config{
+		QueueSize:   utils.GetEnvInt("ALERT_QUEUE_SIZE", 256),
+		SendTimeout: utils.GetEnvDuration("ALERT_SEND_TIMEOUT", 10*time.Second),
+	})
+	alertEngine.Start()
+	defer alertEngine.Close()
+
+	dispatcher := webhooks.NewDispatcher(repository.NewWebhookSubscriptionRepository(db), repository.NewWebhookDeliveryRepository(db), webhooks.Config{
+		Workers:        utils.GetEnvInt("WEBHOOK_WORKERS", 4),
+		QueueSize:      utils.GetEnvInt("WEBHOOK_QUEUE_SIZE", 256),
+		Timeout:        utils.GetEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		MaxAttempts:    utils.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		InitialBackoff: utils.GetEnvDuration("WEBHOOK_INITIAL_BACKOFF", 10*time.Second),
+		MaxBackoff:     utils.GetEnvDuration("WEBHOOK_MAX_BACKOFF", time.Hour),
+		PollInterval:   utils.GetEnvDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+	})
+	dispatcher.Start()
+	defer dispatcher.Close()
+
+	newTextExtractor, err := NewTextExtractorFactory()
+	if err != nil {
+		fmt.Println("Failed to set up OCR:", err)
+		panic(err)
+	}
+
+	// Devices without their own preprocessing settings get these steps; a crop
+	// region only makes sense per device
+	preprocessSteps, err := domain.ParsePreprocessSteps(os.Getenv("PHOTO_PREPROCESS"))
+	if err == nil {
+		err = domain.Preprocessing{Steps: preprocessSteps}.Validate()
+	}
+	if err != nil {
+		fmt.Println("Invalid PHOTO_PREPROCESS:", err)
+		panic(err)
+	}
+
+	ocrSettings := domain.OCRSettings{
+		PageSegMode: utils.GetEnvInt("OCR_PSM", 0),
+		Whitelist:   os.Getenv("OCR_WHITELIST"),
+	}
+	for _, language := range strings.Split(os.Getenv("OCR_LANGUAGES"), "+") {
+		if language = strings.TrimSpace(language); language != "" {
+			ocrSettings.Languages = append(ocrSettings.Languages, language)
+		}
+	}
+	if err := ocrSettings.Validate(); err != nil {
+		fmt.Println("Invalid OCR settings:", err)
+		panic(err)
+	}
+
+	brokerHandler := broker.NewBrokerHandler(photoRepository, deviceRepository, statusHistoryRepository, telemetryRepository, blobStore, photoEvents, frames, alertEngine, dispatcher, broker.PipelineConfig{
+		Workers:       utils.GetEnvInt("PHOTO_WORKERS", 4),
+		QueueSize:     utils.GetEnvInt("PHOTO_QUEUE_SIZE", 64),
+		Policy:        broker.QueuePolicy(utils.GetEnv("PHOTO_QUEUE_POLICY", string(broker.DropOldest))),
+		LookupTimeout: utils.GetEnvDuration("PHOTO_LOOKUP_TIMEOUT", 5*time.Second),
+		OCRTimeout:    utils.GetEnvDuration("PHOTO_OCR_TIMEOUT", 30*time.Second),
+		SaveTimeout:   utils.GetEnvDuration("PHOTO_SAVE_TIMEOUT", 10*time.Second),
+		UploadTimeout: utils.GetEnvDuration("PHOTO_UPLOAD_TIMEOUT", 30*time.Second),
+		UploadRetries: utils.GetEnvInt("PHOTO_UPLOAD_RETRIES", 3),
+
+		ThumbnailSize:     utils.GetEnvInt("PHOTO_THUMBNAIL_SIZE", 160),
+		PreviewSize:       utils.GetEnvInt("PHOTO_PREVIEW_SIZE", 800),
+		DerivativeQuality: utils.GetEnvInt("PHOTO_DERIVATIVE_QUALITY", 80),
+
+		ChangeDetection: domain.ChangeDetection{
+			Threshold: utils.GetEnvFloat("PHOTO_CHANGE_THRESHOLD", 0),
+			Action:    domain.ChangeAction(utils.GetEnv("PHOTO_CHANGE_ACTION", string(domain.ChangeActionFlag))),
+		},
+
+		Preprocessing: domain.Preprocessing{Steps: preprocessSteps},
+		OCR:           ocrSettings,
+
+		NewTextExtractor: newTextExtractor,
+	})
+	defer brokerHandler.Close()
+
+	reconcileCtx, stopReconciler := context.WithCancel(context.Background())
+	defer stopReconciler()
+	reconciler := broker.NewReconciler(photoRepository, blobStore, photoEvents, alertEngine, dispatcher, broker.ReconcilerConfig{
+		Interval:           utils.GetEnvDuration("RECONCILE_INTERVAL", time.Minute),
+		PendingGracePeriod: utils.GetEnvDuration("RECONCILE_PENDING_GRACE", 5*time.Minute),
+		MaxPendingAge:      utils.GetEnvDuration("RECONCILE_MAX_PENDING_AGE", time.Hour),
+	})
+	go reconciler.Run(reconcileCtx)
+
+	presence := broker.NewPresenceSweeper(deviceRepository, statusHistoryRepository, dispatcher, broker.PresenceConfig{
+		Interval: utils.GetEnvDuration("PRESENCE_SWEEP_INTERVAL", 30*time.Second),
+		Timeout:  utils.GetEnvDuration("PRESENCE_TIMEOUT", 3*time.Minute),
+	})
+	go presence.Run(reconcileCtx)
+	// Drop the live frames of devices nobody has watched or heard from in a while
+	go frames.Run(reconcileCtx, utils.GetEnvDuration("MJPEG_IDLE_TTL", 10*time.Minute))
+
+	timelapses := timelapse.NewRunner(repository.NewTimelapseRepository(db), photoRepository, blobStore,
+		timelapse.NewFFmpegRenderer(
+			utils.GetEnv("FFMPEG_PATH", "ffmpeg"),
+			utils.GetEnvInt("TIMELAPSE_WIDTH", 1280),
+			utils.GetEnvInt("TIMELAPSE_HEIGHT", 720),
+			utils.GetEnv("TIMELAPSE_FONT", "/usr/share/fonts/dejavu/DejaVuSans.ttf"),
+		),
+		timelapse.Config{
+			Workers:       utils.GetEnvInt("TIMELAPSE_WORKERS", 1),
+			QueueSize:     utils.GetEnvInt("TIMELAPSE_QUEUE_SIZE", 16),
+			MaxFrames:     utils.GetEnvInt("TIMELAPSE_MAX_FRAMES", 3600),
+			WorkDir:       utils.GetEnv("TIMELAPSE_WORK_DIR", ""),
+			RenderTimeout: utils.GetEnvDuration("TIMELAPSE_TIMEOUT", 30*time.Minute),
+		},
+	)
+	ocrJobs := reocr.NewRunner(repository.NewOCRJobRepository(db), photoRepository, textVersionRepository, deviceRepository, blobStore, reocr.Config{
+		Workers:          utils.GetEnvInt("REOCR_WORKERS", 1),
+		QueueSize:        utils.GetEnvInt("REOCR_QUEUE_SIZE", 16),
+		OCRTimeout:       utils.GetEnvDuration("PHOTO_OCR_TIMEOUT", 30*time.Second),
+		Preprocessing:    domain.Preprocessing{Steps: preprocessSteps},
+		OCR:              ocrSettings,
+		NewTextExtractor: newTextExtractor,
+	})
+	resumeCtx, cancelResume := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := timelapses.Start(resumeCtx); err != nil {
+		fmt.Println("Failed to resume time-lapse jobs:", err)
+	}
+	if err := ocrJobs.Start(resumeCtx); err != nil {
+		fmt.Println("Failed to resume re-OCR jobs:", err)
+	}
+	cancelResume()
+	defer timelapses.Close()
+	defer ocrJobs.Close()
+
+	// The broker asks the auth endpoints about every client, the server's own
+	// connection included, so they have to be up before connecting
+	serverIdentity := os.Getenv("MQTT_SERVER_IDENTITY")
+	if serverIdentity == "" {
+		serverIdentity, err = certificateCommonName("/run/secrets/web.crt")
+		if err != nil {
+			panic(err)
+		}
+	}
+	var sharedReadTopics []string
+	if topics := os.Getenv("MQTT_SHARED_READ_TOPICS"); topics != "" {
+		sharedReadTopics = strings.Split(topics, ",")
+	}
+	acl := broker.NewACL(broker.ACLConfig{
+		ServerIdentity:   serverIdentity,
+		SharedReadTopics: sharedReadTopics,
+		PublishWindow:    utils.GetEnvDuration("MQTT_PUBLISH_WINDOW", 10*time.Second),
+	})
+	authMux := http.NewServeMux()
+	routes.InitMQTTAuthRoutes(acl, authMux)
+	authAddr := utils.GetEnv("MQTT_AUTH_ADDR", ":8081")
+	go func() {
+		fmt.Println("Starting MQTT auth server on", authAddr)
+		if err := http.ListenAndServe(authAddr, authMux); err != nil {
+			panic(err)
+		}
+	}()
+
+	// Start the connection
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
 		panic(token.Error())
 	}
 
-	// Subscribe to a Topic
-	if token := client.Subscribe("photos/#", 0, brokerHandler.HandlePhoto); token.Wait() && token.Error() != nil {
+	// Subscribe to a Topic. Messages devices publish live are only handled
+	// when the ACL allowed their publisher to use the topic
+	if token := client.Subscribe("photos/#", 0, acl.Verified(brokerHandler.HandlePhoto)); token.Wait() && token.Error() != nil {
+		fmt.Println(token.Error())
+		os.Exit(1)
+	}
+
+	if token := client.Subscribe("register/#", 0, acl.Verified(brokerHandler.RegisterDevice)); token.Wait() && token.Error() != nil {
+		fmt.Println(token.Error())
+		os.Exit(1)
+	}
+
+	// Device status messages and wills are retained, so subscribing delivers
+	// the current state of every device. Being old, they rely on the broker
+	// ACL alone
+	if token := client.Subscribe("status/#", 1, brokerHandler.DisconnectDevice); token.Wait() && token.Error() != nil {
+		fmt.Println(token.Error())
+		os.Exit(1)
+	}
+
+	if token := client.Subscribe("telemetry/#", 0, acl.Verified(brokerHandler.HandleTelemetry)); token.Wait() && token.Error() != nil {
 		fmt.Println(token.Error())
 		os.Exit(1)
 	}
 
-	if token := client.Subscribe("register/#", 0, brokerHandler.RegisterDevice); token.Wait() && token.Error() != nil {
+	// Older app versions announce their disconnection on device/id/<id>
+	if token := client.Subscribe("device/id/#", 0, acl.Verified(brokerHandler.DisconnectDevice)); token.Wait() && token.Error() != nil {
 		fmt.Println(token.Error())
 		os.Exit(1)
 	}
 
-	if token := client.Subscribe("device/id/#", 0, brokerHandler.DisconnectDevice); token.Wait() && token.Error() != nil {
+	if token := client.Subscribe("heartbeat/#", 0, acl.Verified(brokerHandler.HandleHeartbeat)); token.Wait() && token.Error() != nil {
 		fmt.Println(token.Error())
 		os.Exit(1)
 	}
 
 	// Initialize user routes
-	handler := routes.InitRoutes(db, client)
+	handler := routes.InitRoutes(db, client, blobStore, signer, photoEvents, frames, timelapses, dispatcher, ocrJobs)
 
 	go func() {
 		fmt.Println("Starting HTTP server on port 8080...")
@@ -122,4 +471,6 @@ func main() {
 	}()
 
 	<-c
+	// Stop receiving new photos before draining the ingestion queue
+	client.Disconnect(250)
 }
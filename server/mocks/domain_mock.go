@@ -1,9 +1,9 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: mqtt-streaming-server/domain (interfaces: UserRepository,PhotoRepository,DeviceRepository)
+// Source: mqtt-streaming-server/domain (interfaces: UserRepository,PhotoRepository,DeviceRepository,BlobStore,TimelapseRepository,AlertRuleRepository,AlertRepository,WebhookSubscriptionRepository,WebhookDeliveryRepository,OCRJobRepository,PhotoTextVersionRepository,DeviceStatusHistoryRepository,TelemetryRepository)
 //
 // Generated by this command:
 //
-//	mockgen mqtt-streaming-server/domain UserRepository,PhotoRepository,DeviceRepository
+//	mockgen mqtt-streaming-server/domain UserRepository,PhotoRepository,DeviceRepository,BlobStore,TimelapseRepository,AlertRuleRepository,AlertRepository,WebhookSubscriptionRepository,WebhookDeliveryRepository,OCRJobRepository,PhotoTextVersionRepository,DeviceStatusHistoryRepository,TelemetryRepository
 //
 
 // Package mock_domain is a generated GoMock package.
@@ -11,9 +11,12 @@ package mock_domain
 
 import (
 	context "context"
+	io "io"
 	domain "mqtt-streaming-server/domain"
 	reflect "reflect"
+	time "time"
 
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -94,19 +97,63 @@ func (m *MockPhotoRepository) EXPECT() *MockPhotoRepositoryMockRecorder {
 	return m.recorder
 }
 
-// GetPhotos mocks base method.
-func (m *MockPhotoRepository) GetPhotos(ctx context.Context, filters map[string]any) ([]*domain.Photo, error) {
+// Delete mocks base method.
+func (m *MockPhotoRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockPhotoRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPhotoRepository)(nil).Delete), ctx, id)
+}
+
+// GetByID mocks base method.
+func (m *MockPhotoRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Photo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	ret0, _ := ret[0].(*domain.Photo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockPhotoRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockPhotoRepository)(nil).GetByID), ctx, id)
+}
+
+// GetByStatus mocks base method.
+func (m *MockPhotoRepository) GetByStatus(ctx context.Context, status string, before time.Time) ([]*domain.Photo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPhotos", ctx, filters)
+	ret := m.ctrl.Call(m, "GetByStatus", ctx, status, before)
 	ret0, _ := ret[0].([]*domain.Photo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// GetByStatus indicates an expected call of GetByStatus.
+func (mr *MockPhotoRepositoryMockRecorder) GetByStatus(ctx, status, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByStatus", reflect.TypeOf((*MockPhotoRepository)(nil).GetByStatus), ctx, status, before)
+}
+
+// GetPhotos mocks base method.
+func (m *MockPhotoRepository) GetPhotos(ctx context.Context, query domain.PhotoQuery) (*domain.PhotoPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPhotos", ctx, query)
+	ret0, _ := ret[0].(*domain.PhotoPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // GetPhotos indicates an expected call of GetPhotos.
-func (mr *MockPhotoRepositoryMockRecorder) GetPhotos(ctx, filters any) *gomock.Call {
+func (mr *MockPhotoRepositoryMockRecorder) GetPhotos(ctx, query any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPhotos", reflect.TypeOf((*MockPhotoRepository)(nil).GetPhotos), ctx, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPhotos", reflect.TypeOf((*MockPhotoRepository)(nil).GetPhotos), ctx, query)
 }
 
 // Save mocks base method.
@@ -123,6 +170,49 @@ func (mr *MockPhotoRepositoryMockRecorder) Save(ctx, photo any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockPhotoRepository)(nil).Save), ctx, photo)
 }
 
+// SearchPhotos mocks base method.
+func (m *MockPhotoRepository) SearchPhotos(ctx context.Context, query domain.PhotoQuery) ([]*domain.PhotoSearchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchPhotos", ctx, query)
+	ret0, _ := ret[0].([]*domain.PhotoSearchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchPhotos indicates an expected call of SearchPhotos.
+func (mr *MockPhotoRepositoryMockRecorder) SearchPhotos(ctx, query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchPhotos", reflect.TypeOf((*MockPhotoRepository)(nil).SearchPhotos), ctx, query)
+}
+
+// UpdateStatus mocks base method.
+func (m *MockPhotoRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, status string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateStatus", ctx, id, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateStatus indicates an expected call of UpdateStatus.
+func (mr *MockPhotoRepositoryMockRecorder) UpdateStatus(ctx, id, status any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockPhotoRepository)(nil).UpdateStatus), ctx, id, status)
+}
+
+// UpdateText mocks base method.
+func (m *MockPhotoRepository) UpdateText(ctx context.Context, photo *domain.Photo) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateText", ctx, photo)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateText indicates an expected call of UpdateText.
+func (mr *MockPhotoRepositoryMockRecorder) UpdateText(ctx, photo any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateText", reflect.TypeOf((*MockPhotoRepository)(nil).UpdateText), ctx, photo)
+}
+
 // MockDeviceRepository is a mock of DeviceRepository interface.
 type MockDeviceRepository struct {
 	ctrl     *gomock.Controller
@@ -177,6 +267,36 @@ func (mr *MockDeviceRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockDeviceRepository)(nil).GetByID), ctx, id)
 }
 
+// GetSilent mocks base method.
+func (m *MockDeviceRepository) GetSilent(ctx context.Context, before time.Time) ([]*domain.Device, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSilent", ctx, before)
+	ret0, _ := ret[0].([]*domain.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSilent indicates an expected call of GetSilent.
+func (mr *MockDeviceRepositoryMockRecorder) GetSilent(ctx, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSilent", reflect.TypeOf((*MockDeviceRepository)(nil).GetSilent), ctx, before)
+}
+
+// MarkSilentInactive mocks base method.
+func (m *MockDeviceRepository) MarkSilentInactive(ctx context.Context, id string, before time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkSilentInactive", ctx, id, before)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkSilentInactive indicates an expected call of MarkSilentInactive.
+func (mr *MockDeviceRepositoryMockRecorder) MarkSilentInactive(ctx, id, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkSilentInactive", reflect.TypeOf((*MockDeviceRepository)(nil).MarkSilentInactive), ctx, id, before)
+}
+
 // Save mocks base method.
 func (m *MockDeviceRepository) Save(ctx context.Context, device *domain.Device) error {
 	m.ctrl.T.Helper()
@@ -191,6 +311,36 @@ func (mr *MockDeviceRepositoryMockRecorder) Save(ctx, device any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockDeviceRepository)(nil).Save), ctx, device)
 }
 
+// SetStatus mocks base method.
+func (m *MockDeviceRepository) SetStatus(ctx context.Context, id, from, to string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetStatus", ctx, id, from, to)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetStatus indicates an expected call of SetStatus.
+func (mr *MockDeviceRepositoryMockRecorder) SetStatus(ctx, id, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetStatus", reflect.TypeOf((*MockDeviceRepository)(nil).SetStatus), ctx, id, from, to)
+}
+
+// Touch mocks base method.
+func (m *MockDeviceRepository) Touch(ctx context.Context, id string, seenAt time.Time, photo bool) (*domain.Device, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Touch", ctx, id, seenAt, photo)
+	ret0, _ := ret[0].(*domain.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Touch indicates an expected call of Touch.
+func (mr *MockDeviceRepositoryMockRecorder) Touch(ctx, id, seenAt, photo any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touch", reflect.TypeOf((*MockDeviceRepository)(nil).Touch), ctx, id, seenAt, photo)
+}
+
 // Update mocks base method.
 func (m *MockDeviceRepository) Update(ctx context.Context, id string, device *domain.Device) error {
 	m.ctrl.T.Helper()
@@ -204,3 +354,939 @@ func (mr *MockDeviceRepositoryMockRecorder) Update(ctx, id, device any) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockDeviceRepository)(nil).Update), ctx, id, device)
 }
+
+// UpdateChangeDetection mocks base method.
+func (m *MockDeviceRepository) UpdateChangeDetection(ctx context.Context, id string, settings *domain.ChangeDetection) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateChangeDetection", ctx, id, settings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateChangeDetection indicates an expected call of UpdateChangeDetection.
+func (mr *MockDeviceRepositoryMockRecorder) UpdateChangeDetection(ctx, id, settings any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateChangeDetection", reflect.TypeOf((*MockDeviceRepository)(nil).UpdateChangeDetection), ctx, id, settings)
+}
+
+// UpdateOCRSettings mocks base method.
+func (m *MockDeviceRepository) UpdateOCRSettings(ctx context.Context, id string, settings *domain.OCRSettings) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOCRSettings", ctx, id, settings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOCRSettings indicates an expected call of UpdateOCRSettings.
+func (mr *MockDeviceRepositoryMockRecorder) UpdateOCRSettings(ctx, id, settings any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOCRSettings", reflect.TypeOf((*MockDeviceRepository)(nil).UpdateOCRSettings), ctx, id, settings)
+}
+
+// UpdatePreprocessing mocks base method.
+func (m *MockDeviceRepository) UpdatePreprocessing(ctx context.Context, id string, settings *domain.Preprocessing) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePreprocessing", ctx, id, settings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePreprocessing indicates an expected call of UpdatePreprocessing.
+func (mr *MockDeviceRepositoryMockRecorder) UpdatePreprocessing(ctx, id, settings any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePreprocessing", reflect.TypeOf((*MockDeviceRepository)(nil).UpdatePreprocessing), ctx, id, settings)
+}
+
+// MockBlobStore is a mock of BlobStore interface.
+type MockBlobStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockBlobStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockBlobStoreMockRecorder is the mock recorder for MockBlobStore.
+type MockBlobStoreMockRecorder struct {
+	mock *MockBlobStore
+}
+
+// NewMockBlobStore creates a new mock instance.
+func NewMockBlobStore(ctrl *gomock.Controller) *MockBlobStore {
+	mock := &MockBlobStore{ctrl: ctrl}
+	mock.recorder = &MockBlobStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBlobStore) EXPECT() *MockBlobStoreMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockBlobStore) Delete(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockBlobStoreMockRecorder) Delete(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockBlobStore)(nil).Delete), ctx, key)
+}
+
+// Get mocks base method.
+func (m *MockBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, key)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockBlobStoreMockRecorder) Get(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockBlobStore)(nil).Get), ctx, key)
+}
+
+// Put mocks base method.
+func (m *MockBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", ctx, key, data, contentType)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockBlobStoreMockRecorder) Put(ctx, key, data, contentType any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockBlobStore)(nil).Put), ctx, key, data, contentType)
+}
+
+// SignedURL mocks base method.
+func (m *MockBlobStore) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SignedURL", ctx, key, expires)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SignedURL indicates an expected call of SignedURL.
+func (mr *MockBlobStoreMockRecorder) SignedURL(ctx, key, expires any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignedURL", reflect.TypeOf((*MockBlobStore)(nil).SignedURL), ctx, key, expires)
+}
+
+// Stat mocks base method.
+func (m *MockBlobStore) Stat(ctx context.Context, key string) (*domain.BlobInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", ctx, key)
+	ret0, _ := ret[0].(*domain.BlobInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat.
+func (mr *MockBlobStoreMockRecorder) Stat(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockBlobStore)(nil).Stat), ctx, key)
+}
+
+// MockTimelapseRepository is a mock of TimelapseRepository interface.
+type MockTimelapseRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTimelapseRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockTimelapseRepositoryMockRecorder is the mock recorder for MockTimelapseRepository.
+type MockTimelapseRepositoryMockRecorder struct {
+	mock *MockTimelapseRepository
+}
+
+// NewMockTimelapseRepository creates a new mock instance.
+func NewMockTimelapseRepository(ctrl *gomock.Controller) *MockTimelapseRepository {
+	mock := &MockTimelapseRepository{ctrl: ctrl}
+	mock.recorder = &MockTimelapseRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTimelapseRepository) EXPECT() *MockTimelapseRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockTimelapseRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockTimelapseRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockTimelapseRepository)(nil).Delete), ctx, id)
+}
+
+// GetByID mocks base method.
+func (m *MockTimelapseRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Timelapse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	ret0, _ := ret[0].(*domain.Timelapse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockTimelapseRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockTimelapseRepository)(nil).GetByID), ctx, id)
+}
+
+// GetByStatus mocks base method.
+func (m *MockTimelapseRepository) GetByStatus(ctx context.Context, status string) ([]*domain.Timelapse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByStatus", ctx, status)
+	ret0, _ := ret[0].([]*domain.Timelapse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByStatus indicates an expected call of GetByStatus.
+func (mr *MockTimelapseRepositoryMockRecorder) GetByStatus(ctx, status any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByStatus", reflect.TypeOf((*MockTimelapseRepository)(nil).GetByStatus), ctx, status)
+}
+
+// List mocks base method.
+func (m *MockTimelapseRepository) List(ctx context.Context, deviceID string) ([]*domain.Timelapse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, deviceID)
+	ret0, _ := ret[0].([]*domain.Timelapse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockTimelapseRepositoryMockRecorder) List(ctx, deviceID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockTimelapseRepository)(nil).List), ctx, deviceID)
+}
+
+// Save mocks base method.
+func (m *MockTimelapseRepository) Save(ctx context.Context, timelapse *domain.Timelapse) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, timelapse)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockTimelapseRepositoryMockRecorder) Save(ctx, timelapse any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockTimelapseRepository)(nil).Save), ctx, timelapse)
+}
+
+// SetStatus mocks base method.
+func (m *MockTimelapseRepository) SetStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetStatus", ctx, id, from, to)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetStatus indicates an expected call of SetStatus.
+func (mr *MockTimelapseRepositoryMockRecorder) SetStatus(ctx, id, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetStatus", reflect.TypeOf((*MockTimelapseRepository)(nil).SetStatus), ctx, id, from, to)
+}
+
+// Update mocks base method.
+func (m *MockTimelapseRepository) Update(ctx context.Context, timelapse *domain.Timelapse) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, timelapse)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockTimelapseRepositoryMockRecorder) Update(ctx, timelapse any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockTimelapseRepository)(nil).Update), ctx, timelapse)
+}
+
+// MockAlertRuleRepository is a mock of AlertRuleRepository interface.
+type MockAlertRuleRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAlertRuleRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockAlertRuleRepositoryMockRecorder is the mock recorder for MockAlertRuleRepository.
+type MockAlertRuleRepositoryMockRecorder struct {
+	mock *MockAlertRuleRepository
+}
+
+// NewMockAlertRuleRepository creates a new mock instance.
+func NewMockAlertRuleRepository(ctrl *gomock.Controller) *MockAlertRuleRepository {
+	mock := &MockAlertRuleRepository{ctrl: ctrl}
+	mock.recorder = &MockAlertRuleRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAlertRuleRepository) EXPECT() *MockAlertRuleRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockAlertRuleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockAlertRuleRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockAlertRuleRepository)(nil).Delete), ctx, id)
+}
+
+// GetByID mocks base method.
+func (m *MockAlertRuleRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.AlertRule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	ret0, _ := ret[0].(*domain.AlertRule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockAlertRuleRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockAlertRuleRepository)(nil).GetByID), ctx, id)
+}
+
+// GetEnabled mocks base method.
+func (m *MockAlertRuleRepository) GetEnabled(ctx context.Context) ([]*domain.AlertRule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEnabled", ctx)
+	ret0, _ := ret[0].([]*domain.AlertRule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEnabled indicates an expected call of GetEnabled.
+func (mr *MockAlertRuleRepositoryMockRecorder) GetEnabled(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEnabled", reflect.TypeOf((*MockAlertRuleRepository)(nil).GetEnabled), ctx)
+}
+
+// List mocks base method.
+func (m *MockAlertRuleRepository) List(ctx context.Context) ([]*domain.AlertRule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]*domain.AlertRule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockAlertRuleRepositoryMockRecorder) List(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAlertRuleRepository)(nil).List), ctx)
+}
+
+// Save mocks base method.
+func (m *MockAlertRuleRepository) Save(ctx context.Context, rule *domain.AlertRule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, rule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockAlertRuleRepositoryMockRecorder) Save(ctx, rule any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockAlertRuleRepository)(nil).Save), ctx, rule)
+}
+
+// Update mocks base method.
+func (m *MockAlertRuleRepository) Update(ctx context.Context, rule *domain.AlertRule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, rule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockAlertRuleRepositoryMockRecorder) Update(ctx, rule any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockAlertRuleRepository)(nil).Update), ctx, rule)
+}
+
+// MockAlertRepository is a mock of AlertRepository interface.
+type MockAlertRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAlertRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockAlertRepositoryMockRecorder is the mock recorder for MockAlertRepository.
+type MockAlertRepositoryMockRecorder struct {
+	mock *MockAlertRepository
+}
+
+// NewMockAlertRepository creates a new mock instance.
+func NewMockAlertRepository(ctrl *gomock.Controller) *MockAlertRepository {
+	mock := &MockAlertRepository{ctrl: ctrl}
+	mock.recorder = &MockAlertRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAlertRepository) EXPECT() *MockAlertRepositoryMockRecorder {
+	return m.recorder
+}
+
+// List mocks base method.
+func (m *MockAlertRepository) List(ctx context.Context, query domain.AlertQuery) ([]*domain.Alert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, query)
+	ret0, _ := ret[0].([]*domain.Alert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockAlertRepositoryMockRecorder) List(ctx, query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAlertRepository)(nil).List), ctx, query)
+}
+
+// Save mocks base method.
+func (m *MockAlertRepository) Save(ctx context.Context, alert *domain.Alert) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, alert)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockAlertRepositoryMockRecorder) Save(ctx, alert any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockAlertRepository)(nil).Save), ctx, alert)
+}
+
+// MockWebhookSubscriptionRepository is a mock of WebhookSubscriptionRepository interface.
+type MockWebhookSubscriptionRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookSubscriptionRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockWebhookSubscriptionRepositoryMockRecorder is the mock recorder for MockWebhookSubscriptionRepository.
+type MockWebhookSubscriptionRepositoryMockRecorder struct {
+	mock *MockWebhookSubscriptionRepository
+}
+
+// NewMockWebhookSubscriptionRepository creates a new mock instance.
+func NewMockWebhookSubscriptionRepository(ctrl *gomock.Controller) *MockWebhookSubscriptionRepository {
+	mock := &MockWebhookSubscriptionRepository{ctrl: ctrl}
+	mock.recorder = &MockWebhookSubscriptionRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookSubscriptionRepository) EXPECT() *MockWebhookSubscriptionRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockWebhookSubscriptionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockWebhookSubscriptionRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockWebhookSubscriptionRepository)(nil).Delete), ctx, id)
+}
+
+// GetByEvent mocks base method.
+func (m *MockWebhookSubscriptionRepository) GetByEvent(ctx context.Context, eventType domain.WebhookEventType) ([]*domain.WebhookSubscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByEvent", ctx, eventType)
+	ret0, _ := ret[0].([]*domain.WebhookSubscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByEvent indicates an expected call of GetByEvent.
+func (mr *MockWebhookSubscriptionRepositoryMockRecorder) GetByEvent(ctx, eventType any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByEvent", reflect.TypeOf((*MockWebhookSubscriptionRepository)(nil).GetByEvent), ctx, eventType)
+}
+
+// GetByID mocks base method.
+func (m *MockWebhookSubscriptionRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.WebhookSubscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	ret0, _ := ret[0].(*domain.WebhookSubscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockWebhookSubscriptionRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockWebhookSubscriptionRepository)(nil).GetByID), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockWebhookSubscriptionRepository) List(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]*domain.WebhookSubscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockWebhookSubscriptionRepositoryMockRecorder) List(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWebhookSubscriptionRepository)(nil).List), ctx)
+}
+
+// Save mocks base method.
+func (m *MockWebhookSubscriptionRepository) Save(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, subscription)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockWebhookSubscriptionRepositoryMockRecorder) Save(ctx, subscription any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockWebhookSubscriptionRepository)(nil).Save), ctx, subscription)
+}
+
+// Update mocks base method.
+func (m *MockWebhookSubscriptionRepository) Update(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, subscription)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockWebhookSubscriptionRepositoryMockRecorder) Update(ctx, subscription any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockWebhookSubscriptionRepository)(nil).Update), ctx, subscription)
+}
+
+// MockWebhookDeliveryRepository is a mock of WebhookDeliveryRepository interface.
+type MockWebhookDeliveryRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookDeliveryRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockWebhookDeliveryRepositoryMockRecorder is the mock recorder for MockWebhookDeliveryRepository.
+type MockWebhookDeliveryRepositoryMockRecorder struct {
+	mock *MockWebhookDeliveryRepository
+}
+
+// NewMockWebhookDeliveryRepository creates a new mock instance.
+func NewMockWebhookDeliveryRepository(ctrl *gomock.Controller) *MockWebhookDeliveryRepository {
+	mock := &MockWebhookDeliveryRepository{ctrl: ctrl}
+	mock.recorder = &MockWebhookDeliveryRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookDeliveryRepository) EXPECT() *MockWebhookDeliveryRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetByID mocks base method.
+func (m *MockWebhookDeliveryRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	ret0, _ := ret[0].(*domain.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockWebhookDeliveryRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockWebhookDeliveryRepository)(nil).GetByID), ctx, id)
+}
+
+// GetDue mocks base method.
+func (m *MockWebhookDeliveryRepository) GetDue(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDue", ctx, now, limit)
+	ret0, _ := ret[0].([]*domain.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDue indicates an expected call of GetDue.
+func (mr *MockWebhookDeliveryRepositoryMockRecorder) GetDue(ctx, now, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDue", reflect.TypeOf((*MockWebhookDeliveryRepository)(nil).GetDue), ctx, now, limit)
+}
+
+// List mocks base method.
+func (m *MockWebhookDeliveryRepository) List(ctx context.Context, query domain.WebhookDeliveryQuery) ([]*domain.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, query)
+	ret0, _ := ret[0].([]*domain.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockWebhookDeliveryRepositoryMockRecorder) List(ctx, query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWebhookDeliveryRepository)(nil).List), ctx, query)
+}
+
+// Save mocks base method.
+func (m *MockWebhookDeliveryRepository) Save(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockWebhookDeliveryRepositoryMockRecorder) Save(ctx, delivery any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockWebhookDeliveryRepository)(nil).Save), ctx, delivery)
+}
+
+// Update mocks base method.
+func (m *MockWebhookDeliveryRepository) Update(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockWebhookDeliveryRepositoryMockRecorder) Update(ctx, delivery any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockWebhookDeliveryRepository)(nil).Update), ctx, delivery)
+}
+
+// MockOCRJobRepository is a mock of OCRJobRepository interface.
+type MockOCRJobRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockOCRJobRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockOCRJobRepositoryMockRecorder is the mock recorder for MockOCRJobRepository.
+type MockOCRJobRepositoryMockRecorder struct {
+	mock *MockOCRJobRepository
+}
+
+// NewMockOCRJobRepository creates a new mock instance.
+func NewMockOCRJobRepository(ctrl *gomock.Controller) *MockOCRJobRepository {
+	mock := &MockOCRJobRepository{ctrl: ctrl}
+	mock.recorder = &MockOCRJobRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOCRJobRepository) EXPECT() *MockOCRJobRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockOCRJobRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockOCRJobRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockOCRJobRepository)(nil).Delete), ctx, id)
+}
+
+// GetByID mocks base method.
+func (m *MockOCRJobRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.OCRJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	ret0, _ := ret[0].(*domain.OCRJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockOCRJobRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockOCRJobRepository)(nil).GetByID), ctx, id)
+}
+
+// GetByStatus mocks base method.
+func (m *MockOCRJobRepository) GetByStatus(ctx context.Context, status string) ([]*domain.OCRJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByStatus", ctx, status)
+	ret0, _ := ret[0].([]*domain.OCRJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByStatus indicates an expected call of GetByStatus.
+func (mr *MockOCRJobRepositoryMockRecorder) GetByStatus(ctx, status any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByStatus", reflect.TypeOf((*MockOCRJobRepository)(nil).GetByStatus), ctx, status)
+}
+
+// List mocks base method.
+func (m *MockOCRJobRepository) List(ctx context.Context, deviceID string) ([]*domain.OCRJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, deviceID)
+	ret0, _ := ret[0].([]*domain.OCRJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockOCRJobRepositoryMockRecorder) List(ctx, deviceID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockOCRJobRepository)(nil).List), ctx, deviceID)
+}
+
+// Save mocks base method.
+func (m *MockOCRJobRepository) Save(ctx context.Context, job *domain.OCRJob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockOCRJobRepositoryMockRecorder) Save(ctx, job any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockOCRJobRepository)(nil).Save), ctx, job)
+}
+
+// SetStatus mocks base method.
+func (m *MockOCRJobRepository) SetStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetStatus", ctx, id, from, to)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetStatus indicates an expected call of SetStatus.
+func (mr *MockOCRJobRepositoryMockRecorder) SetStatus(ctx, id, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetStatus", reflect.TypeOf((*MockOCRJobRepository)(nil).SetStatus), ctx, id, from, to)
+}
+
+// Update mocks base method.
+func (m *MockOCRJobRepository) Update(ctx context.Context, job *domain.OCRJob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockOCRJobRepositoryMockRecorder) Update(ctx, job any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockOCRJobRepository)(nil).Update), ctx, job)
+}
+
+// MockPhotoTextVersionRepository is a mock of PhotoTextVersionRepository interface.
+type MockPhotoTextVersionRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockPhotoTextVersionRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockPhotoTextVersionRepositoryMockRecorder is the mock recorder for MockPhotoTextVersionRepository.
+type MockPhotoTextVersionRepositoryMockRecorder struct {
+	mock *MockPhotoTextVersionRepository
+}
+
+// NewMockPhotoTextVersionRepository creates a new mock instance.
+func NewMockPhotoTextVersionRepository(ctrl *gomock.Controller) *MockPhotoTextVersionRepository {
+	mock := &MockPhotoTextVersionRepository{ctrl: ctrl}
+	mock.recorder = &MockPhotoTextVersionRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPhotoTextVersionRepository) EXPECT() *MockPhotoTextVersionRepositoryMockRecorder {
+	return m.recorder
+}
+
+// DeleteByPhoto mocks base method.
+func (m *MockPhotoTextVersionRepository) DeleteByPhoto(ctx context.Context, photoID primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByPhoto", ctx, photoID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteByPhoto indicates an expected call of DeleteByPhoto.
+func (mr *MockPhotoTextVersionRepositoryMockRecorder) DeleteByPhoto(ctx, photoID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByPhoto", reflect.TypeOf((*MockPhotoTextVersionRepository)(nil).DeleteByPhoto), ctx, photoID)
+}
+
+// ListByPhoto mocks base method.
+func (m *MockPhotoTextVersionRepository) ListByPhoto(ctx context.Context, photoID primitive.ObjectID) ([]*domain.PhotoTextVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByPhoto", ctx, photoID)
+	ret0, _ := ret[0].([]*domain.PhotoTextVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListByPhoto indicates an expected call of ListByPhoto.
+func (mr *MockPhotoTextVersionRepositoryMockRecorder) ListByPhoto(ctx, photoID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByPhoto", reflect.TypeOf((*MockPhotoTextVersionRepository)(nil).ListByPhoto), ctx, photoID)
+}
+
+// Save mocks base method.
+func (m *MockPhotoTextVersionRepository) Save(ctx context.Context, version *domain.PhotoTextVersion) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockPhotoTextVersionRepositoryMockRecorder) Save(ctx, version any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockPhotoTextVersionRepository)(nil).Save), ctx, version)
+}
+
+// MockDeviceStatusHistoryRepository is a mock of DeviceStatusHistoryRepository interface.
+type MockDeviceStatusHistoryRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeviceStatusHistoryRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockDeviceStatusHistoryRepositoryMockRecorder is the mock recorder for MockDeviceStatusHistoryRepository.
+type MockDeviceStatusHistoryRepositoryMockRecorder struct {
+	mock *MockDeviceStatusHistoryRepository
+}
+
+// NewMockDeviceStatusHistoryRepository creates a new mock instance.
+func NewMockDeviceStatusHistoryRepository(ctrl *gomock.Controller) *MockDeviceStatusHistoryRepository {
+	mock := &MockDeviceStatusHistoryRepository{ctrl: ctrl}
+	mock.recorder = &MockDeviceStatusHistoryRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeviceStatusHistoryRepository) EXPECT() *MockDeviceStatusHistoryRepositoryMockRecorder {
+	return m.recorder
+}
+
+// List mocks base method.
+func (m *MockDeviceStatusHistoryRepository) List(ctx context.Context, deviceID string, limit int) ([]*domain.DeviceStatusChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, deviceID, limit)
+	ret0, _ := ret[0].([]*domain.DeviceStatusChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockDeviceStatusHistoryRepositoryMockRecorder) List(ctx, deviceID, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockDeviceStatusHistoryRepository)(nil).List), ctx, deviceID, limit)
+}
+
+// Save mocks base method.
+func (m *MockDeviceStatusHistoryRepository) Save(ctx context.Context, change *domain.DeviceStatusChange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockDeviceStatusHistoryRepositoryMockRecorder) Save(ctx, change any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockDeviceStatusHistoryRepository)(nil).Save), ctx, change)
+}
+
+// MockTelemetryRepository is a mock of TelemetryRepository interface.
+type MockTelemetryRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTelemetryRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockTelemetryRepositoryMockRecorder is the mock recorder for MockTelemetryRepository.
+type MockTelemetryRepositoryMockRecorder struct {
+	mock *MockTelemetryRepository
+}
+
+// NewMockTelemetryRepository creates a new mock instance.
+func NewMockTelemetryRepository(ctrl *gomock.Controller) *MockTelemetryRepository {
+	mock := &MockTelemetryRepository{ctrl: ctrl}
+	mock.recorder = &MockTelemetryRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTelemetryRepository) EXPECT() *MockTelemetryRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Query mocks base method.
+func (m *MockTelemetryRepository) Query(ctx context.Context, query domain.TelemetryQuery) ([]domain.TelemetryPoint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Query", ctx, query)
+	ret0, _ := ret[0].([]domain.TelemetryPoint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Query indicates an expected call of Query.
+func (mr *MockTelemetryRepositoryMockRecorder) Query(ctx, query any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Query", reflect.TypeOf((*MockTelemetryRepository)(nil).Query), ctx, query)
+}
+
+// Save mocks base method.
+func (m *MockTelemetryRepository) Save(ctx context.Context, sample *domain.TelemetrySample) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, sample)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockTelemetryRepositoryMockRecorder) Save(ctx, sample any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockTelemetryRepository)(nil).Save), ctx, sample)
+}
@@ -0,0 +1,79 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"mqtt-streaming-server/domain"
+)
+
+// Command runs an external program for every image. The image is written to
+// its stdin. Its stdout is either a JSON domain.OCRResult, for engines that
+// report confidence and word boxes, or plain text, so that e.g.
+// `tesseract stdin stdout` works unchanged.
+//
+// The OCR settings reach the program as environment variables:
+// OCR_LANGUAGES (joined with "+", as Tesseract's -l expects), OCR_PSM and
+// OCR_WHITELIST, each set only when the setting is.
+type Command struct {
+	Path string
+	Args []string
+}
+
+func NewCommand(path string, args ...string) *Command {
+	return &Command{Path: path, Args: args}
+}
+
+func (c *Command) Extract(ctx context.Context, image []byte, settings domain.OCRSettings) (*domain.OCRResult, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Env = append(os.Environ(), settingsEnv(settings)...)
+	cmd.Stdin = bytes.NewReader(image)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%s: %v: %s", c.Path, err, strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) > 0 && output[0] == '{' {
+		var result domain.OCRResult
+		if err := json.Unmarshal(output, &result); err != nil {
+			return nil, fmt.Errorf("%s: invalid JSON output: %v", c.Path, err)
+		}
+		return &result, nil
+	}
+	return &domain.OCRResult{Text: string(output)}, nil
+}
+
+func settingsEnv(settings domain.OCRSettings) []string {
+	var env []string
+	if len(settings.Languages) > 0 {
+		env = append(env, "OCR_LANGUAGES="+strings.Join(settings.Languages, "+"))
+	}
+	if settings.PageSegMode > 0 {
+		env = append(env, "OCR_PSM="+strconv.Itoa(settings.PageSegMode))
+	}
+	if settings.Whitelist != "" {
+		env = append(env, "OCR_WHITELIST="+settings.Whitelist)
+	}
+	return env
+}
+
+func (c *Command) Close() error {
+	return nil
+}
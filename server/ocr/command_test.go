@@ -0,0 +1,75 @@
+package ocr_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/ocr"
+)
+
+// script writes an executable shell script and returns its path.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ocr.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommand_Extract(t *testing.T) {
+	tests := []struct {
+		name           string
+		script         string
+		settings       domain.OCRSettings
+		wantText       string
+		wantConfidence float64
+		wantWords      int
+		wantErr        bool
+	}{
+		{name: "plain text output", script: `cat >/dev/null; echo "  HELLO WORLD  "`, wantText: "HELLO WORLD"},
+		{name: "stdin is the image", script: `cat`, wantText: "image-bytes"},
+		{
+			name:           "JSON output",
+			script:         `cat >/dev/null; echo '{"text":"EXIT","confidence":0.8,"words":[{"text":"EXIT","confidence":0.8,"x":1,"y":2,"width":30,"height":10}]}'`,
+			wantText:       "EXIT",
+			wantConfidence: 0.8,
+			wantWords:      1,
+		},
+		{
+			name:     "settings in the environment",
+			script:   `cat >/dev/null; echo "$OCR_LANGUAGES $OCR_PSM $OCR_WHITELIST"`,
+			settings: domain.OCRSettings{Languages: []string{"eng", "ron"}, PageSegMode: 7, Whitelist: "0123456789"},
+			wantText: "eng+ron 7 0123456789",
+		},
+		{name: "invalid JSON", script: `cat >/dev/null; echo '{"text":'`, wantErr: true},
+		{name: "command fails", script: `echo boom >&2; exit 3`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ocr.NewCommand(script(t, tt.script)).Extract(context.Background(), []byte("image-bytes"), tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result.Text != tt.wantText || result.Confidence != tt.wantConfidence || len(result.Words) != tt.wantWords {
+				t.Errorf("unexpected result %+v", result)
+			}
+		})
+	}
+}
+
+func TestCommand_ExtractTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ocr.NewCommand(script(t, "exec sleep 5")).Extract(ctx, nil, domain.OCRSettings{}); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
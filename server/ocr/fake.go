@@ -0,0 +1,55 @@
+// Package ocr holds the TextExtractor implementations that need no cgo, an
+// external command and a fake, and the preprocessing that prepares photos for
+// any engine. The Tesseract one lives in ocr/tesseract.
+package ocr
+
+import (
+	"context"
+	"sync"
+
+	"mqtt-streaming-server/domain"
+)
+
+// Fake returns a fixed result. Its zero value recognizes no text, which makes
+// it the no-op engine for deployments that do not need OCR.
+type Fake struct {
+	Result domain.OCRResult
+	Err    error
+
+	mu       sync.Mutex
+	calls    int
+	settings domain.OCRSettings
+}
+
+func (f *Fake) Extract(ctx context.Context, _ []byte, settings domain.OCRSettings) (*domain.OCRResult, error) {
+	f.mu.Lock()
+	f.calls++
+	f.settings = settings
+	f.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	result := f.Result
+	return &result, nil
+}
+
+// Calls returns how many images were passed to Extract.
+func (f *Fake) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// LastSettings returns the settings of the latest Extract call.
+func (f *Fake) LastSettings() domain.OCRSettings {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.settings
+}
+
+func (f *Fake) Close() error {
+	return nil
+}
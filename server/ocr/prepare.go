@@ -0,0 +1,189 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"math"
+	"strings"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/imaging"
+)
+
+// Prepared is a photo ready for OCR: one preprocessed image per region of
+// interest, or a single one for the whole photo.
+type Prepared struct {
+	// Width and Height are the photo's dimensions after auto-rotation, the
+	// frame the word boxes returned by Extract are expressed in.
+	Width, Height int
+
+	inputs []*ocrInput
+}
+
+// Prepare preprocesses the photo once per region of interest, or once as a
+// whole when there are none. Regions take the place of the preprocessing crop.
+func Prepare(body []byte, img image.Image, preprocessing domain.Preprocessing, regions []domain.Region) (*Prepared, error) {
+	if len(regions) == 0 {
+		input, err := preprocess(body, img, preprocessing)
+		if err != nil {
+			return nil, err
+		}
+		return &Prepared{Width: input.width, Height: input.height, inputs: []*ocrInput{input}}, nil
+	}
+
+	steps := []domain.PreprocessStep{domain.PreprocessCrop}
+	for _, step := range preprocessing.Steps {
+		if step != domain.PreprocessCrop {
+			steps = append(steps, step)
+		}
+	}
+	inputs := make([]*ocrInput, 0, len(regions))
+	for _, region := range regions {
+		input, err := preprocess(body, img, domain.Preprocessing{Steps: steps, Crop: &region})
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	return &Prepared{Width: inputs[0].width, Height: inputs[0].height, inputs: inputs}, nil
+}
+
+// Extract runs OCR on every prepared image and merges the results: the texts
+// one per line, the word boxes mapped back onto the photo, and the mean
+// confidence. Any failed region fails the whole extraction.
+func (p *Prepared) Extract(ctx context.Context, extractor domain.TextExtractor, settings domain.OCRSettings) (*domain.OCRResult, error) {
+	inputs := p.inputs
+	merged := &domain.OCRResult{}
+	var texts []string
+	for _, input := range inputs {
+		result, err := extractor.Extract(ctx, input.data, settings)
+		if err != nil {
+			return nil, err
+		}
+		if len(inputs) == 1 {
+			result.Words = input.mapWords(result.Words)
+			return result, nil
+		}
+		if text := strings.TrimSpace(result.Text); text != "" {
+			texts = append(texts, text)
+		}
+		merged.Confidence += result.Confidence / float64(len(inputs))
+		merged.Language = result.Language
+		merged.Words = append(merged.Words, input.mapWords(result.Words)...)
+	}
+	merged.Text = strings.Join(texts, "\n")
+	return merged, nil
+}
+
+// ocrInput is a photo prepared for OCR, along with what is needed to map the
+// word boxes found in it back onto the photo.
+type ocrInput struct {
+	data []byte
+	// width and height are the photo's dimensions after auto-rotation, the
+	// frame the mapped word boxes are expressed in.
+	width, height int
+
+	// offset is the top-left corner of the crop region.
+	offset image.Point
+	// deskew is the angle the cropped image was rotated by, and deskewed the
+	// size of the rotated image.
+	deskew   float64
+	deskewed image.Point
+}
+
+// preprocess runs the enabled steps over the photo in their canonical order.
+// Without any steps the original bytes go to OCR untouched.
+func preprocess(body []byte, img image.Image, settings domain.Preprocessing) (*ocrInput, error) {
+	input := &ocrInput{data: body, width: img.Bounds().Dx(), height: img.Bounds().Dy()}
+	if len(settings.Steps) == 0 {
+		return input, nil
+	}
+
+	if settings.Has(domain.PreprocessAutoRotate) {
+		img = imaging.Orient(img, imaging.ExifOrientation(body))
+		input.width, input.height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+	if settings.Has(domain.PreprocessCrop) && settings.Crop != nil {
+		rect := cropRect(*settings.Crop, input.width, input.height)
+		img = imaging.Crop(img, rect)
+		input.offset = rect.Min
+	}
+
+	// The remaining steps work on luma only; Tesseract binarizes colour
+	// images itself, so without them the image stays in colour
+	var gray *image.Gray
+	if settings.Has(domain.PreprocessGrayscale) || settings.Has(domain.PreprocessNormalize) ||
+		settings.Has(domain.PreprocessDeskew) || settings.Has(domain.PreprocessThreshold) {
+		gray = imaging.Grayscale(img)
+	}
+	if settings.Has(domain.PreprocessNormalize) {
+		gray = imaging.NormalizeContrast(gray)
+	}
+	if settings.Has(domain.PreprocessDeskew) {
+		if angle := imaging.EstimateSkew(gray); math.Abs(angle) >= imaging.MinSkew {
+			gray = imaging.Rotate(gray, angle)
+			input.deskew = angle
+			input.deskewed = gray.Rect.Size()
+		}
+	}
+	if settings.Has(domain.PreprocessThreshold) {
+		gray = imaging.AdaptiveThreshold(gray, 0, thresholdOffset)
+	}
+	if gray != nil {
+		img = gray
+	}
+
+	// PNG keeps thresholded text edges sharp where JPEG would smear them
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	input.data = buf.Bytes()
+	return input, nil
+}
+
+// thresholdOffset is how much darker than its surroundings a pixel must be to
+// count as ink, which keeps paper texture and sensor noise white.
+const thresholdOffset = 10
+
+// cropRect converts a crop region to pixels of a width x height image.
+func cropRect(region domain.Region, width, height int) image.Rectangle {
+	return image.Rect(
+		int(region.X*float64(width)),
+		int(region.Y*float64(height)),
+		int(math.Ceil((region.X+region.Width)*float64(width))),
+		int(math.Ceil((region.Y+region.Height)*float64(height))),
+	).Intersect(image.Rect(0, 0, width, height))
+}
+
+// mapWords moves word boxes found in the preprocessed image back onto the
+// photo, so highlights line up with what clients display.
+func (input *ocrInput) mapWords(words []domain.WordBox) []domain.WordBox {
+	if input.deskew == 0 && input.offset == (image.Point{}) {
+		return words
+	}
+	mapped := make([]domain.WordBox, len(words))
+	for i, word := range words {
+		x0, y0 := float64(word.X), float64(word.Y)
+		x1, y1 := x0+float64(word.Width), y0+float64(word.Height)
+		if input.deskew != 0 {
+			// A rotated box is no longer axis-aligned; keep its bounding box
+			minX, minY := math.Inf(1), math.Inf(1)
+			maxX, maxY := math.Inf(-1), math.Inf(-1)
+			for _, corner := range [][2]float64{{x0, y0}, {x1, y0}, {x0, y1}, {x1, y1}} {
+				x, y := imaging.RotatePoint(corner[0], corner[1], input.deskewed.X, input.deskewed.Y, input.deskew)
+				minX, minY = math.Min(minX, x), math.Min(minY, y)
+				maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+			}
+			x0, y0, x1, y1 = math.Max(minX, 0), math.Max(minY, 0), maxX, maxY
+		}
+		word.X = int(math.Round(x0)) + input.offset.X
+		word.Y = int(math.Round(y0)) + input.offset.Y
+		word.Width = int(math.Round(x1 - x0))
+		word.Height = int(math.Round(y1 - y0))
+		mapped[i] = word
+	}
+	return mapped
+}
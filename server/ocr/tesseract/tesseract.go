@@ -0,0 +1,122 @@
+// Package tesseract is the TextExtractor backed by the Tesseract library
+// through cgo.
+package tesseract
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/otiai10/gosseract/v2"
+
+	"mqtt-streaming-server/domain"
+)
+
+// defaultLanguages is what gosseract clients start with.
+var defaultLanguages = []string{"eng"}
+
+// Extractor owns a gosseract client, which cannot be shared between goroutines.
+type Extractor struct {
+	client *gosseract.Client
+}
+
+func New() *Extractor {
+	return &Extractor{client: gosseract.NewClient()}
+}
+
+// Extract runs OCR on the extractor's client. gosseract calls cannot be
+// interrupted, so on timeout the busy client is abandoned (and closed once
+// Tesseract returns) and the extractor continues with a fresh one.
+func (e *Extractor) Extract(ctx context.Context, image []byte, settings domain.OCRSettings) (*domain.OCRResult, error) {
+	type result struct {
+		ocr *domain.OCRResult
+		err error
+	}
+	client := e.client
+	done := make(chan result, 1)
+	go func() {
+		ocr, err := recognize(client, image, settings)
+		done <- result{ocr: ocr, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.ocr, res.err
+	case <-ctx.Done():
+		go func() {
+			<-done
+			client.Close()
+		}()
+		e.client = gosseract.NewClient()
+		return nil, ctx.Err()
+	}
+}
+
+func (e *Extractor) Close() error {
+	return e.client.Close()
+}
+
+// configure applies settings to the client. Every setting is set on every
+// call, since the client is shared by photos of all devices.
+func configure(client *gosseract.Client, settings domain.OCRSettings) error {
+	languages := settings.Languages
+	if len(languages) == 0 {
+		languages = defaultLanguages
+	}
+	// Changing languages reloads the models, so only do it when they differ
+	if !slices.Equal(client.Languages, languages) {
+		if err := client.SetLanguage(languages...); err != nil {
+			return err
+		}
+	}
+	mode := gosseract.PSM_AUTO
+	if settings.PageSegMode > 0 {
+		mode = gosseract.PageSegMode(settings.PageSegMode)
+	}
+	if err := client.SetPageSegMode(mode); err != nil {
+		return err
+	}
+	return client.SetWhitelist(settings.Whitelist)
+}
+
+func recognize(client *gosseract.Client, image []byte, settings domain.OCRSettings) (*domain.OCRResult, error) {
+	if err := configure(client, settings); err != nil {
+		return nil, fmt.Errorf("failed to apply OCR settings: %v", err)
+	}
+	if err := client.SetImageFromBytes(image); err != nil {
+		return nil, err
+	}
+	text, err := client.Text()
+	if err != nil {
+		return nil, err
+	}
+	boxes, err := client.GetBoundingBoxes(gosseract.RIL_WORD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get word boxes: %v", err)
+	}
+
+	result := &domain.OCRResult{Text: text, Language: strings.Join(client.Languages, "+")}
+	var total float64
+	for _, box := range boxes {
+		word := strings.TrimSpace(box.Word)
+		if word == "" {
+			continue
+		}
+		// Tesseract reports confidence as a percentage
+		confidence := box.Confidence / 100
+		result.Words = append(result.Words, domain.WordBox{
+			Text:       word,
+			Confidence: confidence,
+			X:          box.Box.Min.X,
+			Y:          box.Box.Min.Y,
+			Width:      box.Box.Dx(),
+			Height:     box.Box.Dy(),
+		})
+		total += confidence
+	}
+	if len(result.Words) > 0 {
+		result.Confidence = total / float64(len(result.Words))
+	}
+	return result, nil
+}
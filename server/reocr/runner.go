@@ -0,0 +1,321 @@
+// Package reocr reruns text extraction over stored photos, so that photos
+// taken before an OCR settings change or engine upgrade get the new text.
+package reocr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/jobs"
+	"mqtt-streaming-server/ocr"
+)
+
+var ErrQueueFull = errors.New("re-OCR queue is full")
+
+// maxTextUpdateAttempts bounds how often a photo is reloaded when other jobs
+// keep replacing its text first.
+const maxTextUpdateAttempts = 3
+
+type Config struct {
+	// Workers is the number of jobs run at the same time; each owns an OCR engine.
+	Workers int
+	// QueueSize is how many jobs may wait for a worker.
+	QueueSize int
+	// OCRTimeout bounds the extraction of a single photo.
+	OCRTimeout time.Duration
+
+	// Preprocessing and OCR apply to devices without their own settings, as
+	// they do on ingestion.
+	Preprocessing domain.Preprocessing
+	OCR           domain.OCRSettings
+
+	// NewTextExtractor builds the OCR engine owned by a single worker.
+	NewTextExtractor func() domain.TextExtractor
+}
+
+// Runner processes queued re-OCR jobs in the background and keeps their
+// status in the repository, so the API only has to read it back.
+type Runner struct {
+	repository       domain.OCRJobRepository
+	photoRepository  domain.PhotoRepository
+	versions         domain.PhotoTextVersionRepository
+	deviceRepository domain.DeviceRepository
+	blobStore        domain.BlobStore
+	cfg              Config
+	queue            *jobs.Queue[*domain.OCRJob]
+
+	// extractors holds the OCR engine of each worker while the runner is started.
+	extractors []domain.TextExtractor
+}
+
+func NewRunner(repository domain.OCRJobRepository, photoRepository domain.PhotoRepository, versions domain.PhotoTextVersionRepository, deviceRepository domain.DeviceRepository, blobStore domain.BlobStore, cfg Config) *Runner {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.OCRTimeout <= 0 {
+		cfg.OCRTimeout = 30 * time.Second
+	}
+	if cfg.NewTextExtractor == nil {
+		cfg.NewTextExtractor = func() domain.TextExtractor { return &ocr.Fake{} }
+	}
+	r := &Runner{
+		repository:       repository,
+		photoRepository:  photoRepository,
+		versions:         versions,
+		deviceRepository: deviceRepository,
+		blobStore:        blobStore,
+		cfg:              cfg,
+	}
+	r.queue = jobs.NewQueue[*domain.OCRJob](repository, handler{r}, jobs.Config{
+		Name:      "re-OCR job",
+		Workers:   cfg.Workers,
+		QueueSize: cfg.QueueSize,
+	})
+	return r
+}
+
+// Start launches the workers and requeues the jobs a previous run left
+// unfinished. A requeued job reads its whole range again.
+func (r *Runner) Start(ctx context.Context) error {
+	for i := 0; i < r.cfg.Workers; i++ {
+		r.extractors = append(r.extractors, r.cfg.NewTextExtractor())
+	}
+
+	var unfinished []*domain.OCRJob
+	for _, status := range []string{domain.OCRJobStatusRunning, domain.OCRJobStatusQueued} {
+		pending, err := r.repository.GetByStatus(ctx, status)
+		if err != nil {
+			// New jobs still run when the old ones cannot be resumed
+			r.queue.Start(nil)
+			return fmt.Errorf("failed to fetch %s re-OCR jobs: %w", status, err)
+		}
+		unfinished = append(unfinished, pending...)
+	}
+
+	// Oldest first
+	var queued []primitive.ObjectID
+	for i := len(unfinished) - 1; i >= 0; i-- {
+		job := unfinished[i]
+		if job.Status == domain.OCRJobStatusRunning {
+			job.Status = domain.OCRJobStatusQueued
+			job.Progress, job.Processed, job.Failed = 0, 0, 0
+			if err := r.repository.Update(ctx, job); err != nil {
+				fmt.Printf("Failed to requeue re-OCR job %s: %v\n", job.ID.Hex(), err)
+				continue
+			}
+		}
+		queued = append(queued, job.ID)
+	}
+	r.queue.Start(queued)
+	return nil
+}
+
+// Close stops the workers and their OCR engines. Jobs still running are left
+// in the running state and picked up again by the next Start.
+func (r *Runner) Close() {
+	r.queue.Close()
+	for _, extractor := range r.extractors {
+		extractor.Close()
+	}
+	r.extractors = nil
+}
+
+// Submit validates and stores a new job and queues it.
+func (r *Runner) Submit(ctx context.Context, job *domain.OCRJob) error {
+	if err := job.Validate(); err != nil {
+		return err
+	}
+	job.Status = domain.OCRJobStatusQueued
+	job.CreatedAt = time.Now().UTC()
+	if err := r.repository.Save(ctx, job); err != nil {
+		return err
+	}
+
+	if !r.queue.Enqueue(job.ID) {
+		if err := r.repository.Delete(ctx, job.ID); err != nil {
+			fmt.Printf("Failed to remove unqueued re-OCR job %s: %v\n", job.ID.Hex(), err)
+		}
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// Cancel marks a queued job as canceled, or stops a running job and waits for
+// its worker to record the final state. Photos already read keep their new
+// text.
+func (r *Runner) Cancel(ctx context.Context, id primitive.ObjectID) error {
+	return r.queue.Cancel(ctx, id)
+}
+
+// handler reads the photos of the jobs the queue hands out.
+type handler struct {
+	*Runner
+}
+
+func (h handler) Load(ctx context.Context, id primitive.ObjectID) (*domain.OCRJob, error) {
+	return h.repository.GetByID(ctx, id)
+}
+
+func (h handler) Run(ctx context.Context, worker int, job *domain.OCRJob) error {
+	return h.run(ctx, job, h.extractors[worker])
+}
+
+func (h handler) Finish(ctx context.Context, job *domain.OCRJob, status, message string) {
+	now := time.Now().UTC()
+	job.Status = status
+	job.Error = message
+	job.FinishedAt = &now
+	if status == domain.OCRJobStatusCompleted {
+		job.Progress = 100
+		fmt.Printf("Re-OCR job %s read %d photos, %d failed\n", job.ID.Hex(), job.Processed, job.Failed)
+	}
+	if err := h.repository.Update(ctx, job); err != nil {
+		fmt.Printf("Failed to update re-OCR job %s: %v\n", job.ID.Hex(), err)
+	}
+}
+
+// run reads every photo of the range again, oldest first, with the device's
+// current settings. A photo that cannot be read keeps its text and counts as
+// failed; only errors listing the photos fail the job.
+func (r *Runner) run(ctx context.Context, job *domain.OCRJob, extractor domain.TextExtractor) error {
+	preprocessing, settings := r.cfg.Preprocessing, r.cfg.OCR
+	device, err := r.deviceRepository.GetByID(ctx, job.DeviceID)
+	switch {
+	case err == nil:
+		if device.Preprocessing != nil {
+			preprocessing = *device.Preprocessing
+		}
+		if device.OCR != nil {
+			settings = *device.OCR
+		}
+	case err != mongo.ErrNoDocuments:
+		return fmt.Errorf("failed to load device: %w", err)
+	}
+	// A removed device's photos are read with the server defaults
+
+	query := domain.PhotoQuery{
+		Start:     job.Start,
+		End:       job.End,
+		DeviceIDs: []string{job.DeviceID},
+		Limit:     domain.MaxPhotoQueryLimit,
+		Sort:      domain.SortOldestFirst,
+	}
+	for {
+		page, err := r.photoRepository.GetPhotos(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to fetch photos: %w", err)
+		}
+		job.Total = max(page.Total, job.Processed+int64(len(page.Photos)))
+
+		for _, photo := range page.Photos {
+			err := r.reprocess(ctx, job, photo, extractor, preprocessing, settings)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			job.Processed++
+			if err != nil {
+				fmt.Printf("Failed to re-read photo %s: %v\n", photo.ID.Hex(), err)
+				job.Failed++
+			}
+			r.updateProgress(ctx, job)
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		query.After, err = domain.DecodePhotoCursor(page.NextCursor)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reprocess extracts the text of one photo and stores it, after saving the
+// text it replaces to the photo's history.
+func (r *Runner) reprocess(ctx context.Context, job *domain.OCRJob, photo *domain.Photo, extractor domain.TextExtractor, preprocessing domain.Preprocessing, settings domain.OCRSettings) error {
+	data, err := r.download(ctx, photo)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	prepared, err := ocr.Prepare(data, img, preprocessing, settings.Regions)
+	if err != nil {
+		return fmt.Errorf("failed to preprocess image: %w", err)
+	}
+
+	ocrCtx, cancel := context.WithTimeout(ctx, r.cfg.OCRTimeout)
+	result, err := prepared.Extract(ocrCtx, extractor, settings)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to extract text: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		// The old text is saved first, so a failed update never loses it
+		err = r.versions.Save(ctx, &domain.PhotoTextVersion{
+			PhotoID:    photo.ID,
+			Version:    photo.TextVersion,
+			Text:       photo.Text,
+			OCR:        photo.OCR,
+			ReplacedBy: job.ID,
+			ReplacedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save text version: %w", err)
+		}
+		updated := *photo
+		updated.Text = result.Text
+		updated.OCR = domain.NewPhotoOCR(result, nil)
+		updated.Width, updated.Height = prepared.Width, prepared.Height
+		updated.TextVersion++
+		err = r.photoRepository.UpdateText(ctx, &updated)
+		if err == nil {
+			*photo = updated
+			return nil
+		}
+		if !errors.Is(err, domain.ErrTextVersionConflict) || attempt == maxTextUpdateAttempts {
+			return fmt.Errorf("failed to update photo: %w", err)
+		}
+
+		// Another job replaced the text since the photo was read; keep that
+		// text in the history too and replace it in turn
+		photo, err = r.photoRepository.GetByID(ctx, photo.ID)
+		if err != nil {
+			return fmt.Errorf("failed to reload photo: %w", err)
+		}
+	}
+}
+
+func (r *Runner) download(ctx context.Context, photo *domain.Photo) ([]byte, error) {
+	body, err := r.blobStore.Get(ctx, photo.ObjectKey())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (r *Runner) updateProgress(ctx context.Context, job *domain.OCRJob) {
+	progress := int(job.Processed * 100 / max(job.Total, 1))
+	if progress <= job.Progress {
+		return
+	}
+	job.Progress = progress
+	if err := r.repository.Update(ctx, job); err != nil {
+		fmt.Printf("Failed to update re-OCR job %s progress: %v\n", job.ID.Hex(), err)
+	}
+}
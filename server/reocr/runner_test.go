@@ -0,0 +1,344 @@
+package reocr_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/ocr"
+	"mqtt-streaming-server/reocr"
+	"mqtt-streaming-server/storage"
+)
+
+// jobStore backs a mock OCRJobRepository with a map, and reports every job
+// that reaches a final state on finished.
+type jobStore struct {
+	mu       sync.Mutex
+	jobs     map[primitive.ObjectID]domain.OCRJob
+	finished chan domain.OCRJob
+}
+
+func newJobRepository(ctrl *gomock.Controller) (*mock_domain.MockOCRJobRepository, *jobStore) {
+	store := &jobStore{jobs: make(map[primitive.ObjectID]domain.OCRJob), finished: make(chan domain.OCRJob, 8)}
+	repo := mock_domain.NewMockOCRJobRepository(ctrl)
+	repo.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, job *domain.OCRJob) error {
+		job.ID = primitive.NewObjectID()
+		store.mu.Lock()
+		store.jobs[job.ID] = *job
+		store.mu.Unlock()
+		return nil
+	}).AnyTimes()
+	repo.EXPECT().GetByID(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id primitive.ObjectID) (*domain.OCRJob, error) {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		job, ok := store.jobs[id]
+		if !ok {
+			return nil, mongo.ErrNoDocuments
+		}
+		return &job, nil
+	}).AnyTimes()
+	repo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, job *domain.OCRJob) error {
+		store.mu.Lock()
+		store.jobs[job.ID] = *job
+		store.mu.Unlock()
+		if job.Finished() {
+			store.finished <- *job
+		}
+		return nil
+	}).AnyTimes()
+	repo.EXPECT().SetStatus(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+		store.mu.Lock()
+		job, ok := store.jobs[id]
+		if !ok || job.Status != from {
+			store.mu.Unlock()
+			return false, nil
+		}
+		job.Status = to
+		if job.Finished() {
+			now := time.Now().UTC()
+			job.FinishedAt = &now
+		}
+		store.jobs[id] = job
+		store.mu.Unlock()
+		if job.Finished() {
+			store.finished <- job
+		}
+		return true, nil
+	}).AnyTimes()
+	repo.EXPECT().GetByStatus(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	return repo, store
+}
+
+func (s *jobStore) get(id primitive.ObjectID) domain.OCRJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+func (s *jobStore) waitFinished(t *testing.T) domain.OCRJob {
+	t.Helper()
+	select {
+	case job := <-s.finished:
+		return job
+	case <-time.After(5 * time.Second):
+		t.Fatal("re-OCR job did not finish")
+		return domain.OCRJob{}
+	}
+}
+
+func jpegBytes(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 30)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// blockingExtractor signals each call on started and waits for the context.
+type blockingExtractor struct {
+	started chan struct{}
+}
+
+func (b *blockingExtractor) Extract(ctx context.Context, _ []byte, _ domain.OCRSettings) (*domain.OCRResult, error) {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *blockingExtractor) Close() error {
+	return nil
+}
+
+func TestRunner_RereadsPhotos(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	blobStore := storage.NewMemoryStore(nil)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var photos []*domain.Photo
+	for i := 0; i < 3; i++ {
+		photo := &domain.Photo{
+			ID:          primitive.NewObjectID(),
+			DeviceID:    "dev-1",
+			Timestamp:   start.Add(time.Duration(i) * time.Minute),
+			ImageType:   "jpeg",
+			Text:        "OLD",
+			TextVersion: 2,
+			StorageKey:  "photos/dev-1/" + primitive.NewObjectID().Hex() + ".jpeg",
+		}
+		// The last photo lost its image and keeps its text
+		if i < 2 {
+			blobStore.Put(ctx, photo.StorageKey, jpegBytes(t), "image/jpeg")
+		}
+		photos = append(photos, photo)
+	}
+
+	photoRepo := mock_domain.NewMockPhotoRepository(ctrl)
+	photoRepo.EXPECT().GetPhotos(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, query domain.PhotoQuery) (*domain.PhotoPage, error) {
+		if query.Sort != domain.SortOldestFirst || len(query.DeviceIDs) != 1 || query.DeviceIDs[0] != "dev-1" || !query.Start.Equal(start) {
+			t.Errorf("unexpected photo query %+v", query)
+		}
+		return &domain.PhotoPage{Photos: photos, Total: int64(len(photos))}, nil
+	})
+	var updated []domain.Photo
+	photoRepo.EXPECT().UpdateText(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, photo *domain.Photo) error {
+		updated = append(updated, *photo)
+		return nil
+	}).Times(2)
+
+	versions := mock_domain.NewMockPhotoTextVersionRepository(ctrl)
+	var saved []domain.PhotoTextVersion
+	versions.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, version *domain.PhotoTextVersion) error {
+		saved = append(saved, *version)
+		return nil
+	}).Times(2)
+
+	settings := domain.OCRSettings{Languages: []string{"ron"}, PageSegMode: 6}
+	devices := mock_domain.NewMockDeviceRepository(ctrl)
+	devices.EXPECT().GetByID(gomock.Any(), "dev-1").Return(&domain.Device{DeviceID: "dev-1", OCR: &settings}, nil)
+
+	extractor := &ocr.Fake{Result: domain.OCRResult{Text: "NEW", Confidence: 0.7}}
+	repo, store := newJobRepository(ctrl)
+	runner := reocr.NewRunner(repo, photoRepo, versions, devices, blobStore, reocr.Config{
+		NewTextExtractor: func() domain.TextExtractor { return extractor },
+	})
+	if err := runner.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer runner.Close()
+
+	job := &domain.OCRJob{DeviceID: "dev-1", Start: start, End: start.Add(time.Hour)}
+	if err := runner.Submit(ctx, job); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	got := store.waitFinished(t)
+	if got.Status != domain.OCRJobStatusCompleted || got.Progress != 100 || got.Total != 3 || got.Processed != 3 || got.Failed != 1 {
+		t.Fatalf("unexpected finished job %+v", got)
+	}
+	if !reflect.DeepEqual(extractor.LastSettings(), settings) {
+		t.Errorf("expected the device's OCR settings, got %+v", extractor.LastSettings())
+	}
+	for i, photo := range updated {
+		if photo.Text != "NEW" || photo.TextVersion != 3 || photo.OCR.Status != domain.OCRStatusDone || photo.Width != 40 {
+			t.Errorf("unexpected updated photo %+v", photo)
+		}
+		if v := saved[i]; v.PhotoID != photo.ID || v.Text != "OLD" || v.Version != 2 || v.ReplacedBy != job.ID {
+			t.Errorf("unexpected text version %+v", v)
+		}
+	}
+}
+
+func TestRunner_RereadsPhotoReplacedMeanwhile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	blobStore := storage.NewMemoryStore(nil)
+	photo := &domain.Photo{ID: primitive.NewObjectID(), DeviceID: "dev-1", ImageType: "jpeg", Text: "OLD", TextVersion: 2, StorageKey: "photos/dev-1/a.jpeg"}
+	blobStore.Put(ctx, photo.StorageKey, jpegBytes(t), "image/jpeg")
+	// Another job stored its text while this one was reading the photo
+	replaced := *photo
+	replaced.Text, replaced.TextVersion = "OTHER", 3
+
+	photoRepo := mock_domain.NewMockPhotoRepository(ctrl)
+	photoRepo.EXPECT().GetPhotos(gomock.Any(), gomock.Any()).Return(&domain.PhotoPage{Photos: []*domain.Photo{photo}, Total: 1}, nil)
+	photoRepo.EXPECT().GetByID(gomock.Any(), photo.ID).Return(&replaced, nil)
+	var updated []domain.Photo
+	photoRepo.EXPECT().UpdateText(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, photo *domain.Photo) error {
+		updated = append(updated, *photo)
+		if photo.TextVersion != 4 {
+			return domain.ErrTextVersionConflict
+		}
+		return nil
+	}).Times(2)
+
+	versions := mock_domain.NewMockPhotoTextVersionRepository(ctrl)
+	var saved []domain.PhotoTextVersion
+	versions.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, version *domain.PhotoTextVersion) error {
+		saved = append(saved, *version)
+		return nil
+	}).Times(2)
+
+	devices := mock_domain.NewMockDeviceRepository(ctrl)
+	devices.EXPECT().GetByID(gomock.Any(), "dev-1").Return(nil, mongo.ErrNoDocuments)
+
+	extractor := &ocr.Fake{Result: domain.OCRResult{Text: "NEW", Confidence: 0.7}}
+	repo, store := newJobRepository(ctrl)
+	runner := reocr.NewRunner(repo, photoRepo, versions, devices, blobStore, reocr.Config{
+		NewTextExtractor: func() domain.TextExtractor { return extractor },
+	})
+	if err := runner.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer runner.Close()
+
+	start := time.Now().Add(-time.Hour)
+	job := &domain.OCRJob{DeviceID: "dev-1", Start: start, End: start.Add(time.Hour)}
+	if err := runner.Submit(ctx, job); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	if got := store.waitFinished(t); got.Status != domain.OCRJobStatusCompleted || got.Failed != 0 {
+		t.Fatalf("unexpected finished job %+v", got)
+	}
+	if last := updated[len(updated)-1]; last.Text != "NEW" || last.TextVersion != 4 {
+		t.Errorf("expected the new text on top of the other job's, got %+v", last)
+	}
+	// Both replaced texts are kept, each under its own version
+	if saved[0].Version != 2 || saved[0].Text != "OLD" || saved[1].Version != 3 || saved[1].Text != "OTHER" {
+		t.Errorf("unexpected text versions %+v", saved)
+	}
+}
+
+func TestRunner_CancelRunningJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	blobStore := storage.NewMemoryStore(nil)
+	photo := &domain.Photo{ID: primitive.NewObjectID(), DeviceID: "dev-1", ImageType: "jpeg", StorageKey: "photos/dev-1/a.jpeg"}
+	blobStore.Put(ctx, photo.StorageKey, jpegBytes(t), "image/jpeg")
+
+	photoRepo := mock_domain.NewMockPhotoRepository(ctrl)
+	photoRepo.EXPECT().GetPhotos(gomock.Any(), gomock.Any()).Return(&domain.PhotoPage{Photos: []*domain.Photo{photo}, Total: 1}, nil)
+	devices := mock_domain.NewMockDeviceRepository(ctrl)
+	devices.EXPECT().GetByID(gomock.Any(), "dev-1").Return(nil, mongo.ErrNoDocuments)
+
+	extractor := &blockingExtractor{started: make(chan struct{}, 1)}
+	repo, store := newJobRepository(ctrl)
+	runner := reocr.NewRunner(repo, photoRepo, mock_domain.NewMockPhotoTextVersionRepository(ctrl), devices, blobStore, reocr.Config{
+		NewTextExtractor: func() domain.TextExtractor { return extractor },
+	})
+	if err := runner.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer runner.Close()
+
+	start := time.Now().Add(-time.Hour)
+	job := &domain.OCRJob{DeviceID: "dev-1", Start: start, End: start.Add(time.Hour)}
+	if err := runner.Submit(ctx, job); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	select {
+	case <-extractor.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("extraction did not start")
+	}
+
+	if err := runner.Cancel(ctx, job.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	// Cancel waits for the worker, so the final state is already recorded
+	if got := store.get(job.ID); got.Status != domain.OCRJobStatusCanceled || got.Processed != 0 {
+		t.Fatalf("expected canceled job without processed photos, got %+v", got)
+	}
+}
+
+func TestRunner_CancelQueuedJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	repo, store := newJobRepository(ctrl)
+	extractor := &ocr.Fake{}
+	// Not started, so the job stays queued
+	runner := reocr.NewRunner(repo, mock_domain.NewMockPhotoRepository(ctrl), mock_domain.NewMockPhotoTextVersionRepository(ctrl), mock_domain.NewMockDeviceRepository(ctrl), storage.NewMemoryStore(nil), reocr.Config{
+		NewTextExtractor: func() domain.TextExtractor { return extractor },
+	})
+
+	start := time.Now().Add(-time.Hour)
+	job := &domain.OCRJob{DeviceID: "dev-1", Start: start, End: start.Add(time.Hour)}
+	if err := runner.Submit(ctx, job); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if err := runner.Cancel(ctx, job.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if got := store.waitFinished(t); got.Status != domain.OCRJobStatusCanceled || got.FinishedAt == nil {
+		t.Fatalf("expected canceled, got %+v", got)
+	}
+
+	// The worker skips the canceled job when it picks it up
+	if err := runner.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	runner.Close()
+	if extractor.Calls() != 0 {
+		t.Errorf("expected canceled job not to be processed")
+	}
+}
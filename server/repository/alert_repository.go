@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mqtt-streaming-server/domain"
+)
+
+type alertRuleRepository struct {
+	db *mongo.Database
+}
+
+func NewAlertRuleRepository(db *mongo.Database) *alertRuleRepository {
+	return &alertRuleRepository{db: db}
+}
+
+func (repo *alertRuleRepository) Save(ctx context.Context, rule *domain.AlertRule) error {
+	collection := repo.db.Collection("alert_rules")
+	result, err := collection.InsertOne(ctx, rule)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		rule.ID = id
+	}
+	return nil
+}
+
+func (repo *alertRuleRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.AlertRule, error) {
+	collection := repo.db.Collection("alert_rules")
+	var rule domain.AlertRule
+	err := collection.FindOne(ctx, map[string]any{"_id": id}).Decode(&rule)
+	if err != nil {
+		return nil, err
+	}
+	// A stored pattern that does not compile only keeps the rule from matching
+	rule.Compile()
+	return &rule, nil
+}
+
+func (repo *alertRuleRepository) List(ctx context.Context) ([]*domain.AlertRule, error) {
+	return repo.find(ctx, map[string]any{})
+}
+
+func (repo *alertRuleRepository) GetEnabled(ctx context.Context) ([]*domain.AlertRule, error) {
+	return repo.find(ctx, map[string]any{"enabled": true})
+}
+
+func (repo *alertRuleRepository) find(ctx context.Context, filter map[string]any) ([]*domain.AlertRule, error) {
+	collection := repo.db.Collection("alert_rules")
+	rules := make([]*domain.AlertRule, 0)
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var rule domain.AlertRule
+		if err := cursor.Decode(&rule); err != nil {
+			return nil, err
+		}
+		rule.Compile()
+		rules = append(rules, &rule)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (repo *alertRuleRepository) Update(ctx context.Context, rule *domain.AlertRule) error {
+	collection := repo.db.Collection("alert_rules")
+	result, err := collection.ReplaceOne(ctx, map[string]any{"_id": rule.ID}, rule)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *alertRuleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	collection := repo.db.Collection("alert_rules")
+	result, err := collection.DeleteOne(ctx, map[string]any{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+type alertRepository struct {
+	db *mongo.Database
+}
+
+func NewAlertRepository(db *mongo.Database) *alertRepository {
+	return &alertRepository{db: db}
+}
+
+func (repo *alertRepository) Save(ctx context.Context, alert *domain.Alert) error {
+	collection := repo.db.Collection("alerts")
+	result, err := collection.InsertOne(ctx, alert)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		alert.ID = id
+	}
+	return nil
+}
+
+func (repo *alertRepository) List(ctx context.Context, query domain.AlertQuery) ([]*domain.Alert, error) {
+	collection := repo.db.Collection("alerts")
+	filter := map[string]any{}
+	if !query.RuleID.IsZero() {
+		filter["rule_id"] = query.RuleID
+	}
+	if query.DeviceID != "" {
+		filter["device_id"] = query.DeviceID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "fired_at", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+
+	alerts := make([]*domain.Alert, 0)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var alert domain.Alert
+		if err := cursor.Decode(&alert); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, &alert)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
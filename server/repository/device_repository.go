@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"mqtt-streaming-server/domain"
 )
@@ -61,3 +63,137 @@ func (repo *deviceRepository) GetByID(ctx context.Context, deviceID string) (*do
 	}
 	return device, nil
 }
+
+func (repo *deviceRepository) UpdateChangeDetection(ctx context.Context, deviceID string, settings *domain.ChangeDetection) error {
+	collection := repo.db.Collection("devices")
+	update := map[string]any{"$set": map[string]any{"change_detection": settings}}
+	if settings == nil {
+		update = map[string]any{"$unset": map[string]any{"change_detection": ""}}
+	}
+	result, err := collection.UpdateOne(ctx, map[string]string{"device_id": deviceID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *deviceRepository) UpdatePreprocessing(ctx context.Context, deviceID string, settings *domain.Preprocessing) error {
+	collection := repo.db.Collection("devices")
+	update := map[string]any{"$set": map[string]any{"preprocessing": settings}}
+	if settings == nil {
+		update = map[string]any{"$unset": map[string]any{"preprocessing": ""}}
+	}
+	result, err := collection.UpdateOne(ctx, map[string]string{"device_id": deviceID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *deviceRepository) UpdateOCRSettings(ctx context.Context, deviceID string, settings *domain.OCRSettings) error {
+	collection := repo.db.Collection("devices")
+	update := map[string]any{"$set": map[string]any{"ocr": settings}}
+	if settings == nil {
+		update = map[string]any{"$unset": map[string]any{"ocr": ""}}
+	}
+	result, err := collection.UpdateOne(ctx, map[string]string{"device_id": deviceID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *deviceRepository) Touch(ctx context.Context, deviceID string, seenAt time.Time, photo bool) (*domain.Device, error) {
+	collection := repo.db.Collection("devices")
+	// $max keeps the latest time when messages are processed out of order
+	seen := map[string]any{"last_seen": seenAt}
+	if photo {
+		seen["last_photo_at"] = seenAt
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var device *domain.Device
+	err := collection.FindOneAndUpdate(ctx, map[string]string{"device_id": deviceID}, map[string]any{"$max": seen}, opts).Decode(&device)
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+func (repo *deviceRepository) SetStatus(ctx context.Context, deviceID, from, to string) (bool, error) {
+	collection := repo.db.Collection("devices")
+	result, err := collection.UpdateOne(ctx,
+		map[string]string{"device_id": deviceID, "device_status": from},
+		map[string]any{"$set": map[string]any{"device_status": to}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (repo *deviceRepository) GetSilent(ctx context.Context, before time.Time) ([]*domain.Device, error) {
+	collection := repo.db.Collection("devices")
+	devices := make([]*domain.Device, 0)
+	cursor, err := collection.Find(ctx, map[string]any{
+		"device_status": domain.DeviceStatusActive,
+		"last_seen":     map[string]any{"$lt": before},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var device domain.Device
+		if err := cursor.Decode(&device); err != nil {
+			return nil, err
+		}
+		devices = append(devices, &device)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func (repo *deviceRepository) MarkSilentInactive(ctx context.Context, deviceID string, before time.Time) (bool, error) {
+	collection := repo.db.Collection("devices")
+	result, err := collection.UpdateOne(ctx,
+		map[string]any{
+			"device_id":     deviceID,
+			"device_status": domain.DeviceStatusActive,
+			"last_seen":     map[string]any{"$lt": before},
+		},
+		map[string]any{"$set": map[string]any{"device_status": domain.DeviceStatusInactive}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// BackfillLastSeen gives active devices registered before presence was
+// tracked a last_seen of now, so they get a full timeout to check in before
+// the sweeper marks them inactive.
+func (repo *deviceRepository) BackfillLastSeen(ctx context.Context, now time.Time) (int, error) {
+	collection := repo.db.Collection("devices")
+	result, err := collection.UpdateMany(ctx,
+		map[string]any{"device_status": domain.DeviceStatusActive, "last_seen": map[string]any{"$exists": false}},
+		map[string]any{"$set": map[string]any{"last_seen": now}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
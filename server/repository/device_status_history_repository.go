@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mqtt-streaming-server/domain"
+)
+
+type deviceStatusHistoryRepository struct {
+	db *mongo.Database
+}
+
+func NewDeviceStatusHistoryRepository(db *mongo.Database) *deviceStatusHistoryRepository {
+	return &deviceStatusHistoryRepository{db: db}
+}
+
+// EnsureIndexes creates the index the per-device history relies on.
+func (repo *deviceStatusHistoryRepository) EnsureIndexes(ctx context.Context) error {
+	collection := repo.db.Collection("device_status_history")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "device_id", Value: 1}, {Key: "at", Value: -1}},
+		Options: options.Index().SetName("device_at"),
+	})
+	return err
+}
+
+func (repo *deviceStatusHistoryRepository) Save(ctx context.Context, change *domain.DeviceStatusChange) error {
+	collection := repo.db.Collection("device_status_history")
+	result, err := collection.InsertOne(ctx, change)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		change.ID = id
+	}
+	return nil
+}
+
+func (repo *deviceStatusHistoryRepository) List(ctx context.Context, deviceID string, limit int) ([]*domain.DeviceStatusChange, error) {
+	collection := repo.db.Collection("device_status_history")
+	changes := make([]*domain.DeviceStatusChange, 0)
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := collection.Find(ctx, map[string]any{"device_id": deviceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var change domain.DeviceStatusChange
+		if err := cursor.Decode(&change); err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
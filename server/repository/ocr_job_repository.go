@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mqtt-streaming-server/domain"
+)
+
+type ocrJobRepository struct {
+	db *mongo.Database
+}
+
+func NewOCRJobRepository(db *mongo.Database) *ocrJobRepository {
+	return &ocrJobRepository{db: db}
+}
+
+func (repo *ocrJobRepository) Save(ctx context.Context, job *domain.OCRJob) error {
+	collection := repo.db.Collection("ocr_jobs")
+	result, err := collection.InsertOne(ctx, job)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		job.ID = id
+	}
+	return nil
+}
+
+func (repo *ocrJobRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.OCRJob, error) {
+	collection := repo.db.Collection("ocr_jobs")
+	var job domain.OCRJob
+	err := collection.FindOne(ctx, map[string]any{"_id": id}).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (repo *ocrJobRepository) List(ctx context.Context, deviceID string) ([]*domain.OCRJob, error) {
+	filter := map[string]any{}
+	if deviceID != "" {
+		filter["device_id"] = deviceID
+	}
+	return repo.find(ctx, filter)
+}
+
+func (repo *ocrJobRepository) GetByStatus(ctx context.Context, status string) ([]*domain.OCRJob, error) {
+	return repo.find(ctx, map[string]any{"status": status})
+}
+
+func (repo *ocrJobRepository) find(ctx context.Context, filter map[string]any) ([]*domain.OCRJob, error) {
+	collection := repo.db.Collection("ocr_jobs")
+	jobs := make([]*domain.OCRJob, 0)
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var job domain.OCRJob
+		if err := cursor.Decode(&job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (repo *ocrJobRepository) Update(ctx context.Context, job *domain.OCRJob) error {
+	collection := repo.db.Collection("ocr_jobs")
+	_, err := collection.ReplaceOne(ctx, map[string]any{"_id": job.ID}, job)
+	return err
+}
+
+func (repo *ocrJobRepository) SetStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+	collection := repo.db.Collection("ocr_jobs")
+	set := map[string]any{"status": to}
+	if (&domain.OCRJob{Status: to}).Finished() {
+		set["finished_at"] = time.Now().UTC()
+	}
+	result, err := collection.UpdateOne(ctx,
+		map[string]any{"_id": id, "status": from},
+		map[string]any{"$set": set},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (repo *ocrJobRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	collection := repo.db.Collection("ocr_jobs")
+	_, err := collection.DeleteOne(ctx, map[string]any{"_id": id})
+	return err
+}
@@ -2,13 +2,29 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"mqtt-streaming-server/domain"
 )
 
+// photoQueryMaxTime bounds how long MongoDB spends on a photo listing or
+// search, so a slow filter fails instead of scanning the whole collection.
+const photoQueryMaxTime = 5 * time.Second
+
+// MongoDB server error codes.
+const (
+	errIndexNotFound    = 27
+	errMaxTimeMSExpired = 50
+)
+
 type photoRepository struct {
 	db *mongo.Database
 }
@@ -17,11 +33,240 @@ func NewPhotoRepository(db *mongo.Database) *photoRepository {
 	return &photoRepository{db: db}
 }
 
-func (repo *photoRepository) GetPhotos(ctx context.Context, filters map[string]any) ([]*domain.Photo, error) {
+// EnsureIndexes creates the indexes the photo queries rely on. Creating an
+// index that already exists is a no-op, so this is safe to run on every start.
+func (repo *photoRepository) EnsureIndexes(ctx context.Context) error {
+	collection := repo.db.Collection("photos")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "text", Value: "text"}},
+			Options: options.Index().SetName("text_search"),
+		},
+		{
+			Keys:    bson.D{{Key: "device_id", Value: 1}, {Key: "timestamp", Value: -1}},
+			Options: options.Index().SetName("device_timestamp"),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "timestamp", Value: -1}},
+			Options: options.Index().SetName("status_timestamp"),
+		},
+	})
+	return err
+}
+
+func (repo *photoRepository) GetPhotos(ctx context.Context, query domain.PhotoQuery) (*domain.PhotoPage, error) {
+	collection := repo.db.Collection("photos")
+	filter := photoFilter(query)
+
+	total, err := collection.CountDocuments(ctx, filter, options.Count().SetMaxTime(photoQueryMaxTime))
+	if err != nil {
+		return nil, photoQueryError(err)
+	}
+
+	direction := -1 // Sort by timestamp in descending order
+	if query.Sort == domain.SortOldestFirst {
+		direction = 1
+	}
+	if query.After != nil {
+		// Resume strictly after the cursor in the requested order
+		op := "$lt"
+		if direction == 1 {
+			op = "$gt"
+		}
+		filter = map[string]any{"$and": []any{filter, map[string]any{
+			"$or": []any{
+				map[string]any{"timestamp": map[string]any{op: query.After.Timestamp}},
+				map[string]any{"timestamp": query.After.Timestamp, "_id": map[string]any{op: query.After.ID}},
+			},
+		}}}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: direction}, {Key: "_id", Value: direction}}).
+		SetMaxTime(photoQueryMaxTime)
+	if query.Limit > 0 {
+		// Fetch one extra photo to know whether there is a next page
+		findOptions.SetLimit(int64(query.Limit) + 1)
+	}
+
+	photos := make([]*domain.Photo, 0)
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, photoQueryError(err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var photo domain.Photo
+		if err := cursor.Decode(&photo); err != nil {
+			return nil, err
+		}
+		photos = append(photos, &photo)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, photoQueryError(err)
+	}
+
+	page := &domain.PhotoPage{Photos: photos, Total: total}
+	if query.Limit > 0 && len(photos) > query.Limit {
+		page.Photos = photos[:query.Limit]
+		last := page.Photos[len(page.Photos)-1]
+		page.NextCursor = domain.PhotoCursor{Timestamp: last.Timestamp, ID: last.ID}.Encode()
+	}
+	return page, nil
+}
+
+func (repo *photoRepository) SearchPhotos(ctx context.Context, query domain.PhotoQuery) ([]*domain.PhotoSearchResult, error) {
+	collection := repo.db.Collection("photos")
+	query.TextMode = domain.TextFullText
+	score := map[string]any{"$meta": "textScore"}
+	findOptions := options.Find().
+		SetProjection(map[string]any{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "timestamp", Value: -1}}).
+		SetMaxTime(photoQueryMaxTime)
+	if query.Limit > 0 {
+		findOptions.SetLimit(int64(query.Limit))
+	}
+
+	cursor, err := collection.Find(ctx, photoFilter(query), findOptions)
+	if err != nil {
+		return nil, photoQueryError(err)
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]*domain.PhotoSearchResult, 0)
+	for cursor.Next(ctx) {
+		var doc struct {
+			domain.Photo `bson:",inline"`
+			Score        float64 `bson:"score"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		photo := doc.Photo
+		results = append(results, &domain.PhotoSearchResult{Photo: &photo, Score: doc.Score})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, photoQueryError(err)
+	}
+
+	return results, nil
+}
+
+// photoFilter translates a query into a Mongo filter on committed photos.
+func photoFilter(query domain.PhotoQuery) map[string]any {
+	filter := map[string]any{"status": domain.PhotoStatusCommitted}
+	timestamp := map[string]any{}
+	if !query.Start.IsZero() {
+		timestamp["$gte"] = query.Start
+	}
+	if !query.End.IsZero() {
+		timestamp["$lte"] = query.End
+	}
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+	if len(query.DeviceIDs) == 1 {
+		filter["device_id"] = query.DeviceIDs[0]
+	} else if len(query.DeviceIDs) > 1 {
+		filter["device_id"] = map[string]any{"$in": query.DeviceIDs}
+	}
+	if len(query.Tags) > 0 {
+		filter["tags"] = map[string]any{"$all": query.Tags}
+	}
+	if query.ChangedOnly {
+		filter["unchanged"] = map[string]any{"$ne": true}
+	}
+	if query.Text != "" {
+		// Only regex mode passes user input through as a pattern, and it is validated first
+		switch query.TextMode {
+		case domain.TextExact:
+			filter["text"] = query.Text
+		case domain.TextRegex:
+			filter["text"] = map[string]any{"$regex": query.Text, "$options": "i"}
+		case domain.TextFullText:
+			filter["$text"] = map[string]any{"$search": query.Text}
+		default:
+			filter["text"] = map[string]any{"$regex": regexp.QuoteMeta(query.Text), "$options": "i"}
+		}
+	}
+	return filter
+}
+
+// photoQueryError translates the server errors of a photo query into the
+// domain errors callers can act on.
+func photoQueryError(err error) error {
+	var serverErr mongo.ServerError
+	switch {
+	case errors.As(err, &serverErr) && serverErr.HasErrorCode(errMaxTimeMSExpired):
+		return fmt.Errorf("%w: %v", domain.ErrQueryTimeout, err)
+	case errors.As(err, &serverErr) && serverErr.HasErrorCode(errIndexNotFound):
+		return fmt.Errorf("%w: %v", domain.ErrTextIndexMissing, err)
+	default:
+		return err
+	}
+}
+
+func (repo *photoRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Photo, error) {
+	collection := repo.db.Collection("photos")
+	var photo domain.Photo
+	err := collection.FindOne(ctx, map[string]any{"_id": id}).Decode(&photo)
+	if err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+func (repo *photoRepository) Save(ctx context.Context, photo *domain.Photo) error {
+	collection := repo.db.Collection("photos")
+	result, err := collection.InsertOne(ctx, photo)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		photo.ID = id
+	}
+	return nil
+}
+
+func (repo *photoRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, status string) error {
+	collection := repo.db.Collection("photos")
+	_, err := collection.UpdateByID(ctx, id, map[string]any{"$set": map[string]any{"status": status}})
+	return err
+}
+
+func (repo *photoRepository) UpdateText(ctx context.Context, photo *domain.Photo) error {
+	collection := repo.db.Collection("photos")
+	// Version 0 is never stored, as text_version is omitted when empty
+	var previous any = photo.TextVersion - 1
+	if photo.TextVersion <= 1 {
+		previous = map[string]any{"$in": []any{0, nil}}
+	}
+	filter := map[string]any{"_id": photo.ID, "text_version": previous}
+	result, err := collection.UpdateOne(ctx, filter, map[string]any{"$set": map[string]any{
+		"text":         photo.Text,
+		"ocr":          photo.OCR,
+		"width":        photo.Width,
+		"height":       photo.Height,
+		"text_version": photo.TextVersion,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrTextVersionConflict
+	}
+	return nil
+}
+
+func (repo *photoRepository) GetByStatus(ctx context.Context, status string, before time.Time) ([]*domain.Photo, error) {
 	collection := repo.db.Collection("photos")
 	photos := make([]*domain.Photo, 0)
-	cursor, err := collection.Find(ctx, filters, &options.FindOptions{
-		Sort: map[string]int{"timestamp": -1}, // Sort by timestamp in descending order
+	cursor, err := collection.Find(ctx, map[string]any{
+		"status":    status,
+		"timestamp": map[string]any{"$lt": before},
 	})
 	if err != nil {
 		return nil, err
@@ -43,8 +288,64 @@ func (repo *photoRepository) GetPhotos(ctx context.Context, filters map[string]a
 	return photos, nil
 }
 
-func (repo *photoRepository) Save(ctx context.Context, photo *domain.Photo) error {
+func (repo *photoRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
 	collection := repo.db.Collection("photos")
-	_, err := collection.InsertOne(ctx, photo)
+	_, err := collection.DeleteOne(ctx, map[string]any{"_id": id})
 	return err
 }
+
+// BackfillStatus marks photos saved before the ingestion states existed as committed.
+func (repo *photoRepository) BackfillStatus(ctx context.Context) (int, error) {
+	collection := repo.db.Collection("photos")
+	result, err := collection.UpdateMany(ctx,
+		map[string]any{"status": map[string]any{"$exists": false}},
+		map[string]any{"$set": map[string]any{"status": domain.PhotoStatusCommitted}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// BackfillOCRFailures replaces the "OCR failed" text that photos stored
+// before OCR errors were recorded carry, so that text is not searched.
+func (repo *photoRepository) BackfillOCRFailures(ctx context.Context) (int, error) {
+	collection := repo.db.Collection("photos")
+	result, err := collection.UpdateMany(ctx,
+		map[string]any{"text": "OCR failed", "ocr": map[string]any{"$exists": false}},
+		map[string]any{"$set": map[string]any{
+			"text": "",
+			"ocr":  domain.PhotoOCR{Status: domain.OCRStatusFailed, Error: "unknown error"},
+		}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// BackfillStorageKeys records the legacy timestamp-derived key on photos saved
+// before storage_key existed, so every document names the blob it points at.
+func (repo *photoRepository) BackfillStorageKeys(ctx context.Context) (int, error) {
+	collection := repo.db.Collection("photos")
+	cursor, err := collection.Find(ctx, map[string]any{"storage_key": map[string]any{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var photo domain.Photo
+		if err := cursor.Decode(&photo); err != nil {
+			return updated, err
+		}
+		_, err := collection.UpdateByID(ctx, photo.ID, map[string]any{"$set": map[string]any{"storage_key": photo.LegacyStorageKey()}})
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, cursor.Err()
+}
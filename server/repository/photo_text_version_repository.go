@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mqtt-streaming-server/domain"
+)
+
+type photoTextVersionRepository struct {
+	db *mongo.Database
+}
+
+func NewPhotoTextVersionRepository(db *mongo.Database) *photoTextVersionRepository {
+	return &photoTextVersionRepository{db: db}
+}
+
+// EnsureIndexes creates the index the per-photo history relies on, which
+// also keeps a single text per photo version.
+func (repo *photoTextVersionRepository) EnsureIndexes(ctx context.Context) error {
+	collection := repo.db.Collection("photo_text_versions")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "photo_id", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetName("photo_version").SetUnique(true),
+	})
+	return err
+}
+
+func (repo *photoTextVersionRepository) Save(ctx context.Context, version *domain.PhotoTextVersion) error {
+	collection := repo.db.Collection("photo_text_versions")
+	result, err := collection.InsertOne(ctx, version)
+	if mongo.IsDuplicateKeyError(err) {
+		// Saved already by a job that lost the update or failed after saving;
+		// the text of a version never changes, so the stored one is kept
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		version.ID = id
+	}
+	return nil
+}
+
+func (repo *photoTextVersionRepository) ListByPhoto(ctx context.Context, photoID primitive.ObjectID) ([]*domain.PhotoTextVersion, error) {
+	collection := repo.db.Collection("photo_text_versions")
+	versions := make([]*domain.PhotoTextVersion, 0)
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}})
+	cursor, err := collection.Find(ctx, map[string]any{"photo_id": photoID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var version domain.PhotoTextVersion
+		if err := cursor.Decode(&version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, &version)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (repo *photoTextVersionRepository) DeleteByPhoto(ctx context.Context, photoID primitive.ObjectID) error {
+	collection := repo.db.Collection("photo_text_versions")
+	_, err := collection.DeleteMany(ctx, map[string]any{"photo_id": photoID})
+	return err
+}
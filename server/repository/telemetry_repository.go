@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mqtt-streaming-server/domain"
+)
+
+type telemetryRepository struct {
+	db *mongo.Database
+}
+
+func NewTelemetryRepository(db *mongo.Database) *telemetryRepository {
+	return &telemetryRepository{db: db}
+}
+
+// EnsureCollection creates the telemetry time-series collection, whose
+// samples MongoDB removes once they are older than retention. An existing
+// collection is left as it is, so changing the retention takes a collMod.
+func (repo *telemetryRepository) EnsureCollection(ctx context.Context, retention time.Duration) error {
+	names, err := repo.db.ListCollectionNames(ctx, map[string]any{"name": "telemetry"})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return nil
+	}
+	opts := options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().SetTimeField("timestamp").SetMetaField("device_id").SetGranularity("minutes"),
+	)
+	if retention > 0 {
+		opts.SetExpireAfterSeconds(int64(retention.Seconds()))
+	}
+	return repo.db.CreateCollection(ctx, "telemetry", opts)
+}
+
+func (repo *telemetryRepository) Save(ctx context.Context, sample *domain.TelemetrySample) error {
+	collection := repo.db.Collection("telemetry")
+	_, err := collection.InsertOne(ctx, sample)
+	return err
+}
+
+func (repo *telemetryRepository) Query(ctx context.Context, query domain.TelemetryQuery) ([]domain.TelemetryPoint, error) {
+	collection := repo.db.Collection("telemetry")
+	// The metric is validated against the known ones, so it is safe in a field path
+	field := "values." + string(query.Metric)
+	filter := map[string]any{
+		"device_id": query.DeviceID,
+		"timestamp": map[string]any{"$gte": query.From, "$lt": query.To},
+		field:       map[string]any{"$exists": true},
+	}
+
+	points := make([]domain.TelemetryPoint, 0)
+	if query.Interval == 0 {
+		findOptions := options.Find().
+			SetSort(bson.D{{Key: "timestamp", Value: 1}}).
+			SetLimit(domain.MaxTelemetryPoints + 1)
+		cursor, err := collection.Find(ctx, filter, findOptions)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var sample domain.TelemetrySample
+			if err := cursor.Decode(&sample); err != nil {
+				return nil, err
+			}
+			value := sample.Values[query.Metric]
+			points = append(points, domain.TelemetryPoint{Timestamp: sample.Timestamp, Value: value, Min: value, Max: value, Count: 1})
+		}
+		if err := cursor.Err(); err != nil {
+			return nil, err
+		}
+		// One more than the cap is fetched to tell a full range from a cut off one
+		if len(points) > domain.MaxTelemetryPoints {
+			return nil, domain.ErrTooManyTelemetryPoints
+		}
+		return points, nil
+	}
+
+	// Buckets start at multiples of the interval since the Unix epoch
+	millis := map[string]any{"$toLong": "$timestamp"}
+	bucket := map[string]any{"$subtract": []any{millis, map[string]any{"$mod": []any{millis, query.Interval.Milliseconds()}}}}
+	metric := "$" + field
+	pipeline := []any{
+		map[string]any{"$match": filter},
+		map[string]any{"$group": map[string]any{
+			"_id":   bucket,
+			"value": map[string]any{"$avg": metric},
+			"min":   map[string]any{"$min": metric},
+			"max":   map[string]any{"$max": metric},
+			"count": map[string]any{"$sum": 1},
+		}},
+		map[string]any{"$sort": map[string]any{"_id": 1}},
+		map[string]any{"$limit": domain.MaxTelemetryPoints + 1},
+		map[string]any{"$project": map[string]any{
+			"_id":       0,
+			"timestamp": map[string]any{"$toDate": "$_id"},
+			"value":     1,
+			"min":       1,
+			"max":       1,
+			"count":     1,
+		}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var point domain.TelemetryPoint
+		if err := cursor.Decode(&point); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if len(points) > domain.MaxTelemetryPoints {
+		return nil, domain.ErrTooManyTelemetryPoints
+	}
+	return points, nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mqtt-streaming-server/domain"
+)
+
+type timelapseRepository struct {
+	db *mongo.Database
+}
+
+func NewTimelapseRepository(db *mongo.Database) *timelapseRepository {
+	return &timelapseRepository{db: db}
+}
+
+func (repo *timelapseRepository) Save(ctx context.Context, timelapse *domain.Timelapse) error {
+	collection := repo.db.Collection("timelapses")
+	result, err := collection.InsertOne(ctx, timelapse)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		timelapse.ID = id
+	}
+	return nil
+}
+
+func (repo *timelapseRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Timelapse, error) {
+	collection := repo.db.Collection("timelapses")
+	var timelapse domain.Timelapse
+	err := collection.FindOne(ctx, map[string]any{"_id": id}).Decode(&timelapse)
+	if err != nil {
+		return nil, err
+	}
+	return &timelapse, nil
+}
+
+func (repo *timelapseRepository) List(ctx context.Context, deviceID string) ([]*domain.Timelapse, error) {
+	filter := map[string]any{}
+	if deviceID != "" {
+		filter["device_id"] = deviceID
+	}
+	return repo.find(ctx, filter)
+}
+
+func (repo *timelapseRepository) GetByStatus(ctx context.Context, status string) ([]*domain.Timelapse, error) {
+	return repo.find(ctx, map[string]any{"status": status})
+}
+
+func (repo *timelapseRepository) find(ctx context.Context, filter map[string]any) ([]*domain.Timelapse, error) {
+	collection := repo.db.Collection("timelapses")
+	timelapses := make([]*domain.Timelapse, 0)
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var timelapse domain.Timelapse
+		if err := cursor.Decode(&timelapse); err != nil {
+			return nil, err
+		}
+		timelapses = append(timelapses, &timelapse)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return timelapses, nil
+}
+
+func (repo *timelapseRepository) Update(ctx context.Context, timelapse *domain.Timelapse) error {
+	collection := repo.db.Collection("timelapses")
+	_, err := collection.ReplaceOne(ctx, map[string]any{"_id": timelapse.ID}, timelapse)
+	return err
+}
+
+func (repo *timelapseRepository) SetStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+	collection := repo.db.Collection("timelapses")
+	set := map[string]any{"status": to}
+	if (&domain.Timelapse{Status: to}).Finished() {
+		set["finished_at"] = time.Now().UTC()
+	}
+	result, err := collection.UpdateOne(ctx,
+		map[string]any{"_id": id, "status": from},
+		map[string]any{"$set": set},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (repo *timelapseRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	collection := repo.db.Collection("timelapses")
+	_, err := collection.DeleteOne(ctx, map[string]any{"_id": id})
+	return err
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mqtt-streaming-server/domain"
+)
+
+type webhookSubscriptionRepository struct {
+	db *mongo.Database
+}
+
+func NewWebhookSubscriptionRepository(db *mongo.Database) *webhookSubscriptionRepository {
+	return &webhookSubscriptionRepository{db: db}
+}
+
+func (repo *webhookSubscriptionRepository) Save(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	collection := repo.db.Collection("webhook_subscriptions")
+	result, err := collection.InsertOne(ctx, subscription)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		subscription.ID = id
+	}
+	return nil
+}
+
+func (repo *webhookSubscriptionRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.WebhookSubscription, error) {
+	collection := repo.db.Collection("webhook_subscriptions")
+	var subscription domain.WebhookSubscription
+	err := collection.FindOne(ctx, map[string]any{"_id": id}).Decode(&subscription)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (repo *webhookSubscriptionRepository) List(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	return repo.find(ctx, map[string]any{})
+}
+
+func (repo *webhookSubscriptionRepository) GetByEvent(ctx context.Context, eventType domain.WebhookEventType) ([]*domain.WebhookSubscription, error) {
+	return repo.find(ctx, map[string]any{"enabled": true, "events": eventType})
+}
+
+func (repo *webhookSubscriptionRepository) find(ctx context.Context, filter map[string]any) ([]*domain.WebhookSubscription, error) {
+	collection := repo.db.Collection("webhook_subscriptions")
+	subscriptions := make([]*domain.WebhookSubscription, 0)
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var subscription domain.WebhookSubscription
+		if err := cursor.Decode(&subscription); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func (repo *webhookSubscriptionRepository) Update(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	collection := repo.db.Collection("webhook_subscriptions")
+	result, err := collection.ReplaceOne(ctx, map[string]any{"_id": subscription.ID}, subscription)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *webhookSubscriptionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	collection := repo.db.Collection("webhook_subscriptions")
+	result, err := collection.DeleteOne(ctx, map[string]any{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+type webhookDeliveryRepository struct {
+	db *mongo.Database
+}
+
+func NewWebhookDeliveryRepository(db *mongo.Database) *webhookDeliveryRepository {
+	return &webhookDeliveryRepository{db: db}
+}
+
+func (repo *webhookDeliveryRepository) Save(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	collection := repo.db.Collection("webhook_deliveries")
+	result, err := collection.InsertOne(ctx, delivery)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		delivery.ID = id
+	}
+	return nil
+}
+
+func (repo *webhookDeliveryRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.WebhookDelivery, error) {
+	collection := repo.db.Collection("webhook_deliveries")
+	var delivery domain.WebhookDelivery
+	err := collection.FindOne(ctx, map[string]any{"_id": id}).Decode(&delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (repo *webhookDeliveryRepository) List(ctx context.Context, query domain.WebhookDeliveryQuery) ([]*domain.WebhookDelivery, error) {
+	filter := map[string]any{}
+	if !query.SubscriptionID.IsZero() {
+		filter["subscription_id"] = query.SubscriptionID
+	}
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+	return repo.find(ctx, filter, opts)
+}
+
+func (repo *webhookDeliveryRepository) GetDue(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	filter := map[string]any{
+		"status":          domain.WebhookDeliveryPending,
+		"next_attempt_at": map[string]any{"$lte": now},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(int64(limit))
+	return repo.find(ctx, filter, opts)
+}
+
+func (repo *webhookDeliveryRepository) find(ctx context.Context, filter map[string]any, opts *options.FindOptions) ([]*domain.WebhookDelivery, error) {
+	collection := repo.db.Collection("webhook_deliveries")
+	deliveries := make([]*domain.WebhookDelivery, 0)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var delivery domain.WebhookDelivery
+		if err := cursor.Decode(&delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (repo *webhookDeliveryRepository) Update(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	collection := repo.db.Collection("webhook_deliveries")
+	result, err := collection.ReplaceOne(ctx, map[string]any{"_id": delivery.ID}, delivery)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/storage"
+)
+
+// BlobController serves blobs through links issued by a storage.URLSigner,
+// for stores that have no presigned URLs of their own.
+type BlobController struct {
+	BlobStore domain.BlobStore
+	Signer    *storage.URLSigner
+}
+
+func InitBlobRoutes(blobStore domain.BlobStore, signer *storage.URLSigner, mux *http.ServeMux) {
+	if signer == nil {
+		return
+	}
+	blobController := &BlobController{
+		BlobStore: blobStore,
+		Signer:    signer,
+	}
+
+	// The signature in the query string authorizes the request, no JWT needed
+	mux.HandleFunc("/blobs/", blobController.ServeBlob)
+}
+
+func (ctlr BlobController) ServeBlob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	key := strings.TrimPrefix(r.URL.Path, "/blobs/")
+
+	if err := ctlr.Signer.Verify(key, r.URL.Query()); err != nil {
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	info, err := ctlr.BlobStore.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, domain.ErrBlobNotFound) {
+			http.Error(w, "Blob not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error reading blob:", err)
+		http.Error(w, "Failed to read blob", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := ctlr.BlobStore.Get(ctx, key)
+	if err != nil {
+		fmt.Println("Error reading blob:", err)
+		http.Error(w, "Failed to read blob", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	io.Copy(w, body)
+}
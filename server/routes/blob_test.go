@@ -0,0 +1,89 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"mqtt-streaming-server/routes"
+	"mqtt-streaming-server/storage"
+)
+
+func TestBlobController_ServeBlob(t *testing.T) {
+	signer := storage.NewURLSigner("http://localhost:8080/blobs", "secret")
+	store := storage.NewMemoryStore(signer)
+	if err := store.Put(context.Background(), "photos/1.jpeg", []byte("jpeg-bytes"), "image/jpeg"); err != nil {
+		t.Fatalf("failed to seed store: %v", err)
+	}
+
+	signedURL := func(key string, expires time.Duration) string {
+		u, _ := url.Parse(signer.Sign(key, expires))
+		return u.RequestURI()
+	}
+
+	tests := []struct {
+		name             string
+		method           string
+		target           string
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:             "valid signature",
+			method:           http.MethodGet,
+			target:           signedURL("photos/1.jpeg", time.Minute),
+			expectedStatus:   http.StatusOK,
+			expectedContains: "jpeg-bytes",
+		},
+		{
+			name:             "missing signature",
+			method:           http.MethodGet,
+			target:           "/blobs/photos/1.jpeg",
+			expectedStatus:   http.StatusForbidden,
+			expectedContains: "Forbidden",
+		},
+		{
+			name:             "expired link",
+			method:           http.MethodGet,
+			target:           signedURL("photos/1.jpeg", -time.Minute),
+			expectedStatus:   http.StatusForbidden,
+			expectedContains: "expired",
+		},
+		{
+			name:             "missing blob",
+			method:           http.MethodGet,
+			target:           signedURL("photos/2.jpeg", time.Minute),
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Blob not found",
+		},
+		{
+			name:             "method not allowed",
+			method:           http.MethodPost,
+			target:           signedURL("photos/1.jpeg", time.Minute),
+			expectedStatus:   http.StatusMethodNotAllowed,
+			expectedContains: "Method not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctlr := routes.BlobController{BlobStore: store, Signer: signer}
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			rr := httptest.NewRecorder()
+
+			ctlr.ServeBlob(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContains != "" && !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
@@ -2,29 +2,53 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/events"
 	"mqtt-streaming-server/repository"
 )
 
+const (
+	defaultStatusHistorySize = 50
+	maxStatusHistorySize     = 500
+)
+
 type DeviceController struct {
 	DeviceRepository domain.DeviceRepository
+	StatusHistory    domain.DeviceStatusHistoryRepository
+	Telemetry        domain.TelemetryRepository
+	Frames           *events.FrameStore
 	mqttClient       mqtt.Client
 }
 
-func InitDeviceRoutes(db *mongo.Database, mqttClient mqtt.Client, mux *http.ServeMux) {
+func InitDeviceRoutes(db *mongo.Database, mqttClient mqtt.Client, frames *events.FrameStore, mux *http.ServeMux) {
 	deviceController := &DeviceController{
 		DeviceRepository: repository.NewDeviceRepository(db),
+		StatusHistory:    repository.NewDeviceStatusHistoryRepository(db),
+		Telemetry:        repository.NewTelemetryRepository(db),
+		Frames:           frames,
 		mqttClient:       mqttClient,
 	}
+	userRepository := repository.NewUserRepository(db)
 
 	mux.Handle("/devices", withAuth(http.HandlerFunc(deviceController.GetDevices)))
 	mux.Handle("/devices/switch", withAuth(http.HandlerFunc(deviceController.SwitchDeviceMode)))
+	mux.Handle("/devices/{id}/change-detection", withAuth(http.HandlerFunc(deviceController.ChangeDetection)))
+	mux.Handle("/devices/{id}/preprocessing", withAuth(http.HandlerFunc(deviceController.Preprocessing)))
+	mux.Handle("/devices/{id}/ocr", withAuth(http.HandlerFunc(deviceController.OCRSettings)))
+	mux.Handle("/devices/{id}/status-history", withAuth(http.HandlerFunc(deviceController.GetStatusHistory)))
+	mux.Handle("/devices/{id}/telemetry", withAuth(http.HandlerFunc(deviceController.GetTelemetry)))
+	mux.Handle("/devices/{id}/mjpeg", withViewerAuth(userRepository, http.HandlerFunc(deviceController.StreamMJPEG)))
 }
 
 func (ctlr DeviceController) SwitchDeviceMode(w http.ResponseWriter, r *http.Request) {
@@ -83,3 +107,323 @@ func (ctlr DeviceController) GetDevices(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(devices)
 }
+
+// ChangeDetection serves PUT and DELETE on /devices/{id}/change-detection. PUT
+// sets the device's own threshold and action; DELETE returns the device to the
+// server defaults.
+func (ctlr DeviceController) ChangeDetection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Check if the user is authorized
+	if ctx.Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var settings *domain.ChangeDetection
+	if r.Method == http.MethodPut {
+		settings = &domain.ChangeDetection{}
+		if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := settings.Validate(); err != nil {
+			http.Error(w, "Invalid change detection settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := ctlr.DeviceRepository.UpdateChangeDetection(ctx, r.PathValue("id"), settings); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update device", http.StatusInternalServerError)
+		return
+	}
+
+	if settings == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// Preprocessing serves PUT and DELETE on /devices/{id}/preprocessing. PUT sets
+// the image preprocessing steps run before OCR on the device's photos; DELETE
+// returns the device to the server defaults.
+func (ctlr DeviceController) Preprocessing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Check if the user is authorized
+	if ctx.Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var settings *domain.Preprocessing
+	if r.Method == http.MethodPut {
+		settings = &domain.Preprocessing{}
+		if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := settings.Validate(); err != nil {
+			http.Error(w, "Invalid preprocessing settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := ctlr.DeviceRepository.UpdatePreprocessing(ctx, r.PathValue("id"), settings); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update device", http.StatusInternalServerError)
+		return
+	}
+
+	if settings == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// OCRSettings serves PUT and DELETE on /devices/{id}/ocr. PUT sets the
+// languages, page segmentation mode, whitelist and regions of interest used
+// to read the device's photos; DELETE returns the device to the server defaults.
+func (ctlr DeviceController) OCRSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Check if the user is authorized
+	if ctx.Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var settings *domain.OCRSettings
+	if r.Method == http.MethodPut {
+		settings = &domain.OCRSettings{}
+		if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := settings.Validate(); err != nil {
+			http.Error(w, "Invalid OCR settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := ctlr.DeviceRepository.UpdateOCRSettings(ctx, r.PathValue("id"), settings); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update device", http.StatusInternalServerError)
+		return
+	}
+
+	if settings == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// GetStatusHistory lists the device's status changes, newest first.
+func (ctlr DeviceController) GetStatusHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	deviceID := r.PathValue("id")
+
+	limit := defaultStatusHistorySize
+	if param := r.URL.Query().Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 || parsed > maxStatusHistorySize {
+			http.Error(w, fmt.Sprintf("Invalid limit, expected 1 to %d", maxStatusHistorySize), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	if _, err := ctlr.DeviceRepository.GetByID(ctx, deviceID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error fetching device:", err)
+		http.Error(w, "Failed to fetch device", http.StatusInternalServerError)
+		return
+	}
+
+	changes, err := ctlr.StatusHistory.List(ctx, deviceID, limit)
+	if err != nil {
+		fmt.Println("Error fetching status history:", err)
+		http.Error(w, "Failed to fetch status history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// GetTelemetry returns one metric of the device between from and to, Unix
+// timestamps defaulting to the last 24 hours. With interval, in seconds, the
+// readings are averaged over buckets of that length.
+func (ctlr DeviceController) GetTelemetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	query, err := parseTelemetryQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := ctlr.DeviceRepository.GetByID(ctx, query.DeviceID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error fetching device:", err)
+		http.Error(w, "Failed to fetch device", http.StatusInternalServerError)
+		return
+	}
+
+	points, err := ctlr.Telemetry.Query(ctx, query)
+	if errors.Is(err, domain.ErrTooManyTelemetryPoints) {
+		http.Error(w, fmt.Sprintf("More than %d readings in the range, narrow it or set an interval", domain.MaxTelemetryPoints), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error fetching telemetry:", err)
+		http.Error(w, "Failed to fetch telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(points)
+}
+
+// parseTelemetryQuery builds a validated TelemetryQuery from the request parameters.
+func parseTelemetryQuery(r *http.Request) (domain.TelemetryQuery, error) {
+	params := r.URL.Query()
+	now := time.Now().UTC()
+	query := domain.TelemetryQuery{
+		DeviceID: r.PathValue("id"),
+		Metric:   domain.TelemetryMetric(params.Get("metric")),
+		From:     now.Add(-24 * time.Hour),
+		To:       now,
+	}
+
+	if from := params.Get("from"); from != "" {
+		seconds, err := strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("invalid from timestamp: %v", err)
+		}
+		query.From = time.Unix(seconds, 0).UTC()
+	}
+	if to := params.Get("to"); to != "" {
+		seconds, err := strconv.ParseInt(to, 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("invalid to timestamp: %v", err)
+		}
+		query.To = time.Unix(seconds, 0).UTC()
+	}
+	if interval := params.Get("interval"); interval != "" {
+		seconds, err := strconv.Atoi(interval)
+		if err != nil {
+			return query, errors.New("invalid interval, expected a number of seconds")
+		}
+		query.Interval = time.Duration(seconds) * time.Second
+	}
+
+	if err := query.Validate(); err != nil {
+		return query, fmt.Errorf("invalid query: %v", err)
+	}
+	return query, nil
+}
+
+// StreamMJPEG serves the device's live JPEG frames as multipart/x-mixed-replace,
+// which browsers, VLC and NVR software play as a video stream.
+func (ctlr DeviceController) StreamMJPEG(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	deviceID := r.PathValue("id")
+
+	if _, err := ctlr.DeviceRepository.GetByID(ctx, deviceID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch device", http.StatusInternalServerError)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	viewer, err := ctlr.Frames.Watch(deviceID)
+	if err != nil {
+		http.Error(w, "Too many viewers for this device", http.StatusServiceUnavailable)
+		return
+	}
+	defer viewer.Close()
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		frame, err := viewer.Next(ctx)
+		if err != nil {
+			return
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":   {frame.ContentType},
+			"Content-Length": {strconv.Itoa(len(frame.Data))},
+		})
+		if err != nil {
+			return
+		}
+		if _, err := part.Write(frame.Data); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
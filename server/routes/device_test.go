@@ -3,14 +3,20 @@ package routes_test
 import (
 	"context"
 	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/mock/gomock"
 
 	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/events"
 	mock_domain "mqtt-streaming-server/mocks"
 	"mqtt-streaming-server/routes"
 )
@@ -36,6 +42,22 @@ func TestDeviceController_GetDevices(t *testing.T) {
 			expectedStatus:   http.StatusOK,
 			expectedContains: "iPhone",
 		},
+		{
+			name:      "device details",
+			userEmail: "user@example.com",
+			userRole:  "admin",
+			mockDevices: []*domain.Device{{
+				ID:         "dev-1",
+				DeviceName: "Pixel 7",
+				DeviceInfo: domain.DeviceInfo{
+					Manufacturer: "Google",
+					Model:        "Pixel 7",
+					Camera:       &domain.CameraCapabilities{Lenses: []domain.Lens{{Facing: domain.LensBack}}},
+				},
+			}},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"manufacturer":"Google","model":"Pixel 7","camera":{"lenses":[{"facing":"back"}]}`,
+		},
 		{
 			name:             "no devices",
 			userEmail:        "empty@example.com",
@@ -201,4 +223,490 @@ func TestDeviceController_SwitchDeviceMode_InvalidRequestBody(t *testing.T) {
 	if !strings.Contains(rr.Body.String(), "Invalid request body") {
 		t.Errorf("expected body to contain 'Invalid request body', got %q", rr.Body.String())
 	}
-}
\ No newline at end of file
+}
+func TestDeviceController_StreamMJPEG(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_domain.NewMockDeviceRepository(ctrl)
+	mockRepo.EXPECT().GetByID(gomock.Any(), "dev-1").Return(&domain.Device{ID: "dev-1"}, nil).AnyTimes()
+	mockRepo.EXPECT().GetByID(gomock.Any(), "unknown").Return(nil, mongo.ErrNoDocuments).AnyTimes()
+
+	frames := events.NewFrameStore(4, 1)
+	frames.Push("dev-1", []byte("frame-1"), "image/jpeg")
+	ctlr := routes.DeviceController{DeviceRepository: mockRepo, Frames: frames}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/devices/{id}/mjpeg", ctlr.StreamMJPEG)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/devices/unknown/mjpeg")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown device, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/devices/dev-1/mjpeg")
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" {
+		t.Fatalf("expected multipart/x-mixed-replace, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	part, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read first frame: %v", err)
+	}
+	if got := part.Header.Get("Content-Type"); got != "image/jpeg" {
+		t.Errorf("expected image/jpeg part, got %q", got)
+	}
+	if data, _ := io.ReadAll(io.LimitReader(part, int64(len("frame-1")))); string(data) != "frame-1" {
+		t.Errorf("expected latest frame, got %q", data)
+	}
+
+	// The single viewer slot is taken by the open stream
+	second, err := http.Get(server.URL + "/devices/dev-1/mjpeg")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	second.Body.Close()
+	if second.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when the viewer cap is reached, got %d", second.StatusCode)
+	}
+}
+
+func TestDeviceController_ChangeDetection(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		userRole         string
+		body             string
+		expectUpdate     bool
+		wantSettings     *domain.ChangeDetection
+		mockError        error
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:           "set threshold",
+			method:         http.MethodPut,
+			userRole:       "admin",
+			body:           `{"threshold":0.02,"action":"drop"}`,
+			expectUpdate:   true,
+			wantSettings:   &domain.ChangeDetection{Threshold: 0.02, Action: domain.ChangeActionDrop},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "reset to defaults",
+			method:         http.MethodDelete,
+			userRole:       "admin",
+			expectUpdate:   true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:             "unknown device",
+			method:           http.MethodDelete,
+			userRole:         "admin",
+			expectUpdate:     true,
+			mockError:        mongo.ErrNoDocuments,
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Device not found",
+		},
+		{
+			name:             "threshold out of range",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"threshold":2,"action":"drop"}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "threshold must be between 0 and 1",
+		},
+		{
+			name:             "unknown action",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"threshold":0.1,"action":"archive"}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "invalid action",
+		},
+		{
+			name:             "unauthorized access",
+			method:           http.MethodPut,
+			userRole:         "user",
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockDeviceRepository(ctrl)
+			ctlr := routes.DeviceController{DeviceRepository: mockRepo}
+
+			if tt.expectUpdate {
+				mockRepo.EXPECT().
+					UpdateChangeDetection(gomock.Any(), "dev-1", gomock.Eq(tt.wantSettings)).
+					Return(tt.mockError)
+			}
+
+			req := httptest.NewRequest(tt.method, "/devices/dev-1/change-detection", strings.NewReader(tt.body))
+			req.SetPathValue("id", "dev-1")
+			req = req.WithContext(context.WithValue(req.Context(), "role", tt.userRole))
+			rr := httptest.NewRecorder()
+
+			ctlr.ChangeDetection(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContains != "" && !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeviceController_Preprocessing(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		userRole         string
+		body             string
+		expectUpdate     bool
+		wantSettings     *domain.Preprocessing
+		mockError        error
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:         "set steps with crop",
+			method:       http.MethodPut,
+			userRole:     "admin",
+			body:         `{"steps":["auto_rotate","crop","threshold"],"crop":{"x":0.1,"y":0.2,"width":0.5,"height":0.5}}`,
+			expectUpdate: true,
+			wantSettings: &domain.Preprocessing{
+				Steps: []domain.PreprocessStep{domain.PreprocessAutoRotate, domain.PreprocessCrop, domain.PreprocessThreshold},
+				Crop:  &domain.Region{X: 0.1, Y: 0.2, Width: 0.5, Height: 0.5},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "reset to defaults",
+			method:         http.MethodDelete,
+			userRole:       "admin",
+			expectUpdate:   true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:             "unknown device",
+			method:           http.MethodDelete,
+			userRole:         "admin",
+			expectUpdate:     true,
+			mockError:        mongo.ErrNoDocuments,
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Device not found",
+		},
+		{
+			name:             "unknown step",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"steps":["sharpen"]}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: `invalid step "sharpen"`,
+		},
+		{
+			name:             "crop without region",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"steps":["crop"]}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "needs a crop region",
+		},
+		{
+			name:             "crop region outside the image",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"steps":["crop"],"crop":{"x":0.6,"y":0,"width":0.6,"height":1}}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "crop region must lie within the image",
+		},
+		{
+			name:             "unauthorized access",
+			method:           http.MethodPut,
+			userRole:         "user",
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockDeviceRepository(ctrl)
+			ctlr := routes.DeviceController{DeviceRepository: mockRepo}
+
+			if tt.expectUpdate {
+				mockRepo.EXPECT().
+					UpdatePreprocessing(gomock.Any(), "dev-1", gomock.Eq(tt.wantSettings)).
+					Return(tt.mockError)
+			}
+
+			req := httptest.NewRequest(tt.method, "/devices/dev-1/preprocessing", strings.NewReader(tt.body))
+			req.SetPathValue("id", "dev-1")
+			req = req.WithContext(context.WithValue(req.Context(), "role", tt.userRole))
+			rr := httptest.NewRecorder()
+
+			ctlr.Preprocessing(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContains != "" && !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeviceController_OCRSettings(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		userRole         string
+		body             string
+		expectUpdate     bool
+		wantSettings     *domain.OCRSettings
+		mockError        error
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:         "set languages and region",
+			method:       http.MethodPut,
+			userRole:     "admin",
+			body:         `{"languages":["eng","ron"],"page_seg_mode":7,"whitelist":"ABC123","regions":[{"x":0.25,"y":0.5,"width":0.5,"height":0.25}]}`,
+			expectUpdate: true,
+			wantSettings: &domain.OCRSettings{
+				Languages:   []string{"eng", "ron"},
+				PageSegMode: 7,
+				Whitelist:   "ABC123",
+				Regions:     []domain.Region{{X: 0.25, Y: 0.5, Width: 0.5, Height: 0.25}},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "reset to defaults",
+			method:         http.MethodDelete,
+			userRole:       "admin",
+			expectUpdate:   true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:             "unknown device",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"languages":["eng"]}`,
+			expectUpdate:     true,
+			wantSettings:     &domain.OCRSettings{Languages: []string{"eng"}},
+			mockError:        mongo.ErrNoDocuments,
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Device not found",
+		},
+		{
+			name:             "invalid language",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"languages":["../eng"]}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: `invalid language "../eng"`,
+		},
+		{
+			name:             "page segmentation mode out of range",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"page_seg_mode":14}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "page segmentation mode must be between 0 and 13",
+		},
+		{
+			name:             "region outside the image",
+			method:           http.MethodPut,
+			userRole:         "admin",
+			body:             `{"regions":[{"x":0,"y":0,"width":1,"height":1},{"x":0.5,"y":0.5,"width":0.6,"height":0.1}]}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "region 2 must lie within the image",
+		},
+		{
+			name:             "unauthorized access",
+			method:           http.MethodPut,
+			userRole:         "user",
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockDeviceRepository(ctrl)
+			ctlr := routes.DeviceController{DeviceRepository: mockRepo}
+
+			if tt.expectUpdate {
+				mockRepo.EXPECT().
+					UpdateOCRSettings(gomock.Any(), "dev-1", gomock.Eq(tt.wantSettings)).
+					Return(tt.mockError)
+			}
+
+			req := httptest.NewRequest(tt.method, "/devices/dev-1/ocr", strings.NewReader(tt.body))
+			req.SetPathValue("id", "dev-1")
+			req = req.WithContext(context.WithValue(req.Context(), "role", tt.userRole))
+			rr := httptest.NewRecorder()
+
+			ctlr.OCRSettings(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContains != "" && !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeviceController_GetStatusHistory(t *testing.T) {
+	history := []*domain.DeviceStatusChange{
+		{DeviceID: "dev-1", From: domain.DeviceStatusActive, To: domain.DeviceStatusInactive, Reason: domain.DeviceStatusTimeout},
+	}
+	tests := []struct {
+		name             string
+		query            string
+		lookupErr        error
+		expectList       bool
+		wantLimit        int
+		expectedStatus   int
+		expectedContains string
+	}{
+		{name: "default limit", expectList: true, wantLimit: 50, expectedStatus: http.StatusOK, expectedContains: `"reason":"timeout"`},
+		{name: "custom limit", query: "?limit=5", expectList: true, wantLimit: 5, expectedStatus: http.StatusOK},
+		{name: "invalid limit", query: "?limit=0", expectedStatus: http.StatusBadRequest, expectedContains: "Invalid limit"},
+		{name: "unknown device", lookupErr: mongo.ErrNoDocuments, expectedStatus: http.StatusNotFound, expectedContains: "Device not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockDeviceRepository(ctrl)
+			mockHistory := mock_domain.NewMockDeviceStatusHistoryRepository(ctrl)
+			ctlr := routes.DeviceController{DeviceRepository: mockRepo, StatusHistory: mockHistory}
+
+			if tt.expectList || tt.lookupErr != nil {
+				mockRepo.EXPECT().GetByID(gomock.Any(), "dev-1").Return(&domain.Device{DeviceID: "dev-1"}, tt.lookupErr)
+			}
+			if tt.expectList {
+				mockHistory.EXPECT().List(gomock.Any(), "dev-1", tt.wantLimit).Return(history, nil)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/devices/dev-1/status-history"+tt.query, nil)
+			req.SetPathValue("id", "dev-1")
+			rr := httptest.NewRecorder()
+
+			ctlr.GetStatusHistory(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContains != "" && !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeviceController_GetTelemetry(t *testing.T) {
+	points := []domain.TelemetryPoint{{Timestamp: time.Unix(1714564800, 0).UTC(), Value: 75.5, Min: 70, Max: 81, Count: 4}}
+	tests := []struct {
+		name             string
+		query            string
+		lookupErr        error
+		wantQuery        *domain.TelemetryQuery
+		queryErr         error
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:  "downsampled range",
+			query: "?metric=battery_level&from=1714521600&to=1714608000&interval=3600",
+			wantQuery: &domain.TelemetryQuery{
+				DeviceID: "dev-1",
+				Metric:   domain.MetricBatteryLevel,
+				From:     time.Unix(1714521600, 0).UTC(),
+				To:       time.Unix(1714608000, 0).UTC(),
+				Interval: time.Hour,
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"value":75.5,"min":70,"max":81,"count":4`,
+		},
+		{name: "missing metric", query: "?from=1714521600&to=1714608000", expectedStatus: http.StatusBadRequest, expectedContains: `invalid metric ""`},
+		{name: "invalid from", query: "?metric=temperature&from=yesterday", expectedStatus: http.StatusBadRequest, expectedContains: "invalid from timestamp: "},
+		{name: "invalid interval", query: "?metric=temperature&interval=5m", expectedStatus: http.StatusBadRequest, expectedContains: "invalid interval"},
+		{name: "too many points", query: "?metric=temperature&from=1714521600&to=1714608000&interval=1", expectedStatus: http.StatusBadRequest, expectedContains: "interval is too short"},
+		{
+			name:             "too many raw readings",
+			query:            "?metric=temperature&from=1714521600&to=1714608000",
+			wantQuery:        &domain.TelemetryQuery{DeviceID: "dev-1", Metric: domain.MetricTemperature, From: time.Unix(1714521600, 0).UTC(), To: time.Unix(1714608000, 0).UTC()},
+			queryErr:         domain.ErrTooManyTelemetryPoints,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "More than 10000 readings in the range",
+		},
+		{name: "unknown device", query: "?metric=temperature", lookupErr: mongo.ErrNoDocuments, expectedStatus: http.StatusNotFound, expectedContains: "Device not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockDeviceRepository(ctrl)
+			mockTelemetry := mock_domain.NewMockTelemetryRepository(ctrl)
+			ctlr := routes.DeviceController{DeviceRepository: mockRepo, Telemetry: mockTelemetry}
+
+			if tt.wantQuery != nil || tt.lookupErr != nil {
+				mockRepo.EXPECT().GetByID(gomock.Any(), "dev-1").Return(&domain.Device{DeviceID: "dev-1"}, tt.lookupErr)
+			}
+			if tt.wantQuery != nil {
+				mockTelemetry.EXPECT().Query(gomock.Any(), *tt.wantQuery).Return(points, tt.queryErr)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/devices/dev-1/telemetry"+tt.query, nil)
+			req.SetPathValue("id", "dev-1")
+			rr := httptest.NewRecorder()
+
+			ctlr.GetTelemetry(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContains != "" && !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
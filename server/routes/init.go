@@ -9,13 +9,26 @@ import (
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/events"
+	"mqtt-streaming-server/reocr"
+	"mqtt-streaming-server/storage"
+	"mqtt-streaming-server/timelapse"
+	"mqtt-streaming-server/webhooks"
 )
 
-func InitRoutes(db *mongo.Database, mqttClient mqtt.Client) http.Handler {
+func InitRoutes(db *mongo.Database, mqttClient mqtt.Client, blobStore domain.BlobStore, signer *storage.URLSigner, photoEvents *events.Hub[domain.PhotoEvent], frames *events.FrameStore, timelapses *timelapse.Runner, dispatcher *webhooks.Dispatcher, ocrJobs *reocr.Runner) http.Handler {
 	mux := http.NewServeMux()
 	InitUserRoutes(db, mux)
-	InitPhotoRoutes(db, mux)
-	InitDeviceRoutes(db, mqttClient, mux)
+	InitPhotoRoutes(db, blobStore, photoEvents, mux)
+	InitBlobRoutes(blobStore, signer, mux)
+	InitDeviceRoutes(db, mqttClient, frames, mux)
+	InitTimelapseRoutes(db, blobStore, timelapses, mux)
+	InitRuleRoutes(db, mux)
+	InitWebhookRoutes(db, dispatcher, mux)
+	InitOCRJobRoutes(db, ocrJobs, mux)
 
 	corsHandler := withCORS(mux)
 
@@ -29,6 +42,7 @@ func withCORS(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*") // Replace * with your domain in production
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor")
 
 		// Handle preflight requests
 		if r.Method == http.MethodOptions {
@@ -83,3 +97,47 @@ func withAuth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// withStreamAuth is withAuth for endpoints opened by EventSource, <img> or
+// media players, which cannot set headers: the token may also be passed as
+// the access_token query parameter.
+func withStreamAuth(next http.Handler) http.Handler {
+	auth := withAuth(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			if token := r.URL.Query().Get("access_token"); token != "" {
+				r = r.Clone(r.Context())
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		auth.ServeHTTP(w, r)
+	})
+}
+
+// withViewerAuth protects endpoints opened directly by media players and NVR
+// software. Besides the JWT accepted by withStreamAuth, it takes HTTP Basic
+// credentials of a registered user, which those clients support natively.
+func withViewerAuth(userRepository domain.UserRepository, next http.Handler) http.Handler {
+	tokenAuth := withStreamAuth(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, password, ok := r.BasicAuth()
+		if !ok {
+			if r.Header.Get("Authorization") == "" && r.URL.Query().Get("access_token") == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="camera"`)
+			}
+			tokenAuth.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := userRepository.FindByEmail(r.Context(), email)
+		if err != nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="camera"`)
+			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "email", user.Email)
+		ctx = context.WithValue(ctx, "role", user.Role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"mqtt-streaming-server/broker"
+)
+
+// MQTTAuthController serves the HTTP backend of the broker's
+// mosquitto-go-auth plugin, configured with JSON parameters and the status
+// response mode: 200 allows a request and 403 denies it. The broker sends
+// the subject of the client certificate as the username.
+type MQTTAuthController struct {
+	ACL *broker.ACL
+}
+
+type mqttAuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ClientID string `json:"clientid"`
+	Topic    string `json:"topic"`
+	Acc      int    `json:"acc"`
+}
+
+// InitMQTTAuthRoutes registers the plugin endpoints. They must only be
+// reachable by the broker, so they are served apart from the public API.
+func InitMQTTAuthRoutes(acl *broker.ACL, mux *http.ServeMux) {
+	mqttAuthController := &MQTTAuthController{ACL: acl}
+
+	mux.HandleFunc("/mqtt/auth/user", mqttAuthController.User)
+	mux.HandleFunc("/mqtt/auth/superuser", mqttAuthController.Superuser)
+	mux.HandleFunc("/mqtt/auth/acl", mqttAuthController.ACLCheck)
+}
+
+func (ctlr MQTTAuthController) User(w http.ResponseWriter, r *http.Request) {
+	request, ok := decodeMQTTAuthRequest(w, r)
+	if !ok {
+		return
+	}
+	writeMQTTAuthResult(w, ctlr.ACL.Authenticate(request.Username))
+}
+
+func (ctlr MQTTAuthController) Superuser(w http.ResponseWriter, r *http.Request) {
+	request, ok := decodeMQTTAuthRequest(w, r)
+	if !ok {
+		return
+	}
+	writeMQTTAuthResult(w, ctlr.ACL.Superuser(request.Username))
+}
+
+func (ctlr MQTTAuthController) ACLCheck(w http.ResponseWriter, r *http.Request) {
+	request, ok := decodeMQTTAuthRequest(w, r)
+	if !ok {
+		return
+	}
+	writeMQTTAuthResult(w, ctlr.ACL.Allowed(request.Username, request.Topic, broker.Access(request.Acc)))
+}
+
+func decodeMQTTAuthRequest(w http.ResponseWriter, r *http.Request) (mqttAuthRequest, bool) {
+	var request mqttAuthRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return request, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return request, false
+	}
+	return request, true
+}
+
+func writeMQTTAuthResult(w http.ResponseWriter, allowed bool) {
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,93 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mqtt-streaming-server/broker"
+	"mqtt-streaming-server/routes"
+)
+
+func TestMQTTAuthController(t *testing.T) {
+	mux := http.NewServeMux()
+	routes.InitMQTTAuthRoutes(broker.NewACL(broker.ACLConfig{ServerIdentity: "web"}), mux)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "device with a common name",
+			method:         http.MethodPost,
+			path:           "/mqtt/auth/user",
+			body:           `{"username":"CN=dev-1,O=FirstForce","password":"","clientid":"dev-1"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "subject without common name",
+			method:         http.MethodPost,
+			path:           "/mqtt/auth/user",
+			body:           `{"username":"O=FirstForce","clientid":"dev-1"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "server is superuser",
+			method:         http.MethodPost,
+			path:           "/mqtt/auth/superuser",
+			body:           `{"username":"CN=web,O=FirstForce"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "device is not superuser",
+			method:         http.MethodPost,
+			path:           "/mqtt/auth/superuser",
+			body:           `{"username":"CN=dev-1,O=FirstForce"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "publish on own photo topic",
+			method:         http.MethodPost,
+			path:           "/mqtt/auth/acl",
+			body:           `{"username":"CN=dev-1,O=FirstForce","clientid":"dev-1","topic":"photos/dev-1","acc":2}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "publish on another device's photo topic",
+			method:         http.MethodPost,
+			path:           "/mqtt/auth/acl",
+			body:           `{"username":"CN=dev-1,O=FirstForce","clientid":"dev-2","topic":"photos/dev-2","acc":2}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "invalid body",
+			method:         http.MethodPost,
+			path:           "/mqtt/auth/acl",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "wrong method",
+			method:         http.MethodGet,
+			path:           "/mqtt/auth/acl",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
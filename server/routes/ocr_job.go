@@ -0,0 +1,233 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/reocr"
+	"mqtt-streaming-server/repository"
+)
+
+type OCRJobController struct {
+	OCRJobRepository domain.OCRJobRepository
+	Runner           *reocr.Runner
+}
+
+// ocrJobRequest is the body of POST /ocr-jobs. Start and end are Unix
+// timestamps, like the start and end parameters of GET /photos.
+type ocrJobRequest struct {
+	DeviceID string `json:"device_id"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+}
+
+func InitOCRJobRoutes(db *mongo.Database, runner *reocr.Runner, mux *http.ServeMux) {
+	ocrJobController := &OCRJobController{
+		OCRJobRepository: repository.NewOCRJobRepository(db),
+		Runner:           runner,
+	}
+
+	mux.Handle("/ocr-jobs", withAuth(http.HandlerFunc(ocrJobController.OCRJobCollection)))
+	mux.Handle("/ocr-jobs/{id}", withAuth(http.HandlerFunc(ocrJobController.OCRJobResource)))
+	mux.Handle("/ocr-jobs/{id}/cancel", withAuth(http.HandlerFunc(ocrJobController.CancelOCRJob)))
+}
+
+// OCRJobCollection serves GET and POST on /ocr-jobs.
+func (ctlr OCRJobController) OCRJobCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetOCRJobs(w, r)
+	case http.MethodPost:
+		ctlr.CreateOCRJob(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// OCRJobResource serves GET and DELETE on /ocr-jobs/{id}.
+func (ctlr OCRJobController) OCRJobResource(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetOCRJob(w, r)
+	case http.MethodDelete:
+		ctlr.DeleteOCRJob(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctlr OCRJobController) GetOCRJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	jobs, err := ctlr.OCRJobRepository.List(ctx, r.URL.Query().Get("device_id"))
+	if err != nil {
+		fmt.Println("Error fetching re-OCR jobs:", err)
+		http.Error(w, "Failed to fetch re-OCR jobs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// CreateOCRJob queues a new job and answers 202 with its initial state;
+// clients poll GET /ocr-jobs/{id} for its progress.
+func (ctlr OCRJobController) CreateOCRJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Check if the user is authorized
+	if ctx.Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ocrJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job := &domain.OCRJob{
+		DeviceID: req.DeviceID,
+		Start:    time.Unix(req.Start, 0).UTC(),
+		End:      time.Unix(req.End, 0).UTC(),
+	}
+	if email, ok := ctx.Value("email").(string); ok {
+		job.RequestedBy = email
+	}
+	if err := job.Validate(); err != nil {
+		http.Error(w, "Invalid re-OCR job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ctlr.Runner.Submit(ctx, job); err != nil {
+		if errors.Is(err, reocr.ErrQueueFull) {
+			http.Error(w, "Too many re-OCR jobs in progress, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Println("Error creating re-OCR job:", err)
+		http.Error(w, "Failed to create re-OCR job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/ocr-jobs/"+job.ID.Hex())
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (ctlr OCRJobController) GetOCRJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := ctlr.findOCRJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// CancelOCRJob stops a queued or running job. Photos it already read keep
+// their new text. A running job stops after the photo it is reading, and the
+// handler waits for that so it returns the job in its final state.
+func (ctlr OCRJobController) CancelOCRJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Check if the user is authorized
+	if ctx.Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	job, ok := ctlr.findOCRJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Finished() {
+		http.Error(w, "Re-OCR job has already finished", http.StatusConflict)
+		return
+	}
+
+	if err := ctlr.Runner.Cancel(ctx, job.ID); err != nil {
+		fmt.Println("Error canceling re-OCR job:", err)
+		http.Error(w, "Failed to cancel re-OCR job", http.StatusInternalServerError)
+		return
+	}
+	job, err := ctlr.OCRJobRepository.GetByID(ctx, job.ID)
+	if err != nil {
+		fmt.Println("Error fetching re-OCR job:", err)
+		http.Error(w, "Failed to fetch re-OCR job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// DeleteOCRJob cancels the job if it has not finished yet and removes it.
+// The text history of the photos it read is kept.
+func (ctlr OCRJobController) DeleteOCRJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Check if the user is authorized
+	if ctx.Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	job, ok := ctlr.findOCRJob(w, r)
+	if !ok {
+		return
+	}
+
+	// Once Cancel returns no worker writes to the job any more
+	if !job.Finished() {
+		if err := ctlr.Runner.Cancel(ctx, job.ID); err != nil {
+			fmt.Println("Error canceling re-OCR job:", err)
+			http.Error(w, "Failed to delete re-OCR job", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := ctlr.OCRJobRepository.Delete(ctx, job.ID); err != nil {
+		fmt.Println("Error deleting re-OCR job:", err)
+		http.Error(w, "Failed to delete re-OCR job", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findOCRJob loads the job named by the {id} path value, writing the error
+// response and returning false when it cannot.
+func (ctlr OCRJobController) findOCRJob(w http.ResponseWriter, r *http.Request) (*domain.OCRJob, bool) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid re-OCR job ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	job, err := ctlr.OCRJobRepository.GetByID(r.Context(), id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Re-OCR job not found", http.StatusNotFound)
+			return nil, false
+		}
+		fmt.Println("Error fetching re-OCR job:", err)
+		http.Error(w, "Failed to fetch re-OCR job", http.StatusInternalServerError)
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,172 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/reocr"
+	"mqtt-streaming-server/routes"
+	"mqtt-streaming-server/storage"
+)
+
+func newOCRJobController(ctrl *gomock.Controller) (routes.OCRJobController, *mock_domain.MockOCRJobRepository) {
+	mockRepo := mock_domain.NewMockOCRJobRepository(ctrl)
+	runner := reocr.NewRunner(mockRepo, mock_domain.NewMockPhotoRepository(ctrl), mock_domain.NewMockPhotoTextVersionRepository(ctrl),
+		mock_domain.NewMockDeviceRepository(ctrl), storage.NewMemoryStore(nil), reocr.Config{})
+	return routes.OCRJobController{OCRJobRepository: mockRepo, Runner: runner}, mockRepo
+}
+
+func TestOCRJobController_CreateOCRJob(t *testing.T) {
+	tests := []struct {
+		name             string
+		userRole         string
+		body             string
+		expectSave       bool
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:             "queues job",
+			userRole:         "admin",
+			body:             `{"device_id":"dev-1","start":1714564800,"end":1714568400}`,
+			expectSave:       true,
+			expectedStatus:   http.StatusAccepted,
+			expectedContains: `"status":"queued"`,
+		},
+		{
+			name:             "end before start",
+			userRole:         "admin",
+			body:             `{"device_id":"dev-1","start":1714568400,"end":1714564800}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Invalid re-OCR job: end must be after start",
+		},
+		{
+			name:             "missing device",
+			userRole:         "admin",
+			body:             `{"start":1714564800,"end":1714568400}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "device ID must not be empty",
+		},
+		{
+			name:             "invalid body",
+			userRole:         "admin",
+			body:             `{`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Invalid request body",
+		},
+		{
+			name:             "unauthorized access",
+			userRole:         "user",
+			body:             `{"device_id":"dev-1","start":1714564800,"end":1714568400}`,
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctlr, mockRepo := newOCRJobController(ctrl)
+			if tt.expectSave {
+				mockRepo.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, job *domain.OCRJob) error {
+					if job.DeviceID != "dev-1" || job.End.Sub(job.Start).Hours() != 1 || job.RequestedBy != "admin@example.com" {
+						t.Errorf("unexpected job %+v", job)
+					}
+					job.ID = primitive.NewObjectID()
+					return nil
+				})
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/ocr-jobs", strings.NewReader(tt.body))
+			ctx := context.WithValue(req.Context(), "email", "admin@example.com")
+			req = req.WithContext(context.WithValue(ctx, "role", tt.userRole))
+			rr := httptest.NewRecorder()
+
+			ctlr.OCRJobCollection(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestOCRJobController_CancelOCRJob(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	tests := []struct {
+		name             string
+		userRole         string
+		mockJob          *domain.OCRJob
+		expectCancel     bool
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:             "queued job is canceled",
+			userRole:         "admin",
+			mockJob:          &domain.OCRJob{ID: id, DeviceID: "dev-1", Status: domain.OCRJobStatusQueued},
+			expectCancel:     true,
+			expectedStatus:   http.StatusAccepted,
+			expectedContains: `"status":"canceled"`,
+		},
+		{
+			name:             "finished job",
+			userRole:         "admin",
+			mockJob:          &domain.OCRJob{ID: id, DeviceID: "dev-1", Status: domain.OCRJobStatusCompleted},
+			expectedStatus:   http.StatusConflict,
+			expectedContains: "already finished",
+		},
+		{
+			name:             "unauthorized access",
+			userRole:         "user",
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctlr, mockRepo := newOCRJobController(ctrl)
+			if tt.mockJob != nil {
+				mockRepo.EXPECT().GetByID(gomock.Any(), id).Return(tt.mockJob, nil)
+			}
+			if tt.expectCancel {
+				canceled := *tt.mockJob
+				canceled.Status = domain.OCRJobStatusCanceled
+				mockRepo.EXPECT().SetStatus(gomock.Any(), id, domain.OCRJobStatusQueued, domain.OCRJobStatusCanceled).Return(true, nil)
+				mockRepo.EXPECT().GetByID(gomock.Any(), id).Return(&canceled, nil)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/ocr-jobs/"+id.Hex()+"/cancel", nil)
+			req.SetPathValue("id", id.Hex())
+			req = req.WithContext(context.WithValue(req.Context(), "role", tt.userRole))
+			rr := httptest.NewRecorder()
+
+			ctlr.CancelOCRJob(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
@@ -1,29 +1,55 @@
 package routes
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"path"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/events"
 	"mqtt-streaming-server/repository"
-	"mqtt-streaming-server/utils"
+)
+
+const (
+	presignedURLExpiry = 15 * time.Minute
+
+	defaultPhotoPageSize = 50
+	maxSearchSnippets    = 3
+	streamKeepAlive      = 15 * time.Second
 )
 
 type PhotoController struct {
-	PhotoRepository domain.PhotoRepository
+	PhotoRepository       domain.PhotoRepository
+	TextVersionRepository domain.PhotoTextVersionRepository
+	BlobStore             domain.BlobStore
+	PhotoEvents           *events.Hub[domain.PhotoEvent]
 }
 
-func InitPhotoRoutes(db *mongo.Database, mux *http.ServeMux) {
+func InitPhotoRoutes(db *mongo.Database, blobStore domain.BlobStore, photoEvents *events.Hub[domain.PhotoEvent], mux *http.ServeMux) {
 	photoController := &PhotoController{
-		PhotoRepository: repository.NewPhotoRepository(db),
+		PhotoRepository:       repository.NewPhotoRepository(db),
+		TextVersionRepository: repository.NewPhotoTextVersionRepository(db),
+		BlobStore:             blobStore,
+		PhotoEvents:           photoEvents,
 	}
 
 	mux.Handle("/photos", withAuth(http.HandlerFunc(photoController.GetPhotos)))
+	mux.Handle("/photos/search", withAuth(http.HandlerFunc(photoController.SearchPhotos)))
+	mux.Handle("/photos/stream", withStreamAuth(http.HandlerFunc(photoController.StreamPhotos)))
+	mux.Handle("/photos/{id}", withAuth(http.HandlerFunc(photoController.PhotoResource)))
+	mux.Handle("/photos/{id}/raw", withAuth(http.HandlerFunc(photoController.GetPhotoRaw)))
+	mux.Handle("/photos/{id}/text-versions", withAuth(http.HandlerFunc(photoController.GetPhotoTextVersions)))
 }
 
 func (ctlr PhotoController) GetPhotos(w http.ResponseWriter, r *http.Request) {
@@ -34,65 +60,436 @@ func (ctlr PhotoController) GetPhotos(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
-	start := r.URL.Query().Get("start")
-	end := r.URL.Query().Get("end")
-	text := r.URL.Query().Get("text")
-	deviceID := r.URL.Query().Get("device_id")
+	query, err := parsePhotoQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size, err := parsePhotoSize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if start == "" {
-		start = strconv.FormatInt(time.Now().Add(-24*time.Hour).UTC().Unix(), 10)
+	page, err := ctlr.PhotoRepository.GetPhotos(ctx, query)
+	if err != nil {
+		fmt.Println("Error fetching photos:", err)
+		writePhotoQueryError(w, err, "Failed to fetch photos: ")
+		return
 	}
+	photos := page.Photos
 
-	if end == "" {
-		end = strconv.FormatInt(time.Now().UTC().Unix(), 10)
+	if err := ctlr.presignPhotos(ctx, photos, size); err != nil {
+		http.Error(w, "Failed to get presigned URL", http.StatusInternalServerError)
+		return
 	}
 
-	startInt, err := strconv.ParseInt(start, 10, 64)
+	w.Header().Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photos)
+}
+
+// writePhotoQueryError answers a failed photo query. Queries too slow to
+// finish are the client's to narrow down.
+func writePhotoQueryError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrQueryTimeout):
+		http.Error(w, "Query took too long, narrow it down", http.StatusBadRequest)
+	case errors.Is(err, domain.ErrTextIndexMissing):
+		http.Error(w, "Full-text search is not available yet", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// SearchPhotos ranks photos by full-text relevance of their OCR text to q and
+// returns highlighted snippets of the matches.
+func (ctlr PhotoController) SearchPhotos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	if search == "" {
+		http.Error(w, "Missing search query q", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parsePhotoQuery(r)
 	if err != nil {
-		http.Error(w, "Invalid start timestamp "+err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size, err := parsePhotoSize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.Text = search
+	query.TextMode = domain.TextFullText
+	query.After = nil
+	if err := query.Validate(); err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	endInt, err := strconv.ParseInt(end, 10, 64)
+	results, err := ctlr.PhotoRepository.SearchPhotos(ctx, query)
 	if err != nil {
-		http.Error(w, "Invalid end timestamp "+err.Error(), http.StatusBadRequest)
+		fmt.Println("Error searching photos:", err)
+		writePhotoQueryError(w, err, "Failed to search photos")
 		return
 	}
 
-	filters := map[string]any{
-		"timestamp": map[string]any{
-			"$gte": time.Unix(startInt, 0),
-			"$lte": time.Unix(endInt, 0),
-		},
+	photos := make([]*domain.Photo, 0, len(results))
+	for _, result := range results {
+		result.Snippets = domain.BuildSnippets(result.Text, search, maxSearchSnippets)
+		if result.OCR != nil {
+			result.Highlights = domain.BuildHighlights(result.OCR.Words, search)
+		}
+		photos = append(photos, result.Photo)
+	}
+	if err := ctlr.presignPhotos(ctx, photos, size); err != nil {
+		http.Error(w, "Failed to get presigned URL", http.StatusInternalServerError)
+		return
 	}
 
-	if text != "" {
-		filters["text"] = map[string]any{
-			"$regex":   text,
-			"$options": "i",
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// StreamPhotos pushes a Server-Sent Event for every photo committed while the
+// client is connected, optionally restricted to the device_id parameter(s).
+func (ctlr PhotoController) StreamPhotos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	size, err := parsePhotoSize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deviceIDs := splitListParam(r.URL.Query()["device_id"])
+	sub := ctlr.PhotoEvents.Subscribe(func(event domain.PhotoEvent) bool {
+		return len(deviceIDs) == 0 || slices.Contains(deviceIDs, event.Photo.DeviceID)
+	})
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped by the hub for falling behind; the client should reconnect
+				fmt.Fprint(w, "event: error\ndata: {\"error\":\"slow consumer\"}\n\n")
+				flusher.Flush()
+				return
+			}
+			// Copy so concurrent subscribers do not share the presigned URL field
+			photo := *event.Photo
+			if err := ctlr.presignPhotos(ctx, []*domain.Photo{&photo}, size); err != nil {
+				continue
+			}
+			data, err := json.Marshal(domain.PhotoEvent{Type: event.Type, Photo: &photo})
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", photo.ID.Hex(), event.Type, data)
+			flusher.Flush()
 		}
 	}
+}
 
-	if deviceID != "" {
-		filters["device_id"] = deviceID
+// PhotoResource serves GET and DELETE on /photos/{id}.
+func (ctlr PhotoController) PhotoResource(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetPhoto(w, r)
+	case http.MethodDelete:
+		ctlr.DeletePhoto(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
+}
 
-	photos, err := ctlr.PhotoRepository.GetPhotos(ctx, filters)
+func (ctlr PhotoController) GetPhoto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	size, err := parsePhotoSize(r)
 	if err != nil {
-		fmt.Println("Error fetching photos:", err)
-		http.Error(w, "Failed to fetch photos: ", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	photo, ok := ctlr.findPhoto(w, r)
+	if !ok {
+		return
+	}
+	// highlight returns the boxes of the words matching the term, in the
+	// pixel coordinates of the original image
+	if search := strings.TrimSpace(r.URL.Query().Get("highlight")); search != "" && photo.OCR != nil {
+		photo.Highlights = domain.BuildHighlights(photo.OCR.Words, search)
+	}
+
+	if err := ctlr.presignPhotos(ctx, []*domain.Photo{photo}, size); err != nil {
+		http.Error(w, "Failed to get presigned URL", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photo)
+}
+
+// GetPhotoRaw streams the image bytes through the API, for clients that cannot reach the blob store.
+func (ctlr PhotoController) GetPhotoRaw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	size, err := parsePhotoSize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	photo, ok := ctlr.findPhoto(w, r)
+	if !ok {
+		return
+	}
+
+	key, contentType := photo.SizeKey(size)
+	body, err := ctlr.BlobStore.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, domain.ErrBlobNotFound) {
+			http.Error(w, "Photo image not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error reading photo:", err)
+		http.Error(w, "Failed to read photo", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", photo.ID.Hex()+path.Ext(key)))
+	io.Copy(w, body)
+}
+
+// GetPhotoTextVersions lists the texts re-OCR jobs replaced on the photo,
+// newest first. The current text is on the photo itself.
+func (ctlr PhotoController) GetPhotoTextVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	photo, ok := ctlr.findPhoto(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := ctlr.TextVersionRepository.ListByPhoto(r.Context(), photo.ID)
+	if err != nil {
+		fmt.Println("Error fetching text versions:", err)
+		http.Error(w, "Failed to fetch text versions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+func (ctlr PhotoController) DeletePhoto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Check if the user is authorized
+	if ctx.Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	photo, ok := ctlr.findPhoto(w, r)
+	if !ok {
+		return
+	}
+
+	// Remove the blobs first so a failure leaves a record that can be deleted again
+	for _, key := range photo.BlobKeys() {
+		if err := ctlr.BlobStore.Delete(ctx, key); err != nil && !errors.Is(err, domain.ErrBlobNotFound) {
+			fmt.Println("Error deleting photo blob:", err)
+			http.Error(w, "Failed to delete photo", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := ctlr.TextVersionRepository.DeleteByPhoto(ctx, photo.ID); err != nil {
+		fmt.Println("Error deleting photo text history:", err)
+		http.Error(w, "Failed to delete photo", http.StatusInternalServerError)
+		return
+	}
+	if err := ctlr.PhotoRepository.Delete(ctx, photo.ID); err != nil {
+		fmt.Println("Error deleting photo:", err)
+		http.Error(w, "Failed to delete photo", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findPhoto loads the committed photo named by the {id} path value, writing
+// the error response and returning false when it cannot.
+func (ctlr PhotoController) findPhoto(w http.ResponseWriter, r *http.Request) (*domain.Photo, bool) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid photo ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	photo, err := ctlr.PhotoRepository.GetByID(r.Context(), id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Photo not found", http.StatusNotFound)
+			return nil, false
+		}
+		fmt.Println("Error fetching photo:", err)
+		http.Error(w, "Failed to fetch photo", http.StatusInternalServerError)
+		return nil, false
+	}
+	if photo.Status != domain.PhotoStatusCommitted {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return nil, false
+	}
+	return photo, true
+}
+
+// presignPhotos sets the presigned URL of every photo to the image of the given size.
+func (ctlr PhotoController) presignPhotos(ctx context.Context, photos []*domain.Photo, size domain.PhotoSize) error {
 	for _, photo := range photos {
-		presignedURL, err := utils.GetPresignedURL(ctx, fmt.Sprintf("photos/%d.%s", photo.Timestamp.Unix(), photo.ImageType))
+		key, _ := photo.SizeKey(size)
+		presignedURL, err := ctlr.BlobStore.SignedURL(ctx, key, presignedURLExpiry)
 		if err != nil {
-			http.Error(w, "Failed to get presigned URL", http.StatusInternalServerError)
-			return
+			fmt.Println("Error presigning photo:", err)
+			return err
 		}
 		photo.PresignedURL = presignedURL
 	}
+	return nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(photos)
+// parsePhotoQuery builds a validated PhotoQuery from the request parameters.
+// Device IDs and tags may be repeated or comma separated.
+func parsePhotoQuery(r *http.Request) (domain.PhotoQuery, error) {
+	params := r.URL.Query()
+	start := params.Get("start")
+	end := params.Get("end")
+
+	if start == "" {
+		start = strconv.FormatInt(time.Now().Add(-24*time.Hour).UTC().Unix(), 10)
+	}
+
+	if end == "" {
+		end = strconv.FormatInt(time.Now().UTC().Unix(), 10)
+	}
+
+	startInt, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return domain.PhotoQuery{}, fmt.Errorf("Invalid start timestamp %v", err)
+	}
+
+	endInt, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return domain.PhotoQuery{}, fmt.Errorf("Invalid end timestamp %v", err)
+	}
+
+	limit := defaultPhotoPageSize
+	if limitParam := params.Get("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			return domain.PhotoQuery{}, fmt.Errorf("Invalid limit, expected 1 to %d", domain.MaxPhotoQueryLimit)
+		}
+	}
+
+	query := domain.PhotoQuery{
+		Start:     time.Unix(startInt, 0),
+		End:       time.Unix(endInt, 0),
+		DeviceIDs: splitListParam(params["device_id"]),
+		Text:      params.Get("text"),
+		TextMode:  domain.TextMode(params.Get("text_mode")),
+		Tags:      splitListParam(params["tag"]),
+		Limit:     limit,
+		Sort:      domain.SortOrder(params.Get("sort")),
+	}
+
+	if changedOnly := params.Get("changed_only"); changedOnly != "" {
+		query.ChangedOnly, err = strconv.ParseBool(changedOnly)
+		if err != nil {
+			return domain.PhotoQuery{}, errors.New("Invalid changed_only, expected true or false")
+		}
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		query.After, err = domain.DecodePhotoCursor(cursor)
+		if err != nil {
+			return domain.PhotoQuery{}, errors.New("Invalid cursor")
+		}
+	}
+
+	if err := query.Validate(); err != nil {
+		return domain.PhotoQuery{}, fmt.Errorf("Invalid query: %v", err)
+	}
+	return query, nil
+}
+
+// parsePhotoSize reads the size parameter, which picks the image presigned URLs point at.
+func parsePhotoSize(r *http.Request) (domain.PhotoSize, error) {
+	size, err := domain.ParsePhotoSize(r.URL.Query().Get("size"))
+	if err != nil {
+		return "", errors.New("Invalid size, expected thumb, preview or original")
+	}
+	return size, nil
+}
+
+func splitListParam(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
 }
@@ -1,29 +1,76 @@
 package routes_test
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/mock/gomock"
 
 	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/events"
 	mock_domain "mqtt-streaming-server/mocks"
 	"mqtt-streaming-server/routes"
+	"mqtt-streaming-server/storage"
 )
 
 func TestPhotoController_GetPhotos(t *testing.T) {
 	tests := []struct {
 		name             string
 		userEmail        string
+		query            string
 		mockPhotos       []*domain.Photo
 		mockError        error
 		expectedStatus   int
 		expectedContains string
 	}{
+		{
+			name:      "photos with signed URLs",
+			userEmail: "user@example.com",
+			mockPhotos: []*domain.Photo{
+				{DeviceID: "dev-1", ImageType: "jpeg", Timestamp: time.Unix(1700000000, 0), Text: "hello"},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: "http://localhost:8080/blobs/photos/1700000000.jpeg?expires=",
+		},
+		{
+			name:      "photos with persisted storage key",
+			userEmail: "user@example.com",
+			mockPhotos: []*domain.Photo{
+				{DeviceID: "dev-1", ImageType: "jpeg", Timestamp: time.Unix(1700000000, 0), StorageKey: "photos/dev-1/1700000000000-0011223344556677.jpeg"},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: "http://localhost:8080/blobs/photos/dev-1/1700000000000-0011223344556677.jpeg?expires=",
+		},
+		{
+			name:      "thumbnail size",
+			userEmail: "user@example.com",
+			query:     "?size=thumb",
+			mockPhotos: []*domain.Photo{
+				{DeviceID: "dev-1", ImageType: "png", StorageKey: "photos/dev-1/a.png", ThumbnailKey: "photos/dev-1/a_thumb.jpeg"},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: "http://localhost:8080/blobs/photos/dev-1/a_thumb.jpeg?expires=",
+		},
+		{
+			name:      "missing preview falls back to original",
+			userEmail: "user@example.com",
+			query:     "?size=preview",
+			mockPhotos: []*domain.Photo{
+				{DeviceID: "dev-1", ImageType: "png", StorageKey: "photos/dev-1/a.png"},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: "http://localhost:8080/blobs/photos/dev-1/a.png?expires=",
+		},
 		{
 			name:             "no photos",
 			userEmail:        "empty@example.com",
@@ -46,17 +93,22 @@ func TestPhotoController_GetPhotos(t *testing.T) {
 			defer ctrl.Finish()
 
 			mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
-			ctlr := routes.PhotoController{PhotoRepository: mockRepo}
+			signer := storage.NewURLSigner("http://localhost:8080/blobs", "secret")
+			ctlr := routes.PhotoController{PhotoRepository: mockRepo, BlobStore: storage.NewMemoryStore(signer)}
 
-			req := httptest.NewRequest(http.MethodGet, "/photos", nil)
+			req := httptest.NewRequest(http.MethodGet, "/photos"+tt.query, nil)
 			ctx := context.WithValue(req.Context(), "email", tt.userEmail)
 			req = req.WithContext(ctx)
 			rr := httptest.NewRecorder()
 
 			if tt.mockPhotos != nil || tt.mockError != nil {
+				var page *domain.PhotoPage
+				if tt.mockError == nil {
+					page = &domain.PhotoPage{Photos: tt.mockPhotos, Total: int64(len(tt.mockPhotos))}
+				}
 				mockRepo.EXPECT().
 					GetPhotos(ctx, gomock.Any()).
-					Return(tt.mockPhotos, tt.mockError)
+					Return(page, tt.mockError)
 			}
 
 			ctlr.GetPhotos(rr, req)
@@ -72,6 +124,38 @@ func TestPhotoController_GetPhotos(t *testing.T) {
 }
 
 
+func TestPhotoController_GetPhotos_QueryErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "query timeout", err: fmt.Errorf("%w: operation exceeded time limit", domain.ErrQueryTimeout), expectedStatus: http.StatusBadRequest},
+		{name: "text index missing", err: fmt.Errorf("%w: text index required", domain.ErrTextIndexMissing), expectedStatus: http.StatusServiceUnavailable},
+		{name: "database error", err: errors.New("connection reset"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+			mockRepo.EXPECT().GetPhotos(gomock.Any(), gomock.Any()).Return(nil, tt.err)
+			ctlr := routes.PhotoController{PhotoRepository: mockRepo}
+
+			req := httptest.NewRequest(http.MethodGet, "/photos?text=gate&text_mode=regex", nil)
+			rr := httptest.NewRecorder()
+
+			ctlr.GetPhotos(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
 func TestPhotoController_GetPhotos_MethodNotAllowed(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -111,3 +195,413 @@ func TestPhotoController_GetPhotos_InvalidTimestamp(t *testing.T) {
 		t.Errorf("expected body to contain 'Invalid start timestamp' or 'Invalid end timestamp', got %q", rr.Body.String())
 	}
 }
+
+func TestPhotoController_GetPhotos_Pagination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cursor := domain.PhotoCursor{Timestamp: time.Unix(1700000000, 0).UTC(), ID: primitive.NewObjectID()}
+	next := domain.PhotoCursor{Timestamp: time.Unix(1700000100, 0).UTC(), ID: primitive.NewObjectID()}
+
+	mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+	signer := storage.NewURLSigner("http://localhost:8080/blobs", "secret")
+	ctlr := routes.PhotoController{PhotoRepository: mockRepo, BlobStore: storage.NewMemoryStore(signer)}
+
+	mockRepo.EXPECT().
+		GetPhotos(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, query domain.PhotoQuery) (*domain.PhotoPage, error) {
+			if query.Limit != 10 {
+				t.Errorf("expected limit 10, got %d", query.Limit)
+			}
+			if query.Sort != domain.SortOldestFirst {
+				t.Errorf("expected sort asc, got %q", query.Sort)
+			}
+			if len(query.DeviceIDs) != 2 || query.DeviceIDs[0] != "dev-1" || query.DeviceIDs[1] != "dev-2" {
+				t.Errorf("expected device IDs [dev-1 dev-2], got %v", query.DeviceIDs)
+			}
+			if len(query.Tags) != 1 || query.Tags[0] != "gate" {
+				t.Errorf("expected tags [gate], got %v", query.Tags)
+			}
+			if query.TextMode != domain.TextExact {
+				t.Errorf("expected text mode exact, got %q", query.TextMode)
+			}
+			if query.After == nil || query.After.ID != cursor.ID || !query.After.Timestamp.Equal(cursor.Timestamp) {
+				t.Errorf("expected cursor %+v, got %+v", cursor, query.After)
+			}
+			return &domain.PhotoPage{Photos: []*domain.Photo{}, Total: 42, NextCursor: next.Encode()}, nil
+		})
+
+	req := httptest.NewRequest(http.MethodGet, "/photos?limit=10&sort=asc&device_id=dev-1,dev-2&tag=gate&text=EXIT&text_mode=exact&cursor="+cursor.Encode(), nil)
+	rr := httptest.NewRecorder()
+
+	ctlr.GetPhotos(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("X-Total-Count"); got != "42" {
+		t.Errorf("expected X-Total-Count 42, got %q", got)
+	}
+	if got := rr.Header().Get("X-Next-Cursor"); got != next.Encode() {
+		t.Errorf("expected X-Next-Cursor %q, got %q", next.Encode(), got)
+	}
+}
+
+func TestPhotoController_GetPhotos_InvalidQuery(t *testing.T) {
+	tests := []struct {
+		name             string
+		query            string
+		expectedContains string
+	}{
+		{name: "limit not a number", query: "limit=abc", expectedContains: "Invalid limit"},
+		{name: "limit too large", query: "limit=100000", expectedContains: "limit must be at most"},
+		{name: "limit zero", query: "limit=0", expectedContains: "Invalid limit"},
+		{name: "unknown sort", query: "sort=sideways", expectedContains: "invalid sort order"},
+		{name: "garbage cursor", query: "cursor=not-a-cursor", expectedContains: "Invalid cursor"},
+		{name: "unknown text mode", query: "text=a&text_mode=fuzzy", expectedContains: "invalid text mode"},
+		{name: "bad regex", query: "text=(unclosed&text_mode=regex", expectedContains: "invalid regular expression"},
+		{name: "nested quantifier", query: "text=" + url.QueryEscape("(a+)+$") + "&text_mode=regex", expectedContains: "quantified groups"},
+		{name: "text too long", query: "text=" + strings.Repeat("a", 300), expectedContains: "text must be at most"},
+		{name: "end before start", query: "start=2000&end=1000", expectedContains: "end must not be before start"},
+		{name: "unknown size", query: "size=huge", expectedContains: "Invalid size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+			ctlr := routes.PhotoController{PhotoRepository: mockRepo}
+
+			req := httptest.NewRequest(http.MethodGet, "/photos?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			ctlr.GetPhotos(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestPhotoController_SearchPhotos(t *testing.T) {
+	tests := []struct {
+		name             string
+		target           string
+		mockResults      []*domain.PhotoSearchResult
+		mockError        error
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:   "ranked results with snippets",
+			target: "/photos/search?q=alarm",
+			mockResults: []*domain.PhotoSearchResult{
+				{Photo: &domain.Photo{DeviceID: "dev-1", ImageType: "jpeg", Text: "FIRE ALARM PANEL", StorageKey: "photos/dev-1/a.jpeg"}, Score: 1.5},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"fragments":[{"text":"FIRE "},{"text":"ALARM","match":true},{"text":" PANEL"}]`,
+		},
+		{
+			name:   "word boxes of matches",
+			target: "/photos/search?q=alarm",
+			mockResults: []*domain.PhotoSearchResult{
+				{Photo: &domain.Photo{DeviceID: "dev-1", ImageType: "jpeg", Text: "FIRE ALARM", StorageKey: "photos/dev-1/a.jpeg", OCR: &domain.PhotoOCR{
+					Status: domain.OCRStatusDone,
+					Words:  []domain.WordBox{{Text: "FIRE", X: 4, Width: 40, Height: 12}, {Text: "ALARM", X: 50, Width: 60, Height: 12}},
+				}}, Score: 1},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"highlights":[{"text":"ALARM","confidence":0,"x":50,"y":0,"width":60,"height":12}]`,
+		},
+		{
+			name:             "missing query",
+			target:           "/photos/search",
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Missing search query",
+		},
+		{
+			name:             "repository error",
+			target:           "/photos/search?q=alarm",
+			mockError:        errors.New("db error"),
+			expectedStatus:   http.StatusInternalServerError,
+			expectedContains: "Failed to search photos",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+			signer := storage.NewURLSigner("http://localhost:8080/blobs", "secret")
+			ctlr := routes.PhotoController{PhotoRepository: mockRepo, BlobStore: storage.NewMemoryStore(signer)}
+
+			if tt.mockResults != nil || tt.mockError != nil {
+				mockRepo.EXPECT().
+					SearchPhotos(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, query domain.PhotoQuery) ([]*domain.PhotoSearchResult, error) {
+						if query.TextMode != domain.TextFullText || query.Text != "alarm" {
+							t.Errorf("expected full-text query for alarm, got %q (%s)", query.Text, query.TextMode)
+						}
+						return tt.mockResults, tt.mockError
+					})
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rr := httptest.NewRecorder()
+
+			ctlr.SearchPhotos(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContains != "" && !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestPhotoController_PhotoResource(t *testing.T) {
+	id := primitive.NewObjectID()
+	committed := &domain.Photo{ID: id, DeviceID: "dev-1", ImageType: "jpeg", StorageKey: "photos/dev-1/a.jpeg", Status: domain.PhotoStatusCommitted}
+	pending := &domain.Photo{ID: id, DeviceID: "dev-1", ImageType: "jpeg", StorageKey: "photos/dev-1/a.jpeg", Status: domain.PhotoStatusPending}
+	recognized := &domain.Photo{ID: id, DeviceID: "dev-1", ImageType: "jpeg", StorageKey: "photos/dev-1/a.jpeg", Status: domain.PhotoStatusCommitted, Text: "EXIT 12", OCR: &domain.PhotoOCR{
+		Status: domain.OCRStatusDone,
+		Words:  []domain.WordBox{{Text: "EXIT", X: 10, Width: 30, Height: 9}, {Text: "12", X: 45, Width: 12, Height: 9}},
+	}}
+
+	tests := []struct {
+		name             string
+		method           string
+		pathID           string
+		query            string
+		userRole         string
+		mockPhoto        *domain.Photo
+		mockError        error
+		expectDelete     bool
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:             "get photo",
+			method:           http.MethodGet,
+			pathID:           id.Hex(),
+			mockPhoto:        committed,
+			expectedStatus:   http.StatusOK,
+			expectedContains: "http://localhost:8080/blobs/photos/dev-1/a.jpeg?expires=",
+		},
+		{
+			name:             "get photo with highlights",
+			method:           http.MethodGet,
+			pathID:           id.Hex(),
+			query:            "?highlight=exit",
+			mockPhoto:        recognized,
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"highlights":[{"text":"EXIT","confidence":0,"x":10,"y":0,"width":30,"height":9}]`,
+		},
+		{
+			name:             "pending photo is hidden",
+			method:           http.MethodGet,
+			pathID:           id.Hex(),
+			mockPhoto:        pending,
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Photo not found",
+		},
+		{
+			name:             "unknown photo",
+			method:           http.MethodGet,
+			pathID:           id.Hex(),
+			mockError:        mongo.ErrNoDocuments,
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Photo not found",
+		},
+		{
+			name:             "invalid id",
+			method:           http.MethodGet,
+			pathID:           "not-an-id",
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Invalid photo ID",
+		},
+		{
+			name:           "admin deletes photo",
+			method:         http.MethodDelete,
+			pathID:         id.Hex(),
+			userRole:       "admin",
+			mockPhoto:      committed,
+			expectDelete:   true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:             "user cannot delete photo",
+			method:           http.MethodDelete,
+			pathID:           id.Hex(),
+			userRole:         "user",
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+		{
+			name:             "method not allowed",
+			method:           http.MethodPut,
+			pathID:           id.Hex(),
+			expectedStatus:   http.StatusMethodNotAllowed,
+			expectedContains: "Method not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+			signer := storage.NewURLSigner("http://localhost:8080/blobs", "secret")
+			store := storage.NewMemoryStore(signer)
+			store.Put(context.Background(), "photos/dev-1/a.jpeg", []byte("jpeg-bytes"), "image/jpeg")
+			mockVersions := mock_domain.NewMockPhotoTextVersionRepository(ctrl)
+			ctlr := routes.PhotoController{PhotoRepository: mockRepo, TextVersionRepository: mockVersions, BlobStore: store}
+
+			if tt.mockPhoto != nil || tt.mockError != nil {
+				mockRepo.EXPECT().GetByID(gomock.Any(), id).Return(tt.mockPhoto, tt.mockError)
+			}
+			if tt.expectDelete {
+				mockVersions.EXPECT().DeleteByPhoto(gomock.Any(), id).Return(nil)
+				mockRepo.EXPECT().Delete(gomock.Any(), id).Return(nil)
+			}
+
+			req := httptest.NewRequest(tt.method, "/photos/"+tt.pathID+tt.query, nil)
+			req.SetPathValue("id", tt.pathID)
+			req = req.WithContext(context.WithValue(req.Context(), "role", tt.userRole))
+			rr := httptest.NewRecorder()
+
+			ctlr.PhotoResource(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContains != "" && !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+			if tt.expectDelete {
+				if _, err := store.Stat(context.Background(), "photos/dev-1/a.jpeg"); !errors.Is(err, domain.ErrBlobNotFound) {
+					t.Errorf("expected blob to be deleted, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPhotoController_GetPhotoRaw(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	id := primitive.NewObjectID()
+	mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+	store := storage.NewMemoryStore(nil)
+	store.Put(context.Background(), "photos/dev-1/a.jpeg", []byte("jpeg-bytes"), "image/jpeg")
+	ctlr := routes.PhotoController{PhotoRepository: mockRepo, BlobStore: store}
+
+	mockRepo.EXPECT().GetByID(gomock.Any(), id).Return(&domain.Photo{
+		ID: id, ImageType: "jpeg", StorageKey: "photos/dev-1/a.jpeg", Status: domain.PhotoStatusCommitted,
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/photos/"+id.Hex()+"/raw", nil)
+	req.SetPathValue("id", id.Hex())
+	rr := httptest.NewRecorder()
+
+	ctlr.GetPhotoRaw(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "image/jpeg" {
+		t.Errorf("expected Content-Type image/jpeg, got %q", got)
+	}
+	if rr.Body.String() != "jpeg-bytes" {
+		t.Errorf("expected image bytes, got %q", rr.Body.String())
+	}
+}
+
+func TestPhotoController_GetPhotoTextVersions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	id := primitive.NewObjectID()
+	mockRepo := mock_domain.NewMockPhotoRepository(ctrl)
+	mockVersions := mock_domain.NewMockPhotoTextVersionRepository(ctrl)
+	ctlr := routes.PhotoController{PhotoRepository: mockRepo, TextVersionRepository: mockVersions}
+
+	mockRepo.EXPECT().GetByID(gomock.Any(), id).Return(&domain.Photo{
+		ID: id, Text: "GATE 4", TextVersion: 1, Status: domain.PhotoStatusCommitted,
+	}, nil)
+	mockVersions.EXPECT().ListByPhoto(gomock.Any(), id).Return([]*domain.PhotoTextVersion{
+		{PhotoID: id, Version: 0, Text: "GATE A"},
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/photos/"+id.Hex()+"/text-versions", nil)
+	req.SetPathValue("id", id.Hex())
+	rr := httptest.NewRecorder()
+
+	ctlr.GetPhotoTextVersions(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"text":"GATE A"`) {
+		t.Errorf("expected the replaced text, got %q", rr.Body.String())
+	}
+}
+
+func TestPhotoController_StreamPhotos(t *testing.T) {
+	hub := events.NewHub[domain.PhotoEvent](4, events.DropEvents)
+	signer := storage.NewURLSigner("http://localhost:8080/blobs", "secret")
+	ctlr := routes.PhotoController{BlobStore: storage.NewMemoryStore(signer), PhotoEvents: hub}
+
+	server := httptest.NewServer(http.HandlerFunc(ctlr.StreamPhotos))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/photos/stream?device_id=dev-1")
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", got)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if line, _ := reader.ReadString('\n'); line != ": connected\n" {
+		t.Fatalf("expected connected comment, got %q", line)
+	}
+
+	hub.Publish(domain.PhotoEvent{Type: domain.PhotoCommitted, Photo: &domain.Photo{ID: primitive.NewObjectID(), DeviceID: "dev-2", StorageKey: "photos/dev-2/b.jpeg"}})
+	hub.Publish(domain.PhotoEvent{Type: domain.PhotoCommitted, Photo: &domain.Photo{ID: primitive.NewObjectID(), DeviceID: "dev-1", StorageKey: "photos/dev-1/a.jpeg", Text: "GATE 3"}})
+
+	var data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read stream: %v", err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			data = line
+		}
+	}
+	if !strings.Contains(data, `"device_id":"dev-1"`) || strings.Contains(data, "dev-2") {
+		t.Errorf("expected only the dev-1 event, got %q", data)
+	}
+	if !strings.Contains(data, "http://localhost:8080/blobs/photos/dev-1/a.jpeg?expires=") {
+		t.Errorf("expected presigned URL in event, got %q", data)
+	}
+	if !strings.Contains(data, `"text":"GATE 3"`) {
+		t.Errorf("expected OCR text in event, got %q", data)
+	}
+}
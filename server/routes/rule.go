@@ -0,0 +1,244 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/repository"
+)
+
+const (
+	defaultAlertPageSize = 100
+	maxAlertPageSize     = 500
+)
+
+type RuleController struct {
+	AlertRuleRepository domain.AlertRuleRepository
+	AlertRepository     domain.AlertRepository
+}
+
+func InitRuleRoutes(db *mongo.Database, mux *http.ServeMux) {
+	ruleController := &RuleController{
+		AlertRuleRepository: repository.NewAlertRuleRepository(db),
+		AlertRepository:     repository.NewAlertRepository(db),
+	}
+
+	mux.Handle("/rules", withAuth(http.HandlerFunc(ruleController.RuleCollection)))
+	mux.Handle("/rules/{id}", withAuth(http.HandlerFunc(ruleController.RuleResource)))
+	mux.Handle("/alerts", withAuth(http.HandlerFunc(ruleController.GetAlerts)))
+}
+
+// RuleCollection serves GET and POST on /rules. Rules hold webhook URLs and
+// email addresses, so only admins may see or change them.
+func (ctlr RuleController) RuleCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetRules(w, r)
+	case http.MethodPost:
+		ctlr.CreateRule(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RuleResource serves GET, PUT and DELETE on /rules/{id}, for admins only.
+func (ctlr RuleController) RuleResource(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetRule(w, r)
+	case http.MethodPut:
+		ctlr.UpdateRule(w, r)
+	case http.MethodDelete:
+		ctlr.DeleteRule(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctlr RuleController) GetRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := ctlr.AlertRuleRepository.List(r.Context())
+	if err != nil {
+		fmt.Println("Error fetching rules:", err)
+		http.Error(w, "Failed to fetch rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func (ctlr RuleController) CreateRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var rule domain.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.ID = primitive.NilObjectID
+	rule.CreatedAt = time.Now().UTC()
+	if email, ok := ctx.Value("email").(string); ok {
+		rule.CreatedBy = email
+	}
+
+	if err := ctlr.AlertRuleRepository.Save(ctx, &rule); err != nil {
+		fmt.Println("Error saving rule:", err)
+		http.Error(w, "Failed to save rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/rules/"+rule.ID.Hex())
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (ctlr RuleController) GetRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := ctlr.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// UpdateRule replaces the rule, keeping who created it and when.
+func (ctlr RuleController) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	existing, ok := ctlr.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	var rule domain.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.ID = existing.ID
+	rule.CreatedBy = existing.CreatedBy
+	rule.CreatedAt = existing.CreatedAt
+
+	if err := ctlr.AlertRuleRepository.Update(ctx, &rule); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error updating rule:", err)
+		http.Error(w, "Failed to update rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (ctlr RuleController) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := ctlr.AlertRuleRepository.Delete(r.Context(), id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error deleting rule:", err)
+		http.Error(w, "Failed to delete rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAlerts lists the alert history, most recent first, optionally filtered
+// by the rule_id and device_id parameters.
+func (ctlr RuleController) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := domain.AlertQuery{
+		DeviceID: params.Get("device_id"),
+		Limit:    defaultAlertPageSize,
+	}
+	if ruleID := params.Get("rule_id"); ruleID != "" {
+		id, err := primitive.ObjectIDFromHex(ruleID)
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+		query.RuleID = id
+	}
+	if limit := params.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxAlertPageSize {
+			http.Error(w, fmt.Sprintf("Invalid limit, expected 1 to %d", maxAlertPageSize), http.StatusBadRequest)
+			return
+		}
+		query.Limit = parsed
+	}
+
+	alerts, err := ctlr.AlertRepository.List(r.Context(), query)
+	if err != nil {
+		fmt.Println("Error fetching alerts:", err)
+		http.Error(w, "Failed to fetch alerts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// findRule loads the rule named by the {id} path value, writing the error
+// response and returning false when it cannot.
+func (ctlr RuleController) findRule(w http.ResponseWriter, r *http.Request) (*domain.AlertRule, bool) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	rule, err := ctlr.AlertRuleRepository.GetByID(r.Context(), id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return nil, false
+		}
+		fmt.Println("Error fetching rule:", err)
+		http.Error(w, "Failed to fetch rule", http.StatusInternalServerError)
+		return nil, false
+	}
+	return rule, true
+}
@@ -0,0 +1,180 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/routes"
+)
+
+func TestRuleController_RuleCollection(t *testing.T) {
+	tests := []struct {
+		name             string
+		role             string
+		body             string
+		expectSave       bool
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:             "creates rule",
+			role:             "admin",
+			body:             `{"name":"night motion","condition":"motion","min_change_score":0.1,"window":{"start":"22:00","end":"06:00"},"sinks":[{"type":"webhook","url":"https://example.com/hook"}],"enabled":true}`,
+			expectSave:       true,
+			expectedStatus:   http.StatusCreated,
+			expectedContains: `"created_by":"admin@example.com"`,
+		},
+		{
+			name:             "invalid pattern",
+			role:             "admin",
+			body:             `{"name":"alarm","condition":"text","pattern":"(","sinks":[{"type":"webhook","url":"https://example.com/hook"}]}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Invalid rule",
+		},
+		{
+			name:             "not admin",
+			role:             "user",
+			body:             `{}`,
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRules := mock_domain.NewMockAlertRuleRepository(ctrl)
+			ctlr := routes.RuleController{AlertRuleRepository: mockRules}
+
+			if tt.expectSave {
+				mockRules.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, rule *domain.AlertRule) error {
+					rule.ID = primitive.NewObjectID()
+					return nil
+				})
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/rules", strings.NewReader(tt.body))
+			ctx := context.WithValue(req.Context(), "role", tt.role)
+			req = req.WithContext(context.WithValue(ctx, "email", "admin@example.com"))
+			rr := httptest.NewRecorder()
+
+			ctlr.RuleCollection(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRuleController_RuleResource(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	tests := []struct {
+		name             string
+		method           string
+		id               string
+		setup            func(*mock_domain.MockAlertRuleRepository)
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:   "get rule",
+			method: http.MethodGet,
+			id:     id.Hex(),
+			setup: func(m *mock_domain.MockAlertRuleRepository) {
+				m.EXPECT().GetByID(gomock.Any(), id).Return(&domain.AlertRule{ID: id, Name: "alarm"}, nil)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"name":"alarm"`,
+		},
+		{
+			name:   "get missing rule",
+			method: http.MethodGet,
+			id:     id.Hex(),
+			setup: func(m *mock_domain.MockAlertRuleRepository) {
+				m.EXPECT().GetByID(gomock.Any(), id).Return(nil, mongo.ErrNoDocuments)
+			},
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Rule not found",
+		},
+		{
+			name:   "delete rule",
+			method: http.MethodDelete,
+			id:     id.Hex(),
+			setup: func(m *mock_domain.MockAlertRuleRepository) {
+				m.EXPECT().Delete(gomock.Any(), id).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:             "invalid id",
+			method:           http.MethodDelete,
+			id:               "nope",
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Invalid rule ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRules := mock_domain.NewMockAlertRuleRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(mockRules)
+			}
+			ctlr := routes.RuleController{AlertRuleRepository: mockRules}
+
+			req := httptest.NewRequest(tt.method, "/rules/"+tt.id, nil)
+			req.SetPathValue("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), "role", "admin"))
+			rr := httptest.NewRecorder()
+
+			ctlr.RuleResource(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRuleController_GetAlerts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAlerts := mock_domain.NewMockAlertRepository(ctrl)
+	mockAlerts.EXPECT().List(gomock.Any(), domain.AlertQuery{DeviceID: "dev-1", Limit: 100}).Return([]*domain.Alert{{DeviceID: "dev-1", RuleName: "alarm"}}, nil)
+	ctlr := routes.RuleController{AlertRepository: mockAlerts}
+
+	rr := httptest.NewRecorder()
+	ctlr.GetAlerts(rr, httptest.NewRequest(http.MethodGet, "/alerts?device_id=dev-1", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"rule_name":"alarm"`) {
+		t.Errorf("unexpected response %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	ctlr.GetAlerts(rr, httptest.NewRequest(http.MethodGet, "/alerts?limit=1000", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an oversized limit, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,265 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/repository"
+	"mqtt-streaming-server/timelapse"
+)
+
+const defaultTimelapseFPS = 24
+
+type TimelapseController struct {
+	TimelapseRepository domain.TimelapseRepository
+	BlobStore           domain.BlobStore
+	Runner              *timelapse.Runner
+}
+
+// timelapseRequest is the body of POST /timelapses. Start and end are Unix
+// timestamps, like the start and end parameters of GET /photos.
+type timelapseRequest struct {
+	DeviceID string             `json:"device_id"`
+	Start    int64              `json:"start"`
+	End      int64              `json:"end"`
+	FPS      int                `json:"fps"`
+	Format   domain.VideoFormat `json:"format"`
+	Overlay  *bool              `json:"overlay"`
+}
+
+func InitTimelapseRoutes(db *mongo.Database, blobStore domain.BlobStore, runner *timelapse.Runner, mux *http.ServeMux) {
+	timelapseController := &TimelapseController{
+		TimelapseRepository: repository.NewTimelapseRepository(db),
+		BlobStore:           blobStore,
+		Runner:              runner,
+	}
+
+	mux.Handle("/timelapses", withAuth(http.HandlerFunc(timelapseController.TimelapseCollection)))
+	mux.Handle("/timelapses/{id}", withAuth(http.HandlerFunc(timelapseController.TimelapseResource)))
+	mux.Handle("/timelapses/{id}/download", withAuth(http.HandlerFunc(timelapseController.DownloadTimelapse)))
+}
+
+// TimelapseCollection serves GET and POST on /timelapses.
+func (ctlr TimelapseController) TimelapseCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetTimelapses(w, r)
+	case http.MethodPost:
+		ctlr.CreateTimelapse(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// TimelapseResource serves GET and DELETE on /timelapses/{id}.
+func (ctlr TimelapseController) TimelapseResource(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetTimelapse(w, r)
+	case http.MethodDelete:
+		ctlr.DeleteTimelapse(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctlr TimelapseController) GetTimelapses(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	timelapses, err := ctlr.TimelapseRepository.List(ctx, r.URL.Query().Get("device_id"))
+	if err != nil {
+		fmt.Println("Error fetching time-lapses:", err)
+		http.Error(w, "Failed to fetch time-lapses", http.StatusInternalServerError)
+		return
+	}
+
+	for _, t := range timelapses {
+		if err := ctlr.presignTimelapse(r, t); err != nil {
+			http.Error(w, "Failed to get presigned URL", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timelapses)
+}
+
+// CreateTimelapse queues a new job and answers 202 with its initial state;
+// clients poll GET /timelapses/{id} until it is completed.
+func (ctlr TimelapseController) CreateTimelapse(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req timelapseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job := &domain.Timelapse{
+		DeviceID: req.DeviceID,
+		Start:    time.Unix(req.Start, 0).UTC(),
+		End:      time.Unix(req.End, 0).UTC(),
+		FPS:      req.FPS,
+		Format:   req.Format,
+		Overlay:  req.Overlay == nil || *req.Overlay,
+	}
+	if job.FPS == 0 {
+		job.FPS = defaultTimelapseFPS
+	}
+	if job.Format == "" {
+		job.Format = domain.VideoMP4
+	}
+	if email, ok := ctx.Value("email").(string); ok {
+		job.RequestedBy = email
+	}
+	if err := job.Validate(); err != nil {
+		http.Error(w, "Invalid time-lapse: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ctlr.Runner.Submit(ctx, job); err != nil {
+		if errors.Is(err, timelapse.ErrQueueFull) {
+			http.Error(w, "Too many time-lapses in progress, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Println("Error creating time-lapse:", err)
+		http.Error(w, "Failed to create time-lapse", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/timelapses/"+job.ID.Hex())
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (ctlr TimelapseController) GetTimelapse(w http.ResponseWriter, r *http.Request) {
+	t, ok := ctlr.findTimelapse(w, r)
+	if !ok {
+		return
+	}
+
+	if err := ctlr.presignTimelapse(r, t); err != nil {
+		http.Error(w, "Failed to get presigned URL", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// DownloadTimelapse streams the finished video through the API.
+func (ctlr TimelapseController) DownloadTimelapse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	t, ok := ctlr.findTimelapse(w, r)
+	if !ok {
+		return
+	}
+	if t.Status != domain.TimelapseStatusCompleted {
+		http.Error(w, "Time-lapse is not ready", http.StatusConflict)
+		return
+	}
+
+	body, err := ctlr.BlobStore.Get(ctx, t.StorageKey)
+	if err != nil {
+		if errors.Is(err, domain.ErrBlobNotFound) {
+			http.Error(w, "Time-lapse video not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error reading time-lapse:", err)
+		http.Error(w, "Failed to read time-lapse", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", t.Format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", t.ID.Hex()+"."+string(t.Format)))
+	io.Copy(w, body)
+}
+
+// DeleteTimelapse cancels the job if it has not finished yet and removes it
+// with its video. Only the user who requested it and admins may delete it.
+func (ctlr TimelapseController) DeleteTimelapse(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	t, ok := ctlr.findTimelapse(w, r)
+	if !ok {
+		return
+	}
+	if ctx.Value("role") != "admin" && ctx.Value("email") != t.RequestedBy {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Once Cancel returns no worker holds the job, so the video it may have
+	// stored is under its key and nothing writes to the record any more
+	if !t.Finished() {
+		if err := ctlr.Runner.Cancel(ctx, t.ID); err != nil {
+			fmt.Println("Error canceling time-lapse:", err)
+			http.Error(w, "Failed to delete time-lapse", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := ctlr.BlobStore.Delete(ctx, domain.TimelapseStorageKey(t.ID, t.Format)); err != nil && !errors.Is(err, domain.ErrBlobNotFound) {
+		fmt.Println("Error deleting time-lapse video:", err)
+		http.Error(w, "Failed to delete time-lapse", http.StatusInternalServerError)
+		return
+	}
+	if err := ctlr.TimelapseRepository.Delete(ctx, t.ID); err != nil {
+		fmt.Println("Error deleting time-lapse:", err)
+		http.Error(w, "Failed to delete time-lapse", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findTimelapse loads the job named by the {id} path value, writing the error
+// response and returning false when it cannot.
+func (ctlr TimelapseController) findTimelapse(w http.ResponseWriter, r *http.Request) (*domain.Timelapse, bool) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid time-lapse ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	t, err := ctlr.TimelapseRepository.GetByID(r.Context(), id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Time-lapse not found", http.StatusNotFound)
+			return nil, false
+		}
+		fmt.Println("Error fetching time-lapse:", err)
+		http.Error(w, "Failed to fetch time-lapse", http.StatusInternalServerError)
+		return nil, false
+	}
+	return t, true
+}
+
+func (ctlr TimelapseController) presignTimelapse(r *http.Request, t *domain.Timelapse) error {
+	if t.Status != domain.TimelapseStatusCompleted || t.StorageKey == "" {
+		return nil
+	}
+	downloadURL, err := ctlr.BlobStore.SignedURL(r.Context(), t.StorageKey, presignedURLExpiry)
+	if err != nil {
+		fmt.Println("Error presigning time-lapse:", err)
+		return err
+	}
+	t.DownloadURL = downloadURL
+	return nil
+}
@@ -0,0 +1,221 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/routes"
+	"mqtt-streaming-server/storage"
+	"mqtt-streaming-server/timelapse"
+)
+
+func TestTimelapseController_CreateTimelapse(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		expectSave       bool
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:             "queues job with defaults",
+			body:             `{"device_id":"dev-1","start":1714564800,"end":1714568400}`,
+			expectSave:       true,
+			expectedStatus:   http.StatusAccepted,
+			expectedContains: `"status":"queued"`,
+		},
+		{
+			name:             "end before start",
+			body:             `{"device_id":"dev-1","start":1714568400,"end":1714564800}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Invalid time-lapse: end must be after start",
+		},
+		{
+			name:             "unknown format",
+			body:             `{"device_id":"dev-1","start":1714564800,"end":1714568400,"format":"gif"}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "invalid format",
+		},
+		{
+			name:             "invalid body",
+			body:             `{`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Invalid request body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockTimelapseRepository(ctrl)
+			store := storage.NewMemoryStore(nil)
+			runner := timelapse.NewRunner(mockRepo, mock_domain.NewMockPhotoRepository(ctrl), store, nil, timelapse.Config{})
+			ctlr := routes.TimelapseController{TimelapseRepository: mockRepo, BlobStore: store, Runner: runner}
+
+			if tt.expectSave {
+				mockRepo.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, job *domain.Timelapse) error {
+					if job.FPS != 24 || job.Format != domain.VideoMP4 || !job.Overlay || job.RequestedBy != "user@example.com" {
+						t.Errorf("unexpected job defaults %+v", job)
+					}
+					job.ID = primitive.NewObjectID()
+					return nil
+				})
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/timelapses", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), "email", "user@example.com"))
+			rr := httptest.NewRecorder()
+
+			ctlr.TimelapseCollection(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTimelapseController_TimelapseResource(t *testing.T) {
+	id := primitive.NewObjectID()
+	key := domain.TimelapseStorageKey(id, domain.VideoMP4)
+	completed := &domain.Timelapse{ID: id, DeviceID: "dev-1", Format: domain.VideoMP4, Status: domain.TimelapseStatusCompleted, StorageKey: key, RequestedBy: "owner@example.com"}
+	running := &domain.Timelapse{ID: id, DeviceID: "dev-1", Format: domain.VideoMP4, Status: domain.TimelapseStatusRunning, Progress: 40}
+	// Finished elsewhere: the record still says running, without a storage key
+	stale := &domain.Timelapse{ID: id, DeviceID: "dev-1", Format: domain.VideoMP4, Status: domain.TimelapseStatusRunning, RequestedBy: "owner@example.com"}
+
+	tests := []struct {
+		name             string
+		method           string
+		email            string
+		mockTimelapse    *domain.Timelapse
+		expectCancel     bool
+		expectDelete     bool
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:             "completed job has download URL",
+			method:           http.MethodGet,
+			mockTimelapse:    completed,
+			expectedStatus:   http.StatusOK,
+			expectedContains: "http://localhost:8080/blobs/" + key + "?expires=",
+		},
+		{
+			name:             "running job reports progress",
+			method:           http.MethodGet,
+			mockTimelapse:    running,
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"progress":40`,
+		},
+		{
+			name:           "owner deletes job",
+			method:         http.MethodDelete,
+			email:          "owner@example.com",
+			mockTimelapse:  completed,
+			expectDelete:   true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "deleting unfinished job removes its video",
+			method:         http.MethodDelete,
+			email:          "owner@example.com",
+			mockTimelapse:  stale,
+			expectCancel:   true,
+			expectDelete:   true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:             "other user cannot delete job",
+			method:           http.MethodDelete,
+			email:            "other@example.com",
+			mockTimelapse:    completed,
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mock_domain.NewMockTimelapseRepository(ctrl)
+			store := storage.NewMemoryStore(storage.NewURLSigner("http://localhost:8080/blobs", "secret"))
+			store.Put(context.Background(), key, []byte("video"), "video/mp4")
+			runner := timelapse.NewRunner(mockRepo, mock_domain.NewMockPhotoRepository(ctrl), store, nil, timelapse.Config{})
+			ctlr := routes.TimelapseController{TimelapseRepository: mockRepo, BlobStore: store, Runner: runner}
+
+			mockRepo.EXPECT().GetByID(gomock.Any(), id).Return(tt.mockTimelapse, nil)
+			if tt.expectCancel {
+				mockRepo.EXPECT().SetStatus(gomock.Any(), id, domain.TimelapseStatusQueued, domain.TimelapseStatusCanceled).Return(false, nil)
+			}
+			if tt.expectDelete {
+				mockRepo.EXPECT().Delete(gomock.Any(), id).Return(nil)
+			}
+
+			req := httptest.NewRequest(tt.method, "/timelapses/"+id.Hex(), nil)
+			req.SetPathValue("id", id.Hex())
+			req = req.WithContext(context.WithValue(req.Context(), "email", tt.email))
+			rr := httptest.NewRecorder()
+
+			ctlr.TimelapseResource(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+			if tt.expectDelete {
+				if _, err := store.Stat(context.Background(), key); err == nil {
+					t.Error("expected video to be deleted")
+				}
+			}
+		})
+	}
+}
+
+func TestTimelapseController_DownloadTimelapse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	id := primitive.NewObjectID()
+	key := domain.TimelapseStorageKey(id, domain.VideoWebM)
+	mockRepo := mock_domain.NewMockTimelapseRepository(ctrl)
+	store := storage.NewMemoryStore(nil)
+	store.Put(context.Background(), key, []byte("webm-bytes"), "video/webm")
+	ctlr := routes.TimelapseController{TimelapseRepository: mockRepo, BlobStore: store}
+
+	mockRepo.EXPECT().GetByID(gomock.Any(), id).Return(&domain.Timelapse{
+		ID: id, Format: domain.VideoWebM, Status: domain.TimelapseStatusCompleted, StorageKey: key,
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/timelapses/"+id.Hex()+"/download", nil)
+	req.SetPathValue("id", id.Hex())
+	rr := httptest.NewRecorder()
+
+	ctlr.DownloadTimelapse(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "video/webm" {
+		t.Errorf("expected Content-Type video/webm, got %q", got)
+	}
+	if rr.Body.String() != "webm-bytes" {
+		t.Errorf("expected video bytes, got %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,356 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/repository"
+	"mqtt-streaming-server/webhooks"
+)
+
+const (
+	defaultDeliveryPageSize = 100
+	maxDeliveryPageSize     = 500
+)
+
+type WebhookController struct {
+	WebhookSubscriptionRepository domain.WebhookSubscriptionRepository
+	WebhookDeliveryRepository     domain.WebhookDeliveryRepository
+	Dispatcher                    *webhooks.Dispatcher
+}
+
+func InitWebhookRoutes(db *mongo.Database, dispatcher *webhooks.Dispatcher, mux *http.ServeMux) {
+	webhookController := &WebhookController{
+		WebhookSubscriptionRepository: repository.NewWebhookSubscriptionRepository(db),
+		WebhookDeliveryRepository:     repository.NewWebhookDeliveryRepository(db),
+		Dispatcher:                    dispatcher,
+	}
+
+	mux.Handle("/webhooks", withAuth(http.HandlerFunc(webhookController.WebhookCollection)))
+	mux.Handle("/webhooks/{id}", withAuth(http.HandlerFunc(webhookController.WebhookResource)))
+	mux.Handle("/webhooks/{id}/deliveries", withAuth(http.HandlerFunc(webhookController.GetDeliveries)))
+	mux.Handle("/webhooks/{id}/deliveries/{delivery}/replay", withAuth(http.HandlerFunc(webhookController.ReplayDelivery)))
+	mux.Handle("/webhooks/schemas/{version}/{event}", withAuth(http.HandlerFunc(webhookController.GetSchema)))
+}
+
+// WebhookCollection serves GET and POST on /webhooks, for admins only.
+func (ctlr WebhookController) WebhookCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetWebhooks(w, r)
+	case http.MethodPost:
+		ctlr.CreateWebhook(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// WebhookResource serves GET, PUT and DELETE on /webhooks/{id}, for admins only.
+func (ctlr WebhookController) WebhookResource(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ctlr.GetWebhook(w, r)
+	case http.MethodPut:
+		ctlr.UpdateWebhook(w, r)
+	case http.MethodDelete:
+		ctlr.DeleteWebhook(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctlr WebhookController) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := ctlr.WebhookSubscriptionRepository.List(r.Context())
+	if err != nil {
+		fmt.Println("Error fetching webhooks:", err)
+		http.Error(w, "Failed to fetch webhooks", http.StatusInternalServerError)
+		return
+	}
+	for _, subscription := range subscriptions {
+		subscription.Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// CreateWebhook saves the subscription and returns it with its signing
+// secret, which is generated when the request does not set one. The secret
+// is not returned again.
+func (ctlr WebhookController) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var subscription domain.WebhookSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if subscription.Secret == "" {
+		subscription.Secret = newWebhookSecret()
+	}
+	if err := subscription.Validate(); err != nil {
+		http.Error(w, "Invalid webhook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	subscription.ID = primitive.NilObjectID
+	subscription.CreatedAt = time.Now().UTC()
+	if email, ok := ctx.Value("email").(string); ok {
+		subscription.CreatedBy = email
+	}
+
+	if err := ctlr.WebhookSubscriptionRepository.Save(ctx, &subscription); err != nil {
+		fmt.Println("Error saving webhook:", err)
+		http.Error(w, "Failed to save webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/webhooks/"+subscription.ID.Hex())
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (ctlr WebhookController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := ctlr.findWebhook(w, r)
+	if !ok {
+		return
+	}
+	subscription.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// UpdateWebhook replaces the subscription, keeping who created it and when.
+// The secret is kept unless the request sets a new one.
+func (ctlr WebhookController) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	existing, ok := ctlr.findWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var subscription domain.WebhookSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	rotated := subscription.Secret != ""
+	if !rotated {
+		subscription.Secret = existing.Secret
+	}
+	if err := subscription.Validate(); err != nil {
+		http.Error(w, "Invalid webhook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	subscription.ID = existing.ID
+	subscription.CreatedBy = existing.CreatedBy
+	subscription.CreatedAt = existing.CreatedAt
+
+	if err := ctlr.WebhookSubscriptionRepository.Update(ctx, &subscription); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error updating webhook:", err)
+		http.Error(w, "Failed to update webhook", http.StatusInternalServerError)
+		return
+	}
+	if !rotated {
+		subscription.Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// DeleteWebhook removes the subscription. Its delivery log is kept; pending
+// deliveries fail on their next attempt.
+func (ctlr WebhookController) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := ctlr.WebhookSubscriptionRepository.Delete(r.Context(), id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println("Error deleting webhook:", err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveries lists the subscription's delivery log, most recent first,
+// optionally filtered by the status parameter.
+func (ctlr WebhookController) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Context().Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	params := r.URL.Query()
+	query := domain.WebhookDeliveryQuery{
+		SubscriptionID: id,
+		Status:         params.Get("status"),
+		Limit:          defaultDeliveryPageSize,
+	}
+	switch query.Status {
+	case "", domain.WebhookDeliveryPending, domain.WebhookDeliverySucceeded, domain.WebhookDeliveryFailed:
+	default:
+		http.Error(w, "Invalid status, expected pending, succeeded or failed", http.StatusBadRequest)
+		return
+	}
+	if limit := params.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxDeliveryPageSize {
+			http.Error(w, fmt.Sprintf("Invalid limit, expected 1 to %d", maxDeliveryPageSize), http.StatusBadRequest)
+			return
+		}
+		query.Limit = parsed
+	}
+
+	deliveries, err := ctlr.WebhookDeliveryRepository.List(r.Context(), query)
+	if err != nil {
+		fmt.Println("Error fetching webhook deliveries:", err)
+		http.Error(w, "Failed to fetch deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// ReplayDelivery sends a logged delivery again as a new delivery, whatever
+// the outcome of the original.
+func (ctlr WebhookController) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if ctx.Value("role") != "admin" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	subscriptionID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := primitive.ObjectIDFromHex(r.PathValue("delivery"))
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	original, err := ctlr.WebhookDeliveryRepository.GetByID(ctx, deliveryID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		fmt.Println("Error fetching webhook delivery:", err)
+		http.Error(w, "Failed to fetch delivery", http.StatusInternalServerError)
+		return
+	}
+	if err == mongo.ErrNoDocuments || original.SubscriptionID != subscriptionID {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+
+	delivery, err := ctlr.Dispatcher.Replay(ctx, original)
+	if err != nil {
+		fmt.Println("Error replaying webhook delivery:", err)
+		http.Error(w, "Failed to replay delivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// GetSchema serves the JSON Schema of an event payload, e.g.
+// /webhooks/schemas/v1/photo.ingested.
+func (ctlr WebhookController) GetSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(r.PathValue("version"), "v"))
+	if err != nil {
+		http.Error(w, "Invalid schema version", http.StatusBadRequest)
+		return
+	}
+	schema, err := webhooks.Schema(version, domain.WebhookEventType(r.PathValue("event")))
+	if err != nil {
+		http.Error(w, "Schema not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(schema)
+}
+
+// findWebhook loads the subscription named by the {id} path value, writing
+// the error response and returning false when it cannot.
+func (ctlr WebhookController) findWebhook(w http.ResponseWriter, r *http.Request) (*domain.WebhookSubscription, bool) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	subscription, err := ctlr.WebhookSubscriptionRepository.GetByID(r.Context(), id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return nil, false
+		}
+		fmt.Println("Error fetching webhook:", err)
+		http.Error(w, "Failed to fetch webhook", http.StatusInternalServerError)
+		return nil, false
+	}
+	return subscription, true
+}
+
+// newWebhookSecret returns a random 256-bit secret, hex encoded.
+func newWebhookSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return hex.EncodeToString(secret)
+}
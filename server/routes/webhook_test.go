@@ -0,0 +1,184 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/routes"
+	"mqtt-streaming-server/webhooks"
+)
+
+func TestWebhookController_WebhookCollection(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		role             string
+		body             string
+		setup            func(*mock_domain.MockWebhookSubscriptionRepository)
+		expectedStatus   int
+		expectedContains string
+		unexpected       string
+	}{
+		{
+			name:   "creates subscription with generated secret",
+			method: http.MethodPost,
+			role:   "admin",
+			body:   `{"url":"https://example.com/hook","events":["photo.ingested"],"enabled":true}`,
+			setup: func(m *mock_domain.MockWebhookSubscriptionRepository) {
+				m.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sub *domain.WebhookSubscription) error {
+					if len(sub.Secret) != 64 {
+						t.Errorf("expected a generated secret, got %q", sub.Secret)
+					}
+					sub.ID = primitive.NewObjectID()
+					return nil
+				})
+			},
+			expectedStatus:   http.StatusCreated,
+			expectedContains: `"secret":"`,
+		},
+		{
+			name:             "unknown event",
+			method:           http.MethodPost,
+			role:             "admin",
+			body:             `{"url":"https://example.com/hook","events":["photo.deleted"]}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: `Invalid webhook: invalid event "photo.deleted"`,
+		},
+		{
+			name:             "relative url",
+			method:           http.MethodPost,
+			role:             "admin",
+			body:             `{"url":"/hook","events":["photo.ingested"]}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedContains: "Invalid webhook: url must be an absolute http or https URL",
+		},
+		{
+			name:   "list hides secrets",
+			method: http.MethodGet,
+			role:   "admin",
+			setup: func(m *mock_domain.MockWebhookSubscriptionRepository) {
+				m.EXPECT().List(gomock.Any()).Return([]*domain.WebhookSubscription{{URL: "https://example.com/hook", Secret: "s3cret"}}, nil)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"url":"https://example.com/hook"`,
+			unexpected:       "s3cret",
+		},
+		{
+			name:             "not admin",
+			method:           http.MethodGet,
+			role:             "user",
+			expectedStatus:   http.StatusUnauthorized,
+			expectedContains: "Unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockSubscriptions := mock_domain.NewMockWebhookSubscriptionRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(mockSubscriptions)
+			}
+			ctlr := routes.WebhookController{WebhookSubscriptionRepository: mockSubscriptions}
+
+			req := httptest.NewRequest(tt.method, "/webhooks", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), "role", tt.role))
+			rr := httptest.NewRecorder()
+
+			ctlr.WebhookCollection(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+			if tt.unexpected != "" && strings.Contains(rr.Body.String(), tt.unexpected) {
+				t.Errorf("expected body not to contain %q, got %q", tt.unexpected, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookController_ReplayDelivery(t *testing.T) {
+	subscriptionID := primitive.NewObjectID()
+	deliveryID := primitive.NewObjectID()
+	failed := &domain.WebhookDelivery{ID: deliveryID, SubscriptionID: subscriptionID, EventID: "evt-1", Status: domain.WebhookDeliveryFailed}
+
+	tests := []struct {
+		name             string
+		subscriptionID   string
+		mockDelivery     *domain.WebhookDelivery
+		mockErr          error
+		expectReplay     bool
+		expectedStatus   int
+		expectedContains string
+	}{
+		{
+			name:             "replays delivery",
+			subscriptionID:   subscriptionID.Hex(),
+			mockDelivery:     failed,
+			expectReplay:     true,
+			expectedStatus:   http.StatusAccepted,
+			expectedContains: `"replay_of":"` + deliveryID.Hex() + `"`,
+		},
+		{
+			name:             "delivery of another subscription",
+			subscriptionID:   primitive.NewObjectID().Hex(),
+			mockDelivery:     failed,
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Delivery not found",
+		},
+		{
+			name:             "missing delivery",
+			subscriptionID:   subscriptionID.Hex(),
+			mockErr:          mongo.ErrNoDocuments,
+			expectedStatus:   http.StatusNotFound,
+			expectedContains: "Delivery not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDeliveries := mock_domain.NewMockWebhookDeliveryRepository(ctrl)
+			mockDeliveries.EXPECT().GetByID(gomock.Any(), deliveryID).Return(tt.mockDelivery, tt.mockErr)
+			if tt.expectReplay {
+				mockDeliveries.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, d *domain.WebhookDelivery) error {
+					d.ID = primitive.NewObjectID()
+					return nil
+				})
+			}
+			dispatcher := webhooks.NewDispatcher(mock_domain.NewMockWebhookSubscriptionRepository(ctrl), mockDeliveries, webhooks.Config{})
+			ctlr := routes.WebhookController{WebhookDeliveryRepository: mockDeliveries, Dispatcher: dispatcher}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/"+tt.subscriptionID+"/deliveries/"+deliveryID.Hex()+"/replay", nil)
+			req.SetPathValue("id", tt.subscriptionID)
+			req.SetPathValue("delivery", deliveryID.Hex())
+			req = req.WithContext(context.WithValue(req.Context(), "role", "admin"))
+			rr := httptest.NewRecorder()
+
+			ctlr.ReplayDelivery(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
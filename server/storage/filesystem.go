@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"mqtt-streaming-server/domain"
+)
+
+type filesystemStore struct {
+	root   string
+	signer *URLSigner
+}
+
+// NewFilesystemStore keeps blobs as files below root, one file per key.
+func NewFilesystemStore(root string, signer *URLSigner) (*filesystemStore, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &filesystemStore{root: root, signer: signer}, nil
+}
+
+// path maps a key to a file below root; cleaning against "/" stops keys from escaping it.
+func (s *filesystemStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (s *filesystemStore) Put(_ context.Context, key string, data []byte, _ string) error {
+	target := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	// Write to a temporary file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+func (s *filesystemStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, domain.ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	return f, nil
+}
+
+func (s *filesystemStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+func (s *filesystemStore) SignedURL(_ context.Context, key string, expires time.Duration) (string, error) {
+	if s.signer == nil {
+		return "", errors.New("filesystem store has no URL signer configured")
+	}
+	return s.signer.Sign(key, expires), nil
+}
+
+func (s *filesystemStore) Stat(_ context.Context, key string) (*domain.BlobInfo, error) {
+	fi, err := os.Stat(s.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, domain.ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to stat blob: %w", err)
+	}
+	return &domain.BlobInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: fi.ModTime().UTC(),
+	}, nil
+}
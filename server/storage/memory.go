@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"mqtt-streaming-server/domain"
+)
+
+type memoryBlob struct {
+	data []byte
+	info domain.BlobInfo
+}
+
+type memoryStore struct {
+	mu     sync.RWMutex
+	blobs  map[string]memoryBlob
+	signer *URLSigner
+}
+
+// NewMemoryStore keeps blobs in process memory, for tests and throwaway setups.
+func NewMemoryStore(signer *URLSigner) *memoryStore {
+	return &memoryStore{
+		blobs:  make(map[string]memoryBlob),
+		signer: signer,
+	}
+}
+
+func (s *memoryStore) Put(_ context.Context, key string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = memoryBlob{
+		data: bytes.Clone(data),
+		info: domain.BlobInfo{
+			Key:          key,
+			Size:         int64(len(data)),
+			ContentType:  contentType,
+			LastModified: time.Now().UTC(),
+		},
+	}
+	return nil
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, domain.ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(blob.data)), nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *memoryStore) SignedURL(_ context.Context, key string, expires time.Duration) (string, error) {
+	if s.signer == nil {
+		return "", errors.New("memory store has no URL signer configured")
+	}
+	return s.signer.Sign(key, expires), nil
+}
+
+func (s *memoryStore) Stat(_ context.Context, key string) (*domain.BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, domain.ErrBlobNotFound
+	}
+	info := blob.info
+	return &info, nil
+}
@@ -0,0 +1,138 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/storage"
+)
+
+func TestBlobStores(t *testing.T) {
+	signer := storage.NewURLSigner("http://localhost:8080/blobs", "secret")
+	fsStore, err := storage.NewFilesystemStore(t.TempDir(), signer)
+	if err != nil {
+		t.Fatalf("failed to create filesystem store: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		store domain.BlobStore
+	}{
+		{name: "memory", store: storage.NewMemoryStore(signer)},
+		{name: "filesystem", store: fsStore},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			key := "photos/dev-1/photo.jpeg"
+
+			if _, err := tt.store.Stat(ctx, key); !errors.Is(err, domain.ErrBlobNotFound) {
+				t.Fatalf("expected ErrBlobNotFound before Put, got %v", err)
+			}
+
+			if err := tt.store.Put(ctx, key, []byte("jpeg-bytes"), "image/jpeg"); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+
+			info, err := tt.store.Stat(ctx, key)
+			if err != nil {
+				t.Fatalf("Stat failed: %v", err)
+			}
+			if info.Size != int64(len("jpeg-bytes")) || info.ContentType != "image/jpeg" {
+				t.Errorf("unexpected blob info %+v", info)
+			}
+
+			body, err := tt.store.Get(ctx, key)
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			data, _ := io.ReadAll(body)
+			body.Close()
+			if string(data) != "jpeg-bytes" {
+				t.Errorf("expected %q, got %q", "jpeg-bytes", data)
+			}
+
+			signed, err := tt.store.SignedURL(ctx, key, time.Minute)
+			if err != nil {
+				t.Fatalf("SignedURL failed: %v", err)
+			}
+			if !strings.HasPrefix(signed, "http://localhost:8080/blobs/photos/dev-1/photo.jpeg?") {
+				t.Errorf("unexpected signed URL %q", signed)
+			}
+
+			if err := tt.store.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if _, err := tt.store.Get(ctx, key); !errors.Is(err, domain.ErrBlobNotFound) {
+				t.Errorf("expected ErrBlobNotFound after Delete, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFilesystemStore_KeyCannotEscapeRoot(t *testing.T) {
+	root := t.TempDir()
+	store, err := storage.NewFilesystemStore(root+"/blobs", nil)
+	if err != nil {
+		t.Fatalf("failed to create filesystem store: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "../outside.txt", []byte("x"), "text/plain"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := store.Stat(ctx, "outside.txt"); err != nil {
+		t.Errorf("expected key to be confined to the store root, got %v", err)
+	}
+}
+
+func TestURLSigner_Verify(t *testing.T) {
+	signer := storage.NewURLSigner("http://localhost:8080/blobs", "secret")
+
+	tests := []struct {
+		name    string
+		key     string
+		expires time.Duration
+		tamper  func(url.Values)
+		wantErr error
+	}{
+		{name: "valid", key: "photos/1.jpeg", expires: time.Minute},
+		{name: "expired", key: "photos/1.jpeg", expires: -time.Minute, wantErr: storage.ErrURLExpired},
+		{
+			name:    "tampered signature",
+			key:     "photos/1.jpeg",
+			expires: time.Minute,
+			tamper:  func(q url.Values) { q.Set("signature", "deadbeef") },
+			wantErr: storage.ErrURLInvalidSignature,
+		},
+		{
+			name:    "tampered expiry",
+			key:     "photos/1.jpeg",
+			expires: time.Minute,
+			tamper:  func(q url.Values) { q.Set("expires", "99999999999") },
+			wantErr: storage.ErrURLInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(signer.Sign(tt.key, tt.expires))
+			if err != nil {
+				t.Fatalf("failed to parse signed URL: %v", err)
+			}
+			query := u.Query()
+			if tt.tamper != nil {
+				tt.tamper(query)
+			}
+			if err := signer.Verify(tt.key, query); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
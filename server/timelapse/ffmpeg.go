@@ -0,0 +1,112 @@
+package timelapse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mqtt-streaming-server/domain"
+)
+
+// overlayTimeFormat is how capture times are printed on the frames.
+const overlayTimeFormat = "2006-01-02 15:04:05 MST"
+
+// FFmpegRenderer renders time-lapses with the ffmpeg binary. Frames are fed
+// through the concat demuxer so each one can carry its own capture time, which
+// the drawtext filter prints when an overlay is requested.
+type FFmpegRenderer struct {
+	// Path of the ffmpeg binary.
+	Path string
+	// Width and Height of the video; frames are scaled and letterboxed to fit.
+	Width  int
+	Height int
+	// FontFile is passed to drawtext; leave empty to rely on fontconfig.
+	FontFile string
+}
+
+func NewFFmpegRenderer(path string, width, height int, fontFile string) *FFmpegRenderer {
+	if path == "" {
+		path = "ffmpeg"
+	}
+	if width <= 0 || height <= 0 {
+		width, height = 1280, 720
+	}
+	return &FFmpegRenderer{Path: path, Width: width, Height: height, FontFile: fontFile}
+}
+
+func (f *FFmpegRenderer) Render(ctx context.Context, job RenderJob) error {
+	script := filepath.Join(filepath.Dir(job.Output), "frames.ffconcat")
+	if err := os.WriteFile(script, []byte(concatScript(job)), 0o600); err != nil {
+		return fmt.Errorf("failed to write frame list: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.Path, f.args(job, script)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (f *FFmpegRenderer) args(job RenderJob, script string) []string {
+	filters := []string{
+		fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", f.Width, f.Height),
+		fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", f.Width, f.Height),
+	}
+	if job.Overlay {
+		drawtext := "drawtext=text='%{metadata\\:capture_time}':x=16:y=h-th-16:fontsize=28:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=6"
+		if f.FontFile != "" {
+			drawtext += ":fontfile='" + f.FontFile + "'"
+		}
+		filters = append(filters, drawtext)
+	}
+	filters = append(filters, "format=yuv420p")
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-f", "concat", "-safe", "0", "-i", script,
+		"-vf", strings.Join(filters, ","),
+		"-r", strconv.Itoa(job.FPS),
+		"-an",
+	}
+	switch job.Format {
+	case domain.VideoWebM:
+		args = append(args, "-c:v", "libvpx-vp9", "-b:v", "0", "-crf", "33", "-row-mt", "1")
+	default:
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-movflags", "+faststart")
+	}
+	return append(args, job.Output)
+}
+
+// concatScript lists every frame for the concat demuxer, shown for 1/FPS
+// seconds and tagged with its capture time.
+func concatScript(job RenderJob) string {
+	duration := strconv.FormatFloat(1/float64(job.FPS), 'f', -1, 64)
+	var b strings.Builder
+	b.WriteString("ffconcat version 1.0\n")
+	for _, frame := range job.Frames {
+		fmt.Fprintf(&b, "file '%s'\n", escapeConcatPath(frame.Path))
+		fmt.Fprintf(&b, "file_packet_metadata 'capture_time=%s'\n", frame.Timestamp.UTC().Format(overlayTimeFormat))
+		fmt.Fprintf(&b, "duration %s\n", duration)
+	}
+	// The concat demuxer ignores the duration of the last entry, so repeat it
+	if len(job.Frames) > 0 {
+		last := job.Frames[len(job.Frames)-1]
+		fmt.Fprintf(&b, "file '%s'\n", escapeConcatPath(last.Path))
+		fmt.Fprintf(&b, "file_packet_metadata 'capture_time=%s'\n", last.Timestamp.UTC().Format(overlayTimeFormat))
+	}
+	return b.String()
+}
+
+func escapeConcatPath(path string) string {
+	return strings.ReplaceAll(path, "'", `'\''`)
+}
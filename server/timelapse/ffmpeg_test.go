@@ -0,0 +1,116 @@
+package timelapse_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/timelapse"
+)
+
+// fakeFFmpeg records its arguments and writes the frame list it was given to
+// the output path, so tests can inspect both without a real ffmpeg.
+const fakeFFmpeg = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+for last; do :; done
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-i" ]; then cp "$2" "$last"; fi
+	shift
+done
+`
+
+func TestFFmpegRenderer_Render(t *testing.T) {
+	binDir := t.TempDir()
+	ffmpeg := filepath.Join(binDir, "ffmpeg")
+	if err := os.WriteFile(ffmpeg, []byte(fakeFFmpeg), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		format     domain.VideoFormat
+		overlay    bool
+		wantArgs   []string
+		unwantArgs []string
+	}{
+		{
+			name:     "mp4 with overlay",
+			format:   domain.VideoMP4,
+			overlay:  true,
+			wantArgs: []string{"libx264", "drawtext=text='%{metadata\\:capture_time}'", "fontfile='/fonts/sans.ttf'", "-r 2"},
+		},
+		{
+			name:       "webm without overlay",
+			format:     domain.VideoWebM,
+			wantArgs:   []string{"libvpx-vp9", "scale=640:360"},
+			unwantArgs: []string{"drawtext"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			job := timelapse.RenderJob{
+				Frames: []timelapse.RenderFrame{
+					{Path: filepath.Join(workDir, "frame-000000.jpeg"), Timestamp: first},
+					{Path: filepath.Join(workDir, "frame-000001.jpeg"), Timestamp: first.Add(time.Minute)},
+				},
+				FPS:     2,
+				Format:  tt.format,
+				Overlay: tt.overlay,
+				Output:  filepath.Join(workDir, "out."+string(tt.format)),
+			}
+
+			renderer := timelapse.NewFFmpegRenderer(ffmpeg, 640, 360, "/fonts/sans.ttf")
+			if err := renderer.Render(context.Background(), job); err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+
+			args, _ := os.ReadFile(filepath.Join(binDir, "args"))
+			for _, want := range tt.wantArgs {
+				if !strings.Contains(string(args), want) {
+					t.Errorf("expected ffmpeg arguments to contain %q, got %s", want, args)
+				}
+			}
+			for _, unwant := range tt.unwantArgs {
+				if strings.Contains(string(args), unwant) {
+					t.Errorf("expected ffmpeg arguments without %q, got %s", unwant, args)
+				}
+			}
+
+			script, _ := os.ReadFile(job.Output)
+			for _, want := range []string{
+				"file '" + job.Frames[0].Path + "'\nfile_packet_metadata 'capture_time=2024-05-01 12:00:00 UTC'\nduration 0.5\n",
+				"file '" + job.Frames[1].Path + "'\nfile_packet_metadata 'capture_time=2024-05-01 12:01:00 UTC'\n",
+			} {
+				if !strings.Contains(string(script), want) {
+					t.Errorf("expected frame list to contain %q, got:\n%s", want, script)
+				}
+			}
+		})
+	}
+}
+
+func TestFFmpegRenderer_ReportsFailure(t *testing.T) {
+	ffmpeg := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\necho 'Unknown encoder' >&2\nexit 1\n"
+	if err := os.WriteFile(ffmpeg, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	renderer := timelapse.NewFFmpegRenderer(ffmpeg, 0, 0, "")
+	err := renderer.Render(context.Background(), timelapse.RenderJob{
+		Frames: []timelapse.RenderFrame{{Path: "frame.jpeg", Timestamp: time.Now()}},
+		FPS:    24,
+		Format: domain.VideoMP4,
+		Output: filepath.Join(t.TempDir(), "out.mp4"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "Unknown encoder") {
+		t.Errorf("expected error with ffmpeg output, got %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package timelapse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/jobs"
+)
+
+var ErrQueueFull = errors.New("time-lapse queue is full")
+
+// Renderer turns a list of image files into a video.
+type Renderer interface {
+	Render(ctx context.Context, job RenderJob) error
+}
+
+// RenderJob describes one video to render.
+type RenderJob struct {
+	Frames  []RenderFrame
+	FPS     int
+	Format  domain.VideoFormat
+	Overlay bool
+	// Output is the path the video is written to.
+	Output string
+}
+
+type RenderFrame struct {
+	Path      string
+	Timestamp time.Time
+}
+
+type Config struct {
+	// Workers is the number of videos rendered at the same time.
+	Workers int
+	// QueueSize is how many jobs may wait for a worker.
+	QueueSize int
+	// MaxFrames caps the frames of one video; longer ranges are sampled evenly.
+	MaxFrames int
+	// WorkDir holds the temporary files of running jobs; empty uses the system temp dir.
+	WorkDir string
+	// RenderTimeout bounds the whole job, from fetching photos to storing the video.
+	RenderTimeout time.Duration
+}
+
+// Runner renders queued time-lapse jobs in the background and keeps their
+// status in the repository, so the API only has to read it back.
+type Runner struct {
+	repository      domain.TimelapseRepository
+	photoRepository domain.PhotoRepository
+	blobStore       domain.BlobStore
+	renderer        Renderer
+	cfg             Config
+	queue           *jobs.Queue[*domain.Timelapse]
+}
+
+func NewRunner(repository domain.TimelapseRepository, photoRepository domain.PhotoRepository, blobStore domain.BlobStore, renderer Renderer, cfg Config) *Runner {
+	if cfg.MaxFrames <= 0 {
+		cfg.MaxFrames = 3600
+	}
+	if cfg.RenderTimeout <= 0 {
+		cfg.RenderTimeout = 30 * time.Minute
+	}
+	r := &Runner{
+		repository:      repository,
+		photoRepository: photoRepository,
+		blobStore:       blobStore,
+		renderer:        renderer,
+		cfg:             cfg,
+	}
+	r.queue = jobs.NewQueue[*domain.Timelapse](repository, handler{r}, jobs.Config{
+		Name:      "time-lapse",
+		Workers:   cfg.Workers,
+		QueueSize: cfg.QueueSize,
+		Timeout:   cfg.RenderTimeout,
+	})
+	return r
+}
+
+// Start launches the workers and requeues the jobs a previous run left unfinished.
+func (r *Runner) Start(ctx context.Context) error {
+	var unfinished []*domain.Timelapse
+	for _, status := range []string{domain.TimelapseStatusRunning, domain.TimelapseStatusQueued} {
+		timelapses, err := r.repository.GetByStatus(ctx, status)
+		if err != nil {
+			// New jobs still run when the old ones cannot be resumed
+			r.queue.Start(nil)
+			return fmt.Errorf("failed to fetch %s time-lapses: %w", status, err)
+		}
+		unfinished = append(unfinished, timelapses...)
+	}
+
+	// Oldest first
+	var queued []primitive.ObjectID
+	for i := len(unfinished) - 1; i >= 0; i-- {
+		timelapse := unfinished[i]
+		if timelapse.Status == domain.TimelapseStatusRunning {
+			timelapse.Status = domain.TimelapseStatusQueued
+			timelapse.Progress = 0
+			if err := r.repository.Update(ctx, timelapse); err != nil {
+				fmt.Printf("Failed to requeue time-lapse %s: %v\n", timelapse.ID.Hex(), err)
+				continue
+			}
+		}
+		queued = append(queued, timelapse.ID)
+	}
+	r.queue.Start(queued)
+	return nil
+}
+
+// Close stops the workers. Jobs still running are left in the running state
+// and picked up again by the next Start.
+func (r *Runner) Close() {
+	r.queue.Close()
+}
+
+// Submit validates and stores a new job and queues it for rendering.
+func (r *Runner) Submit(ctx context.Context, timelapse *domain.Timelapse) error {
+	if err := timelapse.Validate(); err != nil {
+		return err
+	}
+	timelapse.Status = domain.TimelapseStatusQueued
+	timelapse.CreatedAt = time.Now().UTC()
+	if err := r.repository.Save(ctx, timelapse); err != nil {
+		return err
+	}
+
+	if !r.queue.Enqueue(timelapse.ID) {
+		if err := r.repository.Delete(ctx, timelapse.ID); err != nil {
+			fmt.Printf("Failed to remove unqueued time-lapse %s: %v\n", timelapse.ID.Hex(), err)
+		}
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// Cancel marks a queued job as canceled, or stops a job being rendered and
+// waits for its worker to record the final state. A finished job is left as
+// it is.
+func (r *Runner) Cancel(ctx context.Context, id primitive.ObjectID) error {
+	return r.queue.Cancel(ctx, id)
+}
+
+// handler renders the jobs the queue hands out.
+type handler struct {
+	*Runner
+}
+
+func (h handler) Load(ctx context.Context, id primitive.ObjectID) (*domain.Timelapse, error) {
+	return h.repository.GetByID(ctx, id)
+}
+
+func (h handler) Run(ctx context.Context, _ int, timelapse *domain.Timelapse) error {
+	return h.render(ctx, timelapse)
+}
+
+func (h handler) Finish(ctx context.Context, timelapse *domain.Timelapse, status, message string) {
+	now := time.Now().UTC()
+	timelapse.Status = status
+	timelapse.Error = message
+	timelapse.FinishedAt = &now
+	if status == domain.TimelapseStatusCompleted {
+		timelapse.Progress = 100
+		fmt.Printf("Time-lapse %s rendered from %d photos\n", timelapse.ID.Hex(), timelapse.FrameCount)
+	}
+	if err := h.repository.Update(ctx, timelapse); err != nil {
+		fmt.Printf("Failed to update time-lapse %s: %v\n", timelapse.ID.Hex(), err)
+	}
+}
+
+func (r *Runner) render(ctx context.Context, timelapse *domain.Timelapse) error {
+	dir, err := os.MkdirTemp(r.cfg.WorkDir, "timelapse-")
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	frames, err := r.fetchFrames(ctx, timelapse, dir)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return errors.New("no photos in the requested range")
+	}
+	timelapse.FrameCount = len(frames)
+
+	output := filepath.Join(dir, "timelapse."+string(timelapse.Format))
+	err = r.renderer.Render(ctx, RenderJob{
+		Frames:  frames,
+		FPS:     timelapse.FPS,
+		Format:  timelapse.Format,
+		Overlay: timelapse.Overlay,
+		Output:  output,
+	})
+	if err != nil {
+		return err
+	}
+
+	video, err := os.ReadFile(output)
+	if err != nil {
+		return fmt.Errorf("failed to read rendered video: %w", err)
+	}
+	key := domain.TimelapseStorageKey(timelapse.ID, timelapse.Format)
+	if err := r.blobStore.Put(ctx, key, video, timelapse.Format.ContentType()); err != nil {
+		return fmt.Errorf("failed to store video: %w", err)
+	}
+	timelapse.StorageKey = key
+	timelapse.Size = int64(len(video))
+	return nil
+}
+
+// fetchFrames downloads the photos of the range, oldest first, into dir. When
+// the range holds more than MaxFrames photos, every n-th photo is used.
+// Fetching counts for the first 90% of the progress; rendering is the rest.
+func (r *Runner) fetchFrames(ctx context.Context, timelapse *domain.Timelapse, dir string) ([]RenderFrame, error) {
+	query := domain.PhotoQuery{
+		Start:     timelapse.Start,
+		End:       timelapse.End,
+		DeviceIDs: []string{timelapse.DeviceID},
+		Limit:     domain.MaxPhotoQueryLimit,
+		Sort:      domain.SortOldestFirst,
+	}
+
+	var frames []RenderFrame
+	stride := int64(1)
+	index := int64(0)
+	for {
+		page, err := r.photoRepository.GetPhotos(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch photos: %w", err)
+		}
+		if page.Total > int64(r.cfg.MaxFrames) {
+			stride = (page.Total + int64(r.cfg.MaxFrames) - 1) / int64(r.cfg.MaxFrames)
+		}
+
+		for _, photo := range page.Photos {
+			index++
+			if (index-1)%stride != 0 {
+				continue
+			}
+			path := filepath.Join(dir, fmt.Sprintf("frame-%06d.%s", len(frames), photo.ImageType))
+			if err := r.download(ctx, photo, path); err != nil {
+				if errors.Is(err, domain.ErrBlobNotFound) {
+					fmt.Printf("Skipping photo %s without image\n", photo.ID.Hex())
+					continue
+				}
+				return nil, err
+			}
+			frames = append(frames, RenderFrame{Path: path, Timestamp: photo.Timestamp})
+		}
+		r.updateProgress(ctx, timelapse, int(index*90/max(page.Total, 1)))
+
+		if page.NextCursor == "" {
+			return frames, nil
+		}
+		query.After, err = domain.DecodePhotoCursor(page.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *Runner) download(ctx context.Context, photo *domain.Photo, path string) error {
+	body, err := r.blobStore.Get(ctx, photo.ObjectKey())
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to download photo %s: %w", photo.ID.Hex(), err)
+	}
+	return file.Close()
+}
+
+func (r *Runner) updateProgress(ctx context.Context, timelapse *domain.Timelapse, progress int) {
+	if progress <= timelapse.Progress {
+		return
+	}
+	timelapse.Progress = progress
+	if err := r.repository.Update(ctx, timelapse); err != nil {
+		fmt.Printf("Failed to update time-lapse %s progress: %v\n", timelapse.ID.Hex(), err)
+	}
+}
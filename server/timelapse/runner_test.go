@@ -0,0 +1,290 @@
+package timelapse_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/mock/gomock"
+
+	"mqtt-streaming-server/domain"
+	mock_domain "mqtt-streaming-server/mocks"
+	"mqtt-streaming-server/storage"
+	"mqtt-streaming-server/timelapse"
+)
+
+// fakeRenderer writes the number of frames as the video and records the job.
+type fakeRenderer struct {
+	mu   sync.Mutex
+	jobs []timelapse.RenderJob
+}
+
+func (f *fakeRenderer) Render(_ context.Context, job timelapse.RenderJob) error {
+	f.mu.Lock()
+	f.jobs = append(f.jobs, job)
+	f.mu.Unlock()
+	return os.WriteFile(job.Output, []byte(strings.Repeat("f", len(job.Frames))), 0o600)
+}
+
+// blockingRenderer signals each render on started and waits for the context.
+type blockingRenderer struct {
+	started chan struct{}
+}
+
+func (b *blockingRenderer) Render(ctx context.Context, _ timelapse.RenderJob) error {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// timelapseStore backs a mock TimelapseRepository with a map, and reports
+// every job that reaches a final state on finished.
+type timelapseStore struct {
+	mu       sync.Mutex
+	jobs     map[primitive.ObjectID]domain.Timelapse
+	finished chan domain.Timelapse
+}
+
+func newTimelapseRepository(ctrl *gomock.Controller) (*mock_domain.MockTimelapseRepository, *timelapseStore) {
+	store := &timelapseStore{jobs: make(map[primitive.ObjectID]domain.Timelapse), finished: make(chan domain.Timelapse, 8)}
+	repo := mock_domain.NewMockTimelapseRepository(ctrl)
+	repo.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, t *domain.Timelapse) error {
+		t.ID = primitive.NewObjectID()
+		store.mu.Lock()
+		store.jobs[t.ID] = *t
+		store.mu.Unlock()
+		return nil
+	}).AnyTimes()
+	repo.EXPECT().GetByID(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id primitive.ObjectID) (*domain.Timelapse, error) {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		t, ok := store.jobs[id]
+		if !ok {
+			return nil, mongo.ErrNoDocuments
+		}
+		return &t, nil
+	}).AnyTimes()
+	repo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, t *domain.Timelapse) error {
+		store.mu.Lock()
+		store.jobs[t.ID] = *t
+		store.mu.Unlock()
+		if t.Finished() {
+			store.finished <- *t
+		}
+		return nil
+	}).AnyTimes()
+	repo.EXPECT().SetStatus(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+		store.mu.Lock()
+		t, ok := store.jobs[id]
+		if !ok || t.Status != from {
+			store.mu.Unlock()
+			return false, nil
+		}
+		t.Status = to
+		if t.Finished() {
+			now := time.Now().UTC()
+			t.FinishedAt = &now
+		}
+		store.jobs[id] = t
+		store.mu.Unlock()
+		if t.Finished() {
+			store.finished <- t
+		}
+		return true, nil
+	}).AnyTimes()
+	repo.EXPECT().GetByStatus(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	return repo, store
+}
+
+func (s *timelapseStore) get(id primitive.ObjectID) domain.Timelapse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+func (s *timelapseStore) waitFinished(t *testing.T) domain.Timelapse {
+	t.Helper()
+	select {
+	case job := <-s.finished:
+		return job
+	case <-time.After(5 * time.Second):
+		t.Fatal("time-lapse did not finish")
+		return domain.Timelapse{}
+	}
+}
+
+func TestRunner_RendersAndStoresVideo(t *testing.T) {
+	tests := []struct {
+		name       string
+		photos     int
+		maxFrames  int
+		wantStatus string
+		wantFrames int
+		wantError  string
+	}{
+		{name: "all photos become frames", photos: 5, maxFrames: 10, wantStatus: domain.TimelapseStatusCompleted, wantFrames: 5},
+		{name: "long ranges are sampled", photos: 10, maxFrames: 4, wantStatus: domain.TimelapseStatusCompleted, wantFrames: 4},
+		{name: "empty range fails", photos: 0, maxFrames: 10, wantStatus: domain.TimelapseStatusFailed, wantError: "no photos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			blobStore := storage.NewMemoryStore(nil)
+			start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+			var photos []*domain.Photo
+			for i := 0; i < tt.photos; i++ {
+				photo := &domain.Photo{
+					ID:         primitive.NewObjectID(),
+					DeviceID:   "dev-1",
+					Timestamp:  start.Add(time.Duration(i) * time.Minute),
+					ImageType:  "jpeg",
+					StorageKey: "photos/dev-1/" + primitive.NewObjectID().Hex() + ".jpeg",
+				}
+				blobStore.Put(ctx, photo.StorageKey, []byte("jpeg"), "image/jpeg")
+				photos = append(photos, photo)
+			}
+
+			photoRepo := mock_domain.NewMockPhotoRepository(ctrl)
+			photoRepo.EXPECT().GetPhotos(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, query domain.PhotoQuery) (*domain.PhotoPage, error) {
+				if query.Sort != domain.SortOldestFirst || len(query.DeviceIDs) != 1 || query.DeviceIDs[0] != "dev-1" {
+					t.Errorf("unexpected photo query %+v", query)
+				}
+				return &domain.PhotoPage{Photos: photos, Total: int64(len(photos))}, nil
+			})
+
+			repo, store := newTimelapseRepository(ctrl)
+			renderer := &fakeRenderer{}
+			runner := timelapse.NewRunner(repo, photoRepo, blobStore, renderer, timelapse.Config{MaxFrames: tt.maxFrames, WorkDir: t.TempDir()})
+			if err := runner.Start(ctx); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			defer runner.Close()
+
+			job := &domain.Timelapse{DeviceID: "dev-1", Start: start, End: start.Add(time.Hour), FPS: 12, Format: domain.VideoMP4}
+			if err := runner.Submit(ctx, job); err != nil {
+				t.Fatalf("Submit failed: %v", err)
+			}
+
+			got := store.waitFinished(t)
+			if got.Status != tt.wantStatus {
+				t.Fatalf("expected status %s, got %s (%s)", tt.wantStatus, got.Status, got.Error)
+			}
+			if !strings.Contains(got.Error, tt.wantError) {
+				t.Errorf("expected error containing %q, got %q", tt.wantError, got.Error)
+			}
+			if tt.wantStatus != domain.TimelapseStatusCompleted {
+				return
+			}
+
+			if got.FrameCount != tt.wantFrames || got.Progress != 100 {
+				t.Errorf("expected %d frames at 100%%, got %d frames at %d%%", tt.wantFrames, got.FrameCount, got.Progress)
+			}
+			if got.StorageKey != domain.TimelapseStorageKey(job.ID, domain.VideoMP4) {
+				t.Errorf("unexpected storage key %q", got.StorageKey)
+			}
+			info, err := blobStore.Stat(ctx, got.StorageKey)
+			if err != nil {
+				t.Fatalf("expected stored video: %v", err)
+			}
+			if info.ContentType != "video/mp4" || info.Size != int64(tt.wantFrames) {
+				t.Errorf("unexpected video blob %+v", info)
+			}
+		})
+	}
+}
+
+func TestRunner_CancelQueuedJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	repo, store := newTimelapseRepository(ctrl)
+	renderer := &fakeRenderer{}
+	// Not started, so the job stays queued
+	runner := timelapse.NewRunner(repo, mock_domain.NewMockPhotoRepository(ctrl), storage.NewMemoryStore(nil), renderer, timelapse.Config{})
+
+	start := time.Now().Add(-time.Hour)
+	job := &domain.Timelapse{DeviceID: "dev-1", Start: start, End: start.Add(time.Hour), FPS: 24, Format: domain.VideoWebM}
+	if err := runner.Submit(ctx, job); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if err := runner.Cancel(ctx, job.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if got := store.waitFinished(t); got.Status != domain.TimelapseStatusCanceled || got.FinishedAt == nil {
+		t.Fatalf("expected canceled, got %+v", got)
+	}
+
+	// The worker skips the canceled job when it picks it up
+	if err := runner.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	runner.Close()
+	if len(renderer.jobs) != 0 {
+		t.Errorf("expected canceled job not to be rendered")
+	}
+}
+
+func TestRunner_CancelRunningJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	blobStore := storage.NewMemoryStore(nil)
+	start := time.Now().Add(-time.Hour)
+	photo := &domain.Photo{ID: primitive.NewObjectID(), DeviceID: "dev-1", Timestamp: start, ImageType: "jpeg", StorageKey: "photos/dev-1/a.jpeg"}
+	blobStore.Put(ctx, photo.StorageKey, []byte("jpeg"), "image/jpeg")
+
+	photoRepo := mock_domain.NewMockPhotoRepository(ctrl)
+	photoRepo.EXPECT().GetPhotos(gomock.Any(), gomock.Any()).Return(&domain.PhotoPage{Photos: []*domain.Photo{photo}, Total: 1}, nil)
+	repo, store := newTimelapseRepository(ctrl)
+	renderer := &blockingRenderer{started: make(chan struct{}, 1)}
+	runner := timelapse.NewRunner(repo, photoRepo, blobStore, renderer, timelapse.Config{WorkDir: t.TempDir()})
+	if err := runner.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer runner.Close()
+
+	job := &domain.Timelapse{DeviceID: "dev-1", Start: start, End: start.Add(time.Hour), FPS: 24, Format: domain.VideoMP4}
+	if err := runner.Submit(ctx, job); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	select {
+	case <-renderer.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rendering did not start")
+	}
+
+	// Cancel returns once the worker has recorded the final state
+	if err := runner.Cancel(ctx, job.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if got := store.get(job.ID); got.Status != domain.TimelapseStatusCanceled {
+		t.Fatalf("expected canceled once Cancel returned, got %s", got.Status)
+	}
+	if _, err := blobStore.Stat(ctx, domain.TimelapseStorageKey(job.ID, domain.VideoMP4)); err == nil {
+		t.Error("expected no video for a canceled job")
+	}
+}
+
+func TestRunner_RejectsInvalidJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	runner := timelapse.NewRunner(mock_domain.NewMockTimelapseRepository(ctrl), mock_domain.NewMockPhotoRepository(ctrl), storage.NewMemoryStore(nil), &fakeRenderer{}, timelapse.Config{})
+	start := time.Now()
+	job := &domain.Timelapse{DeviceID: "dev-1", Start: start, End: start.Add(time.Hour), FPS: 240, Format: domain.VideoMP4}
+	if err := runner.Submit(context.Background(), job); err == nil {
+		t.Error("expected an fps above the maximum to be rejected")
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetEnv returns the value of the environment variable key, or def when it is unset or empty.
+func GetEnv(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// GetEnvInt parses the environment variable key as an integer, falling back to def.
+func GetEnvInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("Invalid integer for %s: %q, using default %d\n", key, value, def)
+		return def
+	}
+	return parsed
+}
+
+// GetEnvDuration parses the environment variable key as a time.Duration (e.g. "30s"), falling back to def.
+func GetEnvDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Invalid duration for %s: %q, using default %s\n", key, value, def)
+		return def
+	}
+	return parsed
+}
+
+// GetEnvFloat parses the environment variable key as a float, falling back to def.
+func GetEnvFloat(key string, def float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		fmt.Printf("Invalid number for %s: %q, using default %g\n", key, value, def)
+		return def
+	}
+	return parsed
+}
@@ -0,0 +1,370 @@
+// Package webhooks delivers photo and device lifecycle events to the HTTP
+// endpoints subscribed to them.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mqtt-streaming-server/domain"
+)
+
+type Config struct {
+	// Workers is how many deliveries are attempted concurrently.
+	Workers int
+	// QueueSize is how many events, and how many due deliveries, may wait in
+	// memory. Events beyond it are dropped; deliveries stay pending in the
+	// delivery log until the next poll.
+	QueueSize int
+	// Timeout bounds a single delivery attempt.
+	Timeout time.Duration
+	// MaxAttempts is how many times a delivery is tried before it is marked failed.
+	MaxAttempts int
+	// InitialBackoff is the wait after the first failed attempt; it doubles
+	// with every further failure, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// PollInterval is how often the delivery log is checked for due retries.
+	PollInterval time.Duration
+}
+
+// Dispatcher fans events out to the matching subscriptions and delivers them.
+// Every delivery is recorded before its first attempt, so retries survive a
+// restart and any delivery can be replayed from the log.
+type Dispatcher struct {
+	subscriptions domain.WebhookSubscriptionRepository
+	deliveries    domain.WebhookDeliveryRepository
+	client        *http.Client
+	cfg           Config
+
+	events   chan domain.WebhookEvent
+	attempts chan *domain.WebhookDelivery
+	// queueMu guards closed and drained; senders hold it for reading so
+	// Close cannot close the channels under them.
+	queueMu sync.RWMutex
+	// closed is set once events is closed, drained once attempts is.
+	closed  bool
+	drained bool
+
+	// inFlight holds the deliveries queued or being attempted, so the poller
+	// does not queue them twice.
+	mu       sync.Mutex
+	inFlight map[primitive.ObjectID]struct{}
+
+	stopPoll context.CancelFunc
+	fanOut   sync.WaitGroup
+	poller   sync.WaitGroup
+	workers  sync.WaitGroup
+}
+
+func NewDispatcher(subscriptions domain.WebhookSubscriptionRepository, deliveries domain.WebhookDeliveryRepository, cfg Config) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 256
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 10 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = max(time.Hour, cfg.InitialBackoff)
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	return &Dispatcher{
+		subscriptions: subscriptions,
+		deliveries:    deliveries,
+		client:        &http.Client{},
+		cfg:           cfg,
+		events:        make(chan domain.WebhookEvent, cfg.QueueSize),
+		attempts:      make(chan *domain.WebhookDelivery, cfg.QueueSize),
+		inFlight:      make(map[primitive.ObjectID]struct{}),
+	}
+}
+
+// Start runs the fan-out loop, the delivery workers and the retry poller until Close.
+func (d *Dispatcher) Start() {
+	d.fanOut.Add(1)
+	go func() {
+		defer d.fanOut.Done()
+		for event := range d.events {
+			d.dispatch(context.Background(), event)
+		}
+	}()
+
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+			for delivery := range d.attempts {
+				d.attempt(context.Background(), delivery)
+				d.release(delivery.ID)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stopPoll = cancel
+	d.poller.Add(1)
+	go func() {
+		defer d.poller.Done()
+		ticker := time.NewTicker(d.cfg.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.queueDue(ctx)
+			}
+		}
+	}()
+}
+
+// Close stops accepting events, fans out the queued ones and waits for the
+// attempts in progress. Deliveries still pending are retried after a restart.
+// It must only be called after Start.
+func (d *Dispatcher) Close() {
+	d.stopPoll()
+	d.poller.Wait()
+
+	d.queueMu.Lock()
+	if d.closed {
+		d.queueMu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.events)
+	d.queueMu.Unlock()
+	d.fanOut.Wait()
+
+	d.queueMu.Lock()
+	d.drained = true
+	close(d.attempts)
+	d.queueMu.Unlock()
+	d.workers.Wait()
+}
+
+// Publish queues the event for delivery without blocking. Events arriving
+// after Close are ignored.
+func (d *Dispatcher) Publish(event domain.WebhookEvent) {
+	d.queueMu.RLock()
+	defer d.queueMu.RUnlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.events <- event:
+	default:
+		fmt.Printf("Webhook queue full, dropping %s event %s\n", event.Type, event.ID)
+	}
+}
+
+// Replay records a new delivery of the original's payload and queues it. The
+// event ID is kept, so receivers see it as the same event.
+func (d *Dispatcher) Replay(ctx context.Context, original *domain.WebhookDelivery) (*domain.WebhookDelivery, error) {
+	now := time.Now().UTC()
+	replayOf := original.ID
+	delivery := &domain.WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         domain.WebhookDeliveryPending,
+		NextAttemptAt:  now,
+		ReplayOf:       &replayOf,
+		CreatedAt:      now,
+	}
+	if err := d.deliveries.Save(ctx, delivery); err != nil {
+		return nil, err
+	}
+	d.enqueue(delivery)
+	return delivery, nil
+}
+
+// dispatch records a delivery for every subscription that wants the event and queues it.
+func (d *Dispatcher) dispatch(ctx context.Context, event domain.WebhookEvent) {
+	subscriptions, err := d.subscriptions.GetByEvent(ctx, event.Type)
+	if err != nil {
+		fmt.Printf("Failed to load webhook subscriptions for %s: %v\n", event.Type, err)
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("Failed to encode %s event: %v\n", event.Type, err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(event) {
+			continue
+		}
+		now := time.Now().UTC()
+		delivery := &domain.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        string(payload),
+			Status:         domain.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}
+		if err := d.deliveries.Save(ctx, delivery); err != nil {
+			fmt.Printf("Failed to record webhook delivery to %s: %v\n", subscription.URL, err)
+			continue
+		}
+		d.enqueue(delivery)
+	}
+}
+
+// queueDue queues the pending deliveries whose next attempt has come.
+func (d *Dispatcher) queueDue(ctx context.Context) {
+	due, err := d.deliveries.GetDue(ctx, time.Now().UTC(), d.cfg.QueueSize)
+	if err != nil {
+		fmt.Printf("Failed to load due webhook deliveries: %v\n", err)
+		return
+	}
+	for _, delivery := range due {
+		d.enqueue(delivery)
+	}
+}
+
+// enqueue hands the delivery to the workers unless it is already in flight.
+// When the queue is full the delivery stays pending for the poller.
+func (d *Dispatcher) enqueue(delivery *domain.WebhookDelivery) {
+	d.mu.Lock()
+	if _, ok := d.inFlight[delivery.ID]; ok {
+		d.mu.Unlock()
+		return
+	}
+	d.inFlight[delivery.ID] = struct{}{}
+	d.mu.Unlock()
+
+	d.queueMu.RLock()
+	defer d.queueMu.RUnlock()
+	if !d.drained {
+		select {
+		case d.attempts <- delivery:
+			return
+		default:
+		}
+	}
+	d.release(delivery.ID)
+}
+
+func (d *Dispatcher) release(id primitive.ObjectID) {
+	d.mu.Lock()
+	delete(d.inFlight, id)
+	d.mu.Unlock()
+}
+
+// attempt POSTs the delivery once and records the outcome, scheduling the
+// next attempt with exponential backoff if it failed.
+func (d *Dispatcher) attempt(ctx context.Context, queued *domain.WebhookDelivery) {
+	// The poller may have read the delivery just before its last attempt was recorded
+	delivery, err := d.deliveries.GetByID(ctx, queued.ID)
+	if err != nil {
+		fmt.Printf("Failed to load webhook delivery %s: %v\n", queued.ID.Hex(), err)
+		return
+	}
+	if delivery.Status != domain.WebhookDeliveryPending || delivery.NextAttemptAt.After(time.Now().UTC()) {
+		return
+	}
+
+	subscription, err := d.subscriptions.GetByID(ctx, delivery.SubscriptionID)
+	if err == mongo.ErrNoDocuments {
+		delivery.Status = domain.WebhookDeliveryFailed
+		delivery.LastError = "subscription deleted"
+		d.save(ctx, delivery)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Failed to load webhook subscription %s: %v\n", delivery.SubscriptionID.Hex(), err)
+		return
+	}
+
+	delivery.Attempts++
+	status, err := d.post(ctx, subscription, delivery)
+	delivery.ResponseStatus = status
+	if err == nil {
+		now := time.Now().UTC()
+		delivery.Status = domain.WebhookDeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		d.save(ctx, delivery)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.cfg.MaxAttempts {
+		delivery.Status = domain.WebhookDeliveryFailed
+		fmt.Printf("Webhook delivery %s to %s failed after %d attempts: %v\n", delivery.ID.Hex(), subscription.URL, delivery.Attempts, err)
+	} else {
+		delivery.NextAttemptAt = time.Now().UTC().Add(d.Backoff(delivery.Attempts))
+		fmt.Printf("Webhook delivery %s to %s failed, retrying at %s: %v\n", delivery.ID.Hex(), subscription.URL, delivery.NextAttemptAt.Format(time.RFC3339), err)
+	}
+	d.save(ctx, delivery)
+}
+
+// Backoff returns the wait after the given number of failed attempts.
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	backoff := d.cfg.InitialBackoff
+	for i := 1; i < attempts && backoff < d.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.cfg.MaxBackoff)
+}
+
+func (d *Dispatcher) post(ctx context.Context, subscription *domain.WebhookSubscription, delivery *domain.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mqtt-streaming-server-webhooks")
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(EventIDHeader, delivery.EventID)
+	req.Header.Set(DeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(VersionHeader, strconv.Itoa(domain.WebhookSchemaVersion))
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) save(ctx context.Context, delivery *domain.WebhookDelivery) {
+	if err := d.deliveries.Update(ctx, delivery); err != nil {
+		fmt.Printf("Failed to update webhook delivery %s: %v\n", delivery.ID.Hex(), err)
+	}
+}
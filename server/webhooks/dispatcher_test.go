@@ -0,0 +1,273 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/webhooks"
+)
+
+// memoryStore backs both repositories with maps.
+type memoryStore struct {
+	mu            sync.Mutex
+	subscriptions map[primitive.ObjectID]domain.WebhookSubscription
+	deliveries    map[primitive.ObjectID]domain.WebhookDelivery
+}
+
+func newMemoryStore(subscriptions ...domain.WebhookSubscription) *memoryStore {
+	s := &memoryStore{
+		subscriptions: make(map[primitive.ObjectID]domain.WebhookSubscription),
+		deliveries:    make(map[primitive.ObjectID]domain.WebhookDelivery),
+	}
+	for _, sub := range subscriptions {
+		s.subscriptions[sub.ID] = sub
+	}
+	return s
+}
+
+func (s *memoryStore) GetByEvent(_ context.Context, eventType domain.WebhookEventType) ([]*domain.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var subs []*domain.WebhookSubscription
+	for _, sub := range s.subscriptions {
+		sub := sub
+		subs = append(subs, &sub)
+	}
+	return subs, nil
+}
+
+func (s *memoryStore) getSubscription(id primitive.ObjectID) (*domain.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &sub, nil
+}
+
+func (s *memoryStore) Save(_ context.Context, delivery *domain.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery.ID = primitive.NewObjectID()
+	s.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (s *memoryStore) GetByID(_ context.Context, id primitive.ObjectID) (*domain.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &delivery, nil
+}
+
+func (s *memoryStore) List(context.Context, domain.WebhookDeliveryQuery) ([]*domain.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deliveries []*domain.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		delivery := delivery
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, nil
+}
+
+func (s *memoryStore) GetDue(_ context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*domain.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == domain.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) && len(due) < limit {
+			delivery := delivery
+			due = append(due, &delivery)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) Update(_ context.Context, delivery *domain.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// subscriptionRepo exposes the subscription side of memoryStore, whose
+// method names clash with the delivery side.
+type subscriptionRepo struct{ *memoryStore }
+
+func (r subscriptionRepo) GetByID(_ context.Context, id primitive.ObjectID) (*domain.WebhookSubscription, error) {
+	return r.getSubscription(id)
+}
+func (r subscriptionRepo) Save(context.Context, *domain.WebhookSubscription) error { return nil }
+func (r subscriptionRepo) List(context.Context) ([]*domain.WebhookSubscription, error) {
+	return r.GetByEvent(context.Background(), "")
+}
+func (r subscriptionRepo) Update(context.Context, *domain.WebhookSubscription) error { return nil }
+func (r subscriptionRepo) Delete(context.Context, primitive.ObjectID) error          { return nil }
+
+// waitFor polls the store until every delivery satisfies done.
+func waitFor(t *testing.T, store *memoryStore, count int, done func(domain.WebhookDelivery) bool) []domain.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		store.mu.Lock()
+		var deliveries []domain.WebhookDelivery
+		for _, delivery := range store.deliveries {
+			if done(delivery) {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		store.mu.Unlock()
+		if len(deliveries) == count {
+			return deliveries
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d deliveries", count)
+	return nil
+}
+
+func TestDispatcher_DeliversSignedEvents(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.Header.Clone(), body}
+	}))
+	defer server.Close()
+
+	subscribed := domain.WebhookSubscription{
+		ID:      primitive.NewObjectID(),
+		URL:     server.URL,
+		Events:  []domain.WebhookEventType{domain.WebhookDeviceRegistered},
+		Secret:  "s3cret",
+		Enabled: true,
+	}
+	otherDevice := subscribed
+	otherDevice.ID = primitive.NewObjectID()
+	otherDevice.DeviceIDs = []string{"dev-2"}
+	store := newMemoryStore(subscribed, otherDevice)
+
+	dispatcher := webhooks.NewDispatcher(subscriptionRepo{store}, store, webhooks.Config{PollInterval: time.Hour})
+	dispatcher.Start()
+	event := domain.NewDeviceEvent(domain.WebhookDeviceRegistered, &domain.Device{DeviceID: "dev-1", DeviceName: "Pixel", DeviceStatus: "active"})
+	dispatcher.Publish(event)
+
+	var req received
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery received")
+	}
+	if err := webhooks.Verify("s3cret", req.header.Get(webhooks.SignatureHeader), req.body, time.Minute, time.Now()); err != nil {
+		t.Errorf("signature did not verify: %v", err)
+	}
+	if req.header.Get(webhooks.EventHeader) != "device.registered" || req.header.Get(webhooks.EventIDHeader) != event.ID {
+		t.Errorf("unexpected headers %v", req.header)
+	}
+	var payload struct {
+		Type    string                 `json:"type"`
+		Version int                    `json:"version"`
+		Data    domain.DeviceEventData `json:"data"`
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if payload.Version != domain.WebhookSchemaVersion || payload.Data.DeviceName != "Pixel" {
+		t.Errorf("unexpected payload %s", req.body)
+	}
+
+	waitFor(t, store, 1, func(d domain.WebhookDelivery) bool {
+		return d.Status == domain.WebhookDeliverySucceeded && d.SubscriptionID == subscribed.ID && d.DeliveredAt != nil
+	})
+	dispatcher.Close()
+	if len(store.deliveries) != 1 {
+		t.Errorf("expected only the matching subscription to get a delivery, got %d", len(store.deliveries))
+	}
+}
+
+func TestDispatcher_RetriesThenFails(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sub := domain.WebhookSubscription{ID: primitive.NewObjectID(), URL: server.URL, Events: []domain.WebhookEventType{domain.WebhookPhotoIngested}, Secret: "s", Enabled: true}
+	store := newMemoryStore(sub)
+	dispatcher := webhooks.NewDispatcher(subscriptionRepo{store}, store, webhooks.Config{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		PollInterval:   5 * time.Millisecond,
+	})
+	dispatcher.Start()
+	dispatcher.Publish(domain.NewPhotoIngestedEvent(&domain.Photo{ID: primitive.NewObjectID(), DeviceID: "dev-1"}))
+
+	failed := waitFor(t, store, 1, func(d domain.WebhookDelivery) bool { return d.Status == domain.WebhookDeliveryFailed })
+	dispatcher.Close()
+
+	if failed[0].Attempts != 3 || failed[0].ResponseStatus != http.StatusServiceUnavailable || failed[0].LastError == "" {
+		t.Errorf("unexpected delivery %+v", failed[0])
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestDispatcher_Replay(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	sub := domain.WebhookSubscription{ID: primitive.NewObjectID(), URL: server.URL, Events: []domain.WebhookEventType{domain.WebhookPhotoIngested}, Secret: "s", Enabled: true}
+	store := newMemoryStore(sub)
+	original := &domain.WebhookDelivery{SubscriptionID: sub.ID, EventID: "evt-1", EventType: domain.WebhookPhotoIngested, Payload: `{}`, Status: domain.WebhookDeliveryFailed, Attempts: 8}
+	store.Save(context.Background(), original)
+
+	dispatcher := webhooks.NewDispatcher(subscriptionRepo{store}, store, webhooks.Config{PollInterval: time.Hour})
+	dispatcher.Start()
+	replay, err := dispatcher.Replay(context.Background(), original)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	waitFor(t, store, 1, func(d domain.WebhookDelivery) bool { return d.Status == domain.WebhookDeliverySucceeded })
+	dispatcher.Close()
+
+	if replay.ReplayOf == nil || *replay.ReplayOf != original.ID || replay.EventID != "evt-1" {
+		t.Errorf("unexpected replay %+v", replay)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected one request, got %d", calls.Load())
+	}
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	dispatcher := webhooks.NewDispatcher(nil, nil, webhooks.Config{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := dispatcher.Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
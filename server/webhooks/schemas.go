@@ -0,0 +1,19 @@
+package webhooks
+
+import (
+	"embed"
+	"fmt"
+
+	"mqtt-streaming-server/domain"
+)
+
+// schemas holds the JSON Schema of every event payload, one directory per
+// schema version.
+//
+//go:embed schemas
+var schemas embed.FS
+
+// Schema returns the JSON Schema of the event type at the given version.
+func Schema(version int, eventType domain.WebhookEventType) ([]byte, error) {
+	return schemas.ReadFile(fmt.Sprintf("schemas/v%d/%s.json", version, eventType))
+}
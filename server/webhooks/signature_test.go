@@ -0,0 +1,95 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"mqtt-streaming-server/domain"
+	"mqtt-streaming-server/webhooks"
+)
+
+func TestVerify(t *testing.T) {
+	sentAt := time.Unix(1714564800, 0)
+	body := []byte(`{"type":"photo.ingested"}`)
+	header := webhooks.Sign("s3cret", sentAt, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "valid", secret: "s3cret", header: header, body: body, now: sentAt.Add(time.Minute)},
+		{name: "wrong secret", secret: "other", header: header, body: body, now: sentAt, wantErr: true},
+		{name: "tampered body", secret: "s3cret", header: header, body: []byte(`{}`), now: sentAt, wantErr: true},
+		{name: "too old", secret: "s3cret", header: header, body: body, now: sentAt.Add(time.Hour), wantErr: true},
+		{name: "malformed header", secret: "s3cret", header: "v1=abc", body: body, now: sentAt, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhooks.Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now)
+			if tt.wantErr != errors.Is(err, webhooks.ErrInvalidSignature) || (!tt.wantErr && err != nil) {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	if _, err := webhooks.Schema(1, "photo.ingested"); err != nil {
+		t.Errorf("expected the v1 photo.ingested schema, got %v", err)
+	}
+	if _, err := webhooks.Schema(2, "photo.ingested"); err == nil {
+		t.Error("expected no v2 schema")
+	}
+}
+
+// TestSchema_CoversPayloads checks that every field the server sends is
+// described by the schema of its event.
+func TestSchema_CoversPayloads(t *testing.T) {
+	lastSeen := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	device := &domain.Device{DeviceID: "dev-1", DeviceName: "Pixel", DeviceStatus: domain.DeviceStatusActive, LastSeen: &lastSeen}
+	events := []domain.WebhookEvent{
+		domain.NewPhotoIngestedEvent(&domain.Photo{ID: primitive.NewObjectID(), DeviceID: "dev-1", Timestamp: lastSeen, ImageType: "jpeg"}),
+		domain.NewDeviceEvent(domain.WebhookDeviceRegistered, device),
+		domain.NewDeviceEvent(domain.WebhookDeviceDisconnected, device),
+	}
+
+	for _, event := range events {
+		t.Run(string(event.Type), func(t *testing.T) {
+			raw, err := webhooks.Schema(event.Version, event.Type)
+			if err != nil {
+				t.Fatalf("no schema: %v", err)
+			}
+			var schema struct {
+				Properties map[string]struct {
+					Properties map[string]any `json:"properties"`
+				} `json:"properties"`
+			}
+			if err := json.Unmarshal(raw, &schema); err != nil {
+				t.Fatalf("invalid schema: %v", err)
+			}
+
+			body, _ := json.Marshal(event)
+			var payload map[string]any
+			json.Unmarshal(body, &payload)
+			for field := range payload {
+				if _, ok := schema.Properties[field]; !ok {
+					t.Errorf("schema does not describe %s", field)
+				}
+			}
+			for field := range payload["data"].(map[string]any) {
+				if _, ok := schema.Properties["data"].Properties[field]; !ok {
+					t.Errorf("schema does not describe data.%s", field)
+				}
+			}
+		})
+	}
+}